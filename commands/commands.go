@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	database "go-multitenancy-boilerplate/database"
+)
+
+// A management command run from the command line, returns the process exit code.
+type command func(args []string) int
+
+var groups = map[string]map[string]command{
+	"tenant": {
+		"create":    tenantCreate,
+		"list":      tenantList,
+		"suspend":   tenantSuspend,
+		"resume":    tenantResume,
+		"delete":    tenantDelete,
+		"provision": tenantProvision,
+	},
+	"migrate": {
+		"master":  migrateMaster,
+		"tenants": migrateTenants,
+		"status":  migrateStatus,
+	},
+	"master-user": {
+		"create": masterUserCreate,
+	},
+	"sessions": {
+		"purge": sessionsPurge,
+	},
+	"login": {
+		"unlock": loginUnlock,
+	},
+	"secrets": {
+		"reencrypt": secretsReencrypt,
+	},
+}
+
+const usage = `Usage: go-multitenancy-boilerplate <command> [arguments]
+
+  serve                                   Start the HTTP server (default)
+
+  tenant create -subdomain <name> [-strategy database|schema|shared]
+  tenant list [-search <text>] [-status <status>] [-deleted]
+  tenant suspend (-id <id> | -subdomain <name>) [-reason <text>]
+  tenant resume (-id <id> | -subdomain <name>)
+  tenant delete (-id <id> | -subdomain <name>)
+  tenant provision (-id <id> | -subdomain <name>)
+
+  migrate master [-down <steps>]
+  migrate tenants [-only-failed] [-concurrency <n>] [-id <id>]
+  migrate status [-id <id>]
+
+  master-user create -email <email> [-type <account type>]
+                                          The password comes from MASTER_USER_PASSWORD, a prompt or stdin
+
+  sessions purge [-all]
+
+  login unlock (-ip <address> | -email <email> [-id <tenant id> | -subdomain <name>])
+
+  secrets reencrypt                       Encrypt every stored secret with ENCRYPTION_ACTIVE_KID
+`
+
+// Runs a management command such as "tenant create", returns the process exit code.
+func Run(args []string) int {
+
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	group, found := groups[args[0]]
+
+	if !found {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	run, found := group[args[1]]
+
+	if !found {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	// Commands reuse the master connection and migrations but none of the server background work.
+	database.StartDatabaseServices()
+	defer database.StopDatabaseServices()
+
+	// Keep the output readable.
+	database.Connection.LogMode(false)
+
+	return run(args[2:])
+}
+
+// Prints an error to stderr and returns the failure exit code.
+func failed(message string, err error) int {
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, message+":", err)
+	} else {
+		fmt.Fprintln(os.Stderr, message)
+	}
+
+	return 1
+}
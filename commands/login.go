@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"net"
+
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+func loginUnlock(args []string) int {
+
+	flags := flag.NewFlagSet("login unlock", flag.ContinueOnError)
+	ipAddress := flags.String("ip", "", "IP address to unlock")
+	email := flags.String("email", "", "email address to unlock, of the master dashboard unless a tenant is given")
+	id, subDomain := tenantFlags(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	actor := services.SystemActor("cli")
+
+	if len(*ipAddress) > 0 {
+
+		if net.ParseIP(*ipAddress) == nil {
+			return failed("The IP address is incorrect, please try again.", nil)
+		}
+
+		if err := services.UnlockIpAddress(actor, *ipAddress); err != nil {
+			return failed("An error occurred while unlocking the IP address", err)
+		}
+
+		fmt.Println("Unlocked logins from", *ipAddress)
+		return 0
+	}
+
+	if len(*email) == 0 {
+		return failed("Either -ip or -email is required", nil)
+	}
+
+	var tenantId uint
+
+	if *id > 0 || len(*subDomain) > 0 {
+
+		var err error
+
+		if tenantId, err = resolveTenantId(*id, *subDomain); err != nil {
+			return failed("The tenant could not be found", err)
+		}
+	}
+
+	if err := services.UnlockEmail(actor, tenantId, *email); err != nil {
+		return failed("An error occurred while unlocking the email address", err)
+	}
+
+	fmt.Println("Unlocked logins with", *email)
+
+	return 0
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+	services "go-multitenancy-boilerplate/services/v1"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func masterUserCreate(args []string) int {
+
+	flags := flag.NewFlagSet("master-user create", flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the master user")
+	accountType := flags.Int("type", 0, "account type of the master user")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// The API checks the email address before creating the user, the password policy is checked by the service.
+	if !helpers.ValidateEmail(*email) {
+		return failed("Email is incorrect, please try again.", nil)
+	}
+
+	password, err := readPassword()
+
+	if err != nil {
+		return failed("An error occurred while reading the password", err)
+	}
+
+	insertedId, err := services.CreateMasterUser(services.SystemActor("cli"), *email, password, *accountType)
+
+	if err != nil {
+		return failed("An error occurred while creating the master user", err)
+	}
+
+	fmt.Printf("Created master user %d\n", insertedId)
+
+	return 0
+}
+
+// Reads a password from MASTER_USER_PASSWORD, a prompt on the terminal or the first line of stdin.
+// Flags would leave it in the shell history and the process list.
+func readPassword() (string, error) {
+
+	if password := os.Getenv("MASTER_USER_PASSWORD"); len(password) > 0 {
+		return password, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+
+	if !terminal.IsTerminal(fd) {
+
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+
+		if err != nil && len(line) == 0 {
+			return "", errors.New("no password was given on stdin")
+		}
+
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirmation, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return "", err
+	}
+
+	if string(password) != string(confirmation) {
+		return "", errors.New("the passwords did not match")
+	}
+
+	return string(password), nil
+}
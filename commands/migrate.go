@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	database "go-multitenancy-boilerplate/database"
+	migrations "go-multitenancy-boilerplate/database/migrations"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+func migrateMaster(args []string) int {
+
+	flags := flag.NewFlagSet("migrate master", flag.ContinueOnError)
+	down := flags.Int("down", 0, "revert this many master migrations instead")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Pending master migrations are applied as soon as the database services start.
+	if *down > 0 {
+
+		reverted, err := database.MasterMigrations.Down(database.Connection, *down)
+
+		for _, migration := range reverted {
+			fmt.Printf("Reverted master migration %d %s\n", migration.Version, migration.Name)
+		}
+
+		if err != nil {
+			return failed("An error occurred while reverting the master migrations", err)
+		}
+	}
+
+	current, err := database.MasterMigrations.CurrentVersion(database.Connection)
+
+	if err != nil {
+		return failed("An error occurred while reading the master schema version", err)
+	}
+
+	fmt.Printf("The master database is on version %d of %d\n", current, database.MasterMigrations.Latest())
+
+	return 0
+}
+
+func migrateTenants(args []string) int {
+
+	flags := flag.NewFlagSet("migrate tenants", flag.ContinueOnError)
+	onlyFailed := flags.Bool("only-failed", false, "only retry tenants whose last migration failed")
+	concurrency := flags.Int("concurrency", 4, "number of tenant schemas migrated at the same time")
+	id := flags.Uint("id", 0, "only migrate this tenant")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	options := database.FleetMigrationOptions{
+		Concurrency: *concurrency,
+		OnlyFailed:  *onlyFailed,
+	}
+
+	if *id > 0 {
+		options.TenantIds = []uint{*id}
+	}
+
+	report, err := database.MigrateTenantFleet(database.NewFleetMigrationRunId(), options)
+
+	if err != nil {
+		return failed("An error occurred while migrating the tenants", err)
+	}
+
+	fmt.Printf("Tenant migration run %s finished, %d succeeded and %d failed\n", report.RunId, report.Succeeded, report.Failed)
+
+	if report.Failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func migrateStatus(args []string) int {
+
+	flags := flag.NewFlagSet("migrate status", flag.ContinueOnError)
+	id := flags.Uint("id", 0, "show the migrations of this tenant instead of the master database")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var current int64
+	var statuses []migrations.MigrationStatus
+	var err error
+
+	if *id > 0 {
+		current, statuses, err = services.GetTenantMigrationStatus(*id)
+	} else {
+		current, statuses, err = services.GetMasterMigrationStatus()
+	}
+
+	if err != nil {
+		return failed("An error occurred while reading the migration status", err)
+	}
+
+	fmt.Printf("Current version: %d\n\n", current)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED")
+
+	for _, status := range statuses {
+
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+
+		fmt.Fprintf(writer, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+
+	writer.Flush()
+
+	return 0
+}
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+
+	database "go-multitenancy-boilerplate/database"
+)
+
+func secretsReencrypt(args []string) int {
+
+	flags := flag.NewFlagSet("secrets reencrypt", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	encrypted, err := database.ReencryptSecrets()
+
+	if err != nil {
+		return failed(fmt.Sprintf("An error occurred after encrypting %d secrets", encrypted), err)
+	}
+
+	fmt.Printf("Encrypted %d secrets with the active key.\n", encrypted)
+
+	return 0
+}
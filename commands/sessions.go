@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+
+	database "go-multitenancy-boilerplate/database"
+)
+
+func sessionsPurge(args []string) int {
+
+	flags := flag.NewFlagSet("sessions purge", flag.ContinueOnError)
+	all := flags.Bool("all", false, "remove every session, logging everybody out")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := database.PurgeSessions(*all); err != nil {
+		return failed("An error occurred while purging the sessions", err)
+	}
+
+	if *all {
+		fmt.Println("Removed every session.")
+	} else {
+		fmt.Println("Removed the expired sessions.")
+	}
+
+	return 0
+}
@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+func tenantCreate(args []string) int {
+
+	flags := flag.NewFlagSet("tenant create", flag.ContinueOnError)
+	subDomain := flags.String("subdomain", "", "sub domain identifier of the new tenant")
+	strategy := flags.String("strategy", "", "isolation strategy: database, schema or shared")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if !helpers.ValidateSubDomain(*subDomain) {
+		return failed("The sub domain identifier may only contain lowercase letters, numbers and hyphens.", nil)
+	}
+
+	if len(*strategy) > 0 && !tenants.IsValidIsolationStrategy(*strategy) {
+		return failed("The isolation strategy must be one of database, schema or shared.", nil)
+	}
+
+	// Provisioning runs in the foreground, there is no request to time out here.
+	outcome, err := services.CreateTenant(services.SystemActor("cli"), *subDomain, *strategy)
+
+	if err != nil {
+		return failed(outcome, err)
+	}
+
+	fmt.Println(outcome)
+
+	return 0
+}
+
+func tenantList(args []string) int {
+
+	flags := flag.NewFlagSet("tenant list", flag.ContinueOnError)
+	search := flags.String("search", "", "partial sub domain identifier")
+	status := flags.String("status", "", "only list tenants with this status")
+	deleted := flags.Bool("deleted", false, "include deleted tenants waiting to be purged")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tSUBDOMAIN\tSTRATEGY\tSTATUS\tPROVISIONING\tSCHEMA\tDELETED")
+
+	for page := 1; ; page++ {
+
+		found, total, err := services.ListTenants(services.TenantListOptions{
+			Search:         *search,
+			Status:         *status,
+			IncludeDeleted: *deleted,
+			Page:           page,
+			PageSize:       100,
+		})
+
+		if err != nil {
+			return failed("An error occurred while listing the tenants", err)
+		}
+
+		for _, tenant := range found {
+
+			deletedAt := ""
+			if tenant.DeletedAt != nil {
+				deletedAt = tenant.DeletedAt.Format("2006-01-02 15:04")
+			}
+
+			fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n", tenant.ID, tenant.TenantSubDomainIdentifier, tenant.Strategy(), tenant.Status, tenant.ProvisioningStatus, tenant.SchemaVersion, deletedAt)
+		}
+
+		if page*100 >= total {
+			break
+		}
+	}
+
+	writer.Flush()
+
+	return 0
+}
+
+func tenantSuspend(args []string) int {
+
+	flags := flag.NewFlagSet("tenant suspend", flag.ContinueOnError)
+	id, subDomain := tenantFlags(flags)
+	reason := flags.String("reason", "", "why the tenant is suspended")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	return runOnTenant(*id, *subDomain, func(tenantId uint) (string, error) {
+		return services.SuspendTenant(tenantId, *reason)
+	})
+}
+
+func tenantResume(args []string) int {
+
+	flags := flag.NewFlagSet("tenant resume", flag.ContinueOnError)
+	id, subDomain := tenantFlags(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	return runOnTenant(*id, *subDomain, services.ResumeTenant)
+}
+
+func tenantDelete(args []string) int {
+
+	flags := flag.NewFlagSet("tenant delete", flag.ContinueOnError)
+	id, subDomain := tenantFlags(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	return runOnTenant(*id, *subDomain, services.DeleteTenant)
+}
+
+func tenantProvision(args []string) int {
+
+	flags := flag.NewFlagSet("tenant provision", flag.ContinueOnError)
+	id, subDomain := tenantFlags(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	return runOnTenant(*id, *subDomain, services.ProvisionTenant)
+}
+
+// Registers the flags used to pick a tenant.
+func tenantFlags(flags *flag.FlagSet) (*uint, *string) {
+	id := flags.Uint("id", 0, "id of the tenant")
+	subDomain := flags.String("subdomain", "", "sub domain identifier of the tenant")
+	return id, subDomain
+}
+
+// Resolves the tenant from its id or sub domain and runs the action against it.
+func runOnTenant(id uint, subDomain string, action func(id uint) (string, error)) int {
+
+	tenantId, err := resolveTenantId(id, subDomain)
+
+	if err != nil {
+		return failed("The tenant could not be found", err)
+	}
+
+	outcome, err := action(tenantId)
+
+	if err != nil {
+		return failed(outcome, err)
+	}
+
+	fmt.Println(outcome)
+
+	return 0
+}
+
+func resolveTenantId(id uint, subDomain string) (uint, error) {
+
+	if id > 0 {
+		return id, nil
+	}
+
+	if len(subDomain) == 0 {
+		return 0, fmt.Errorf("either -id or -subdomain is required")
+	}
+
+	tenant, err := services.GetTenantBySubDomain(subDomain)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return tenant.ID, nil
+}
@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	models "go-multitenancy-boilerplate/models"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Describes the tenant user or API key making the request for the audit log.
+func tenantActor(c *gin.Context) services.Actor {
+
+	actor := requestActor(c, models.ActorUser)
+
+	// Requests made with an API key are recorded against the key, acting for the user who created it.
+	if value, found := c.Get("apiKey"); found {
+
+		apiKey := value.(*tenants.TenantApiKey)
+
+		actor.Type = models.ActorApiKey
+		actor.Id = apiKey.ID
+		actor.Email = apiKey.Prefix
+		actor.ApiKeyUserId = apiKey.CreatedBy
+	}
+
+	actor.TenantId = c.GetUint("tenantId")
+	actor.TenantIdentifier = c.GetString("tenantIdentifier")
+
+	return actor
+}
+
+// Describes the master user making the request for the audit log.
+func masterActor(c *gin.Context) services.Actor {
+	return requestActor(c, models.ActorMasterUser)
+}
+
+func requestActor(c *gin.Context, actorType string) services.Actor {
+	return services.Actor{
+		Type:      actorType,
+		Id:        c.GetUint("userId"),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// Records a login lockout, requests resolved to a tenant are tenant lockouts.
+func RecordLockout(c *gin.Context, email string) {
+
+	if db, found := c.Get("connection"); found {
+		services.RecordLockout(tenantActor(c), email, db.(*gorm.DB))
+		return
+	}
+
+	services.RecordLockout(masterActor(c), email, nil)
+}
@@ -0,0 +1,137 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+
+	database "go-multitenancy-boilerplate/database"
+	middlewares "go-multitenancy-boilerplate/middlewares"
+	models "go-multitenancy-boilerplate/models"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Init
+func SetupApiKeyRoutes(router *gin.Engine) {
+
+	apiKeys := router.Group("/api/v1/api-keys")
+
+	// Keys are managed by logged in users only, a key can't mint or revoke keys.
+	apiKeys.Use(middlewares.FindTenancy(database.Connection, database.TenantConnections))
+	apiKeys.Use(middlewares.IfAuthorized(database.Store))
+	apiKeys.Use(middlewares.RequireUser())
+	apiKeys.Use(middlewares.RequirePermission(models.PermissionApiKeysManage))
+	{
+		// GET
+		apiKeys.GET("", HandleListApiKeys)
+
+		// POST
+		apiKeys.POST("", HandleCreateApiKey)
+
+		// DELETE
+		apiKeys.DELETE(":id", HandleRevokeApiKey)
+	}
+}
+
+// @Summary Creates an API key acting for the current user with some of their permissions, the key is only returned this once.
+// @tags api-keys
+// @Router /api/v1/api-keys [post]
+func HandleCreateApiKey(c *gin.Context) {
+
+	var json resources.CreateApiKeyRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	apiKey, key, err := services.CreateApiKey(tenantActor(c), services.ApiKeyRequest{
+		Name:       json.Name,
+		Scopes:     json.Scopes,
+		AllowedIps: json.AllowedIps,
+		ExpiresAt:  json.ExpiresAt,
+	}, db.(*gorm.DB))
+
+	switch errors.Cause(err) {
+	case services.ErrInvalidApiKey:
+		resources.Failed(c, http.StatusBadRequest, "The API key details are invalid.", err.Error())
+		return
+	case services.ErrScopeNotHeld:
+		resources.Failed(c, http.StatusForbidden, "You can't give a key a permission you don't have.", err.Error())
+		return
+	}
+
+	if err != nil {
+		fmt.Println("An error occurred while creating the API key", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	resources.Succeeded(c, resources.CreatedApiKeyResponse{
+		ApiKeyResponse: resources.NewApiKeyResponse(*apiKey),
+		Key:            key,
+	})
+}
+
+// @Summary Lists the API keys of the tenant which haven't been revoked.
+// @tags api-keys
+// @Router /api/v1/api-keys [get]
+func HandleListApiKeys(c *gin.Context) {
+
+	apiKeys, err := services.ListApiKeys(c.GetUint("tenantId"))
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	items := make([]resources.ApiKeyResponse, 0, len(apiKeys))
+
+	for _, apiKey := range apiKeys {
+		items = append(items, resources.NewApiKeyResponse(apiKey))
+	}
+
+	resources.Succeeded(c, items)
+}
+
+// @Summary Revokes an API key of the tenant, it stops working straight away.
+// @tags api-keys
+// @Router /api/v1/api-keys/{id} [delete]
+func HandleRevokeApiKey(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No API key ID found, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	err := services.RevokeApiKey(tenantActor(c), id, db.(*gorm.DB))
+
+	if gorm.IsRecordNotFoundError(err) {
+		resources.Failed(c, http.StatusNotFound, "The API key could not be found.")
+		return
+	}
+
+	if err == services.ErrApiKeyRevoked {
+		resources.Failed(c, http.StatusConflict, "The API key has already been revoked.")
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, "The API key has been revoked.")
+}
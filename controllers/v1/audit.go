@@ -0,0 +1,95 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	database "go-multitenancy-boilerplate/database"
+	middlewares "go-multitenancy-boilerplate/middlewares"
+	models "go-multitenancy-boilerplate/models"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Init
+func SetupAuditRoutes(router *gin.Engine) {
+
+	// Events of the tenant resolved for the request.
+	audit := router.Group("/api/v1/audit")
+
+	audit.Use(middlewares.FindTenancy(database.Connection, database.TenantConnections))
+	audit.Use(middlewares.IfAuthorized(database.Store))
+	{
+		audit.GET("", middlewares.RequirePermission(models.PermissionAuditRead), HandleListAuditEvents)
+	}
+
+	// Events of the master plane.
+	masterAudit := router.Group("/api/v1/master/audit")
+
+	masterAudit.Use(middlewares.IfMasterAuthorized(database.Store))
+	{
+		masterAudit.GET("", middlewares.RequireMasterPermission(models.PermissionAuditRead), HandleListMasterAuditEvents)
+	}
+}
+
+// @Summary Lists the audit events of the tenant, newest first.
+// @tags audit
+// @Router api/v1/audit [Get]
+func HandleListAuditEvents(c *gin.Context) {
+
+	db, _ := c.Get("connection")
+
+	listAuditEvents(c, db.(*gorm.DB))
+}
+
+// @Summary Lists the audit events of the master plane, newest first.
+// @tags audit
+// @Router api/v1/master/audit [Get]
+func HandleListMasterAuditEvents(c *gin.Context) {
+	listAuditEvents(c, database.Connection)
+}
+
+func listAuditEvents(c *gin.Context, connection *gorm.DB) {
+
+	var json resources.ListAuditEventsRequest
+
+	if err := c.ShouldBindQuery(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Incorrect filters supplied, please try again.")
+		return
+	}
+
+	json.Normalize()
+
+	found, total, err := services.ListAuditEvents(services.AuditFilter{
+		ActorId:    json.ActorId,
+		Action:     json.Action,
+		TargetType: json.TargetType,
+		TargetId:   json.TargetId,
+		Outcome:    json.Outcome,
+		TenantId:   json.TenantId,
+		From:       json.From,
+		To:         json.To,
+		Page:       json.Page,
+		PageSize:   json.PageSize,
+	}, connection)
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	items := make([]resources.AuditEventResponse, 0, len(found))
+
+	for _, event := range found {
+		items = append(items, resources.NewAuditEventResponse(event))
+	}
+
+	resources.Succeeded(c, resources.PaginatedResponse{
+		Items:    items,
+		Total:    total,
+		Page:     json.Page,
+		PageSize: json.PageSize,
+	})
+}
@@ -0,0 +1,65 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// @Summary Emails a new verification link to a tenant user who hasn't verified their email address.
+// @tags users
+// @Router /api/v1/users/email/verification [post]
+func HandleRequestEmailVerification(c *gin.Context) {
+
+	var json resources.ForgotPasswordRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil || !helpers.ValidateEmail(json.Email) {
+		resources.Failed(c, http.StatusBadRequest, "Email is incorrect, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	if err := services.RequestEmailVerification(tenantActor(c), json.Email, db.(*gorm.DB)); err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	resources.Succeeded(c, "If an unverified account with that email exists a verification link has been sent.")
+}
+
+// @Summary Verifies the email address of a tenant user using a verification token.
+// @tags users
+// @Router /api/v1/users/email/verify [post]
+func HandleVerifyEmail(c *gin.Context) {
+
+	var json resources.VerifyEmailRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	err := services.VerifyEmail(tenantActor(c), json.Token, db.(*gorm.DB))
+
+	if err == services.ErrInvalidToken {
+		resources.Failed(c, http.StatusBadRequest, "The verification link is invalid or has expired.")
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	resources.Succeeded(c, "Your email address has been verified.")
+}
@@ -0,0 +1,225 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
+	middlewares "go-multitenancy-boilerplate/middlewares"
+	models "go-multitenancy-boilerplate/models"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Init
+func SetupInvitationRoutes(router *gin.Engine) {
+
+	invitations := router.Group("/api/v1/invitations")
+
+	// Un-authorize APIs
+	invitations.Use(middlewares.FindTenancy(database.Connection, database.TenantConnections))
+	{
+		invitations.POST("accept", HandleAcceptInvitation)
+
+		// Authorized APIs
+		invitations.Use(middlewares.IfAuthorized(database.Store))
+		{
+			invite := middlewares.RequirePermission(models.PermissionUsersCreate)
+
+			// GET
+			invitations.GET("", middlewares.RequirePermission(models.PermissionUsersRead), HandleListInvitations)
+
+			// POST
+			invitations.POST("", invite, HandleCreateInvitation)
+			invitations.POST(":id/resend", invite, HandleResendInvitation)
+
+			// DELETE
+			invitations.DELETE(":id", invite, HandleRevokeInvitation)
+		}
+	}
+}
+
+// @Summary Invites somebody to join the tenant by email.
+// @tags invitations
+// @Router api/v1/invitations [Post]
+func HandleCreateInvitation(c *gin.Context) {
+
+	var json resources.CreateInvitationRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil || !helpers.ValidateEmail(json.Email) {
+		resources.Failed(c, http.StatusBadRequest, "Incorrect details supplied, please try again.")
+		return
+	}
+
+	db, _ := c.Get("connection")
+
+	// Inviting with a role is assigning it, which needs the same permission.
+	if json.RoleId > 0 {
+
+		allowed, err := middlewares.HasPermission(c, models.PermissionRolesManage)
+
+		if err != nil {
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+			return
+		}
+
+		if !allowed {
+			resources.Failed(c, http.StatusForbidden, "You do not have permission to do this.", "missing_permission:"+models.PermissionRolesManage)
+			return
+		}
+	}
+
+	invitation, err := services.CreateInvitation(tenantActor(c), json.Email, json.RoleId, db.(*gorm.DB))
+
+	if invitation != nil && err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "The invitation was created but the email could not be sent, please try resending it.", err.Error())
+		return
+	}
+
+	if err != nil {
+		failedInvitationLookup(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.NewInvitationResponse(*invitation))
+}
+
+// @Summary Lists the invitations of the tenant, newest first.
+// @tags invitations
+// @Router api/v1/invitations [Get]
+func HandleListInvitations(c *gin.Context) {
+
+	var json resources.ListInvitationsRequest
+
+	if err := c.ShouldBindQuery(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Incorrect filters supplied, please try again.")
+		return
+	}
+
+	json.Normalize()
+
+	db, _ := c.Get("connection")
+
+	found, total, err := services.ListInvitations(json.Status, json.Page, json.PageSize, db.(*gorm.DB))
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	items := make([]resources.InvitationResponse, 0, len(found))
+
+	for _, invitation := range found {
+		items = append(items, resources.NewInvitationResponse(invitation))
+	}
+
+	resources.Succeeded(c, resources.PaginatedResponse{
+		Items:    items,
+		Total:    total,
+		Page:     json.Page,
+		PageSize: json.PageSize,
+	})
+}
+
+// @Summary Sends an invitation again with a new link, the previous link stops working.
+// @tags invitations
+// @Router api/v1/invitations/:id/resend [Post]
+func HandleResendInvitation(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No invitation ID found, please try again.")
+		return
+	}
+
+	db, _ := c.Get("connection")
+
+	invitation, err := services.ResendInvitation(tenantActor(c), id, db.(*gorm.DB))
+
+	if err != nil {
+		failedInvitationLookup(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.NewInvitationResponse(*invitation))
+}
+
+// @Summary Revokes an invitation which hasn't been accepted yet.
+// @tags invitations
+// @Router api/v1/invitations/:id [Delete]
+func HandleRevokeInvitation(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No invitation ID found, please try again.")
+		return
+	}
+
+	db, _ := c.Get("connection")
+
+	outcome, err := services.RevokeInvitation(tenantActor(c), id, db.(*gorm.DB))
+
+	if err != nil {
+		failedInvitationLookup(c, err)
+		return
+	}
+
+	resources.Succeeded(c, outcome)
+}
+
+// @Summary Accepts an invitation, the invitee chooses their password and name.
+// @tags invitations
+// @Router api/v1/invitations/accept [Post]
+func HandleAcceptInvitation(c *gin.Context) {
+
+	var json resources.AcceptInvitationRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	db, _ := c.Get("connection")
+
+	userId, err := services.AcceptInvitation(tenantActor(c), json.Token, json.Password, json.FirstName, json.LastName, db.(*gorm.DB))
+
+	if err == services.ErrInvalidToken {
+		resources.Failed(c, http.StatusBadRequest, "The invitation is invalid or has expired.")
+		return
+	}
+
+	if failedPasswordPolicy(c, err) {
+		return
+	}
+
+	if err != nil {
+		failedInvitationLookup(c, err)
+		return
+	}
+
+	resources.Succeeded(c, gin.H{
+		"id": userId,
+	})
+}
+
+// Responds to a failed invitation operation with a status matching the error.
+func failedInvitationLookup(c *gin.Context, err error) {
+
+	if gorm.IsRecordNotFoundError(err) {
+		resources.Failed(c, http.StatusNotFound, "The invitation or role could not be found.")
+		return
+	}
+
+	switch err {
+	case services.ErrUserExists, services.ErrInvitationPending, services.ErrInvitationClosed:
+		resources.Failed(c, http.StatusConflict, err.Error())
+		return
+	}
+
+	resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+}
@@ -0,0 +1,170 @@
+package v1
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	ss "go-multitenancy-boilerplate/resources/sessions"
+	services "go-multitenancy-boilerplate/services/v1"
+	throttle "go-multitenancy-boilerplate/throttle"
+)
+
+// @Summary Lets a user who failed to log in too often try again.
+// @tags users
+// @Router /api/v1/users/unlock [post]
+func HandleUnlockUser(c *gin.Context) {
+
+	var json resources.DeleteUserRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	err := services.UnlockUser(tenantActor(c), json.Id, db.(*gorm.DB))
+
+	if !unlocked(c, err) {
+		return
+	}
+
+	resources.Succeeded(c, "The user can log in again.")
+}
+
+// @Summary Lets a master user who failed to log in too often try again.
+// @tags master/users
+// @Router /api/v1/master/users/unlock [post]
+func HandleMasterUnlockUser(c *gin.Context) {
+
+	var json resources.DeleteUserRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	err := services.UnlockMasterUser(masterActor(c), json.Id)
+
+	if !unlocked(c, err) {
+		return
+	}
+
+	resources.Succeeded(c, "The master user can log in again.")
+}
+
+// @Summary Unlocks logins from an IP address, or with an email address of a tenant or the master dashboard.
+// @tags master/users
+// @Router /api/v1/master/users/login/unlock [post]
+func HandleMasterUnlockLogin(c *gin.Context) {
+
+	var json resources.UnlockLoginRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	var err error
+
+	switch {
+	case len(json.IpAddress) > 0:
+		if net.ParseIP(json.IpAddress) == nil {
+			resources.Failed(c, http.StatusBadRequest, "The IP address is incorrect, please try again.")
+			return
+		}
+		err = services.UnlockIpAddress(masterActor(c), json.IpAddress)
+	case len(json.Email) > 0:
+		err = services.UnlockEmail(masterActor(c), json.TenantId, json.Email)
+	default:
+		resources.Failed(c, http.StatusBadRequest, "Either an IP address or an email address is required.")
+		return
+	}
+
+	if !unlocked(c, err) {
+		return
+	}
+
+	resources.Succeeded(c, "Logins have been unlocked.")
+}
+
+// Counts a login which failed on its email address, password or two-factor code against the account and IP address.
+func failedLoginAttempt(c *gin.Context, err error) {
+
+	attempt, found := c.Get("loginAttempt")
+
+	if !found || !services.IsInvalidCredentials(err) {
+		return
+	}
+
+	if _, err := throttle.Default().Failed(attempt.(throttle.Attempt)); err != nil {
+		fmt.Println("An error occurred while counting a failed login", err)
+	}
+}
+
+// Refuses two-factor codes for accounts or IP addresses which failed too often, a new challenge doesn't start over.
+// Otherwise sets the attempt the code counts against, returns whether the code may be checked and responds itself when not.
+func checkTwoFactorAttempt(c *gin.Context, email string, err error, accountKey func(email string) string) bool {
+
+	if err != nil {
+		failedTwoFactor(c, err)
+		return false
+	}
+
+	attempt := throttle.Attempt{Account: accountKey(email), Ip: throttle.IpKey(c.ClientIP())}
+
+	wait, err := throttle.Default().Check(attempt)
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return false
+	}
+
+	if wait > 0 {
+		if ss.OnLockout != nil {
+			ss.OnLockout(c, email)
+		}
+		ss.LockedOut(c, wait)
+		return false
+	}
+
+	c.Set("loginAttempt", attempt)
+
+	return true
+}
+
+// Forgets the failed logins of the account once it logged in, after its second factor when it has one.
+func succeededLoginAttempt(c *gin.Context) {
+
+	attempt, found := c.Get("loginAttempt")
+
+	if !found {
+		return
+	}
+
+	if err := throttle.Default().Succeeded(attempt.(throttle.Attempt)); err != nil {
+		fmt.Println("An error occurred while resetting the failed logins", err)
+	}
+}
+
+// Responds to a failed unlock, returns whether it succeeded.
+func unlocked(c *gin.Context, err error) bool {
+
+	if err == nil {
+		return true
+	}
+
+	if gorm.IsRecordNotFoundError(err) {
+		resources.Failed(c, http.StatusNotFound, "The user could not be found.")
+		return false
+	}
+
+	resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+	return false
+}
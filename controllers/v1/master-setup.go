@@ -0,0 +1,76 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Init
+func SetupMasterSetupRoutes(router *gin.Engine) {
+
+	// Only usable until the first master user exists, guarded by the setup token instead of a session.
+	setup := router.Group("/api/v1/master/setup")
+	{
+		setup.GET("", HandleGetMasterSetupStatus)
+		setup.POST("", HandleCompleteMasterSetup)
+	}
+}
+
+// @Summary Shows whether the first master user still has to be created.
+// @tags master/setup
+// @Router api/v1/master/setup [Get]
+func HandleGetMasterSetupStatus(c *gin.Context) {
+
+	pending, err := services.IsMasterSetupPending()
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, resources.MasterSetupStatusResponse{Pending: pending})
+}
+
+// @Summary Creates the first master user with the setup token printed at start up.
+// @tags master/setup
+// @Router api/v1/master/setup [post]
+func HandleCompleteMasterSetup(c *gin.Context) {
+
+	var json resources.MasterSetupRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Incorrect details supplied, please try again.")
+		return
+	}
+
+	if !helpers.ValidateEmail(json.Email) {
+		resources.Failed(c, http.StatusBadRequest, "Email is incorrect, please try again.")
+		return
+	}
+
+	insertedId, err := services.CompleteMasterSetup(masterActor(c), json.Token, json.Email, json.Password)
+
+	if failedPasswordPolicy(c, err) {
+		return
+	}
+
+	switch err {
+	case nil:
+	case services.ErrMasterSetupCompleted:
+		resources.Failed(c, http.StatusGone, "The master setup has already been completed.")
+		return
+	case services.ErrInvalidSetupToken:
+		resources.Failed(c, http.StatusForbidden, "The setup token is invalid.")
+		return
+	default:
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, insertedId)
+}
@@ -12,9 +12,11 @@ import (
 	database "go-multitenancy-boilerplate/database"
 	helpers "go-multitenancy-boilerplate/helpers"
 	middlewares "go-multitenancy-boilerplate/middlewares"
+	models "go-multitenancy-boilerplate/models"
 	resources "go-multitenancy-boilerplate/resources/api/v1"
 	ss "go-multitenancy-boilerplate/resources/sessions"
 	services "go-multitenancy-boilerplate/services/v1"
+	tokens "go-multitenancy-boilerplate/tokens"
 )
 
 // Init
@@ -23,22 +25,40 @@ func SetupMasterUserRoutes(router *gin.Engine) {
 	users := router.Group("/api/v1/master/users")
 
 	users.POST("login", ss.HandleMasterLoginAttempt(database.Store), HandleMasterLogin)
+	users.POST("login/2fa", HandleMasterTwoFactorLogin)
+	users.POST("login/2fa/setup", HandleMasterTwoFactorLoginSetup)
+	users.POST("token/refresh", HandleMasterRefreshToken)
+	users.POST("password/forgot", HandleMasterForgotPassword)
+	users.POST("password/reset", HandleMasterResetPassword)
+	users.GET("password/policy", HandleGetMasterPasswordPolicy)
 
 	users.Use(middlewares.IfMasterAuthorized(database.Store))
 	{
 		// POST
-		users.POST("", HandleMasterCreateUser)
+		users.POST("", middlewares.RequireMasterPermission(models.PermissionMasterUsersCreate), HandleMasterCreateUser)
 		users.POST("logout", HandleMasterLogout)
+		users.POST("me/2fa/setup", HandleMasterBeginTwoFactorSetup)
+		users.POST("me/2fa/confirm", HandleMasterConfirmTwoFactorSetup)
+		users.POST("me/2fa/recovery-codes", HandleMasterRegenerateRecoveryCodes)
+		users.POST("unlock", middlewares.RequireMasterPermission(models.PermissionMasterUsersUpdate), HandleMasterUnlockUser)
+		users.POST("login/unlock", middlewares.RequireMasterPermission(models.PermissionMasterUsersUpdate), HandleMasterUnlockLogin)
 
 		// PUT
-		users.PUT("", HandleMasterUpdateUserDetails)
+		users.PUT("", middlewares.RequireMasterPermission(models.PermissionMasterUsersUpdate), HandleMasterUpdateUserDetails)
+		users.PUT("me", HandleMasterUpdateCurrentUser)
+		users.PUT("me/password", HandleMasterChangePassword)
 
 		// GET
-		users.GET("{id}", HandleMasterGetUserById)
+		users.GET("{id}", middlewares.RequireMasterPermission(models.PermissionMasterUsersRead), HandleMasterGetUserById)
 		users.GET("me", HandleMasterGetCurrentUser)
+		users.GET("me/sessions", HandleMasterListSessions)
 
 		// DELETE
-		users.DELETE("", HandleMasterDeleteUser)
+		users.DELETE("", middlewares.RequireMasterPermission(models.PermissionMasterUsersDelete), HandleMasterDeleteUser)
+		users.DELETE("me/2fa", HandleMasterDisableTwoFactor)
+		users.DELETE("me/sessions", HandleMasterRevokeOtherSessions)
+		users.DELETE("me/sessions/:id", HandleMasterRevokeSession)
+		users.DELETE("sessions", middlewares.RequireMasterPermission(models.PermissionMasterUsersUpdate), HandleMasterForceLogout)
 	}
 }
 
@@ -60,27 +80,13 @@ func HandleMasterCreateUser(c *gin.Context) {
 		return
 	}
 
-	// Validate the password being sent.
-	if len(json.Password) <= 7 {
-		resources.Failed(c, http.StatusBadRequest, "The specified password was to short, must be longer than 8 characters.")
-		return
-	}
-
-	// Validate the password contains at least one letter and capital
-	if !helpers.ContainsCapitalLetter(json.Password) {
-		resources.Failed(c, http.StatusBadRequest, "The specified password does not contain a capital letter.")
-		return
-	}
+	// Attempt to create a user.
+	insertedId, err := services.CreateMasterUser(masterActor(c), json.Email, json.Password, json.Type)
 
-	// Make sure the password contains at least one special character.
-	if !helpers.ContainsSpecialCharacter(json.Password) {
-		resources.Failed(c, http.StatusBadRequest, "The password must contain at least one special character.")
+	if failedPasswordPolicy(c, err) {
 		return
 	}
 
-	// Attempt to create a user.
-	insertedId, err := services.CreateMasterUser(json.Email, json.Password, json.Type)
-
 	if err != nil {
 		resources.Failed(c, http.StatusInternalServerError, err.Error())
 		return
@@ -103,24 +109,6 @@ func HandleMasterLogin(c *gin.Context) {
 		return
 	}
 
-	// Validate the password being sent.
-	if len(json.Password) <= 7 {
-		resources.Failed(c, http.StatusBadRequest, "The specified password was to short, must be longer than 8 characters.")
-		return
-	}
-
-	// Validate the password contains at least one letter and capital
-	if !helpers.ContainsCapitalLetter(json.Password) {
-		resources.Failed(c, http.StatusBadRequest, "The specified password does not contain a capital letter.")
-		return
-	}
-
-	// Make sure the password contains at least one special character.
-	if !helpers.ContainsSpecialCharacter(json.Password) {
-		resources.Failed(c, http.StatusBadRequest, "The password must contain at least one special character.")
-		return
-	}
-
 	// Get our session from database.
 	session, exists := c.Get("session")
 
@@ -129,40 +117,157 @@ func HandleMasterLogin(c *gin.Context) {
 		return
 	}
 
-	userId, outcome, err := services.LoginMasterUser(json.Email, json.Password)
+	userId, outcome, err := services.LoginMasterUser(masterActor(c), json.Email, json.Password)
 
 	if err != nil {
 
+		failedLoginAttempt(c, err)
+
 		// Save changes to our session if an error occurred and we need to abort early..
 		if err := database.Store.Save(c.Request, c.Writer, session.(*sessions.Session)); err != nil {
-			fmt.Print(err)
+			fmt.Println("An error occurred while saving the session", err)
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+			return
+		}
+
+		if failedPasswordExpired(c, err) {
+			return
 		}
 
 		// Were sending 422 as there is a validation concern.
-		resources.Failed(c, http.StatusUnprocessableEntity, err.Error())
+		if services.IsInvalidCredentials(err) {
+			resources.Failed(c, http.StatusUnprocessableEntity, "Email or Password provided are incorrect, please try again.")
+			return
+		}
+
+		fmt.Println("An error occurred while logging a master user in", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	// Users with two-factor authentication log in once they also entered a code.
+	challenge, err := services.StartMasterTwoFactorLogin(masterActor(c), userId)
+
+	if err != nil || challenge != nil {
+
+		// Save changes to our session.
+		if err := database.Store.Save(c.Request, c.Writer, session.(*sessions.Session)); err != nil {
+			fmt.Println("An error occurred while saving the session", err)
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+			return
+		}
+
+		if err != nil {
+			fmt.Println("An error occurred while starting a two-factor login", err)
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+			return
+		}
+
+		resources.Succeeded(c, resources.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			Challenge:         challenge.Token,
+			EnrolmentRequired: challenge.EnrolmentRequired,
+		})
+		return
+	}
+
+	// Reset login attempts once the password is right, with a second factor only once its code is.
+	succeededLoginAttempt(c)
+
+	pair, ok := authorizeMasterLogin(c, session.(*sessions.Session), userId)
+
+	if !ok {
+		return
+	}
+
+	if pair == nil {
+		resources.Succeeded(c, outcome)
 		return
 	}
 
+	resources.Succeeded(c, pair)
+}
+
+// Records the login, authorizes the session for the master dashboard and issues tokens when they're enabled.
+// Responds itself when something went wrong.
+func authorizeMasterLogin(c *gin.Context, session *sessions.Session, userId uint) (*tokens.Pair, bool) {
+
+	ss.EnsureProfiles(session)
+
 	// Create a copy of the host profile
-	hostProfile := session.(*sessions.Session).Values["profile"].(ss.HostProfile)
+	hostProfile := session.Values["profile"].(ss.HostProfile)
 
-	// Set session values to authorized
-	hostProfile.Authorized = 1
-	hostProfile.AuthorizedTime = time.Now().UTC()
-	hostProfile.UserId = userId
+	// A login replaces the one it was made from, the request's when it was authorized, otherwise the cookie's.
+	previousId := c.GetUint("sessionId")
+
+	if previousId == 0 {
+		previousId = hostProfile.SessionId
+	}
 
-	// Reset login attempts once successfully logged in.
-	hostProfile.LoginAttempts[json.Email].LoginAttempts = 0
+	sessionId, err := services.StartMasterUserSession(userId, previousId, c.Request.UserAgent(), c.ClientIP())
+
+	if err != nil {
+		fmt.Println("An error occurred while recording a login", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return nil, false
+	}
+
+	// Set session values to authorized
+	if tokens.SessionsEnabled() {
+		hostProfile.Authorized = 1
+		hostProfile.AuthorizedTime = time.Now().UTC()
+		hostProfile.UserId = userId
+		hostProfile.SessionId = sessionId
+	}
 
 	// Set host profile back to values.
-	session.(*sessions.Session).Values["profile"] = hostProfile
+	session.Values["profile"] = hostProfile
 
-	// Save changes to our session.
-	if err := database.Store.Save(c.Request, c.Writer, session.(*sessions.Session)); err != nil {
-		fmt.Print(err)
+	// The login moves the session to a new id, so one planted or seen before it is worthless.
+	if !rotateSession(c, session) {
+		return nil, false
 	}
 
-	resources.Succeeded(c, outcome)
+	if !tokens.TokensEnabled() {
+		return nil, true
+	}
+
+	pair, err := services.IssueMasterTokens(userId, sessionId)
+
+	if err != nil {
+		fmt.Println("An error occurred while issuing tokens", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return nil, false
+	}
+
+	return pair, true
+}
+
+// @Summary Exchanges a refresh token for a new access and refresh token
+// @tags master/users
+// @Router /api/v1/master/users/token/refresh [post]
+func HandleMasterRefreshToken(c *gin.Context) {
+
+	if !tokens.TokensEnabled() {
+		resources.Failed(c, http.StatusBadRequest, "Token authentication is not enabled.")
+		return
+	}
+
+	var json resources.RefreshTokenRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	pair, err := services.RefreshMasterTokens(json.RefreshToken)
+
+	if err != nil {
+		resources.Failed(c, http.StatusUnauthorized, "The refresh token is invalid or has expired.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, pair)
 }
 
 // @Summary Logs a user out of the system
@@ -178,6 +283,12 @@ func HandleMasterLogout(c *gin.Context) {
 		return
 	}
 
+	// Ends the recorded login, tokens issued for it stop working too.
+	if err := services.EndMasterUserSession(c.GetUint("userId"), c.GetUint("sessionId")); err != nil {
+		resources.Failed(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	// Get our session from database.
 	session, err := database.Store.Get(c.Request, "connect.s.id")
 
@@ -186,24 +297,30 @@ func HandleMasterLogout(c *gin.Context) {
 		return
 	}
 
-	// Create a copy of the host profile
-	hostProfile := session.Values["profile"].(ss.HostProfile)
+	// Token clients have no cookie session to clear.
+	hostProfile, ok := session.Values["profile"].(ss.HostProfile)
+
+	if !ok {
+		resources.Succeeded(c, "You have successfully logged out of your account.")
+		return
+	}
 
 	// Set session values to unauthorized
 	hostProfile.Authorized = 0
+	hostProfile.SessionId = 0
 
 	// Set host profile back to values.
 	session.Values["profile"] = hostProfile
 
-	// Save changes to our session.
-	if err := database.Store.Save(c.Request, c.Writer, session); err != nil {
-		fmt.Print(err)
+	// The logout moves the session to a new id as well.
+	if !rotateSession(c, session) {
+		return
 	}
 
 	resources.Succeeded(c, "You have successfully logged out of your account.")
 }
 
-// @Summary Updates a users details
+// @Summary Updates a users details, master users change their own at /api/v1/master/users/me
 // @tags master/users
 // @Router /master/api/users/updateUserDetails [post]
 func HandleMasterUpdateUserDetails(c *gin.Context) {
@@ -215,7 +332,17 @@ func HandleMasterUpdateUserDetails(c *gin.Context) {
 		return
 	}
 
-	outcome, err := services.UpdateMasterUser(json.Id, json.Email, json.AccountType, json.FirstName, json.LastName, json.PhoneNumber, json.RecoveryEmail)
+	outcome, err := services.UpdateMasterUser(masterActor(c), json.Id, json.Email, json.AccountType, json.FirstName, json.LastName, json.PhoneNumber, json.RecoveryEmail)
+
+	if err == services.ErrUnknownAccountType {
+		resources.Failed(c, http.StatusBadRequest, "The account type is unknown.")
+		return
+	}
+
+	if err == services.ErrLastSuperAdmin {
+		resources.Failed(c, http.StatusConflict, "The last super admin can not be made a standard user.")
+		return
+	}
 
 	if err != nil {
 		resources.Failed(c, http.StatusInternalServerError, err.Error())
@@ -237,7 +364,7 @@ func HandleMasterDeleteUser(c *gin.Context) {
 		return
 	}
 
-	outcome, err := services.DeleteMasterUser(json.Id)
+	outcome, err := services.DeleteMasterUser(masterActor(c), json.Id)
 
 	if err != nil {
 		resources.Failed(c, http.StatusInternalServerError, err.Error())
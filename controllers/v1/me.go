@@ -0,0 +1,177 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// @Summary Updates the profile of the currently logged in user, the account type can only be changed by an admin.
+// @tags users
+// @Router /api/v1/users/me [put]
+func HandleUpdateCurrentUser(c *gin.Context) {
+
+	var json resources.UpdateProfileRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	if len(json.Email) > 0 && !helpers.ValidateEmail(json.Email) {
+		resources.Failed(c, http.StatusBadRequest, "Email is incorrect, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	outcome, err := services.UpdateUser(tenantActor(c), c.GetUint("userId"), json.Email, nil, json.FirstName, json.LastName, json.PhoneNumber, json.RecoveryEmail, db.(*gorm.DB))
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	resources.Succeeded(c, outcome)
+}
+
+// @Summary Changes the password of the currently logged in user, every other session and token is logged out.
+// @tags users
+// @Router /api/v1/users/me/password [put]
+func HandleChangePassword(c *gin.Context) {
+
+	var json resources.ChangePasswordRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	userId := c.GetUint("userId")
+
+	err := services.ChangePassword(tenantActor(c), userId, json.CurrentPassword, json.Password, db.(*gorm.DB))
+
+	if !changedPassword(c, err) {
+		return
+	}
+
+	// The change logged out every session, this one is authorized again.
+	session, err := database.Store.Get(c.Request, "connect.s.id")
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pair, ok := authorizeTenantLogin(c, session, userId)
+
+	if !ok {
+		return
+	}
+
+	if pair == nil {
+		resources.Succeeded(c, "Your password has been changed.")
+		return
+	}
+
+	resources.Succeeded(c, pair)
+}
+
+// @Summary Updates the profile of the currently logged in master user, the account type can only be changed by a super admin.
+// @tags master/users
+// @Router /api/v1/master/users/me [put]
+func HandleMasterUpdateCurrentUser(c *gin.Context) {
+
+	var json resources.UpdateProfileRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	if len(json.Email) > 0 && !helpers.ValidateEmail(json.Email) {
+		resources.Failed(c, http.StatusBadRequest, "Email is incorrect, please try again.")
+		return
+	}
+
+	outcome, err := services.UpdateMasterUser(masterActor(c), c.GetUint("userId"), json.Email, nil, json.FirstName, json.LastName, json.PhoneNumber, json.RecoveryEmail)
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	resources.Succeeded(c, outcome)
+}
+
+// @Summary Changes the password of the currently logged in master user, every other session and token is logged out.
+// @tags master/users
+// @Router /api/v1/master/users/me/password [put]
+func HandleMasterChangePassword(c *gin.Context) {
+
+	var json resources.ChangePasswordRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	err := services.ChangeMasterPassword(masterActor(c), userId, json.CurrentPassword, json.Password)
+
+	if !changedPassword(c, err) {
+		return
+	}
+
+	// The change logged out every session, this one is authorized again.
+	session, err := database.Store.Get(c.Request, "connect.s.id")
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pair, ok := authorizeMasterLogin(c, session, userId)
+
+	if !ok {
+		return
+	}
+
+	if pair == nil {
+		resources.Succeeded(c, "Your password has been changed.")
+		return
+	}
+
+	resources.Succeeded(c, pair)
+}
+
+// Responds to a failed password change, returns whether the password was changed.
+func changedPassword(c *gin.Context, err error) bool {
+
+	if err == nil {
+		return true
+	}
+
+	if err == services.ErrIncorrectPassword {
+		resources.Failed(c, http.StatusForbidden, "The current password is incorrect.")
+		return false
+	}
+
+	if failedPasswordPolicy(c, err) {
+		return false
+	}
+
+	resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+	return false
+}
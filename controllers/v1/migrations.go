@@ -0,0 +1,116 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
+	middlewares "go-multitenancy-boilerplate/middlewares"
+	models "go-multitenancy-boilerplate/models"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Init
+func SetupMigrationRoutes(router *gin.Engine) {
+
+	migrationRoutes := router.Group("/api/v1/master/migrations")
+
+	migrationRoutes.Use(middlewares.IfMasterAuthorized(database.Store))
+	{
+		migrationRoutes.GET("", middlewares.RequireMasterPermission(models.PermissionMigrationsRead), HandleGetMasterMigrationStatus)
+		migrationRoutes.POST("tenants", middlewares.RequireMasterPermission(models.PermissionMigrationsRun), HandleStartFleetMigration)
+		migrationRoutes.GET("tenants/results", middlewares.RequireMasterPermission(models.PermissionMigrationsRead), HandleListTenantMigrationResults)
+	}
+}
+
+// @Summary Shows the version of the master database and which migrations have been applied.
+// @tags migrations
+// @Router api/v1/master/migrations [Get]
+func HandleGetMasterMigrationStatus(c *gin.Context) {
+
+	current, statuses, err := services.GetMasterMigrationStatus()
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, resources.MigrationStatusResponse{
+		CurrentVersion: current,
+		LatestVersion:  database.MasterMigrations.Latest(),
+		Migrations:     statuses,
+	})
+}
+
+// @Summary Starts migrating every tenant in the background, optionally only the tenants which failed before.
+// @tags migrations
+// @Router api/v1/master/migrations/tenants [Post]
+func HandleStartFleetMigration(c *gin.Context) {
+
+	var json resources.StartFleetMigrationRequest
+
+	// Every option is optional so an empty body is fine.
+	_ = c.ShouldBindJSON(&json)
+
+	if json.Concurrency < 1 {
+		json.Concurrency = helpers.GetEnvInt("TENANT_MIGRATION_CONCURRENCY", 4)
+	}
+
+	runId, err := services.StartFleetMigration(database.FleetMigrationOptions{
+		Concurrency: json.Concurrency,
+		OnlyFailed:  json.OnlyFailed,
+		TenantIds:   json.TenantIds,
+	})
+
+	if err == database.ErrFleetMigrationRunning {
+		resources.Failed(c, http.StatusConflict, "A tenant migration is already running.")
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Accepted(c, gin.H{
+		"runId": runId,
+	})
+}
+
+// @Summary Lists the per tenant results of tenant migration runs.
+// @tags migrations
+// @Router api/v1/master/migrations/tenants/results [Get]
+func HandleListTenantMigrationResults(c *gin.Context) {
+
+	var json resources.ListMigrationResultsRequest
+
+	if err := c.ShouldBindQuery(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Incorrect filters supplied, please try again.")
+		return
+	}
+
+	json.Normalize()
+
+	found, total, err := services.ListTenantMigrationResults(json.RunId, json.TenantId, json.Status, json.Page, json.PageSize)
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	items := make([]resources.TenantMigrationResultResponse, 0, len(found))
+
+	for _, result := range found {
+		items = append(items, resources.NewTenantMigrationResultResponse(result))
+	}
+
+	resources.Succeeded(c, resources.PaginatedResponse{
+		Items:    items,
+		Total:    total,
+		Page:     json.Page,
+		PageSize: json.PageSize,
+	})
+}
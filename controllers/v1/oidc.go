@@ -0,0 +1,307 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+
+	database "go-multitenancy-boilerplate/database"
+	oidc "go-multitenancy-boilerplate/oidc"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Holds the state of the login started by the browser.
+const oidcStateCookie = "oidc_state"
+
+// @Summary Starts a login with the tenant's identity provider, the user is redirected to it.
+// @tags users
+// @Router /api/v1/users/login/oidc [get]
+func HandleOidcLogin(c *gin.Context) {
+
+	redirectURL := oidcRedirectURL(c)
+
+	authorizationURL, state, err := services.StartOidcLogin(c.Request.Context(), c.GetUint("tenantId"), redirectURL)
+
+	if failedOidcLogin(c, err) {
+		return
+	}
+
+	// Only the browser which started the login may finish it, otherwise someone could have theirs finished by a victim.
+	setOidcStateCookie(c, redirectURL, state, int(services.OidcLoginTTL.Seconds()))
+
+	c.Redirect(http.StatusFound, authorizationURL)
+}
+
+// @Summary Finishes a login with the tenant's identity provider, users logging in for the first time are provisioned.
+// @tags users
+// @Router /api/v1/users/login/oidc/callback [get]
+func HandleOidcCallback(c *gin.Context) {
+
+	// The provider sends the user back with an error when they didn't log in.
+	if providerError := c.Query("error"); len(providerError) > 0 {
+		resources.Failed(c, http.StatusUnauthorized, "The identity provider did not log you in.", providerError+": "+c.Query("error_description"))
+		return
+	}
+
+	if len(c.Query("code")) == 0 || len(c.Query("state")) == 0 {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	state, _ := c.Cookie(oidcStateCookie)
+
+	if subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		resources.Failed(c, http.StatusBadRequest, "The login was not started from this browser, please try again.", "oidc_state_mismatch")
+		return
+	}
+
+	// The state is single use, the browser has no need for it any more.
+	setOidcStateCookie(c, oidcRedirectURL(c), "", -1)
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	userId, multiFactor, err := services.FinishOidcLogin(c.Request.Context(), tenantActor(c), c.Query("state"), c.Query("code"), db.(*gorm.DB))
+
+	if failedOidcLogin(c, err) {
+		return
+	}
+
+	// A provider which checked a second factor satisfies two-factor authentication, otherwise
+	// users with it enabled, or owners and admins of tenants requiring it, get the same second step as a password login.
+	if !multiFactor {
+
+		challenge, err := services.StartTwoFactorLogin(tenantActor(c), userId, db.(*gorm.DB))
+
+		if err != nil {
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+			return
+		}
+
+		if challenge != nil {
+			resources.Succeeded(c, resources.TwoFactorChallengeResponse{
+				TwoFactorRequired: true,
+				Challenge:         challenge.Token,
+				EnrolmentRequired: challenge.EnrolmentRequired,
+			})
+			return
+		}
+	}
+
+	session, err := database.Store.Get(c.Request, "connect.s.id")
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pair, ok := authorizeTenantLogin(c, session, userId)
+
+	if !ok {
+		return
+	}
+
+	if pair == nil {
+		resources.Succeeded(c, "You have successfully logged into your account.")
+		return
+	}
+
+	resources.Succeeded(c, pair)
+}
+
+// Sets the cookie holding the state of a login for the callback only, a negative max age removes it.
+// It is lax so that it is still sent when the provider redirects the user back.
+func setOidcStateCookie(c *gin.Context, redirectURL string, state string, maxAge int) {
+
+	callback, _ := url.Parse(redirectURL)
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, callback.Path, "", callback.Scheme == "https", true)
+}
+
+// Where the provider sends the user back to, on the host the login was started from.
+func oidcRedirectURL(c *gin.Context) string {
+
+	scheme := "http"
+
+	if c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	redirectURL := scheme + "://" + c.Request.Host + "/api/v1/users/login/oidc/callback"
+
+	// Tenants named in the query rather than the sub domain are named again on the way back.
+	if tenant := c.Query("tenant"); len(tenant) > 0 {
+		redirectURL += "?tenant=" + url.QueryEscape(tenant)
+	}
+
+	return redirectURL
+}
+
+// Responds to a failed single sign-on login, returns whether it failed.
+func failedOidcLogin(c *gin.Context, err error) bool {
+
+	if err == nil {
+		return false
+	}
+
+	switch errors.Cause(err) {
+	case services.ErrOidcNotEnabled:
+		resources.Failed(c, http.StatusNotFound, "Single sign-on is not enabled for this tenant.", "oidc_not_enabled")
+	case services.ErrOidcLoginInvalid:
+		resources.Failed(c, http.StatusBadRequest, "The login has expired, please try again.", "oidc_login_invalid")
+	case services.ErrOidcUserNotFound:
+		resources.Failed(c, http.StatusForbidden, "There is no account for you in this tenant.", "oidc_user_not_found")
+	case services.ErrOidcAccountConflict:
+		resources.Failed(c, http.StatusConflict, "Your account is linked to another identity.", "oidc_account_conflict")
+	// What the provider answered is only logged, it is none of the user's business.
+	case oidc.ErrExchange, oidc.ErrInvalidIDToken:
+		fmt.Println("An error occurred while finishing a single sign-on login", err)
+		resources.Failed(c, http.StatusUnauthorized, "The identity provider did not log you in.", "oidc_login_failed")
+	case oidc.ErrDiscovery:
+		fmt.Println("An error occurred while loading the identity provider's configuration", err)
+		resources.Failed(c, http.StatusBadGateway, "The identity provider is currently unavailable, please try again later.", "oidc_provider_unavailable")
+	default:
+		fmt.Println("An error occurred while logging in with single sign-on", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+	}
+
+	return true
+}
+
+// Responds when password login is turned off for the tenant, returns whether it is.
+func failedPasswordLoginDisabled(c *gin.Context, err error) bool {
+
+	if err != services.ErrPasswordLoginDisabled {
+		return false
+	}
+
+	resources.Failed(c, http.StatusForbidden, "Please log in with single sign-on.", "password_login_disabled")
+	return true
+}
+
+// @Summary Gets the single sign-on configuration of the current tenant.
+// @tags settings
+// @Router api/v1/settings/oidc [Get]
+func HandleGetOidcConfig(c *gin.Context) {
+	getOidcConfig(c, c.GetUint("tenantId"))
+}
+
+// @Summary Sets up or changes the single sign-on configuration of the current tenant.
+// @tags settings
+// @Router api/v1/settings/oidc [Put]
+func HandleUpdateOidcConfig(c *gin.Context) {
+
+	var json resources.UpdateOidcConfigRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Incorrect settings supplied, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	config, err := services.UpdateTenantOidcConfig(tenantActor(c), c.GetUint("tenantId"), services.OidcConfigUpdate{
+		Enabled:              json.Enabled,
+		Issuer:               json.Issuer,
+		ClientId:             json.ClientId,
+		ClientSecret:         json.ClientSecret,
+		Scopes:               json.Scopes,
+		EmailClaim:           json.EmailClaim,
+		FirstNameClaim:       json.FirstNameClaim,
+		LastNameClaim:        json.LastNameClaim,
+		PhoneNumberClaim:     json.PhoneNumberClaim,
+		RolesClaim:           json.RolesClaim,
+		RoleMapping:          json.RoleMapping,
+		AutoProvision:        json.AutoProvision,
+		DisablePasswordLogin: json.DisablePasswordLogin,
+	}, db.(*gorm.DB))
+
+	if errors.Cause(err) == services.ErrInvalidOidcConfig {
+		resources.Failed(c, http.StatusBadRequest, "Incorrect settings supplied, please try again.", err.Error())
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, resources.NewOidcConfigResponse(*config))
+}
+
+// @Summary Removes the single sign-on configuration of the current tenant, users log in with passwords again.
+// @tags settings
+// @Router api/v1/settings/oidc [Delete]
+func HandleDeleteOidcConfig(c *gin.Context) {
+	deleteOidcConfig(c, tenantActor(c), c.GetUint("tenantId"))
+}
+
+// @Summary Gets the single sign-on configuration of a tenant.
+// @tags tetants
+// @Router api/v1/tenants/{id}/oidc [Get]
+func HandleGetTenantOidcConfig(c *gin.Context) {
+
+	id, ok := existingTenantParam(c)
+
+	if !ok {
+		return
+	}
+
+	getOidcConfig(c, id)
+}
+
+// @Summary Removes the single sign-on configuration of a tenant, e.g. when its identity provider locked everybody out.
+// @tags tetants
+// @Router api/v1/tenants/{id}/oidc [Delete]
+func HandleDeleteTenantOidcConfig(c *gin.Context) {
+
+	id, ok := existingTenantParam(c)
+
+	if !ok {
+		return
+	}
+
+	deleteOidcConfig(c, masterActor(c), id)
+}
+
+func getOidcConfig(c *gin.Context, tenantId uint) {
+
+	config, err := services.GetTenantOidcConfig(tenantId)
+
+	if gorm.IsRecordNotFoundError(err) {
+		resources.Failed(c, http.StatusNotFound, "Single sign-on has not been set up.")
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, resources.NewOidcConfigResponse(*config))
+}
+
+func deleteOidcConfig(c *gin.Context, actor services.Actor, tenantId uint) {
+
+	err := services.DeleteTenantOidcConfig(actor, tenantId)
+
+	if gorm.IsRecordNotFoundError(err) {
+		resources.Failed(c, http.StatusNotFound, "Single sign-on has not been set up.")
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, "Single sign-on has been removed, users log in with their passwords again.")
+}
@@ -0,0 +1,19 @@
+package v1
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reads the :id path parameter of the route.
+func getIdParam(c *gin.Context) (uint, bool) {
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	if err != nil || id == 0 {
+		return 0, false
+	}
+
+	return uint(id), true
+}
@@ -0,0 +1,68 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	passwords "go-multitenancy-boilerplate/passwords"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// @Summary Gets the password policy of the current tenant, so clients can show the rules before submitting.
+// @tags users
+// @Router /api/v1/users/password/policy [get]
+func HandleGetPasswordPolicy(c *gin.Context) {
+
+	policy, err := services.GetTenantPasswordPolicy(c.GetUint("tenantId"))
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, resources.NewPasswordPolicyResponse(policy))
+}
+
+// @Summary Gets the password policy of master users.
+// @tags master/users
+// @Router /api/v1/master/users/password/policy [get]
+func HandleGetMasterPasswordPolicy(c *gin.Context) {
+	resources.Succeeded(c, resources.NewPasswordPolicyResponse(services.MasterPasswordPolicy()))
+}
+
+// Responds with every rule a refused password broke, returns whether the error was a policy error.
+func failedPasswordPolicy(c *gin.Context, err error) bool {
+
+	policyErr, ok := err.(*passwords.PolicyError)
+
+	if !ok {
+		return false
+	}
+
+	errs := make([]interface{}, 0, len(policyErr.Violations))
+
+	for _, violation := range policyErr.Violations {
+		errs = append(errs, violation)
+	}
+
+	resources.Failed(c, http.StatusBadRequest, "The password does not meet the password policy.", errs...)
+	return true
+}
+
+// Responds with the reset token of an expired password, returns whether the error was an expired password.
+func failedPasswordExpired(c *gin.Context, err error) bool {
+
+	expired, ok := err.(*services.PasswordExpiredError)
+
+	if !ok {
+		return false
+	}
+
+	resources.Failed(c, http.StatusForbidden, "Your password has expired, please choose a new one.", resources.PasswordExpiredResponse{
+		Reason:     "password_expired",
+		ResetToken: expired.ResetToken,
+	})
+	return true
+}
@@ -0,0 +1,129 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// The same answer whether or not the email belongs to an account.
+const forgotPasswordOutcome = "If an account with that email exists a password reset link has been sent."
+
+// @Summary Emails a password reset link to a tenant user.
+// @tags users
+// @Router /api/v1/users/password/forgot [post]
+func HandleForgotPassword(c *gin.Context) {
+
+	var json resources.ForgotPasswordRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil || !helpers.ValidateEmail(json.Email) {
+		resources.Failed(c, http.StatusBadRequest, "Email is incorrect, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	err := services.RequestPasswordReset(tenantActor(c), json.Email, db.(*gorm.DB))
+
+	if failedPasswordLoginDisabled(c, err) {
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	resources.Succeeded(c, forgotPasswordOutcome)
+}
+
+// @Summary Sets a new password for a tenant user using a password reset token.
+// @tags users
+// @Router /api/v1/users/password/reset [post]
+func HandleResetPassword(c *gin.Context) {
+
+	var json resources.ResetPasswordRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	err := services.ResetPassword(tenantActor(c), json.Token, json.Password, db.(*gorm.DB))
+
+	if err == services.ErrInvalidToken {
+		resources.Failed(c, http.StatusBadRequest, "The password reset link is invalid or has expired.")
+		return
+	}
+
+	if failedPasswordLoginDisabled(c, err) || failedPasswordPolicy(c, err) {
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	resources.Succeeded(c, "Your password has been reset, you can now log in.")
+}
+
+// @Summary Emails a password reset link to a master user.
+// @tags master/users
+// @Router /api/v1/master/users/password/forgot [post]
+func HandleMasterForgotPassword(c *gin.Context) {
+
+	var json resources.ForgotPasswordRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil || !helpers.ValidateEmail(json.Email) {
+		resources.Failed(c, http.StatusBadRequest, "Email is incorrect, please try again.")
+		return
+	}
+
+	if err := services.RequestMasterPasswordReset(masterActor(c), json.Email); err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	resources.Succeeded(c, forgotPasswordOutcome)
+}
+
+// @Summary Sets a new password for a master user using a password reset token.
+// @tags master/users
+// @Router /api/v1/master/users/password/reset [post]
+func HandleMasterResetPassword(c *gin.Context) {
+
+	var json resources.ResetPasswordRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	err := services.ResetMasterPassword(masterActor(c), json.Token, json.Password)
+
+	if err == services.ErrInvalidToken {
+		resources.Failed(c, http.StatusBadRequest, "The password reset link is invalid or has expired.")
+		return
+	}
+
+	if failedPasswordLoginDisabled(c, err) || failedPasswordPolicy(c, err) {
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	resources.Succeeded(c, "Your password has been reset, you can now log in.")
+}
@@ -0,0 +1,274 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+
+	database "go-multitenancy-boilerplate/database"
+	middlewares "go-multitenancy-boilerplate/middlewares"
+	models "go-multitenancy-boilerplate/models"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Init
+func SetupRoleRoutes(router *gin.Engine) {
+
+	roles := router.Group("/api/v1/roles")
+
+	roles.Use(middlewares.FindTenancy(database.Connection, database.TenantConnections))
+	roles.Use(middlewares.IfAuthorized(database.Store))
+	{
+		read := middlewares.RequirePermission(models.PermissionRolesRead)
+		manage := middlewares.RequirePermission(models.PermissionRolesManage)
+
+		// GET
+		roles.GET("", read, HandleListRoles)
+		roles.GET("permissions", read, HandleListPermissions)
+		roles.GET(":id", read, HandleGetRole)
+
+		// POST
+		roles.POST("", manage, HandleCreateRole)
+		roles.POST(":id/users", manage, HandleAssignRole)
+
+		// PUT
+		roles.PUT(":id", manage, HandleUpdateRole)
+
+		// DELETE
+		roles.DELETE(":id", manage, HandleDeleteRole)
+		roles.DELETE(":id/users/:userId", manage, HandleUnassignRole)
+	}
+}
+
+// @Summary Lists the roles of the tenant.
+// @tags roles
+// @Router api/v1/roles [Get]
+func HandleListRoles(c *gin.Context) {
+
+	db, _ := c.Get("connection")
+
+	found, err := services.ListRoles(db.(*gorm.DB))
+
+	if err != nil {
+		failedRoleLookup(c, err)
+		return
+	}
+
+	items := make([]resources.RoleResponse, 0, len(found))
+
+	for _, role := range found {
+		items = append(items, resources.NewRoleResponse(role))
+	}
+
+	resources.Succeeded(c, items)
+}
+
+// @Summary Lists every permission a role can grant.
+// @tags roles
+// @Router api/v1/roles/permissions [Get]
+func HandleListPermissions(c *gin.Context) {
+	resources.Succeeded(c, models.TenantPermissions)
+}
+
+// @Summary Gets a role with its permissions.
+// @tags roles
+// @Router api/v1/roles/:id [Get]
+func HandleGetRole(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No role ID found, please try again.")
+		return
+	}
+
+	db, _ := c.Get("connection")
+
+	role, err := services.GetRole(id, db.(*gorm.DB))
+
+	if err != nil {
+		failedRoleLookup(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.NewRoleResponse(*role))
+}
+
+// @Summary Creates a custom role.
+// @tags roles
+// @Router api/v1/roles [Post]
+func HandleCreateRole(c *gin.Context) {
+
+	var json resources.CreateRoleRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	db, _ := c.Get("connection")
+
+	role, err := services.CreateRole(json.Name, json.Description, json.Permissions, db.(*gorm.DB))
+
+	if err != nil {
+		failedRoleLookup(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.NewRoleResponse(*role))
+}
+
+// @Summary Updates the name, description and permissions of a role.
+// @tags roles
+// @Router api/v1/roles/:id [Put]
+func HandleUpdateRole(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No role ID found, please try again.")
+		return
+	}
+
+	var json resources.UpdateRoleRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	db, _ := c.Get("connection")
+
+	role, err := services.UpdateRole(id, json.Name, json.Description, json.Permissions, db.(*gorm.DB))
+
+	if err != nil {
+		failedRoleLookup(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.NewRoleResponse(*role))
+}
+
+// @Summary Deletes a custom role.
+// @tags roles
+// @Router api/v1/roles/:id [Delete]
+func HandleDeleteRole(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No role ID found, please try again.")
+		return
+	}
+
+	db, _ := c.Get("connection")
+
+	outcome, err := services.DeleteRole(id, db.(*gorm.DB))
+
+	if err != nil {
+		failedRoleLookup(c, err, outcome)
+		return
+	}
+
+	resources.Succeeded(c, outcome)
+}
+
+// @Summary Gives a user a role.
+// @tags roles
+// @Router api/v1/roles/:id/users [Post]
+func HandleAssignRole(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No role ID found, please try again.")
+		return
+	}
+
+	var json resources.AssignRoleRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	db, _ := c.Get("connection")
+
+	outcome, err := services.AssignRole(json.UserId, id, db.(*gorm.DB))
+
+	if err != nil {
+		failedRoleLookup(c, err, outcome)
+		return
+	}
+
+	resources.Succeeded(c, outcome)
+}
+
+// @Summary Takes a role away from a user.
+// @tags roles
+// @Router api/v1/roles/:id/users/:userId [Delete]
+func HandleUnassignRole(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+	userId, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+
+	if !ok || err != nil {
+		resources.Failed(c, http.StatusBadRequest, "No role or user ID found, please try again.")
+		return
+	}
+
+	db, _ := c.Get("connection")
+
+	outcome, err := services.UnassignRole(uint(userId), id, db.(*gorm.DB))
+
+	if err != nil {
+		failedRoleLookup(c, err, outcome)
+		return
+	}
+
+	resources.Succeeded(c, outcome)
+}
+
+// Responds to a failed role operation with a status matching the error.
+func failedRoleLookup(c *gin.Context, err error, message ...string) {
+
+	if gorm.IsRecordNotFoundError(err) {
+		resources.Failed(c, http.StatusNotFound, "The role or user could not be found.")
+		return
+	}
+
+	switch errors.Cause(err) {
+	case services.ErrUnknownPermission:
+		resources.Failed(c, http.StatusBadRequest, "The role grants an unknown permission.", err.Error())
+		return
+	case services.ErrRoleNameInUse:
+		resources.Failed(c, http.StatusConflict, "A role with that name already exists.")
+		return
+	case services.ErrSystemRole, services.ErrOwnerRolePermanent, services.ErrLastOwner:
+		resources.Failed(c, http.StatusConflict, err.Error())
+		return
+	}
+
+	outcome := "Something went wrong while trying to process that, please try again."
+
+	if len(message) > 0 && len(message[0]) > 0 {
+		outcome = message[0]
+	}
+
+	resources.Failed(c, http.StatusInternalServerError, outcome, err.Error())
+}
+
+// Responds when the user acted on holds a role the current user doesn't, returns whether they do.
+func failedRoleNotHeld(c *gin.Context, err error) bool {
+
+	if err != services.ErrRoleNotHeld {
+		return false
+	}
+
+	resources.Failed(c, http.StatusForbidden, "You can not manage a user holding a role you don't have.", "role_not_held")
+	return true
+}
@@ -0,0 +1,217 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"github.com/jinzhu/gorm"
+
+	database "go-multitenancy-boilerplate/database"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// @Summary Lists the active sessions of the currently logged in user.
+// @tags users
+// @Router /api/v1/users/me/sessions [get]
+func HandleListSessions(c *gin.Context) {
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	sessions, err := services.ListUserSessions(c.GetUint("userId"), db.(*gorm.DB))
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	items := make([]resources.SessionResponse, 0, len(sessions))
+
+	for _, session := range sessions {
+		items = append(items, resources.NewSessionResponse(session, c.GetUint("sessionId")))
+	}
+
+	resources.Succeeded(c, items)
+}
+
+// @Summary Revokes one session of the currently logged in user.
+// @tags users
+// @Router /api/v1/users/me/sessions/{id} [delete]
+func HandleRevokeSession(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No session ID found, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	err := services.RevokeUserSession(tenantActor(c), c.GetUint("userId"), id, db.(*gorm.DB))
+
+	if !revokedSessions(c, err) {
+		return
+	}
+
+	resources.Succeeded(c, "The session has been revoked.")
+}
+
+// @Summary Revokes every session of the currently logged in user except the current one.
+// @tags users
+// @Router /api/v1/users/me/sessions [delete]
+func HandleRevokeOtherSessions(c *gin.Context) {
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	err := services.RevokeOtherUserSessions(tenantActor(c), c.GetUint("userId"), c.GetUint("sessionId"), db.(*gorm.DB))
+
+	if !revokedSessions(c, err) {
+		return
+	}
+
+	resources.Succeeded(c, "Every other session has been revoked.")
+}
+
+// @Summary Logs a user out of every session and token.
+// @tags users
+// @Router /api/v1/users/sessions [delete]
+func HandleForceLogout(c *gin.Context) {
+
+	var json resources.DeleteUserRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	err := services.ForceLogoutUser(tenantActor(c), json.Id, db.(*gorm.DB))
+
+	if !revokedSessions(c, err) {
+		return
+	}
+
+	resources.Succeeded(c, "The user has been logged out everywhere.")
+}
+
+// @Summary Lists the active sessions of the currently logged in master user.
+// @tags master/users
+// @Router /api/v1/master/users/me/sessions [get]
+func HandleMasterListSessions(c *gin.Context) {
+
+	sessions, err := services.ListMasterUserSessions(c.GetUint("userId"))
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	items := make([]resources.SessionResponse, 0, len(sessions))
+
+	for _, session := range sessions {
+		items = append(items, resources.NewMasterSessionResponse(session, c.GetUint("sessionId")))
+	}
+
+	resources.Succeeded(c, items)
+}
+
+// @Summary Revokes one session of the currently logged in master user.
+// @tags master/users
+// @Router /api/v1/master/users/me/sessions/{id} [delete]
+func HandleMasterRevokeSession(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No session ID found, please try again.")
+		return
+	}
+
+	err := services.RevokeMasterUserSession(masterActor(c), c.GetUint("userId"), id)
+
+	if !revokedSessions(c, err) {
+		return
+	}
+
+	resources.Succeeded(c, "The session has been revoked.")
+}
+
+// @Summary Revokes every session of the currently logged in master user except the current one.
+// @tags master/users
+// @Router /api/v1/master/users/me/sessions [delete]
+func HandleMasterRevokeOtherSessions(c *gin.Context) {
+
+	err := services.RevokeOtherMasterUserSessions(masterActor(c), c.GetUint("userId"), c.GetUint("sessionId"))
+
+	if !revokedSessions(c, err) {
+		return
+	}
+
+	resources.Succeeded(c, "Every other session has been revoked.")
+}
+
+// @Summary Logs a master user out of every session and token.
+// @tags master/users
+// @Router /api/v1/master/users/sessions [delete]
+func HandleMasterForceLogout(c *gin.Context) {
+
+	var json resources.DeleteUserRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	err := services.ForceLogoutMasterUser(masterActor(c), json.Id)
+
+	if !revokedSessions(c, err) {
+		return
+	}
+
+	resources.Succeeded(c, "The master user has been logged out everywhere.")
+}
+
+// Responds to a failed session revocation, returns whether it succeeded.
+func revokedSessions(c *gin.Context, err error) bool {
+
+	if err == nil {
+		return true
+	}
+
+	if gorm.IsRecordNotFoundError(err) {
+		resources.Failed(c, http.StatusNotFound, "The session or user could not be found.")
+		return false
+	}
+
+	if failedRoleNotHeld(c, err) {
+		return false
+	}
+
+	resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+	return false
+}
+
+// Saves the session under a new id, later saves in the request go through the new one.
+// Responds itself when the session could not be saved, returns whether it was.
+func rotateSession(c *gin.Context, session *sessions.Session) bool {
+
+	request, err := database.RotateSession(c.Request, c.Writer, session)
+
+	if err != nil {
+		fmt.Println("An error occurred while rotating the session", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return false
+	}
+
+	c.Request = request
+
+	return true
+}
@@ -0,0 +1,146 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	database "go-multitenancy-boilerplate/database"
+	middlewares "go-multitenancy-boilerplate/middlewares"
+	models "go-multitenancy-boilerplate/models"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Init, the master routes live with the other tenant routes.
+func SetupSettingsRoutes(router *gin.Engine) {
+
+	// Settings of the tenant resolved for the request.
+	settings := router.Group("/api/v1/settings")
+
+	settings.Use(middlewares.FindTenancy(database.Connection, database.TenantConnections))
+	settings.Use(middlewares.IfAuthorized(database.Store))
+	{
+		settings.GET("", middlewares.RequirePermission(models.PermissionSettingsRead), HandleGetSettings)
+		settings.PUT("", middlewares.RequirePermission(models.PermissionSettingsManage), HandleUpdateSettings)
+
+		// Single sign-on, configured by the tenant itself.
+		manage := middlewares.RequirePermission(models.PermissionSettingsManage)
+
+		settings.GET("oidc", manage, HandleGetOidcConfig)
+		settings.PUT("oidc", manage, HandleUpdateOidcConfig)
+		settings.DELETE("oidc", manage, HandleDeleteOidcConfig)
+	}
+}
+
+// @Summary Gets the settings of the current tenant.
+// @tags settings
+// @Router api/v1/settings [Get]
+func HandleGetSettings(c *gin.Context) {
+	getTenantSettings(c, c.GetUint("tenantId"))
+}
+
+// @Summary Updates the settings of the current tenant.
+// @tags settings
+// @Router api/v1/settings [Put]
+func HandleUpdateSettings(c *gin.Context) {
+	updateTenantSettings(c, tenantActor(c), c.GetUint("tenantId"))
+}
+
+// @Summary Gets the settings of a tenant.
+// @tags tetants
+// @Router api/v1/tenants/{id}/settings [Get]
+func HandleGetTenantSettings(c *gin.Context) {
+
+	id, ok := existingTenantParam(c)
+
+	if !ok {
+		return
+	}
+
+	getTenantSettings(c, id)
+}
+
+// @Summary Updates the settings of a tenant.
+// @tags tetants
+// @Router api/v1/tenants/{id}/settings [Put]
+func HandleUpdateTenantSettings(c *gin.Context) {
+
+	id, ok := existingTenantParam(c)
+
+	if !ok {
+		return
+	}
+
+	updateTenantSettings(c, masterActor(c), id)
+}
+
+// Reads the :id path parameter, responding with an error unless it names an existing tenant.
+func existingTenantParam(c *gin.Context) (uint, bool) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No tenant ID found, please try again.")
+		return 0, false
+	}
+
+	if _, err := services.GetTenant(id); err != nil {
+		failedTenantLookup(c, err)
+		return 0, false
+	}
+
+	return id, true
+}
+
+func getTenantSettings(c *gin.Context, tenantId uint) {
+
+	settings, err := services.GetTenantSettings(tenantId)
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, resources.NewTenantSettingsResponse(*settings))
+}
+
+func updateTenantSettings(c *gin.Context, actor services.Actor, tenantId uint) {
+
+	var json resources.UpdateTenantSettingsRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Incorrect settings supplied, please try again.")
+		return
+	}
+
+	settings, err := services.UpdateTenantSettings(actor, tenantId, services.TenantSettingsUpdate{
+		RequireEmailVerification:      json.RequireEmailVerification,
+		RequireTwoFactorForAdmins:     json.RequireTwoFactorForAdmins,
+		ResetPasswordPolicy:           json.ResetPasswordPolicy,
+		PasswordMinLength:             json.PasswordMinLength,
+		PasswordRequireUppercase:      json.PasswordRequireUppercase,
+		PasswordRequireLowercase:      json.PasswordRequireLowercase,
+		PasswordRequireDigit:          json.PasswordRequireDigit,
+		PasswordRequireSpecial:        json.PasswordRequireSpecial,
+		PasswordRejectCommon:          json.PasswordRejectCommon,
+		PasswordHistory:               json.PasswordHistory,
+		PasswordMaxAgeDays:            json.PasswordMaxAgeDays,
+		ResetSessionTimeouts:          json.ResetSessionTimeouts,
+		SessionIdleTimeoutMinutes:     json.SessionIdleTimeoutMinutes,
+		SessionAbsoluteTimeoutMinutes: json.SessionAbsoluteTimeoutMinutes,
+	})
+
+	if errors.Cause(err) == services.ErrInvalidSettings {
+		resources.Failed(c, http.StatusBadRequest, "Incorrect settings supplied, please try again.", err.Error())
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, resources.NewTenantSettingsResponse(*settings))
+}
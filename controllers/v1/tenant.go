@@ -4,9 +4,13 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 
 	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
 	middlewares "go-multitenancy-boilerplate/middlewares"
+	models "go-multitenancy-boilerplate/models"
+	tenants "go-multitenancy-boilerplate/models/tenants"
 	resources "go-multitenancy-boilerplate/resources/api/v1"
 	services "go-multitenancy-boilerplate/services/v1"
 )
@@ -14,11 +18,36 @@ import (
 // Init
 func SetupTenantRoutes(router *gin.Engine) {
 
-	users := router.Group("/api/v1/tenants")
+	tenantRoutes := router.Group("/api/v1/tenants")
 
-	users.Use(middlewares.IfMasterAuthorized(database.Store))
+	tenantRoutes.Use(middlewares.IfMasterAuthorized(database.Store))
 	{
-		users.POST("", HandleCreateTenant)
+		// POST
+		manage := middlewares.RequireMasterPermission(models.PermissionTenantsManage)
+		read := middlewares.RequireMasterPermission(models.PermissionTenantsRead)
+
+		// POST
+		tenantRoutes.POST("", manage, HandleCreateTenant)
+		tenantRoutes.POST(":id/suspend", manage, HandleSuspendTenant)
+		tenantRoutes.POST(":id/resume", manage, HandleResumeTenant)
+		tenantRoutes.POST(":id/restore", manage, HandleRestoreTenant)
+		tenantRoutes.POST(":id/provision", manage, HandleProvisionTenant)
+
+		// PUT
+		tenantRoutes.PUT(":id/subdomain", manage, HandleRenameTenant)
+		tenantRoutes.PUT(":id/settings", manage, HandleUpdateTenantSettings)
+
+		// GET
+		tenantRoutes.GET("", read, HandleListTenants)
+		tenantRoutes.GET(":id", read, HandleGetTenant)
+		tenantRoutes.GET(":id/settings", read, HandleGetTenantSettings)
+		tenantRoutes.GET(":id/oidc", read, HandleGetTenantOidcConfig)
+		tenantRoutes.GET("jobs/:id", read, HandleGetProvisioningJob)
+		tenantRoutes.GET(":id/migrations", middlewares.RequireMasterPermission(models.PermissionMigrationsRead), HandleGetTenantMigrationStatus)
+
+		// DELETE
+		tenantRoutes.DELETE(":id", manage, HandleDeleteTenant)
+		tenantRoutes.DELETE(":id/oidc", manage, HandleDeleteTenantOidcConfig)
 	}
 }
 
@@ -34,12 +63,331 @@ func HandleCreateTenant(c *gin.Context) {
 		return
 	}
 
-	outcome, err := services.CreateTenant(json.SubDomainIdentifier)
+	if !helpers.ValidateSubDomain(json.SubDomainIdentifier) {
+		resources.Failed(c, http.StatusBadRequest, "The sub domain identifier may only contain lowercase letters, numbers and hyphens.")
+		return
+	}
+
+	if len(json.IsolationStrategy) > 0 && !tenants.IsValidIsolationStrategy(json.IsolationStrategy) {
+		resources.Failed(c, http.StatusBadRequest, "The isolation strategy must be one of database, schema or shared.")
+		return
+	}
+
+	// Provisioning can take a while, so it runs in the background and the job can be polled.
+	job, outcome, err := services.EnqueueTenantProvisioning(masterActor(c), json.SubDomainIdentifier, json.IsolationStrategy)
+
+	if err == services.ErrSubDomainInUse {
+		resources.Failed(c, http.StatusConflict, outcome, err.Error())
+		return
+	}
 
 	if err != nil {
 		resources.Failed(c, http.StatusInternalServerError, outcome, err.Error())
 		return
 	}
 
+	resources.Accepted(c, resources.NewTenantProvisioningJobResponse(*job))
+}
+
+// @Summary Attempts to get the status of a tenant provisioning job.
+// @tags tetants
+// @Router api/v1/tenants/jobs/{id} [Get]
+func HandleGetProvisioningJob(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No job ID found, please try again.")
+		return
+	}
+
+	job, err := services.GetProvisioningJob(id)
+
+	if gorm.IsRecordNotFoundError(err) {
+		resources.Failed(c, http.StatusNotFound, "The provisioning job could not be found.")
+		return
+	}
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, resources.NewTenantProvisioningJobResponse(*job))
+}
+
+// @Summary Lists tenants a page at a time, filtered by sub domain, status and isolation strategy.
+// @tags tetants
+// @Router api/v1/tenants [Get]
+func HandleListTenants(c *gin.Context) {
+
+	var json resources.ListTenantsRequest
+
+	if err := c.ShouldBindQuery(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Incorrect filters supplied, please try again.")
+		return
+	}
+
+	json.Normalize()
+
+	found, total, err := services.ListTenants(services.TenantListOptions{
+		Search:         json.Search,
+		Status:         json.Status,
+		Strategy:       json.Strategy,
+		IncludeDeleted: json.IncludeDeleted,
+		Page:           json.Page,
+		PageSize:       json.PageSize,
+	})
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	items := make([]resources.TenantResponse, 0, len(found))
+
+	for _, tenant := range found {
+		items = append(items, resources.NewTenantResponse(tenant))
+	}
+
+	resources.Succeeded(c, resources.PaginatedResponse{
+		Items:    items,
+		Total:    total,
+		Page:     json.Page,
+		PageSize: json.PageSize,
+	})
+}
+
+// @Summary Attempts to get an existing tenant by id.
+// @tags tetants
+// @Router api/v1/tenants/{id} [Get]
+func HandleGetTenant(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No tenant ID found, please try again.")
+		return
+	}
+
+	tenant, err := services.GetTenant(id)
+
+	if err != nil {
+		failedTenantLookup(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.NewTenantResponse(*tenant))
+}
+
+// @Summary Suspends a tenant, requests for the tenant are rejected until it is resumed.
+// @tags tetants
+// @Router api/v1/tenants/{id}/suspend [Post]
+func HandleSuspendTenant(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No tenant ID found, please try again.")
+		return
+	}
+
+	var json resources.SuspendTenantRequest
+
+	// The reason is optional so an empty body is fine.
+	_ = c.ShouldBindJSON(&json)
+
+	outcome, err := services.SuspendTenant(id, json.Reason)
+
+	if err != nil {
+		failedTenantLookup(c, err, outcome)
+		return
+	}
+
 	resources.Succeeded(c, outcome)
 }
+
+// @Summary Resumes a suspended tenant.
+// @tags tetants
+// @Router api/v1/tenants/{id}/resume [Post]
+func HandleResumeTenant(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No tenant ID found, please try again.")
+		return
+	}
+
+	outcome, err := services.ResumeTenant(id)
+
+	if err != nil {
+		failedTenantLookup(c, err, outcome)
+		return
+	}
+
+	resources.Succeeded(c, outcome)
+}
+
+// @Summary Renames the sub domain of a tenant, the old sub domain redirects to the new one.
+// @tags tetants
+// @Router api/v1/tenants/{id}/subdomain [Put]
+func HandleRenameTenant(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No tenant ID found, please try again.")
+		return
+	}
+
+	var json resources.RenameTenantRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "No subdomain identifier was found.")
+		return
+	}
+
+	if !helpers.ValidateSubDomain(json.SubDomainIdentifier) {
+		resources.Failed(c, http.StatusBadRequest, "The sub domain identifier may only contain lowercase letters, numbers and hyphens.")
+		return
+	}
+
+	outcome, err := services.RenameTenant(id, json.SubDomainIdentifier)
+
+	if err != nil {
+		failedTenantLookup(c, err, outcome)
+		return
+	}
+
+	resources.Succeeded(c, outcome)
+}
+
+// @Summary Deletes a tenant, its data is dropped once the deletion grace period has passed.
+// @tags tetants
+// @Router api/v1/tenants/{id} [Delete]
+func HandleDeleteTenant(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No tenant ID found, please try again.")
+		return
+	}
+
+	outcome, err := services.DeleteTenant(id)
+
+	if err != nil {
+		failedTenantLookup(c, err, outcome)
+		return
+	}
+
+	resources.Succeeded(c, outcome)
+}
+
+// @Summary Restores a deleted tenant which is still within its deletion grace period.
+// @tags tetants
+// @Router api/v1/tenants/{id}/restore [Post]
+func HandleRestoreTenant(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No tenant ID found, please try again.")
+		return
+	}
+
+	outcome, err := services.RestoreTenant(id)
+
+	if err != nil {
+		failedTenantLookup(c, err, outcome)
+		return
+	}
+
+	resources.Succeeded(c, outcome)
+}
+
+// @Summary Queues another provisioning attempt for a tenant which failed or never finished.
+// @tags tetants
+// @Router api/v1/tenants/{id}/provision [Post]
+func HandleProvisionTenant(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No tenant ID found, please try again.")
+		return
+	}
+
+	job, outcome, err := services.EnqueueTenantReprovisioning(id)
+
+	if err != nil {
+		failedTenantLookup(c, err, outcome)
+		return
+	}
+
+	resources.Accepted(c, resources.NewTenantProvisioningJobResponse(*job))
+}
+
+// @Summary Shows the version a tenant schema is on and which migrations have been applied.
+// @tags tetants
+// @Router api/v1/tenants/{id}/migrations [Get]
+func HandleGetTenantMigrationStatus(c *gin.Context) {
+
+	id, ok := getIdParam(c)
+
+	if !ok {
+		resources.Failed(c, http.StatusBadRequest, "No tenant ID found, please try again.")
+		return
+	}
+
+	current, statuses, err := services.GetTenantMigrationStatus(id)
+
+	if err != nil {
+		failedTenantLookup(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.MigrationStatusResponse{
+		CurrentVersion: current,
+		LatestVersion:  database.TenantMigrations.Latest(),
+		Migrations:     statuses,
+	})
+}
+
+// Responds with a 404 when the tenant does not exist, otherwise a 500.
+func failedTenantLookup(c *gin.Context, err error, message ...string) {
+
+	if gorm.IsRecordNotFoundError(err) {
+		resources.Failed(c, http.StatusNotFound, "The tenant could not be found.")
+		return
+	}
+
+	if err == services.ErrSubDomainInUse {
+		resources.Failed(c, http.StatusConflict, "The sub domain identifier is already in use.")
+		return
+	}
+
+	if err == services.ErrTenantAlreadyProvisioned {
+		resources.Failed(c, http.StatusConflict, "The tenant has already been provisioned.")
+		return
+	}
+
+	if err == services.ErrTenantDeleted {
+		resources.Failed(c, http.StatusConflict, "The tenant has been deleted, restore it first.")
+		return
+	}
+
+	if err == services.ErrTenantBeingProvisioned {
+		resources.Failed(c, http.StatusConflict, "The tenant is being provisioned, try again once it has finished.")
+		return
+	}
+
+	outcome := "Something went wrong while trying to process that, please try again."
+
+	if len(message) > 0 && len(message[0]) > 0 {
+		outcome = message[0]
+	}
+
+	resources.Failed(c, http.StatusInternalServerError, outcome, err.Error())
+}
@@ -0,0 +1,415 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	database "go-multitenancy-boilerplate/database"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+	throttle "go-multitenancy-boilerplate/throttle"
+	tokens "go-multitenancy-boilerplate/tokens"
+)
+
+// @Summary Completes a login with a two-factor code or recovery code.
+// @tags users
+// @Router /api/v1/users/login/2fa [post]
+func HandleTwoFactorLogin(c *gin.Context) {
+
+	var json resources.TwoFactorLoginRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	email, err := services.TwoFactorLoginEmail(tenantActor(c), json.Challenge, db.(*gorm.DB))
+
+	tenantId := c.GetUint("tenantId")
+
+	if !checkTwoFactorAttempt(c, email, err, func(email string) string { return throttle.AccountKey(tenantId, email) }) {
+		return
+	}
+
+	userId, recoveryCodes, err := services.CompleteTwoFactorLogin(tenantActor(c), json.Challenge, json.Code, db.(*gorm.DB))
+
+	if err != nil {
+		failedLoginAttempt(c, err)
+		failedTwoFactor(c, err)
+		return
+	}
+
+	succeededLoginAttempt(c)
+
+	session, err := database.Store.Get(c.Request, "connect.s.id")
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pair, ok := authorizeTenantLogin(c, session, userId)
+
+	if !ok {
+		return
+	}
+
+	resources.Succeeded(c, twoFactorLoginResponse(pair, recoveryCodes))
+}
+
+// @Summary Starts enrolment for a user who has to set up two-factor authentication to log in.
+// @tags users
+// @Router /api/v1/users/login/2fa/setup [post]
+func HandleTwoFactorLoginSetup(c *gin.Context) {
+
+	var json resources.TwoFactorChallengeRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	setup, err := services.BeginTwoFactorLoginSetup(tenantActor(c), json.Challenge, db.(*gorm.DB))
+
+	if err != nil {
+		failedTwoFactor(c, err)
+		return
+	}
+
+	resources.Succeeded(c, setup)
+}
+
+// @Summary Starts two-factor enrolment for the current user, returns the secret and otpauth URI.
+// @tags users
+// @Router /api/v1/users/me/2fa/setup [post]
+func HandleBeginTwoFactorSetup(c *gin.Context) {
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	setup, err := services.BeginTwoFactorSetup(tenantActor(c), c.GetUint("userId"), db.(*gorm.DB))
+
+	if err != nil {
+		failedTwoFactor(c, err)
+		return
+	}
+
+	resources.Succeeded(c, setup)
+}
+
+// @Summary Enables two-factor authentication for the current user with a code from the new secret.
+// @tags users
+// @Router /api/v1/users/me/2fa/confirm [post]
+func HandleConfirmTwoFactorSetup(c *gin.Context) {
+
+	var json resources.TwoFactorCodeRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	if !checkTenantCodeAttempt(c, db.(*gorm.DB)) {
+		return
+	}
+
+	codes, err := services.ConfirmTwoFactorSetup(tenantActor(c), c.GetUint("userId"), json.Code, db.(*gorm.DB))
+
+	if err != nil {
+		failedLoginAttempt(c, err)
+		failedTwoFactor(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Replaces the recovery codes of the current user.
+// @tags users
+// @Router /api/v1/users/me/2fa/recovery-codes [post]
+func HandleRegenerateRecoveryCodes(c *gin.Context) {
+
+	var json resources.TwoFactorCodeRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	if !checkTenantCodeAttempt(c, db.(*gorm.DB)) {
+		return
+	}
+
+	codes, err := services.RegenerateRecoveryCodes(tenantActor(c), c.GetUint("userId"), json.Code, db.(*gorm.DB))
+
+	if err != nil {
+		failedLoginAttempt(c, err)
+		failedTwoFactor(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Disables two-factor authentication for the current user.
+// @tags users
+// @Router /api/v1/users/me/2fa [delete]
+func HandleDisableTwoFactor(c *gin.Context) {
+
+	var json resources.TwoFactorCodeRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	if !checkTenantCodeAttempt(c, db.(*gorm.DB)) {
+		return
+	}
+
+	if err := services.DisableTwoFactor(tenantActor(c), c.GetUint("userId"), json.Code, db.(*gorm.DB)); err != nil {
+		failedLoginAttempt(c, err)
+		failedTwoFactor(c, err)
+		return
+	}
+
+	resources.Succeeded(c, "Two-factor authentication has been disabled.")
+}
+
+// @Summary Completes a master login with a two-factor code or recovery code.
+// @tags master/users
+// @Router /api/v1/master/users/login/2fa [post]
+func HandleMasterTwoFactorLogin(c *gin.Context) {
+
+	var json resources.TwoFactorLoginRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	email, err := services.MasterTwoFactorLoginEmail(json.Challenge)
+
+	if !checkTwoFactorAttempt(c, email, err, throttle.MasterAccountKey) {
+		return
+	}
+
+	userId, recoveryCodes, err := services.CompleteMasterTwoFactorLogin(masterActor(c), json.Challenge, json.Code)
+
+	if err != nil {
+		failedLoginAttempt(c, err)
+		failedTwoFactor(c, err)
+		return
+	}
+
+	succeededLoginAttempt(c)
+
+	session, err := database.Store.Get(c.Request, "connect.s.id")
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	pair, ok := authorizeMasterLogin(c, session, userId)
+
+	if !ok {
+		return
+	}
+
+	resources.Succeeded(c, twoFactorLoginResponse(pair, recoveryCodes))
+}
+
+// @Summary Starts enrolment for a master user who has to set up two-factor authentication to log in.
+// @tags master/users
+// @Router /api/v1/master/users/login/2fa/setup [post]
+func HandleMasterTwoFactorLoginSetup(c *gin.Context) {
+
+	var json resources.TwoFactorChallengeRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	setup, err := services.BeginMasterTwoFactorLoginSetup(masterActor(c), json.Challenge)
+
+	if err != nil {
+		failedTwoFactor(c, err)
+		return
+	}
+
+	resources.Succeeded(c, setup)
+}
+
+// @Summary Starts two-factor enrolment for the current master user, returns the secret and otpauth URI.
+// @tags master/users
+// @Router /api/v1/master/users/me/2fa/setup [post]
+func HandleMasterBeginTwoFactorSetup(c *gin.Context) {
+
+	setup, err := services.BeginMasterTwoFactorSetup(masterActor(c), c.GetUint("userId"))
+
+	if err != nil {
+		failedTwoFactor(c, err)
+		return
+	}
+
+	resources.Succeeded(c, setup)
+}
+
+// @Summary Enables two-factor authentication for the current master user with a code from the new secret.
+// @tags master/users
+// @Router /api/v1/master/users/me/2fa/confirm [post]
+func HandleMasterConfirmTwoFactorSetup(c *gin.Context) {
+
+	var json resources.TwoFactorCodeRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	if !checkMasterCodeAttempt(c) {
+		return
+	}
+
+	codes, err := services.ConfirmMasterTwoFactorSetup(masterActor(c), c.GetUint("userId"), json.Code)
+
+	if err != nil {
+		failedLoginAttempt(c, err)
+		failedTwoFactor(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Replaces the recovery codes of the current master user.
+// @tags master/users
+// @Router /api/v1/master/users/me/2fa/recovery-codes [post]
+func HandleMasterRegenerateRecoveryCodes(c *gin.Context) {
+
+	var json resources.TwoFactorCodeRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	if !checkMasterCodeAttempt(c) {
+		return
+	}
+
+	codes, err := services.RegenerateMasterRecoveryCodes(masterActor(c), c.GetUint("userId"), json.Code)
+
+	if err != nil {
+		failedLoginAttempt(c, err)
+		failedTwoFactor(c, err)
+		return
+	}
+
+	resources.Succeeded(c, resources.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Disables two-factor authentication for the current master user.
+// @tags master/users
+// @Router /api/v1/master/users/me/2fa [delete]
+func HandleMasterDisableTwoFactor(c *gin.Context) {
+
+	var json resources.TwoFactorCodeRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	if !checkMasterCodeAttempt(c) {
+		return
+	}
+
+	if err := services.DisableMasterTwoFactor(masterActor(c), c.GetUint("userId"), json.Code); err != nil {
+		failedLoginAttempt(c, err)
+		failedTwoFactor(c, err)
+		return
+	}
+
+	resources.Succeeded(c, "Two-factor authentication has been disabled.")
+}
+
+// Codes the current user enters to manage their second factor count against the same throttle as their logins,
+// so a session taken over can't be used to guess them. Only a login forgets the failures.
+func checkTenantCodeAttempt(c *gin.Context, connection *gorm.DB) bool {
+
+	email := ""
+	user, err := services.GetUser(c.GetUint("userId"), connection)
+
+	if err == nil {
+		email = user.Email
+	}
+
+	tenantId := c.GetUint("tenantId")
+
+	return checkTwoFactorAttempt(c, email, err, func(email string) string { return throttle.AccountKey(tenantId, email) })
+}
+
+// The master user counterpart of checkTenantCodeAttempt.
+func checkMasterCodeAttempt(c *gin.Context) bool {
+
+	email := ""
+	user, err := services.GetMasterUser(c.GetUint("userId"))
+
+	if err == nil {
+		email = user.Email
+	}
+
+	return checkTwoFactorAttempt(c, email, err, throttle.MasterAccountKey)
+}
+
+func twoFactorLoginResponse(pair *tokens.Pair, recoveryCodes []string) resources.TwoFactorLoginResponse {
+
+	response := resources.TwoFactorLoginResponse{
+		Message:       "You have successfully logged into your account.",
+		RecoveryCodes: recoveryCodes,
+	}
+
+	if pair != nil {
+		response.Tokens = pair
+	}
+
+	return response
+}
+
+// Responds to a failed two-factor operation with a status matching the error.
+func failedTwoFactor(c *gin.Context, err error) {
+
+	switch err {
+	case services.ErrInvalidToken:
+		resources.Failed(c, http.StatusUnauthorized, "The login has expired or too many codes were wrong, please log in again.")
+		return
+	case services.ErrInvalidTwoFactorCode:
+		resources.Failed(c, http.StatusUnauthorized, "The two-factor code is invalid.")
+		return
+	case services.ErrTwoFactorEnabled, services.ErrTwoFactorNotEnabled, services.ErrTwoFactorNotStarted, services.ErrTwoFactorRequired:
+		resources.Failed(c, http.StatusConflict, err.Error())
+		return
+	}
+
+	resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+}
@@ -12,8 +12,11 @@ import (
 	database "go-multitenancy-boilerplate/database"
 	helpers "go-multitenancy-boilerplate/helpers"
 	middlewares "go-multitenancy-boilerplate/middlewares"
+	models "go-multitenancy-boilerplate/models"
 	resources "go-multitenancy-boilerplate/resources/api/v1"
+	ss "go-multitenancy-boilerplate/resources/sessions"
 	services "go-multitenancy-boilerplate/services/v1"
+	tokens "go-multitenancy-boilerplate/tokens"
 )
 
 // Init
@@ -22,21 +25,48 @@ func SetupUserRoutes(router *gin.Engine) {
 	users := router.Group("/api/v1/users")
 
 	// Un-authorize APIs
-	users.Use(middlewares.FindTenancy(database.Connection))
+	users.Use(middlewares.FindTenancy(database.Connection, database.TenantConnections))
 	{
-		users.POST("login", HandleLogin)
+		users.POST("login", ss.HandleLoginAttempt(database.Store), HandleLogin)
+		users.GET("login/oidc", HandleOidcLogin)
+		users.GET("login/oidc/callback", HandleOidcCallback)
+		users.POST("login/2fa", HandleTwoFactorLogin)
+		users.POST("login/2fa/setup", HandleTwoFactorLoginSetup)
+		users.POST("token/refresh", HandleRefreshToken)
+		users.POST("password/forgot", HandleForgotPassword)
+		users.POST("password/reset", HandleResetPassword)
+		users.GET("password/policy", HandleGetPasswordPolicy)
+		users.POST("email/verification", HandleRequestEmailVerification)
+		users.POST("email/verify", HandleVerifyEmail)
 
 		// Authorized APIs
 		users.Use(middlewares.IfAuthorized(database.Store))
 		{
-			users.GET("{id}", HandleGetUserById)
-			users.GET("me", HandleGetCurrentUser)
-
-			users.POST("", HandleCreateUser)
-
-			users.PUT("", HandleUpdateUserDetails)
-
-			users.DELETE("", HandleDeleteUser)
+			// Routes acting on the user themselves, which an API key isn't.
+			self := middlewares.RequireUser()
+
+			users.GET("{id}", middlewares.RequirePermission(models.PermissionUsersRead), HandleGetUserById)
+			users.GET("me", self, HandleGetCurrentUser)
+			users.GET("me/permissions", self, HandleGetCurrentUserPermissions)
+			users.PUT("me", self, HandleUpdateCurrentUser)
+			users.PUT("me/password", self, HandleChangePassword)
+			users.GET("me/sessions", self, HandleListSessions)
+			users.DELETE("me/sessions", self, HandleRevokeOtherSessions)
+			users.DELETE("me/sessions/:id", self, HandleRevokeSession)
+
+			users.POST("me/2fa/setup", self, HandleBeginTwoFactorSetup)
+			users.POST("me/2fa/confirm", self, HandleConfirmTwoFactorSetup)
+			users.POST("me/2fa/recovery-codes", self, HandleRegenerateRecoveryCodes)
+			users.DELETE("me/2fa", self, HandleDisableTwoFactor)
+
+			users.POST("", middlewares.RequirePermission(models.PermissionUsersCreate), HandleCreateUser)
+			users.POST("logout", self, HandleLogout)
+
+			users.PUT("", middlewares.RequirePermission(models.PermissionUsersUpdate), HandleUpdateUserDetails)
+
+			users.DELETE("", middlewares.RequirePermission(models.PermissionUsersDelete), HandleDeleteUser)
+			users.DELETE("sessions", middlewares.RequirePermission(models.PermissionUsersUpdate), HandleForceLogout)
+			users.POST("unlock", middlewares.RequirePermission(models.PermissionUsersUpdate), HandleUnlockUser)
 		}
 	}
 }
@@ -59,35 +89,26 @@ func HandleCreateUser(c *gin.Context) {
 		return
 	}
 
-	// Validate the password being sent.
-	if len(json.Password) <= 7 {
-		resources.Failed(c, http.StatusBadRequest, "The specified password was to short, must be longer than 8 characters.")
-		return
-	}
-
-	// Validate the password contains at least one letter and capital
-	if !helpers.ContainsCapitalLetter(json.Password) {
-		resources.Failed(c, http.StatusBadRequest, "The specified password does not contain a capital letter.")
-		return
-	}
-
-	// Make sure the password contains at least one special character.
-	if !helpers.ContainsSpecialCharacter(json.Password) {
-		resources.Failed(c, http.StatusBadRequest, "The password must contain at least one special character.")
-		return
-	}
-
 	// Get the database object from the connection.
 	db, _ := c.Get("connection")
 
 	// Attempt to create a user.
-	insertedId, err := services.CreateUser(json.Email, json.Password, json.Type, db.(*gorm.DB))
+	insertedId, err := services.CreateUser(tenantActor(c), json.Email, json.Password, json.Type, db.(*gorm.DB))
+
+	if failedPasswordPolicy(c, err) {
+		return
+	}
 
 	if err != nil {
 		resources.Failed(c, http.StatusBadRequest, "Something went wrong while trying to process that, please try again.", err.Error())
 		return
 	}
 
+	// The user exists either way, they can ask for another link if this one doesn't arrive.
+	if err := services.SendEmailVerification(tenantActor(c), insertedId, db.(*gorm.DB)); err != nil {
+		log.Println(err)
+	}
+
 	resources.Succeeded(c, gin.H{
 		"id": insertedId,
 	})
@@ -98,71 +119,238 @@ func HandleCreateUser(c *gin.Context) {
 // @Router /api/users/login [post]
 func HandleLogin(c *gin.Context) {
 
-	var json resources.LoginRequest
+	bindJson, _ := c.Get("bindedJson")
 
-	if err := c.ShouldBindJSON(&json); err != nil {
-		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
-		return
-	}
+	json := bindJson.(resources.LoginRequest)
 
 	if !helpers.ValidateEmail(json.Email) {
 		resources.Failed(c, http.StatusBadRequest, "Email or Password provided are incorrect, please try again.")
 		return
 	}
 
-	// Validate the password being sent.
-	if len(json.Password) <= 7 {
-		resources.Failed(c, http.StatusBadRequest, "The specified password was to short, must be longer than 8 characters.")
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	// Get our session from database.
+	session, exists := c.Get("session")
+
+	if !exists {
+		resources.Failed(c, http.StatusUnprocessableEntity, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	userId, _, err := services.LoginUser(tenantActor(c), json.Email, json.Password, db.(*gorm.DB))
+
+	if err != nil {
+
+		failedLoginAttempt(c, err)
+
+		// Save changes to our session if an error occurred and we need to abort early..
+		if err := database.Store.Save(c.Request, c.Writer, session.(*sessions.Session)); err != nil {
+			fmt.Println("An error occurred while saving the session", err)
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+			return
+		}
+
+		if failedPasswordLoginDisabled(c, err) {
+			return
+		}
+
+		if err == services.ErrEmailNotVerified {
+			resources.Failed(c, http.StatusForbidden, "Please verify your email address before logging in.", "email_not_verified")
+			return
+		}
+
+		if failedPasswordExpired(c, err) {
+			return
+		}
+
+		// Were sending 422 as there is a validation concern.
+		if services.IsInvalidCredentials(err) {
+			resources.Failed(c, http.StatusUnprocessableEntity, "Email or Password provided are incorrect, please try again.")
+			return
+		}
+
+		fmt.Println("An error occurred while logging a user in", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return
+	}
+
+	// Users with two-factor authentication log in once they also entered a code.
+	challenge, err := services.StartTwoFactorLogin(tenantActor(c), userId, db.(*gorm.DB))
+
+	if err != nil || challenge != nil {
+
+		// Save changes to our session.
+		if err := database.Store.Save(c.Request, c.Writer, session.(*sessions.Session)); err != nil {
+			fmt.Println("An error occurred while saving the session", err)
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+			return
+		}
+
+		if err != nil {
+			fmt.Println("An error occurred while starting a two-factor login", err)
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+			return
+		}
+
+		resources.Succeeded(c, resources.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			Challenge:         challenge.Token,
+			EnrolmentRequired: challenge.EnrolmentRequired,
+		})
 		return
 	}
 
-	// Validate the password contains at least one letter and capital
-	if !helpers.ContainsCapitalLetter(json.Password) {
-		resources.Failed(c, http.StatusBadRequest, "The specified password does not contain a capital letter.")
+	// Reset login attempts once the password is right, with a second factor only once its code is.
+	succeededLoginAttempt(c)
+
+	pair, ok := authorizeTenantLogin(c, session.(*sessions.Session), userId)
+
+	if !ok {
 		return
 	}
 
-	// Make sure the password contains at least one special character.
-	if !helpers.ContainsSpecialCharacter(json.Password) {
-		resources.Failed(c, http.StatusBadRequest, "The password must contain at least one special character.")
+	if pair == nil {
+		resources.Succeeded(c, "You have successfully logged into your account.")
 		return
 	}
 
+	resources.Succeeded(c, pair)
+}
+
+// Records the login, authorizes the session for the tenant and issues tokens when they're enabled.
+// Responds itself when something went wrong.
+func authorizeTenantLogin(c *gin.Context, session *sessions.Session, userId uint) (*tokens.Pair, bool) {
+
+	tenantId := c.GetUint("tenantId")
+	tenantIdentifier := c.GetString("tenantIdentifier")
+
 	// Get the database object from the connection.
 	db, _ := c.Get("connection")
 
-	session, exists := c.Get("session")
+	ss.EnsureProfiles(session)
 
-	if !exists {
-		resources.Failed(c, http.StatusUnprocessableEntity, "Something went wrong while trying to process that, please try again.")
+	// Create a copy of the client profile
+	clientProfile := session.Values["client"].(ss.ClientProfile)
+
+	// A login replaces the one it was made from, the request's when it was authorized, otherwise the cookie's.
+	previousId := c.GetUint("sessionId")
+
+	if previousId == 0 {
+		previousId = clientProfile.UserSessionIds[tenantId]
+	}
+
+	sessionId, err := services.StartUserSession(userId, previousId, c.Request.UserAgent(), c.ClientIP(), db.(*gorm.DB))
+
+	if err != nil {
+		fmt.Println("An error occurred while recording a login", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return nil, false
+	}
+
+	// The session is only authorized for the tenant the user logged into.
+	if tokens.SessionsEnabled() {
+		clientProfile.Authorize(tenantId, userId, sessionId)
+	}
+
+	// Set client profile back to values.
+	session.Values["client"] = clientProfile
+
+	// The login moves the session to a new id, so one planted or seen before it is worthless.
+	if !rotateSession(c, session) {
+		return nil, false
+	}
+
+	if !tokens.TokensEnabled() {
+		return nil, true
+	}
+
+	pair, err := services.IssueTenantTokens(userId, sessionId, tenantId, tenantIdentifier, db.(*gorm.DB))
+
+	if err != nil {
+		fmt.Println("An error occurred while issuing tokens", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return nil, false
+	}
+
+	return pair, true
+}
+
+// @Summary Exchanges a refresh token for a new access and refresh token
+// @tags users
+// @Router /api/v1/users/token/refresh [post]
+func HandleRefreshToken(c *gin.Context) {
+
+	if !tokens.TokensEnabled() {
+		resources.Failed(c, http.StatusBadRequest, "Token authentication is not enabled.")
 		return
 	}
 
-	userId, _, err := services.LoginUser(json.Email, json.Password, db.(*gorm.DB))
+	var json resources.RefreshTokenRequest
+
+	if err := c.ShouldBindJSON(&json); err != nil {
+		resources.Failed(c, http.StatusBadRequest, "Missing required fields, please try again.")
+		return
+	}
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	pair, err := services.RefreshTenantTokens(json.RefreshToken, c.GetUint("tenantId"), c.GetString("tenantIdentifier"), db.(*gorm.DB))
 
 	if err != nil {
+		resources.Failed(c, http.StatusUnauthorized, "The refresh token is invalid or has expired.", err.Error())
+		return
+	}
 
-		// Save changes to our session if an error occurred and we need to abort early..
-		if err := database.Store.Save(c.Request, c.Writer, session.(*sessions.Session)); err != nil {
-			fmt.Print(err)
-		}
+	resources.Succeeded(c, pair)
+}
 
-		// Were sending 422 as there is a validation concern.
-		resources.Failed(c, http.StatusUnprocessableEntity, "Something went wrong while trying to process that, please try again.", err.Error())
+// @Summary Logs a user out of the current tenant, sessions for other tenants are kept.
+// @tags users
+// @Router /api/v1/users/logout [post]
+func HandleLogout(c *gin.Context) {
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	// Ends the recorded login, tokens issued for it stop working too.
+	if err := services.EndUserSession(c.GetUint("userId"), c.GetUint("sessionId"), db.(*gorm.DB)); err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	// Get our session from database.
+	session, err := database.Store.Get(c.Request, "connect.s.id")
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Token clients have no cookie session to clear.
+	clientProfile, ok := session.Values["client"].(ss.ClientProfile)
+
+	if !ok {
+		resources.Succeeded(c, "You have successfully logged out of your account.")
 		return
 	}
 
-	// @todo make this into a map so userid's can be multiple.
-	session.(*sessions.Session).Values["userId"] = userId
+	clientProfile.Unauthorize(c.GetUint("tenantId"))
 
-	if err := database.Store.Save(c.Request, c.Writer, session.(*sessions.Session)); err != nil {
-		fmt.Print(err)
+	// Set client profile back to values.
+	session.Values["client"] = clientProfile
+
+	// The logout moves the session to a new id as well.
+	if !rotateSession(c, session) {
+		return
 	}
 
-	resources.Succeeded(c, "You have successfully logged into your account.")
+	resources.Succeeded(c, "You have successfully logged out of your account.")
 }
 
-// @Summary Updates a users details
+// @Summary Updates a users details, users change their own at /api/v1/users/me
 // @tags users
 // @Router /api/users/updateUserDetails [post]
 func HandleUpdateUserDetails(c *gin.Context) {
@@ -176,7 +364,27 @@ func HandleUpdateUserDetails(c *gin.Context) {
 	// Get the database object from the connection.
 	db, _ := c.Get("connection")
 
-	outcome, err := services.UpdateUser(json.Id, json.Email, json.AccountType, json.FirstName, json.LastName, json.PhoneNumber, json.RecoveryEmail, db.(*gorm.DB))
+	// The account type is a privilege, only users who manage roles can change it.
+	if json.AccountType != nil {
+
+		allowed, err := middlewares.HasPermission(c, models.PermissionRolesManage)
+
+		if err != nil {
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+			return
+		}
+
+		if !allowed {
+			resources.Failed(c, http.StatusForbidden, "You do not have permission to do this.", "missing_permission:"+models.PermissionRolesManage)
+			return
+		}
+	}
+
+	outcome, err := services.UpdateUser(tenantActor(c), json.Id, json.Email, json.AccountType, json.FirstName, json.LastName, json.PhoneNumber, json.RecoveryEmail, db.(*gorm.DB))
+
+	if failedRoleNotHeld(c, err) {
+		return
+	}
 
 	if err != nil {
 		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
@@ -201,7 +409,16 @@ func HandleDeleteUser(c *gin.Context) {
 	// Get the database object from the connection.
 	db, _ := c.Get("connection")
 
-	outcome, err := services.DeleteUser(json.Id, db.(*gorm.DB))
+	outcome, err := services.DeleteUser(tenantActor(c), json.Id, db.(*gorm.DB))
+
+	if err == services.ErrLastOwner {
+		resources.Failed(c, http.StatusConflict, "The last owner of a tenant can not be deleted.")
+		return
+	}
+
+	if failedRoleNotHeld(c, err) {
+		return
+	}
 
 	if err != nil {
 		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
@@ -259,3 +476,21 @@ func HandleGetCurrentUser(c *gin.Context) {
 
 	resources.Succeeded(c, outcome)
 }
+
+// @Summary Lists the permissions the currently logged in user has through their roles.
+// @tags users
+// @Router /api/v1/users/me/permissions [get]
+func HandleGetCurrentUserPermissions(c *gin.Context) {
+
+	// Get the database object from the connection.
+	db, _ := c.Get("connection")
+
+	permissions, err := services.GetUserPermissions(c.GetUint("userId"), db.(*gorm.DB))
+
+	if err != nil {
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.", err.Error())
+		return
+	}
+
+	resources.Succeeded(c, permissions)
+}
@@ -4,12 +4,16 @@ import (
 	"encoding/gob"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
-	tenants "go-multitenancy-boilerplate/models/tenants"
-	sessions "go-multitenancy-boilerplate/resources/sessions"
+	helpers "go-multitenancy-boilerplate/helpers"
+	ss "go-multitenancy-boilerplate/resources/sessions"
+	throttle "go-multitenancy-boilerplate/throttle"
 
+	"github.com/gorilla/sessions"
 	"github.com/jinzhu/gorm"
 	_ "github.com/lib/pq"
 	"github.com/wader/gormstore"
@@ -18,6 +22,9 @@ import (
 var Connection *gorm.DB
 var Store *gormstore.Store
 
+// Closed when the database services are stopped to end any background work.
+var quit chan struct{}
+
 func StartDatabaseServices() {
 
 	// Database Connection string
@@ -35,6 +42,9 @@ func StartDatabaseServices() {
 	// Make Master connection available globally.
 	Connection = db
 
+	// Tenant connections are pooled and shared between requests.
+	TenantConnections = NewTenantConnectionManager(TenantPoolOptionsFromEnv())
+
 	// Now Setup store - Tenant Store
 	// Password is passed as byte key method
 	Store = gormstore.NewOptions(db, gormstore.Options{
@@ -42,40 +52,125 @@ func StartDatabaseServices() {
 		SkipCreateTable: false,
 	}, []byte(os.Getenv("sessionsPassword")))
 
+	// Failed logins are counted where every instance sees them, unless configured otherwise.
+	throttle.Setup(db)
+
 	// Register session types for consuming in sessions
-	gob.Register(sessions.HostProfile{})
-	gob.Register(sessions.ClientProfile{})
+	gob.Register(ss.HostProfile{})
+	gob.Register(ss.ClientProfile{})
+
+	// Pick up any SQL migrations shipped next to the binary.
+	if err := loadMigrationFiles(); err != nil {
+		fmt.Println(err)
+		log.Panic("failed to load the migration files")
+	}
 
 	// Always attempt to migrate changes to the master tenant schema
 	if err := MigrateMasterTenantDatabase(); err != nil {
-		fmt.Print("There was an error while trying to migrate the tenant tables..")
+		fmt.Println("There was an error while trying to migrate the master tables..", err)
 		os.Exit(1)
 	}
 
-	// attempt to migrate any tenant table changes to all clients.
-	AutoMigrateTenantTableChanges()
+}
+
+// Starts the background work the server relies on, command line tools only need StartDatabaseServices.
+func StartBackgroundServices() {
+
+	// Tenants still marked running whose lock has expired were cut off when a server stopped mid-migration.
+	if err := ResetStaleTenantMigrations(); err != nil {
+		fmt.Println("An error occurred while resetting interrupted tenant migrations", err)
+	}
+
+	// attempt to migrate any tenant table changes to all clients in the background,
+	// tenants are unavailable until their schema is current.
+	if os.Getenv("AUTO_MIGRATE_TENANTS") != "false" {
+		go autoMigrateTenantTableChanges()
+	}
 
 	// Makes quit Available
-	quit := make(chan struct{})
+	quit = make(chan struct{})
 
 	// Every hour remove dead sessions.
 	go Store.PeriodicCleanup(1*time.Hour, quit)
+
+	// Every hour forget failed logins which no longer lock anything.
+	go throttle.Default().PeriodicCleanup(1*time.Hour, quit)
+
+	// Every minute close tenant pools which have not been used in a while.
+	go TenantConnections.PeriodicEviction(1*time.Minute, quit)
 }
 
-// Simply migrates all of the tenant tables
-func AutoMigrateTenantTableChanges() {
+// Stops background work and closes every open tenant and master connection.
+func StopDatabaseServices() {
+
+	if quit != nil {
+		close(quit)
+	}
 
-	var TenantInformation []tenants.TenantConnectionInformation
+	TenantConnections.Close()
 
-	Connection.Find(&TenantInformation)
+	if err := Connection.Close(); err != nil {
+		fmt.Println(err)
+	}
+}
 
-	for _, element := range TenantInformation {
+// Removes expired sessions, or every session when all is set which logs everybody out.
+func PurgeSessions(all bool) error {
 
-		conn, _ := element.GetConnection()
+	if !all {
+		Store.Cleanup()
+		return nil
+	}
 
-		if err := MigrateTenantTables(conn); err != nil {
-			fmt.Print("An error occurred while attempting to migrate tenant tables")
-			os.Exit(1)
+	return Connection.Exec("DELETE FROM sessions").Error
+}
+
+// Saves a session under a new id and removes the old one, so an id planted or seen before a login or a change of privileges is worthless after it.
+// The store remembers the row it loaded per request, so the session is saved through a copy of the request which is returned, later saves in the request have to use it.
+func RotateSession(r *http.Request, w http.ResponseWriter, session *sessions.Session) (*http.Request, error) {
+
+	if session.ID != "" {
+		if err := Connection.Exec("DELETE FROM sessions WHERE id = ?", session.ID).Error; err != nil {
+			return r, err
 		}
 	}
+
+	rotated := r.WithContext(r.Context())
+
+	if err := Store.Save(rotated, w, session); err != nil {
+		return r, err
+	}
+
+	return rotated, nil
+}
+
+// Migrates every tenant which is behind the latest tenant migration.
+func autoMigrateTenantTableChanges() {
+
+	report, err := MigrateTenantFleet(NewFleetMigrationRunId(), FleetMigrationOptions{
+		Concurrency: helpers.GetEnvInt("TENANT_MIGRATION_CONCURRENCY", 4),
+		OnlyPending: true,
+	})
+
+	if err != nil {
+		fmt.Println("An error occurred while attempting to migrate tenant tables", err)
+		return
+	}
+
+	fmt.Printf("Tenant migration run %s finished, %d succeeded and %d failed\n", report.RunId, report.Succeeded, report.Failed)
+}
+
+// Adds the SQL migrations found in MIGRATIONS_PATH (default migrations) to the master and tenant sets.
+func loadMigrationFiles() error {
+
+	path := os.Getenv("MIGRATIONS_PATH")
+	if path == "" {
+		path = "migrations"
+	}
+
+	if err := MasterMigrations.LoadSQLDir(filepath.Join(path, "master")); err != nil {
+		return err
+	}
+
+	return TenantMigrations.LoadSQLDir(filepath.Join(path, "tenant"))
 }
@@ -0,0 +1,272 @@
+// Package databasetest provides a database/sql driver for tests which records every statement instead of running it.
+// Queries are answered with the rows a test registered for them, which lets code built on gorm be tested without PostgreSQL.
+package databasetest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jinzhu/gorm"
+)
+
+// The name the driver is registered under with database/sql.
+const DriverName = "databasetest"
+
+// A statement sent to the database. Transactions are recorded as BEGIN, COMMIT and ROLLBACK.
+type Statement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// What a statement containing a fragment is answered with.
+type Response struct {
+	Columns []string
+	Rows    [][]driver.Value
+	// Reported for statements which don't return rows.
+	RowsAffected int64
+	// Fails the statement instead.
+	Err error
+}
+
+type rule struct {
+	fragment string
+	response Response
+	times    int // Zero answers every matching statement.
+}
+
+// Records the statements sent through one database and answers them.
+type Recorder struct {
+	lock       sync.Mutex
+	statements []Statement
+	rules      []*rule
+	insertId   int64
+}
+
+var (
+	registerOnce sync.Once
+	recorders    sync.Map
+	opened       int64
+)
+
+// Opens a gorm connection using the postgres dialect whose statements are recorded by the returned recorder.
+func Open() (*gorm.DB, *Recorder) {
+
+	registerOnce.Do(func() {
+		sql.Register(DriverName, recordingDriver{})
+	})
+
+	recorder := &Recorder{}
+	name := fmt.Sprintf("recorder-%d", atomic.AddInt64(&opened, 1))
+	recorders.Store(name, recorder)
+
+	sqlDB, err := sql.Open(DriverName, name)
+
+	if err != nil {
+		panic(err)
+	}
+
+	db, err := gorm.Open("postgres", sqlDB)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Registering callbacks is logged, which only clutters the test output.
+	db.SetLogger(gorm.Logger{LogWriter: log.New(ioutil.Discard, "", 0)})
+
+	return db, recorder
+}
+
+// Answers every statement containing the fragment with the response, later calls take precedence.
+// Statements nobody answers return no rows and affect a single row, inserts returning their id get a new one.
+func (r *Recorder) On(fragment string, response Response) {
+	r.OnTimes(fragment, 0, response)
+}
+
+// Answers the next times statements containing the fragment with the response.
+func (r *Recorder) OnTimes(fragment string, times int, response Response) {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.rules = append([]*rule{{fragment: fragment, response: response, times: times}}, r.rules...)
+}
+
+// The statements recorded so far, oldest first.
+func (r *Recorder) Statements() []Statement {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]Statement(nil), r.statements...)
+}
+
+// The statements recorded so far which contain the fragment.
+func (r *Recorder) Matching(fragment string) []Statement {
+
+	var matching []Statement
+
+	for _, statement := range r.Statements() {
+		if strings.Contains(statement.Query, fragment) {
+			matching = append(matching, statement)
+		}
+	}
+
+	return matching
+}
+
+// Forgets the recorded statements, the responses stay.
+func (r *Recorder) Reset() {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.statements = nil
+}
+
+// Records a statement and finds its response.
+func (r *Recorder) respond(query string, args []driver.Value) Response {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.statements = append(r.statements, Statement{Query: query, Args: args})
+
+	for i, rule := range r.rules {
+		if !strings.Contains(query, rule.fragment) {
+			continue
+		}
+
+		if rule.times > 0 {
+			if rule.times--; rule.times == 0 {
+				r.rules = append(r.rules[:i:i], r.rules[i+1:]...)
+			}
+		}
+
+		return rule.response
+	}
+
+	if strings.HasPrefix(query, "INSERT") && strings.Contains(query, "RETURNING") {
+		r.insertId++
+		return Response{Columns: []string{"id"}, Rows: [][]driver.Value{{r.insertId}}}
+	}
+
+	return Response{RowsAffected: 1}
+}
+
+// database/sql plumbing
+//
+
+type recordingDriver struct{}
+
+func (recordingDriver) Open(name string) (driver.Conn, error) {
+
+	recorder, found := recorders.Load(name)
+
+	if !found {
+		return nil, fmt.Errorf("databasetest: unknown recorder %q", name)
+	}
+
+	return &conn{recorder: recorder.(*Recorder)}, nil
+}
+
+type conn struct {
+	recorder *Recorder
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+
+	if response := c.recorder.respond("BEGIN", nil); response.Err != nil {
+		return nil, response.Err
+	}
+
+	return tx{conn: c}, nil
+}
+
+type tx struct {
+	conn *conn
+}
+
+func (t tx) Commit() error {
+	return t.conn.recorder.respond("COMMIT", nil).Err
+}
+
+func (t tx) Rollback() error {
+	return t.conn.recorder.respond("ROLLBACK", nil).Err
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+// Any number of arguments is accepted.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+
+	response := s.conn.recorder.respond(s.query, args)
+
+	if response.Err != nil {
+		return nil, response.Err
+	}
+
+	return driver.RowsAffected(response.RowsAffected), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+
+	response := s.conn.recorder.respond(s.query, args)
+
+	if response.Err != nil {
+		return nil, response.Err
+	}
+
+	return &rows{columns: response.Columns, values: response.Rows}, nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+
+	return nil
+}
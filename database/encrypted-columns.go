@@ -0,0 +1,184 @@
+package database
+
+import (
+	tenants "go-multitenancy-boilerplate/models/tenants"
+	secrets "go-multitenancy-boilerplate/secrets"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// The encrypted columns of the master database, as table, primary key and column.
+var masterEncryptedColumns = [][3]string{
+	{"master_users", "id", "two_factor_secret"},
+	{"tenant_oidc_configs", "tenant_id", "client_secret"},
+}
+
+// The encrypted columns of every tenant schema.
+var tenantEncryptedColumns = [][3]string{
+	{"users", "id", "two_factor_secret"},
+}
+
+// A value of an encrypted column.
+type encryptedValue struct {
+	ID    uint
+	Value string
+}
+
+// Encrypts every value of the column which isn't encrypted with the active key yet, returns how many were.
+// Columns without such values need no keys, so installs which never stored one don't have to configure them.
+func EncryptColumn(tx *gorm.DB, table string, key string, column string) (int, error) {
+
+	var values []encryptedValue
+
+	if err := tx.Table(table).Select(key + " AS id, " + column + " AS value").Where(column + " <> ''").Scan(&values).Error; err != nil {
+		return 0, err
+	}
+
+	var ring *secrets.KeyRing
+	encrypted := 0
+
+	for _, value := range values {
+
+		if ring == nil {
+			var err error
+			if ring, err = secrets.DefaultKeyRing(); err != nil {
+				return encrypted, err
+			}
+		}
+
+		if !ring.NeedsReencrypt(value.Value) {
+			continue
+		}
+
+		plaintext, err := ring.Decrypt(value.Value)
+
+		if err != nil {
+			return encrypted, err
+		}
+
+		ciphertext, err := ring.Encrypt(plaintext)
+
+		if err != nil {
+			return encrypted, err
+		}
+
+		// Only replaced when nobody changed it in the meantime.
+		if err := tx.Table(table).Where(key+" = ? AND "+column+" = ?", value.ID, value.Value).UpdateColumn(column, ciphertext).Error; err != nil {
+			return encrypted, err
+		}
+
+		encrypted++
+	}
+
+	return encrypted, nil
+}
+
+// Stores every value of the column in plain text again, for rolling back the migration which encrypted it.
+func DecryptColumn(tx *gorm.DB, table string, key string, column string) error {
+
+	var values []encryptedValue
+
+	if err := tx.Table(table).Select(key + " AS id, " + column + " AS value").Where(column + " LIKE 'enc:%'").Scan(&values).Error; err != nil {
+		return err
+	}
+
+	for _, value := range values {
+
+		plaintext, err := secrets.Decrypt(value.Value)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Table(table).Where(key+" = ?", value.ID).UpdateColumn(column, plaintext).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Encrypts the values of a column as a migration.
+func encryptColumnMigration(table string, key string, column string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		_, err := EncryptColumn(tx, table, key, column)
+		return err
+	}
+}
+
+// Decrypts the values of a column as the down migration of encryptColumnMigration.
+func decryptColumnMigration(table string, key string, column string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return DecryptColumn(tx, table, key, column)
+	}
+}
+
+// Encrypts every encrypted column of the master database and every tenant with the active key,
+// run after making a new key active so the old one can be removed. Returns how many values were encrypted.
+func ReencryptSecrets() (int, error) {
+
+	total := 0
+
+	for _, column := range masterEncryptedColumns {
+
+		encrypted, err := EncryptColumn(Connection, column[0], column[1], column[2])
+		total += encrypted
+
+		if err != nil {
+			return total, err
+		}
+	}
+
+	var found []tenants.TenantConnectionInformation
+
+	if err := Connection.Where("provisioning_status = ?", tenants.ProvisioningReady).Order("id").Find(&found).Error; err != nil {
+		return total, err
+	}
+
+	// Tenants sharing tables are encrypted once for all of them.
+	done := make(map[string]bool)
+
+	for _, tenant := range found {
+
+		if done[tenant.ConnectionString] {
+			continue
+		}
+
+		done[tenant.ConnectionString] = true
+
+		encrypted, err := reencryptTenantSecrets(tenant)
+		total += encrypted
+
+		if err != nil {
+			return total, errors.Wrap(err, "tenant "+tenant.TenantSubDomainIdentifier)
+		}
+	}
+
+	return total, nil
+}
+
+func reencryptTenantSecrets(tenant tenants.TenantConnectionInformation) (int, error) {
+
+	conn, release, err := TenantConnections.Acquire(tenant)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer release()
+
+	total := 0
+
+	for _, column := range tenantEncryptedColumns {
+
+		encrypted, err := EncryptColumn(conn, column[0], column[1], column[2])
+		total += encrypted
+
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
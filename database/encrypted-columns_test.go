@@ -0,0 +1,52 @@
+package database
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	databasetest "go-multitenancy-boilerplate/database/databasetest"
+	secrets "go-multitenancy-boilerplate/secrets"
+)
+
+func TestMain(m *testing.M) {
+
+	os.Setenv("ENCRYPTION_KEYS", "2026-10:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+
+	os.Exit(m.Run())
+}
+
+func TestEncryptColumn(t *testing.T) {
+
+	db, recorder := databasetest.Open()
+
+	current, err := secrets.Encrypt("KRSXG5CTMVRXEZLU")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.On("AS value", databasetest.Response{Columns: []string{"id", "value"}, Rows: [][]driver.Value{
+		{int64(1), "JBSWY3DPEHPK3PXP"},
+		{int64(2), current},
+	}})
+
+	encrypted, err := EncryptColumn(db, "users", "id", "two_factor_secret")
+
+	if err != nil || encrypted != 1 {
+		t.Fatalf("expected one secret to be encrypted, got %d, %v", encrypted, err)
+	}
+
+	update := statement(t, recorder, "UPDATE")
+
+	if !strings.Contains(update.Query, "id = $") || update.Args[1] != int64(1) || update.Args[2] != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected only the plaintext secret to be replaced, got %v", update)
+	}
+
+	if value, _ := update.Args[0].(string); !secrets.IsEncrypted(value) {
+		t.Fatalf("expected the secret to be stored encrypted, got %v", update.Args[0])
+	}
+}
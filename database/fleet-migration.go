@@ -0,0 +1,303 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Returned when a fleet migration is requested while another one is still running in this process.
+var ErrFleetMigrationRunning = errors.New("a fleet migration is already running")
+
+// Options for migrating every tenant.
+type FleetMigrationOptions struct {
+	Concurrency int    // Number of tenant schemas migrated at the same time.
+	OnlyFailed  bool   // Only retry tenants whose last migration failed.
+	OnlyPending bool   // Only migrate tenants which are behind the latest tenant migration.
+	TenantIds   []uint // Limit the run to these tenants, empty means every tenant.
+}
+
+// Summary of a fleet migration run, the per tenant results are stored in the master database.
+type FleetMigrationReport struct {
+	RunId     string
+	Succeeded int
+	Failed    int
+}
+
+// Guards against two fleet migrations running at once in this process.
+var fleetMigrationRunning int32
+
+// Whether a fleet migration is running in this process.
+func IsFleetMigrationRunning() bool {
+	return atomic.LoadInt32(&fleetMigrationRunning) == 1
+}
+
+// Creates an identifier for a fleet migration run.
+func NewFleetMigrationRunId() string {
+	return time.Now().UTC().Format("20060102T150405.000000000")
+}
+
+// Migrates every ready tenant with bounded concurrency. A failing tenant never stops the run,
+// its failure is recorded against the tenant so it can be retried with OnlyFailed.
+func MigrateTenantFleet(runId string, options FleetMigrationOptions) (FleetMigrationReport, error) {
+
+	if !atomic.CompareAndSwapInt32(&fleetMigrationRunning, 0, 1) {
+		return FleetMigrationReport{RunId: runId}, ErrFleetMigrationRunning
+	}
+
+	defer atomic.StoreInt32(&fleetMigrationRunning, 0)
+
+	return migrateTenantFleet(runId, options)
+}
+
+// Starts migrating every ready tenant in the background, returns the run id once the run is sure to go ahead.
+// done is called with the report when the run finishes.
+func StartTenantFleetMigration(options FleetMigrationOptions, done func(FleetMigrationReport, error)) (string, error) {
+
+	// Claimed before returning, so two requests can't both be told their run started.
+	if !atomic.CompareAndSwapInt32(&fleetMigrationRunning, 0, 1) {
+		return "", ErrFleetMigrationRunning
+	}
+
+	runId := NewFleetMigrationRunId()
+
+	go func() {
+
+		defer atomic.StoreInt32(&fleetMigrationRunning, 0)
+
+		done(migrateTenantFleet(runId, options))
+	}()
+
+	return runId, nil
+}
+
+// Marks tenants left running by a process which stopped mid-migration as failed, so OnlyFailed retries them.
+// Tenants another replica is still migrating keep extending their lock and are left alone.
+func ResetStaleTenantMigrations() error {
+	return Connection.Model(&tenants.TenantConnectionInformation{}).
+		Where("migration_status = ? AND (migration_locked_until IS NULL OR migration_locked_until < ?)", tenants.MigrationRunning, time.Now().UTC()).
+		Updates(map[string]interface{}{
+			"migration_status":       tenants.MigrationFailed,
+			"migration_locked_until": nil,
+		}).Error
+}
+
+// How long a tenant migration may go without extending its lock before it is assumed to have been cut off.
+func tenantMigrationLease() time.Duration {
+	return helpers.GetEnvDuration("TENANT_MIGRATION_LEASE", 5*time.Minute)
+}
+
+// Keeps the tenants locked for as long as their migration is running.
+func extendTenantMigrationLock(ids []uint, done <-chan struct{}) {
+
+	lease := tenantMigrationLease()
+
+	t := time.NewTicker(lease / 3)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			setTenantMigrationState(ids, map[string]interface{}{"migration_locked_until": time.Now().UTC().Add(lease)})
+		case <-done:
+			return
+		}
+	}
+}
+
+func migrateTenantFleet(runId string, options FleetMigrationOptions) (FleetMigrationReport, error) {
+
+	report := FleetMigrationReport{RunId: runId}
+
+	var found []tenants.TenantConnectionInformation
+
+	query := Connection.Where("provisioning_status = ?", tenants.ProvisioningReady)
+
+	if options.OnlyFailed {
+		query = query.Where("migration_status = ?", tenants.MigrationFailed)
+	}
+
+	if options.OnlyPending {
+		query = query.Where("schema_version < ?", TenantMigrations.Latest())
+	}
+
+	if len(options.TenantIds) > 0 {
+		query = query.Where("id IN (?)", options.TenantIds)
+	}
+
+	if err := query.Order("id").Find(&found).Error; err != nil {
+		return report, err
+	}
+
+	// Tenants sharing tables share a schema, so it is only migrated once for all of them.
+	var groups [][]tenants.TenantConnectionInformation
+	groupIndex := make(map[string]int)
+
+	for _, tenant := range found {
+		if i, ok := groupIndex[tenant.ConnectionString]; ok {
+			groups[i] = append(groups[i], tenant)
+			continue
+		}
+		groupIndex[tenant.ConnectionString] = len(groups)
+		groups = append(groups, []tenants.TenantConnectionInformation{tenant})
+	}
+
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	work := make(chan []tenants.TenantConnectionInformation)
+
+	var mu sync.Mutex
+	var workers sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for group := range work {
+
+				err := migrateTenantGroup(runId, group)
+
+				mu.Lock()
+				if err != nil {
+					report.Failed += len(group)
+				} else {
+					report.Succeeded += len(group)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, group := range groups {
+		work <- group
+	}
+
+	close(work)
+	workers.Wait()
+
+	return report, nil
+}
+
+// Migrates a single tenant and records the outcome against it.
+func MigrateTenant(runId string, tenant tenants.TenantConnectionInformation) error {
+	return migrateTenantGroup(runId, []tenants.TenantConnectionInformation{tenant})
+}
+
+// Migrates the schema shared by a group of tenants and records the outcome for each of them.
+func migrateTenantGroup(runId string, group []tenants.TenantConnectionInformation) error {
+
+	ids := make([]uint, 0, len(group))
+	for _, tenant := range group {
+		ids = append(ids, tenant.ID)
+	}
+
+	started := time.Now().UTC()
+
+	setTenantMigrationState(ids, map[string]interface{}{
+		"migration_status":       tenants.MigrationRunning,
+		"migration_locked_until": started.Add(tenantMigrationLease()),
+	})
+
+	done := make(chan struct{})
+	go extendTenantMigrationLock(ids, done)
+
+	fromVersion, toVersion, err := migrateTenantSchema(group)
+
+	close(done)
+
+	status := tenants.MigrationSucceeded
+	message := ""
+
+	if err != nil {
+		status = tenants.MigrationFailed
+		message = err.Error()
+		fmt.Println("An error occurred while attempting to migrate tenant tables of", group[0].TenantSubDomainIdentifier, err)
+	}
+
+	setTenantMigrationState(ids, map[string]interface{}{
+		"migration_status":       status,
+		"migration_locked_until": nil,
+		"schema_version":         toVersion,
+	})
+
+	for _, tenant := range group {
+		result := tenants.TenantMigrationResult{
+			RunId:       runId,
+			TenantId:    tenant.ID,
+			FromVersion: fromVersion,
+			ToVersion:   toVersion,
+			Status:      status,
+			Error:       message,
+			StartedAt:   started,
+			FinishedAt:  time.Now().UTC(),
+		}
+
+		if err := Connection.Create(&result).Error; err != nil {
+			fmt.Println("An error occurred while recording the migration result of", tenant.TenantSubDomainIdentifier, err)
+		}
+	}
+
+	return err
+}
+
+// Runs the pending tenant migrations for tenants sharing a schema, returns the versions before and after.
+func migrateTenantSchema(group []tenants.TenantConnectionInformation) (int64, int64, error) {
+
+	tenant := group[0]
+
+	conn, release, err := TenantConnections.Acquire(tenant)
+
+	if err != nil {
+		return tenant.SchemaVersion, tenant.SchemaVersion, err
+	}
+
+	defer release()
+
+	fromVersion, err := TenantSchemaVersion(conn)
+
+	if err != nil {
+		return tenant.SchemaVersion, tenant.SchemaVersion, err
+	}
+
+	// Tenants sharing tables share the schema, it is migrated once but each of them gets its own seeds.
+	var tenantConns []*gorm.DB
+
+	for _, tenant := range group {
+		if tenant.Strategy() == tenants.IsolationShared {
+			tenantConns = append(tenantConns, ScopeToTenant(conn, tenant.TenantId))
+		}
+	}
+
+	migrateErr := MigrateTenantTables(conn, tenantConns...)
+
+	// Partially migrated tenants still record how far they got.
+	toVersion, err := TenantSchemaVersion(conn)
+
+	if err != nil {
+		toVersion = fromVersion
+	}
+
+	return fromVersion, toVersion, migrateErr
+}
+
+func setTenantMigrationState(ids []uint, values map[string]interface{}) {
+
+	if err := Connection.Model(&tenants.TenantConnectionInformation{}).Where("id IN (?)", ids).Updates(values).Error; err != nil {
+		fmt.Println("An error occurred while updating the migration state of tenants", ids, err)
+	}
+}
+
+// Tenants can only serve requests once their schema has every migration this build knows about.
+func IsTenantSchemaCurrent(tenant tenants.TenantConnectionInformation) bool {
+	return tenant.SchemaVersion >= TenantMigrations.Latest()
+}
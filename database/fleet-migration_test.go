@@ -0,0 +1,96 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	databasetest "go-multitenancy-boilerplate/database/databasetest"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Swaps the master connection for a recorder, tenant pools fail to open.
+func useFleetTestDatabase() (*databasetest.Recorder, func()) {
+
+	db, recorder := databasetest.Open()
+
+	connection, connections := Connection, TenantConnections
+
+	Connection = db
+	TenantConnections = NewTenantConnectionManager(TenantPoolOptions{})
+	TenantConnections.connect = func(tenants.TenantConnectionInformation) (*gorm.DB, error) {
+		return nil, errors.New("the tenant database is unavailable")
+	}
+
+	return recorder, func() {
+		Connection, TenantConnections = connection, connections
+	}
+}
+
+func TestResetStaleTenantMigrationsSkipsLockedTenants(t *testing.T) {
+
+	recorder, restore := useFleetTestDatabase()
+	defer restore()
+
+	before := time.Now().UTC()
+
+	if err := ResetStaleTenantMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := recorder.Matching(`UPDATE "tenant_connection_informations"`)
+
+	if len(updates) != 1 {
+		t.Fatalf("expected one update, got %v", recorder.Statements())
+	}
+
+	// Only tenants whose lock expired, or which never had one, are reset.
+	if !strings.Contains(updates[0].Query, "migration_locked_until IS NULL OR migration_locked_until < $") {
+		t.Fatalf("expected the update to skip locked tenants, got %s", updates[0].Query)
+	}
+
+	var expiredBefore time.Time
+
+	for _, arg := range updates[0].Args {
+		if at, ok := arg.(time.Time); ok {
+			expiredBefore = at
+		}
+	}
+
+	if expiredBefore.Before(before) || expiredBefore.After(time.Now().UTC()) {
+		t.Fatalf("expected locks which expired by now to be reset, got %v", updates[0].Args)
+	}
+}
+
+func TestMigrateTenantLocksWhileRunning(t *testing.T) {
+
+	recorder, restore := useFleetTestDatabase()
+	defer restore()
+
+	tenant := tenants.TenantConnectionInformation{TenantSubDomainIdentifier: "acme", SchemaVersion: 3}
+	tenant.ID = 2
+
+	if err := MigrateTenant("run", tenant); err == nil {
+		t.Fatal("expected the migration to fail without a tenant database")
+	}
+
+	updates := recorder.Matching(`UPDATE "tenant_connection_informations"`)
+
+	if len(updates) != 2 {
+		t.Fatalf("expected the tenant to be locked and released, got %v", recorder.Statements())
+	}
+
+	// Map updates are sorted by column, migration_locked_until comes first.
+	lockedUntil, ok := updates[0].Args[0].(time.Time)
+
+	if !ok || updates[0].Args[1] != tenants.MigrationRunning || !lockedUntil.After(time.Now().UTC().Add(tenantMigrationLease()-time.Minute)) {
+		t.Fatalf("expected the tenant to be locked for the lease, got %v", updates[0].Args)
+	}
+
+	if updates[1].Args[0] != nil || updates[1].Args[1] != tenants.MigrationFailed {
+		t.Fatalf("expected the lock to be released with the outcome, got %v", updates[1].Args)
+	}
+}
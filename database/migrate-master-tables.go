@@ -1,8 +1,192 @@
 package database
 
 import (
+	"fmt"
+
+	migrations "go-multitenancy-boilerplate/database/migrations"
 	models "go-multitenancy-boilerplate/models"
 	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Versioned migrations of the master database, SQL migrations from migrations/master are added on start.
+var MasterMigrations = migrations.NewSet(
+	migrations.Migration{
+		Version: 1,
+		Name:    "baseline",
+		Up: migrations.AutoMigrate(
+			&tenants.TenantConnectionInformation{},
+			&tenants.TenantSubDomainRedirect{},
+			&tenants.TenantProvisioningJob{},
+			&tenants.TenantSubscriptionInformation{},
+			&tenants.TenantSubscriptionType{},
+			&models.MasterUser{},
+		),
+		Down: migrations.DropTables(
+			&tenants.TenantConnectionInformation{},
+			&tenants.TenantSubDomainRedirect{},
+			&tenants.TenantProvisioningJob{},
+			&tenants.TenantSubscriptionInformation{},
+			&tenants.TenantSubscriptionType{},
+			&models.MasterUser{},
+		),
+	},
+	migrations.Migration{
+		Version: 2,
+		Name:    "tenant_migration_results",
+		Up: migrations.AutoMigrate(
+			&tenants.TenantConnectionInformation{},
+			&tenants.TenantMigrationResult{},
+		),
+		Down: func(tx *gorm.DB) error {
+			if err := migrations.DropTables(&tenants.TenantMigrationResult{})(tx); err != nil {
+				return err
+			}
+			return tx.Model(&tenants.TenantConnectionInformation{}).DropColumn("schema_version").DropColumn("migration_status").Error
+		},
+	},
+	migrations.Migration{
+		Version: 3,
+		Name:    "master_bootstrap",
+		Up:      migrations.AutoMigrate(&models.MasterBootstrap{}),
+		Down:    migrations.DropTables(&models.MasterBootstrap{}),
+	},
+	migrations.Migration{
+		Version: 4,
+		Name:    "audit_events",
+		Up:      migrations.AutoMigrate(&models.AuditEvent{}),
+		Down:    migrations.DropTables(&models.AuditEvent{}),
+	},
+	migrations.Migration{
+		Version: 5,
+		Name:    "master_user_tokens",
+		Up:      migrations.AutoMigrate(&models.MasterUserToken{}),
+		Down:    migrations.DropTables(&models.MasterUserToken{}),
+	},
+	migrations.Migration{
+		Version: 6,
+		Name:    "tenant_settings",
+		Up:      migrations.AutoMigrate(&tenants.TenantSettings{}),
+		Down:    migrations.DropTables(&tenants.TenantSettings{}),
+	},
+	migrations.Migration{
+		Version: 7,
+		Name:    "two_factor",
+		Up:      migrations.AutoMigrate(&models.MasterUser{}, &models.MasterUserToken{}, &models.MasterRecoveryCode{}, &tenants.TenantSettings{}),
+		Down: func(tx *gorm.DB) error {
+			if err := migrations.DropTables(&models.MasterRecoveryCode{})(tx); err != nil {
+				return err
+			}
+			if err := tx.Model(&tenants.TenantSettings{}).DropColumn("require_two_factor_for_admins").Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.MasterUserToken{}).DropColumn("attempts").Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.MasterUser{}).DropColumn("two_factor_secret").DropColumn("two_factor_enabled").DropColumn("two_factor_step").Error
+		},
+	},
+	migrations.Migration{
+		Version: 8,
+		Name:    "password_policy",
+		Up: func(tx *gorm.DB) error {
+			if err := migrations.AutoMigrate(&models.MasterUser{}, &models.MasterPasswordHistory{}, &tenants.TenantSettings{})(tx); err != nil {
+				return err
+			}
+			// Existing passwords start ageing now rather than all expiring at once.
+			return tx.Model(&models.MasterUser{}).Where("password_changed_at IS NULL").UpdateColumn("password_changed_at", gorm.Expr("now()")).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := migrations.DropTables(&models.MasterPasswordHistory{})(tx); err != nil {
+				return err
+			}
+			columns := []string{
+				"password_min_length", "password_require_uppercase", "password_require_lowercase", "password_require_digit",
+				"password_require_special", "password_reject_common", "password_history", "password_max_age_days",
+			}
+			for _, column := range columns {
+				if err := tx.Model(&tenants.TenantSettings{}).DropColumn(column).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&models.MasterUser{}).DropColumn("password_changed_at").Error
+		},
+	},
+	migrations.Migration{
+		Version: 9,
+		Name:    "sessions_valid_from",
+		Up:      migrations.AutoMigrate(&models.MasterUser{}),
+		Down: func(tx *gorm.DB) error {
+			return tx.Model(&models.MasterUser{}).DropColumn("sessions_valid_from").Error
+		},
+	},
+	migrations.Migration{
+		Version: 10,
+		Name:    "master_user_sessions",
+		Up:      migrations.AutoMigrate(&models.MasterUserSession{}),
+		Down:    migrations.DropTables(&models.MasterUserSession{}),
+	},
+	migrations.Migration{
+		Version: 11,
+		Name:    "login_throttles",
+		Up:      migrations.AutoMigrate(&models.LoginThrottle{}),
+		Down:    migrations.DropTables(&models.LoginThrottle{}),
+	},
+	migrations.Migration{
+		Version: 12,
+		Name:    "session_timeouts",
+		Up:      migrations.AutoMigrate(&models.MasterUser{}, &tenants.TenantSettings{}),
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Model(&models.MasterUser{}).DropColumn("privileges_changed_at").Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&tenants.TenantSettings{}).DropColumn("session_idle_timeout_minutes").Error; err != nil {
+				return err
+			}
+			return tx.Model(&tenants.TenantSettings{}).DropColumn("session_absolute_timeout_minutes").Error
+		},
+	},
+	migrations.Migration{
+		Version: 13,
+		Name:    "tenant_api_keys",
+		Up:      migrations.AutoMigrate(&tenants.TenantApiKey{}),
+		Down:    migrations.DropTables(&tenants.TenantApiKey{}),
+	},
+	migrations.Migration{
+		Version: 14,
+		Name:    "tenant_oidc",
+		Up:      migrations.AutoMigrate(&tenants.TenantOidcConfig{}, &tenants.TenantOidcLogin{}),
+		Down:    migrations.DropTables(&tenants.TenantOidcConfig{}, &tenants.TenantOidcLogin{}),
+	},
+	migrations.Migration{
+		Version: 15,
+		Name:    "tenant_migration_locks",
+		Up:      migrations.AutoMigrate(&tenants.TenantConnectionInformation{}),
+		Down: func(tx *gorm.DB) error {
+			return tx.Model(&tenants.TenantConnectionInformation{}).DropColumn("migration_locked_until").Error
+		},
+	},
+	migrations.Migration{
+		Version: 16,
+		Name:    "encrypt_two_factor_secrets",
+		Up:      encryptColumnMigration("master_users", "id", "two_factor_secret"),
+		Down:    decryptColumnMigration("master_users", "id", "two_factor_secret"),
+	},
+	migrations.Migration{
+		Version: 17,
+		Name:    "encrypt_oidc_client_secrets",
+		Up:      encryptColumnMigration("tenant_oidc_configs", "tenant_id", "client_secret"),
+		Down:    decryptColumnMigration("tenant_oidc_configs", "tenant_id", "client_secret"),
+	},
+	migrations.Migration{
+		Version: 18,
+		Name:    "refresh_token_rotation",
+		Up:      migrations.AutoMigrate(&models.MasterUserSession{}),
+		Down: func(tx *gorm.DB) error {
+			return tx.Model(&models.MasterUserSession{}).DropColumn("refresh_token_id").Error
+		},
+	},
 )
 
 /**
@@ -10,21 +194,11 @@ This method uses the base tenant connection set out within init.
 */
 func MigrateMasterTenantDatabase() error {
 
-	if err := Connection.AutoMigrate(&tenants.TenantConnectionInformation{}).Error; err != nil {
-		return err
-	}
-
-	if err := Connection.AutoMigrate(&tenants.TenantSubscriptionInformation{}).Error; err != nil {
-		return err
-	}
-
-	if err := Connection.AutoMigrate(&tenants.TenantSubscriptionType{}).Error; err != nil {
-		return err
-	}
+	applied, err := MasterMigrations.Up(Connection)
 
-	if err := Connection.AutoMigrate(&models.MasterUser{}).Error; err != nil {
-		return err
+	for _, migration := range applied {
+		fmt.Printf("Applied master migration %d %s\n", migration.Version, migration.Name)
 	}
 
-	return nil
+	return err
 }
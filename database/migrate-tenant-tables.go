@@ -3,18 +3,259 @@ package database
 import (
 	"fmt"
 
+	migrations "go-multitenancy-boilerplate/database/migrations"
 	models "go-multitenancy-boilerplate/models"
 
 	"github.com/jinzhu/gorm"
 )
 
-// Attempts to migrate tables using database connection
-func MigrateTenantTables(connection *gorm.DB) error {
+// Every table that lives in a tenant database.
+func tenantModels() []interface{} {
+	return []interface{}{
+		&models.User{},
+		&models.Role{},
+		&models.RolePermission{},
+		&models.UserRole{},
+		&models.AuditEvent{},
+		&models.UserToken{},
+		&models.Invitation{},
+		&models.RecoveryCode{},
+		&models.PasswordHistory{},
+		&models.UserSession{},
+	}
+}
+
+// Versioned migrations of every tenant schema, SQL migrations from migrations/tenant are added on start.
+var TenantMigrations = migrations.NewSet(
+	migrations.Migration{
+		Version: 1,
+		Name:    "baseline",
+		Up:      migrations.AutoMigrate(&models.User{}),
+		Down:    migrations.DropTables(&models.User{}),
+	},
+	migrations.Migration{
+		Version: 2,
+		Name:    "roles",
+		Up:      migrations.AutoMigrate(&models.Role{}, &models.RolePermission{}, &models.UserRole{}),
+		Down:    migrations.DropTables(&models.Role{}, &models.RolePermission{}, &models.UserRole{}),
+	},
+	migrations.Migration{
+		Version: 3,
+		Name:    "audit_events",
+		Up:      migrations.AutoMigrate(&models.AuditEvent{}),
+		Down:    migrations.DropTables(&models.AuditEvent{}),
+	},
+	migrations.Migration{
+		Version: 4,
+		Name:    "user_tokens",
+		Up:      migrations.AutoMigrate(&models.UserToken{}),
+		Down:    migrations.DropTables(&models.UserToken{}),
+	},
+	migrations.Migration{
+		Version: 5,
+		Name:    "invitations_and_email_verification",
+		Up: func(tx *gorm.DB) error {
+			if err := migrations.AutoMigrate(&models.User{}, &models.Invitation{})(tx); err != nil {
+				return err
+			}
+			// Users from before verification existed are trusted, so requiring it locks nobody out.
+			return tx.Model(&models.User{}).UpdateColumns(map[string]interface{}{
+				"email_verified":    true,
+				"email_verified_at": gorm.Expr("created_at"),
+			}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := migrations.DropTables(&models.Invitation{})(tx); err != nil {
+				return err
+			}
+			return tx.Model(&models.User{}).DropColumn("email_verified").DropColumn("email_verified_at").Error
+		},
+	},
+	migrations.Migration{
+		Version: 6,
+		Name:    "two_factor",
+		Up:      migrations.AutoMigrate(&models.User{}, &models.UserToken{}, &models.RecoveryCode{}),
+		Down: func(tx *gorm.DB) error {
+			if err := migrations.DropTables(&models.RecoveryCode{})(tx); err != nil {
+				return err
+			}
+			if err := tx.Model(&models.UserToken{}).DropColumn("attempts").Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.User{}).DropColumn("two_factor_secret").DropColumn("two_factor_enabled").DropColumn("two_factor_step").Error
+		},
+	},
+	migrations.Migration{
+		Version: 7,
+		Name:    "password_policy",
+		Up: func(tx *gorm.DB) error {
+			if err := migrations.AutoMigrate(&models.User{}, &models.PasswordHistory{})(tx); err != nil {
+				return err
+			}
+			// Existing passwords start ageing now rather than all expiring at once.
+			return tx.Model(&models.User{}).Where("password_changed_at IS NULL").UpdateColumn("password_changed_at", gorm.Expr("now()")).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := migrations.DropTables(&models.PasswordHistory{})(tx); err != nil {
+				return err
+			}
+			return tx.Model(&models.User{}).DropColumn("password_changed_at").Error
+		},
+	},
+	migrations.Migration{
+		Version: 8,
+		Name:    "sessions_valid_from",
+		Up:      migrations.AutoMigrate(&models.User{}),
+		Down: func(tx *gorm.DB) error {
+			return tx.Model(&models.User{}).DropColumn("sessions_valid_from").Error
+		},
+	},
+	migrations.Migration{
+		Version: 9,
+		Name:    "user_sessions",
+		Up:      migrations.AutoMigrate(&models.UserSession{}),
+		Down:    migrations.DropTables(&models.UserSession{}),
+	},
+	migrations.Migration{
+		Version: 10,
+		Name:    "privileges_changed_at",
+		Up:      migrations.AutoMigrate(&models.User{}),
+		Down: func(tx *gorm.DB) error {
+			return tx.Model(&models.User{}).DropColumn("privileges_changed_at").Error
+		},
+	},
+	migrations.Migration{
+		Version: 11,
+		Name:    "api_keys_permission",
+		// Nothing to change, the owner role is granted the new permission by SeedTenantTables once migrated.
+		Up: func(tx *gorm.DB) error {
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Where("permission = ?", models.PermissionApiKeysManage).Delete(&models.RolePermission{}).Error
+		},
+	},
+	migrations.Migration{
+		Version: 12,
+		Name:    "oidc_subject",
+		Up:      migrations.AutoMigrate(&models.User{}),
+		Down: func(tx *gorm.DB) error {
+			return tx.Model(&models.User{}).DropColumn("oidc_subject").Error
+		},
+	},
+	migrations.Migration{
+		Version: 13,
+		Name:    "settings_read_permission",
+		// The seeded roles are granted the new permission by SeedTenantTables, custom roles which could
+		// change the settings keep being able to read them.
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec(`INSERT INTO role_permissions (tenant_id, role_id, permission)
+				SELECT tenant_id, role_id, ? FROM role_permissions granted
+				WHERE permission = ? AND NOT EXISTS (
+					SELECT 1 FROM role_permissions existing WHERE existing.role_id = granted.role_id AND existing.permission = ?
+				)`, models.PermissionSettingsRead, models.PermissionSettingsManage, models.PermissionSettingsRead).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Where("permission = ?", models.PermissionSettingsRead).Delete(&models.RolePermission{}).Error
+		},
+	},
+	migrations.Migration{
+		Version: 14,
+		Name:    "encrypt_two_factor_secrets",
+		Up:      encryptColumnMigration("users", "id", "two_factor_secret"),
+		Down:    decryptColumnMigration("users", "id", "two_factor_secret"),
+	},
+	migrations.Migration{
+		Version: 15,
+		Name:    "refresh_token_rotation",
+		Up:      migrations.AutoMigrate(&models.UserSession{}),
+		Down: func(tx *gorm.DB) error {
+			return tx.Model(&models.UserSession{}).DropColumn("refresh_token_id").Error
+		},
+	},
+)
+
+// Attempts to migrate tables using database connection, then seeds the rows every tenant starts with.
+// The migrations run once on the unscoped connection, schema_migrations is shared so a scope would limit
+// their backfills to one tenant. Tenants sharing tables pass their scoped connections to be seeded through.
+func MigrateTenantTables(connection *gorm.DB, tenantConnections ...*gorm.DB) error {
 
 	fmt.Println("Attempting to migrate tables to new database.")
-	if err := connection.AutoMigrate(&models.User{}).Error; err != nil {
+
+	applied, err := TenantMigrations.Up(connection)
+
+	for _, migration := range applied {
+		fmt.Printf("Applied tenant migration %d %s\n", migration.Version, migration.Name)
+	}
+
+	if err != nil {
 		return err
 	}
 
+	if len(tenantConnections) == 0 {
+		return SeedTenantTables(connection)
+	}
+
+	for _, tenantConnection := range tenantConnections {
+		if err := SeedTenantTables(tenantConnection); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// Creates the seeded roles and grants them any permission added since they were created.
+// Safe to run any number of times.
+func SeedTenantTables(connection *gorm.DB) error {
+
+	return connection.Transaction(func(tx *gorm.DB) error {
+
+		for _, name := range []string{models.RoleOwner, models.RoleAdmin, models.RoleMember} {
+
+			var role models.Role
+
+			err := tx.Where("name = ? AND system = ?", name, true).First(&role).Error
+
+			if gorm.IsRecordNotFoundError(err) {
+				role = models.Role{Name: name, System: true}
+				err = tx.Create(&role).Error
+			}
+
+			if err != nil {
+				return err
+			}
+
+			var granted []models.RolePermission
+
+			if err := tx.Where("role_id = ?", role.ID).Find(&granted).Error; err != nil {
+				return err
+			}
+
+			for _, permission := range models.SeedRolePermissions[name] {
+
+				found := false
+				for _, existing := range granted {
+					if existing.Permission == permission {
+						found = true
+					}
+				}
+
+				if found {
+					continue
+				}
+
+				if err := tx.Create(&models.RolePermission{RoleId: role.ID, Permission: permission}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Returns the migration version a tenant schema is on.
+func TenantSchemaVersion(connection *gorm.DB) (int64, error) {
+	return TenantMigrations.CurrentVersion(connection)
+}
@@ -0,0 +1,380 @@
+package migrations
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// A single versioned change to a schema, Down may be nil for migrations that can't be reverted.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// A row of the schema_migrations table, one per applied migration.
+type SchemaMigration struct {
+	Version   int64 `gorm:"primary_key;auto_increment:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// The state of a single migration against a database.
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// An ordered collection of migrations for one kind of schema.
+type Set struct {
+	migrations []Migration
+}
+
+// Creates a set from the given migrations.
+func NewSet(migrations ...Migration) *Set {
+	s := &Set{}
+	s.Add(migrations...)
+	return s
+}
+
+// Adds migrations to the set, a migration replaces any migration with the same version.
+func (s *Set) Add(migrations ...Migration) {
+
+	for _, migration := range migrations {
+
+		replaced := false
+
+		for i := range s.migrations {
+			if s.migrations[i].Version == migration.Version {
+				s.migrations[i] = migration
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			s.migrations = append(s.migrations, migration)
+		}
+	}
+
+	sort.Slice(s.migrations, func(i, j int) bool {
+		return s.migrations[i].Version < s.migrations[j].Version
+	})
+}
+
+// Loads SQL migrations from a directory, files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+// A missing directory is not an error.
+func (s *Set) LoadSQLDir(dir string) error {
+
+	files, err := ioutil.ReadDir(dir)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	found := make(map[int64]*Migration)
+
+	for _, file := range files {
+
+		name := file.Name()
+
+		var direction string
+
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+
+		if err != nil {
+			return errors.Errorf("migration file %s does not start with a version", name)
+		}
+
+		contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+
+		if err != nil {
+			return err
+		}
+
+		migration, ok := found[version]
+
+		if !ok {
+			migration = &Migration{Version: version}
+			if len(parts) > 1 {
+				migration.Name = parts[1]
+			}
+			found[version] = migration
+		}
+
+		if direction == "up" {
+			migration.Up = execSQL(string(contents))
+		} else {
+			migration.Down = execSQL(string(contents))
+		}
+	}
+
+	for _, migration := range found {
+
+		if migration.Up == nil {
+			return errors.Errorf("migration %d has a down file but no up file", migration.Version)
+		}
+
+		s.Add(*migration)
+	}
+
+	return nil
+}
+
+// The version the schema will be on once every migration has been applied.
+func (s *Set) Latest() int64 {
+
+	if len(s.migrations) == 0 {
+		return 0
+	}
+
+	return s.migrations[len(s.migrations)-1].Version
+}
+
+// Applies every pending migration, returns the migrations that were applied.
+func (s *Set) Up(db *gorm.DB) ([]Migration, error) {
+	return s.UpTo(db, s.Latest())
+}
+
+// Applies pending migrations up to and including the given version.
+// Each migration runs in its own transaction together with its schema_migrations row.
+func (s *Set) UpTo(db *gorm.DB, version int64) ([]Migration, error) {
+
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+
+	for _, migration := range s.migrations {
+
+		if migration.Version > version {
+			break
+		}
+
+		ran := false
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+
+			if err := lock(tx); err != nil {
+				return err
+			}
+
+			// Someone else may have applied it while we were waiting for the lock.
+			var count int
+			if err := tx.Model(&SchemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+				return err
+			}
+
+			if count > 0 {
+				return nil
+			}
+
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+
+			ran = true
+
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}).Error
+		})
+
+		if err != nil {
+			return applied, errors.Wrap(err, fmt.Sprintf("migration %d %s", migration.Version, migration.Name))
+		}
+
+		if ran {
+			applied = append(applied, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+// Reverts the most recently applied migrations, returns the migrations that were reverted.
+func (s *Set) Down(db *gorm.DB, steps int) ([]Migration, error) {
+
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+
+	for i := 0; i < steps; i++ {
+
+		var latest SchemaMigration
+
+		if err := db.Order("version desc").First(&latest).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				break
+			}
+			return reverted, err
+		}
+
+		migration, ok := s.find(latest.Version)
+
+		if !ok {
+			return reverted, errors.Errorf("migration %d is applied but unknown to this build", latest.Version)
+		}
+
+		if migration.Down == nil {
+			return reverted, errors.Errorf("migration %d %s can not be reverted", migration.Version, migration.Name)
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+
+			if err := lock(tx); err != nil {
+				return err
+			}
+
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+
+			return tx.Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error
+		})
+
+		if err != nil {
+			return reverted, errors.Wrap(err, fmt.Sprintf("reverting migration %d %s", migration.Version, migration.Name))
+		}
+
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// Returns the highest applied version, 0 when nothing has been applied.
+func (s *Set) CurrentVersion(db *gorm.DB) (int64, error) {
+
+	if !db.HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+
+	var latest SchemaMigration
+
+	if err := db.Order("version desc").First(&latest).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return latest.Version, nil
+}
+
+// Lists every known migration and whether it has been applied.
+func (s *Set) Status(db *gorm.DB) ([]MigrationStatus, error) {
+
+	var rows []SchemaMigration
+
+	if db.HasTable(&SchemaMigration{}) {
+		if err := db.Order("version").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	applied := make(map[int64]SchemaMigration)
+
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+
+	statuses := make([]MigrationStatus, 0, len(s.migrations))
+
+	for _, migration := range s.migrations {
+
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func (s *Set) find(version int64) (Migration, bool) {
+
+	for _, migration := range s.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+
+	return Migration{}, false
+}
+
+func ensureTable(db *gorm.DB) error {
+	return db.AutoMigrate(&SchemaMigration{}).Error
+}
+
+// Serialises migrations of the same schema across processes until the transaction ends.
+func lock(tx *gorm.DB) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext('schema_migrations:' || current_schema()))").Error
+}
+
+func execSQL(sql string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Exec(sql).Error
+	}
+}
+
+// Helper for migrations that create or extend the tables of models.
+func AutoMigrate(models ...interface{}) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, model := range models {
+			if err := tx.AutoMigrate(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Helper for reverting migrations that created tables, the tables are dropped in reverse order.
+func DropTables(models ...interface{}) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for i := len(models) - 1; i >= 0; i-- {
+			if err := tx.DropTableIfExists(models[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,242 @@
+package migrations
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/lib/pq"
+)
+
+// Records the order migrations run in.
+type journal struct {
+	entries []string
+}
+
+func (j *journal) migration(version int64, reversible bool) Migration {
+
+	migration := Migration{
+		Version: version,
+		Name:    fmt.Sprintf("m%d", version),
+		Up: func(tx *gorm.DB) error {
+			j.entries = append(j.entries, fmt.Sprintf("up %d", version))
+			return nil
+		},
+	}
+
+	if reversible {
+		migration.Down = func(tx *gorm.DB) error {
+			j.entries = append(j.entries, fmt.Sprintf("down %d", version))
+			return nil
+		}
+	}
+
+	return migration
+}
+
+func versions(migrations []Migration) []int64 {
+
+	list := []int64{}
+
+	for _, migration := range migrations {
+		list = append(list, migration.Version)
+	}
+
+	return list
+}
+
+func TestSetAdd(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		added    [][]int64 // Versions passed to each call of Add.
+		versions []int64
+	}{
+		{"empty", nil, []int64{}},
+		{"in order", [][]int64{{1, 2, 3}}, []int64{1, 2, 3}},
+		{"out of order", [][]int64{{3, 1, 2}}, []int64{1, 2, 3}},
+		{"over several calls", [][]int64{{2}, {5, 1}, {3}}, []int64{1, 2, 3, 5}},
+		{"same version replaces", [][]int64{{1, 2}, {2}}, []int64{1, 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			set := NewSet()
+			j := &journal{}
+
+			for _, call := range test.added {
+
+				var migrations []Migration
+
+				for _, version := range call {
+					migrations = append(migrations, j.migration(version, true))
+				}
+
+				set.Add(migrations...)
+			}
+
+			if got := versions(set.migrations); !reflect.DeepEqual(got, test.versions) {
+				t.Fatalf("expected versions %v, got %v", test.versions, got)
+			}
+
+			latest := int64(0)
+
+			if len(test.versions) > 0 {
+				latest = test.versions[len(test.versions)-1]
+			}
+
+			if set.Latest() != latest {
+				t.Fatalf("expected latest version %d, got %d", latest, set.Latest())
+			}
+		})
+	}
+}
+
+func TestSetLoadSQLDir(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		files    []string
+		versions []int64
+		fails    bool
+	}{
+		{"up and down", []string{"2_second.up.sql", "2_second.down.sql", "1_first.up.sql"}, []int64{1, 2, 3}, false},
+		{"other files are ignored", []string{"README.md", "1_first.up.sql"}, []int64{1, 3}, false},
+		{"down without up", []string{"4_orphan.down.sql"}, nil, true},
+		{"no version", []string{"first.up.sql"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			dir, err := ioutil.TempDir("", "migrations")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer os.RemoveAll(dir)
+
+			for _, file := range test.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, file), []byte("SELECT 1"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// SQL files are merged with the migrations written in Go.
+			set := NewSet((&journal{}).migration(3, true))
+
+			err = set.LoadSQLDir(dir)
+
+			if test.fails {
+				if err == nil {
+					t.Fatal("expected the directory to be refused")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := versions(set.migrations); !reflect.DeepEqual(got, test.versions) {
+				t.Fatalf("expected versions %v, got %v", test.versions, got)
+			}
+		})
+	}
+}
+
+// Runs migrations against the PostgreSQL database in TEST_CONNECTION_STRING, in a schema of its own dropped by the returned function.
+func testDatabase(t *testing.T) (*gorm.DB, func()) {
+
+	connectionString := os.Getenv("TEST_CONNECTION_STRING")
+
+	if len(connectionString) == 0 {
+		t.Skip("TEST_CONNECTION_STRING is not set")
+	}
+
+	db, err := gorm.Open("postgres", connectionString)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A single connection keeps the search path for every query.
+	db.DB().SetMaxOpenConns(1)
+
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+
+	if err := db.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Exec("SET search_path TO " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return db, func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		db.Close()
+	}
+}
+
+func TestSetUpDown(t *testing.T) {
+
+	db, drop := testDatabase(t)
+	defer drop()
+
+	j := &journal{}
+
+	// Added out of order, run by version.
+	set := NewSet(j.migration(3, true), j.migration(1, false), j.migration(2, true), j.migration(4, true))
+
+	steps := []struct {
+		name    string
+		run     func() ([]Migration, error)
+		entries []string
+		current int64
+		fails   bool
+	}{
+		{"up to", func() ([]Migration, error) { return set.UpTo(db, 2) }, []string{"up 1", "up 2"}, 2, false},
+		{"up", func() ([]Migration, error) { return set.Up(db) }, []string{"up 3", "up 4"}, 4, false},
+		{"up again", func() ([]Migration, error) { return set.Up(db) }, nil, 4, false},
+		{"down", func() ([]Migration, error) { return set.Down(db, 2) }, []string{"down 4", "down 3"}, 2, false},
+		{"down past an irreversible migration", func() ([]Migration, error) { return set.Down(db, 5) }, []string{"down 2"}, 1, true},
+		{"up after down", func() ([]Migration, error) { return set.Up(db) }, []string{"up 2", "up 3", "up 4"}, 4, false},
+	}
+
+	for _, step := range steps {
+
+		j.entries = nil
+
+		ran, err := step.run()
+
+		if step.fails != (err != nil) {
+			t.Fatalf("%s: expected failure to be %v, got %v", step.name, step.fails, err)
+		}
+
+		if !reflect.DeepEqual(j.entries, step.entries) {
+			t.Fatalf("%s: expected %v, got %v", step.name, step.entries, j.entries)
+		}
+
+		if len(ran) != len(step.entries) {
+			t.Fatalf("%s: expected %d migrations to be returned, got %d", step.name, len(step.entries), len(ran))
+		}
+
+		current, err := set.CurrentVersion(db)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if current != step.current {
+			t.Fatalf("%s: expected version %d, got %d", step.name, step.current, current)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package database
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Limits applied to every pooled tenant connection.
+type TenantPoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	MaxTenants      int           // Number of tenant pools kept open at once.
+	IdleTimeout     time.Duration // Pools unused for longer than this are closed.
+}
+
+// A single cached tenant pool.
+type tenantConnection struct {
+	key      string
+	db       *gorm.DB
+	err      error
+	ready    chan struct{} // Closed once the pool has been opened (or failed to open).
+	refs     int
+	lastUsed time.Time
+	evicted  bool
+	element  *list.Element
+}
+
+// Caches one connection pool per tenant and closes the least recently used pools
+// once the number of open tenants or their idle time exceeds the configured limits.
+type TenantConnectionManager struct {
+	mu      sync.Mutex
+	options TenantPoolOptions
+	entries map[string]*tenantConnection
+	lru     *list.List // Front is the most recently used pool.
+	// Opens the pool of a tenant.
+	connect func(tenants.TenantConnectionInformation) (*gorm.DB, error)
+}
+
+// Make the tenant connection registry available globally.
+var TenantConnections *TenantConnectionManager
+
+// Reads the tenant pool limits from the environment.
+func TenantPoolOptionsFromEnv() TenantPoolOptions {
+	return TenantPoolOptions{
+		MaxOpenConns:    helpers.GetEnvInt("TENANT_POOL_MAX_OPEN_CONNS", 10),
+		MaxIdleConns:    helpers.GetEnvInt("TENANT_POOL_MAX_IDLE_CONNS", 2),
+		ConnMaxLifetime: helpers.GetEnvDuration("TENANT_POOL_CONN_MAX_LIFETIME", 30*time.Minute),
+		MaxTenants:      helpers.GetEnvInt("TENANT_POOL_MAX_TENANTS", 100),
+		IdleTimeout:     helpers.GetEnvDuration("TENANT_POOL_IDLE_TIMEOUT", 15*time.Minute),
+	}
+}
+
+// Creates an empty tenant connection registry.
+func NewTenantConnectionManager(options TenantPoolOptions) *TenantConnectionManager {
+	return &TenantConnectionManager{
+		options: options,
+		entries: make(map[string]*tenantConnection),
+		lru:     list.New(),
+		connect: tenants.TenantConnectionInformation.GetConnection,
+	}
+}
+
+// Returns the pooled connection for a tenant, opening it on first use.
+// The returned release function must be called once the caller has finished with the connection,
+// pools are only closed after their last user has released them.
+func (m *TenantConnectionManager) Acquire(info tenants.TenantConnectionInformation) (*gorm.DB, func(), error) {
+
+	key := info.ConnectionString
+
+	m.mu.Lock()
+
+	entry, found := m.entries[key]
+
+	if !found {
+		entry = &tenantConnection{key: key, ready: make(chan struct{})}
+		entry.element = m.lru.PushFront(entry)
+		m.entries[key] = entry
+	}
+
+	entry.refs++
+	entry.lastUsed = time.Now()
+	m.lru.MoveToFront(entry.element)
+
+	m.mu.Unlock()
+
+	// Only the first caller opens the pool, everyone else waits for it.
+	if !found {
+		m.open(entry, info)
+	}
+
+	<-entry.ready
+
+	if entry.err != nil {
+		m.release(entry)
+		return nil, nil, entry.err
+	}
+
+	var once sync.Once
+
+	return entry.db, func() { once.Do(func() { m.release(entry) }) }, nil
+}
+
+// Removes a tenant pool from the registry, it is closed as soon as nobody is using it anymore.
+func (m *TenantConnectionManager) Evict(info tenants.TenantConnectionInformation) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, found := m.entries[info.ConnectionString]; found {
+		m.evictLocked(entry)
+	}
+}
+
+// Closes every idle pool that has not been used within the idle timeout.
+func (m *TenantConnectionManager) EvictIdle() {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := time.Now().Add(-m.options.IdleTimeout)
+
+	for element := m.lru.Back(); element != nil; {
+		entry := element.Value.(*tenantConnection)
+		element = element.Prev()
+
+		if entry.refs == 0 && entry.lastUsed.Before(cutoff) {
+			m.evictLocked(entry)
+		}
+	}
+}
+
+// Runs EvictIdle every interval. Close quit channel to stop.
+func (m *TenantConnectionManager) PeriodicEviction(interval time.Duration, quit <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			m.EvictIdle()
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Closes every tenant pool, used when shutting down.
+// Pools still in use are closed as soon as they are released.
+func (m *TenantConnectionManager) Close() {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, entry := range m.entries {
+		m.evictLocked(entry)
+	}
+}
+
+func (m *TenantConnectionManager) open(entry *tenantConnection, info tenants.TenantConnectionInformation) {
+
+	db, err := m.connect(info)
+
+	if err == nil {
+		db.DB().SetMaxOpenConns(m.options.MaxOpenConns)
+		db.DB().SetMaxIdleConns(m.options.MaxIdleConns)
+		db.DB().SetConnMaxLifetime(m.options.ConnMaxLifetime)
+
+		if info.Strategy() == tenants.IsolationShared {
+			RegisterTenantScopeCallbacks(db)
+		}
+	}
+
+	m.mu.Lock()
+
+	entry.db = db
+	entry.err = err
+
+	// Failed pools are not cached so the next request tries again.
+	if err != nil {
+		m.removeLocked(entry)
+	}
+
+	m.trimLocked()
+
+	m.mu.Unlock()
+
+	close(entry.ready)
+}
+
+func (m *TenantConnectionManager) release(entry *tenantConnection) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.refs--
+	entry.lastUsed = time.Now()
+
+	if entry.evicted && entry.refs == 0 {
+		m.closeLocked(entry)
+	}
+}
+
+// Evicts the least recently used idle pools until we are back under the tenant limit.
+func (m *TenantConnectionManager) trimLocked() {
+
+	if m.options.MaxTenants <= 0 {
+		return
+	}
+
+	for element := m.lru.Back(); element != nil && len(m.entries) > m.options.MaxTenants; {
+		entry := element.Value.(*tenantConnection)
+		element = element.Prev()
+
+		if entry.refs == 0 && entry.db != nil {
+			m.evictLocked(entry)
+		}
+	}
+}
+
+func (m *TenantConnectionManager) evictLocked(entry *tenantConnection) {
+
+	m.removeLocked(entry)
+	entry.evicted = true
+
+	if entry.refs == 0 {
+		m.closeLocked(entry)
+	}
+}
+
+func (m *TenantConnectionManager) removeLocked(entry *tenantConnection) {
+
+	if current, found := m.entries[entry.key]; found && current == entry {
+		delete(m.entries, entry.key)
+		m.lru.Remove(entry.element)
+	}
+}
+
+func (m *TenantConnectionManager) closeLocked(entry *tenantConnection) {
+
+	if entry.db == nil {
+		return
+	}
+
+	if err := entry.db.Close(); err != nil {
+		fmt.Println("An error occurred while closing a tenant connection pool:", err)
+	}
+
+	entry.db = nil
+}
@@ -0,0 +1,273 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	databasetest "go-multitenancy-boilerplate/database/databasetest"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Counts the pools a manager opens, every pool is recorded instead of connecting to PostgreSQL.
+type poolOpener struct {
+	lock   sync.Mutex
+	opened map[string][]*gorm.DB
+	fail   map[string]error
+}
+
+func newTestManager(options TenantPoolOptions) (*TenantConnectionManager, *poolOpener) {
+
+	opener := &poolOpener{opened: make(map[string][]*gorm.DB), fail: make(map[string]error)}
+
+	m := NewTenantConnectionManager(options)
+	m.connect = opener.connect
+
+	return m, opener
+}
+
+func (o *poolOpener) connect(info tenants.TenantConnectionInformation) (*gorm.DB, error) {
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if err := o.fail[info.ConnectionString]; err != nil {
+		return nil, err
+	}
+
+	// Keeps concurrent callers waiting long enough to pile up on the same pool.
+	time.Sleep(10 * time.Millisecond)
+
+	db, _ := databasetest.Open()
+	o.opened[info.ConnectionString] = append(o.opened[info.ConnectionString], db)
+
+	return db, nil
+}
+
+func (o *poolOpener) pools(key string) []*gorm.DB {
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.opened[key]
+}
+
+func tenant(key string) tenants.TenantConnectionInformation {
+	return tenants.TenantConnectionInformation{ConnectionString: key}
+}
+
+func acquire(t *testing.T, m *TenantConnectionManager, key string) (*gorm.DB, func()) {
+
+	db, release, err := m.Acquire(tenant(key))
+
+	if err != nil {
+		t.Fatalf("acquiring %s: %v", key, err)
+	}
+
+	return db, release
+}
+
+func isClosed(db *gorm.DB) bool {
+	return db.DB().Ping() != nil
+}
+
+func TestAcquireSharesOnePool(t *testing.T) {
+
+	m, opener := newTestManager(TenantPoolOptions{MaxTenants: 10})
+
+	var wg sync.WaitGroup
+	dbs := make([]*gorm.DB, 8)
+	releases := make([]func(), 8)
+
+	for i := range dbs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if dbs[i], releases[i], err = m.Acquire(tenant("a")); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	if pools := opener.pools("a"); len(pools) != 1 {
+		t.Fatalf("expected one pool to be opened, got %d", len(pools))
+	}
+
+	for i := range dbs {
+		if dbs[i] != dbs[0] {
+			t.Fatal("expected every caller to get the same pool")
+		}
+
+		releases[i]()
+		// Releasing twice must not release somebody else's reference.
+		releases[i]()
+	}
+
+	if isClosed(dbs[0]) {
+		t.Fatal("expected a released pool to stay open")
+	}
+
+	if again, release := acquire(t, m, "a"); again != dbs[0] {
+		t.Fatal("expected the cached pool to be reused")
+	} else {
+		release()
+	}
+}
+
+func TestAcquireRetriesFailedPools(t *testing.T) {
+
+	m, opener := newTestManager(TenantPoolOptions{MaxTenants: 10})
+
+	opener.fail["a"] = errors.New("connection refused")
+
+	if _, _, err := m.Acquire(tenant("a")); err == nil {
+		t.Fatal("expected the connection error")
+	}
+
+	if _, found := m.entries["a"]; found {
+		t.Fatal("expected a failed pool not to be cached")
+	}
+
+	delete(opener.fail, "a")
+
+	_, release := acquire(t, m, "a")
+	release()
+
+	if pools := opener.pools("a"); len(pools) != 1 {
+		t.Fatalf("expected the pool to be opened on the next attempt, got %d pools", len(pools))
+	}
+}
+
+func TestEvictWaitsForRelease(t *testing.T) {
+
+	m, opener := newTestManager(TenantPoolOptions{MaxTenants: 10})
+
+	db, release := acquire(t, m, "a")
+
+	m.Evict(tenant("a"))
+
+	if isClosed(db) {
+		t.Fatal("expected a pool in use not to be closed")
+	}
+
+	// Requests arriving after the eviction get a new pool.
+	fresh, releaseFresh := acquire(t, m, "a")
+	defer releaseFresh()
+
+	if fresh == db || len(opener.pools("a")) != 2 {
+		t.Fatal("expected a new pool after the eviction")
+	}
+
+	release()
+
+	if !isClosed(db) {
+		t.Fatal("expected the evicted pool to be closed once released")
+	}
+
+	if isClosed(fresh) {
+		t.Fatal("expected the new pool to stay open")
+	}
+
+	// Unknown tenants are ignored.
+	m.Evict(tenant("b"))
+}
+
+func TestEvictIdle(t *testing.T) {
+
+	m, _ := newTestManager(TenantPoolOptions{MaxTenants: 10, IdleTimeout: time.Minute})
+
+	idle, releaseIdle := acquire(t, m, "idle")
+	releaseIdle()
+
+	recent, releaseRecent := acquire(t, m, "recent")
+	releaseRecent()
+
+	busy, releaseBusy := acquire(t, m, "busy")
+	defer releaseBusy()
+
+	m.entries["idle"].lastUsed = time.Now().Add(-2 * time.Minute)
+	m.entries["busy"].lastUsed = time.Now().Add(-2 * time.Minute)
+
+	m.EvictIdle()
+
+	if !isClosed(idle) {
+		t.Fatal("expected the idle pool to be closed")
+	}
+
+	if isClosed(recent) || isClosed(busy) {
+		t.Fatal("expected recently used and busy pools to stay open")
+	}
+
+	if _, found := m.entries["idle"]; found || len(m.entries) != 2 {
+		t.Fatalf("expected only the idle pool to be removed, %d pools left", len(m.entries))
+	}
+}
+
+func TestTrimClosesLeastRecentlyUsed(t *testing.T) {
+
+	m, _ := newTestManager(TenantPoolOptions{MaxTenants: 2})
+
+	a, release := acquire(t, m, "a")
+	release()
+
+	b, release := acquire(t, m, "b")
+	release()
+
+	// Using a again leaves b as the least recently used pool.
+	_, release = acquire(t, m, "a")
+	release()
+
+	c, releaseC := acquire(t, m, "c")
+
+	if !isClosed(b) {
+		t.Fatal("expected the least recently used pool to be closed")
+	}
+
+	if isClosed(a) || isClosed(c) {
+		t.Fatal("expected the recently used pools to stay open")
+	}
+
+	// Pools in use are never closed, the limit is exceeded until they are released.
+	_, releaseA := acquire(t, m, "a")
+	d, releaseD := acquire(t, m, "d")
+
+	if len(m.entries) != 3 || isClosed(a) || isClosed(c) || isClosed(d) {
+		t.Fatalf("expected every pool in use to stay open, %d pools cached", len(m.entries))
+	}
+
+	releaseA()
+	releaseC()
+	releaseD()
+}
+
+func TestCloseWaitsForRelease(t *testing.T) {
+
+	m, _ := newTestManager(TenantPoolOptions{MaxTenants: 10})
+
+	idle, release := acquire(t, m, "idle")
+	release()
+
+	busy, releaseBusy := acquire(t, m, "busy")
+
+	m.Close()
+
+	if !isClosed(idle) || isClosed(busy) {
+		t.Fatal("expected only the idle pool to be closed straight away")
+	}
+
+	releaseBusy()
+
+	if !isClosed(busy) {
+		t.Fatal("expected the busy pool to be closed once released")
+	}
+}
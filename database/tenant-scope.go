@@ -0,0 +1,57 @@
+package database
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// Key the tenant id is stored under on a connection scoped to a single tenant.
+const tenantScopeKey = "multitenancy:tenant_id"
+
+// Returns a connection where every query, create, update and delete on a tenant scoped table
+// is limited to the given tenant. Only the shared table connections have the callbacks registered.
+// Raw SQL (Exec and Raw) is never scoped.
+func ScopeToTenant(db *gorm.DB, tenantId uint) *gorm.DB {
+	return db.Set(tenantScopeKey, tenantId)
+}
+
+// Registers the callbacks that enforce tenant scoping on a shared table connection.
+func RegisterTenantScopeCallbacks(db *gorm.DB) {
+
+	callback := db.Callback()
+
+	callback.Create().Before("gorm:create").Register("multitenancy:set_tenant_id", setTenantIdCallback)
+	callback.Query().Before("gorm:query").Register("multitenancy:scope_query", scopeToTenantCallback)
+	callback.RowQuery().Before("gorm:row_query").Register("multitenancy:scope_row_query", scopeToTenantCallback)
+	callback.Update().Before("gorm:update").Register("multitenancy:scope_update", scopeToTenantCallback)
+	callback.Delete().Before("gorm:delete").Register("multitenancy:scope_delete", scopeToTenantCallback)
+}
+
+// Returns the tenant the scope is limited to, if the table holds tenant scoped rows.
+func scopedTenantId(scope *gorm.Scope) (uint, bool) {
+
+	value, found := scope.Get(tenantScopeKey)
+
+	if !found || !scope.HasColumn("tenant_id") {
+		return 0, false
+	}
+
+	return value.(uint), true
+}
+
+// Stamps the tenant onto newly created rows, whatever the caller set.
+func setTenantIdCallback(scope *gorm.Scope) {
+
+	if tenantId, ok := scopedTenantId(scope); ok {
+		if err := scope.SetColumn("tenant_id", tenantId); err != nil {
+			scope.Err(err)
+		}
+	}
+}
+
+// Adds the tenant condition to select, update and delete statements.
+func scopeToTenantCallback(scope *gorm.Scope) {
+
+	if tenantId, ok := scopedTenantId(scope); ok {
+		scope.Search.Where(scope.QuotedTableName()+".tenant_id = ?", tenantId)
+	}
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	databasetest "go-multitenancy-boilerplate/database/databasetest"
+	models "go-multitenancy-boilerplate/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// A shared table connection scoped to tenant 7, and its recorder.
+func scopedTestConnection() (*gorm.DB, *gorm.DB, *databasetest.Recorder) {
+
+	db, recorder := databasetest.Open()
+
+	RegisterTenantScopeCallbacks(db)
+
+	recorder.On("count(*)", databasetest.Response{Columns: []string{"count"}, Rows: [][]driver.Value{{int64(3)}}})
+
+	return db, ScopeToTenant(db, 7), recorder
+}
+
+// The single statement recorded whose query contains the fragment.
+func statement(t *testing.T, recorder *databasetest.Recorder, fragment string) databasetest.Statement {
+
+	statements := recorder.Matching(fragment)
+
+	if len(statements) != 1 {
+		t.Fatalf("expected one %s statement, got %v", fragment, recorder.Statements())
+	}
+
+	return statements[0]
+}
+
+// Whether the tenant id is among the statement arguments.
+func hasTenantArg(statement databasetest.Statement, tenantId int64) bool {
+
+	for _, arg := range statement.Args {
+		if arg == driver.Value(tenantId) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestScopedCreateStampsTenant(t *testing.T) {
+
+	_, scoped, recorder := scopedTestConnection()
+
+	// Whatever the caller set is overwritten.
+	user := models.User{Email: "someone@example.com", TenantScoped: models.TenantScoped{TenantId: 9}}
+
+	if err := scoped.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	insert := statement(t, recorder, "INSERT")
+
+	if !strings.Contains(insert.Query, `"tenant_id"`) || !hasTenantArg(insert, 7) || hasTenantArg(insert, 9) {
+		t.Fatalf("expected the row to be created for tenant 7, got %s %v", insert.Query, insert.Args)
+	}
+
+	if user.TenantId != 7 {
+		t.Fatalf("expected the model to carry tenant 7, got %d", user.TenantId)
+	}
+}
+
+func TestScopedStatementsFilterTenant(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		run      func(db *gorm.DB) error
+		fragment string
+	}{
+		{"find", func(db *gorm.DB) error {
+			var users []models.User
+			return db.Where("email = ?", "someone@example.com").Find(&users).Error
+		}, "SELECT"},
+		{"first", func(db *gorm.DB) error {
+			var user models.User
+			db.First(&user, 1)
+			return nil
+		}, "SELECT"},
+		{"count", func(db *gorm.DB) error {
+			var count int
+			return db.Model(&models.User{}).Count(&count).Error
+		}, "count(*) FROM"},
+		{"update", func(db *gorm.DB) error {
+			return db.Model(&models.User{}).Where("id = ?", 1).Update("first_name", "Someone").Error
+		}, "UPDATE"},
+		{"save", func(db *gorm.DB) error {
+			return db.Save(&models.User{Model: models.Model{ID: 1}, Email: "someone@example.com"}).Error
+		}, "UPDATE"},
+		{"soft delete", func(db *gorm.DB) error {
+			return db.Where("id = ?", 1).Delete(&models.User{}).Error
+		}, "UPDATE"},
+		{"hard delete", func(db *gorm.DB) error {
+			return db.Unscoped().Where("id = ?", 1).Delete(&models.User{}).Error
+		}, "DELETE"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			db, scoped, recorder := scopedTestConnection()
+
+			if err := test.run(scoped); err != nil {
+				t.Fatal(err)
+			}
+
+			scopedStatement := statement(t, recorder, test.fragment)
+
+			if !strings.Contains(scopedStatement.Query, `"users".tenant_id = $`) || !hasTenantArg(scopedStatement, 7) {
+				t.Fatalf("expected the statement to be limited to tenant 7, got %s %v", scopedStatement.Query, scopedStatement.Args)
+			}
+
+			// The connection itself is not scoped, that is how migrations and the master plane see every tenant.
+			recorder.Reset()
+
+			if err := test.run(db); err != nil {
+				t.Fatal(err)
+			}
+
+			if unscoped := statement(t, recorder, test.fragment); strings.Contains(unscoped.Query, "tenant_id =") {
+				t.Fatalf("expected an unscoped connection to see every tenant, got %s", unscoped.Query)
+			}
+		})
+	}
+}
+
+func TestScopeIgnoresTablesWithoutTenant(t *testing.T) {
+
+	_, scoped, recorder := scopedTestConnection()
+
+	var masters []models.MasterUser
+
+	if err := scoped.Find(&masters).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if query := statement(t, recorder, "SELECT").Query; strings.Contains(query, "tenant_id") {
+		t.Fatalf("expected a table without tenant_id not to be scoped, got %s", query)
+	}
+}
+
+// Raw SQL never reaches the callbacks, callers have to add the tenant condition themselves.
+func TestScopeDoesNotCoverRawSQL(t *testing.T) {
+
+	_, scoped, recorder := scopedTestConnection()
+
+	if err := scoped.Exec("UPDATE users SET first_name = ?", "Someone").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+
+	if err := scoped.Raw("SELECT count(*) FROM users").Row().Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, recorded := range recorder.Statements() {
+		if strings.Contains(recorded.Query, "tenant_id") || hasTenantArg(recorded, 7) {
+			t.Fatalf("expected raw SQL to be sent unchanged, got %s %v", recorded.Query, recorded.Args)
+		}
+	}
+
+	if len(recorder.Statements()) != 2 {
+		t.Fatalf("expected both raw statements to be sent, got %v", recorder.Statements())
+	}
+}
+
+// Connections without the callbacks, such as database and schema tenants, ignore the scope.
+func TestScopeWithoutCallbacks(t *testing.T) {
+
+	db, recorder := databasetest.Open()
+
+	var users []models.User
+
+	if err := ScopeToTenant(db, 7).Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if query := statement(t, recorder, "SELECT").Query; strings.Contains(query, "tenant_id") {
+		t.Fatalf("expected no tenant condition without the callbacks, got %s", query)
+	}
+}
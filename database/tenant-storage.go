@@ -0,0 +1,188 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/pkg/errors"
+)
+
+// Returns the isolation strategy new tenants are created with unless one is requested.
+func DefaultIsolationStrategy() string {
+
+	if strategy := strings.TrimSpace(os.Getenv("TENANT_ISOLATION_STRATEGY")); len(strategy) > 0 {
+		return strategy
+	}
+
+	return tenants.IsolationDatabase
+}
+
+// Builds the connection information for a new tenant using the requested isolation strategy.
+func NewTenantConnectionInformation(subDomainIdentifier string, strategy string) (tenants.TenantConnectionInformation, error) {
+
+	identifier := strings.ToLower(subDomainIdentifier)
+
+	tenant := tenants.TenantConnectionInformation{
+		TenantSubDomainIdentifier: subDomainIdentifier,
+		IsolationStrategy:         strategy,
+	}
+
+	switch strategy {
+	case tenants.IsolationDatabase:
+		databaseName := identifier + os.Getenv("SUFFIX_TENANT_DATABASE_NAME")
+		tenant.ConnectionString = fmt.Sprintf(os.Getenv("CONNECTION_STRING"), databaseName)
+	case tenants.IsolationSchema:
+		// Every pooled connection starts with the tenant schema as its search path.
+		tenant.SchemaName = "tenant_" + strings.Replace(identifier, "-", "_", -1)
+		tenant.ConnectionString = sharedTenantConnectionString() + " search_path=" + tenant.SchemaName
+	case tenants.IsolationShared:
+		// Every shared tenant uses the same pool, rows are told apart by tenant_id.
+		tenant.ConnectionString = sharedTenantConnectionString() + " search_path=public"
+	default:
+		return tenant, errors.New("unknown tenant isolation strategy: " + strategy)
+	}
+
+	return tenant, nil
+}
+
+// Creates the database or schema that will hold the tenant tables.
+// Storage left behind by an earlier failed attempt is reused so provisioning can be retried.
+func CreateTenantStorage(tenant tenants.TenantConnectionInformation) error {
+
+	switch tenant.Strategy() {
+	case tenants.IsolationDatabase:
+		return ensureDatabase(tenantDatabaseName(tenant))
+	case tenants.IsolationSchema:
+		if err := ensureSharedTenantDatabase(); err != nil {
+			return err
+		}
+		return execOnSharedTenantDatabase("CREATE SCHEMA IF NOT EXISTS " + quoteIdentifier(tenant.SchemaName))
+	case tenants.IsolationShared:
+		return ensureSharedTenantDatabase()
+	}
+
+	return errors.New("unknown tenant isolation strategy: " + tenant.Strategy())
+}
+
+// Physically removes every piece of tenant data, this can not be undone.
+func DropTenantStorage(tenant tenants.TenantConnectionInformation) error {
+
+	switch tenant.Strategy() {
+	case tenants.IsolationDatabase:
+		// Nobody should be holding on to the tenant pool while its storage disappears.
+		TenantConnections.Evict(tenant)
+		return dropDatabase(tenantDatabaseName(tenant))
+	case tenants.IsolationSchema:
+		TenantConnections.Evict(tenant)
+		return execOnSharedTenantDatabase("DROP SCHEMA IF EXISTS " + quoteIdentifier(tenant.SchemaName) + " CASCADE")
+	case tenants.IsolationShared:
+		return deleteSharedTenantRows(tenant)
+	}
+
+	return errors.New("unknown tenant isolation strategy: " + tenant.Strategy())
+}
+
+// The database that schema based and shared table tenants live in.
+func sharedTenantDatabaseName() string {
+
+	if name := strings.TrimSpace(os.Getenv("SHARED_TENANT_DATABASE_NAME")); len(name) > 0 {
+		return name
+	}
+
+	return "shared" + os.Getenv("SUFFIX_TENANT_DATABASE_NAME")
+}
+
+func sharedTenantConnectionString() string {
+	return fmt.Sprintf(os.Getenv("CONNECTION_STRING"), sharedTenantDatabaseName())
+}
+
+// Works out the database name of a database per tenant from its connection string.
+func tenantDatabaseName(tenant tenants.TenantConnectionInformation) string {
+
+	for _, part := range strings.Fields(tenant.ConnectionString) {
+		if strings.HasPrefix(part, "dbname=") {
+			return strings.TrimPrefix(part, "dbname=")
+		}
+	}
+
+	return strings.ToLower(tenant.TenantSubDomainIdentifier) + os.Getenv("SUFFIX_TENANT_DATABASE_NAME")
+}
+
+func createDatabase(databaseName string) error {
+	return Connection.Exec("CREATE DATABASE " + quoteIdentifier(databaseName) + " OWNER postgres").Error
+}
+
+func dropDatabase(databaseName string) error {
+
+	// Close any remaining connections, otherwise postgres refuses to drop the database.
+	if err := Connection.Exec("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = ? AND pid <> pg_backend_pid()", databaseName).Error; err != nil {
+		return err
+	}
+
+	return Connection.Exec("DROP DATABASE IF EXISTS " + quoteIdentifier(databaseName)).Error
+}
+
+// Removes the rows a shared table tenant owns from every tenant table.
+func deleteSharedTenantRows(tenant tenants.TenantConnectionInformation) error {
+
+	conn, release, err := TenantConnections.Acquire(tenant)
+
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	scoped := ScopeToTenant(conn, tenant.TenantId).Unscoped()
+
+	for _, model := range tenantModels() {
+		if err := scoped.Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Creates the shared tenant database the first time a tenant needs it.
+func ensureSharedTenantDatabase() error {
+	return ensureDatabase(sharedTenantDatabaseName())
+}
+
+// Creates a database unless it already exists.
+func ensureDatabase(databaseName string) error {
+
+	var count int
+
+	if err := Connection.Raw("SELECT count(*) FROM pg_database WHERE datname = ?", databaseName).Row().Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	return createDatabase(databaseName)
+}
+
+// Runs a statement against the shared tenant database without any tenant search path.
+func execOnSharedTenantDatabase(sql string, values ...interface{}) error {
+
+	conn, release, err := TenantConnections.Acquire(tenants.TenantConnectionInformation{ConnectionString: sharedTenantConnectionString()})
+
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	return conn.Exec(sql, values...).Error
+}
+
+// Quotes a postgres identifier such as a database or schema name.
+func quoteIdentifier(name string) string {
+	return "\"" + strings.Replace(name, "\"", "\"\"", -1) + "\""
+}
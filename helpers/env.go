@@ -0,0 +1,46 @@
+package helpers
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reads an integer environment variable, falling back to the default when unset or malformed.
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// Reads a duration environment variable (e.g. "30m"), falling back to the default when unset or malformed.
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// Reads a boolean environment variable (e.g. "true" or "1"), falling back to the default when unset or malformed.
+func GetEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// Reads a comma separated environment variable, skipping blank entries, nil when unset.
+func GetEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); len(value) > 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,32 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Generates a random url safe token from the given number of random bytes.
+func GenerateToken(size int) (string, error) {
+
+	buffer := make([]byte, size)
+
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+// Hashes a token before it is stored, tokens are random so a plain sha256 is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Compares a token against a stored hash in constant time.
+func CheckTokenHash(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// For local development and tests: logs every message and, when Dir is set, writes it to an .eml file.
+type FileMailer struct {
+	Dir  string
+	From string
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (m *FileMailer) Send(message Message) error {
+
+	m.mu.Lock()
+	m.sent = append(m.sent, message)
+	m.mu.Unlock()
+
+	fmt.Printf("Mail to %s: %s\n%s\n", message.To, message.Subject, message.Body)
+
+	if len(m.Dir) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), sanitize(message.To))
+
+	return ioutil.WriteFile(filepath.Join(m.Dir, name), format(m.From, message), 0600)
+}
+
+// Every message sent so far, oldest first.
+func (m *FileMailer) Sent() []Message {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.sent...)
+}
+
+func sanitize(address string) string {
+
+	safe := []rune(address)
+
+	for i, r := range safe {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '@' || r == '-' || r == '_') {
+			safe[i] = '_'
+		}
+	}
+
+	return string(safe)
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+)
+
+// A plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sends emails, configured with MAIL_DRIVER.
+type Mailer interface {
+	Send(message Message) error
+}
+
+var (
+	defaultMailer Mailer
+	loadMailer    sync.Once
+)
+
+// The mailer configured through the environment, MAIL_DRIVER is smtp, file or log (the default).
+func Default() Mailer {
+
+	loadMailer.Do(func() {
+		defaultMailer = FromEnv()
+	})
+
+	return defaultMailer
+}
+
+// Replaces the default mailer, e.g. with a FileMailer in tests.
+func SetDefault(m Mailer) {
+	loadMailer.Do(func() {})
+	defaultMailer = m
+}
+
+// Builds a mailer from the MAIL_* environment variables.
+func FromEnv() Mailer {
+
+	switch strings.TrimSpace(os.Getenv("MAIL_DRIVER")) {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     os.Getenv("MAIL_SMTP_HOST"),
+			Port:     helpers.GetEnvInt("MAIL_SMTP_PORT", 587),
+			Username: os.Getenv("MAIL_SMTP_USERNAME"),
+			Password: os.Getenv("MAIL_SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	case "file":
+		return &FileMailer{Dir: os.Getenv("MAIL_FILE_DIR"), From: os.Getenv("MAIL_FROM")}
+	}
+
+	return &FileMailer{From: os.Getenv("MAIL_FROM")}
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// Sends emails through an SMTP server, authenticating when a username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(message Message) error {
+
+	var auth smtp.Auth
+
+	if len(m.Username) > 0 {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(fmt.Sprintf("%s:%d", m.Host, m.Port), auth, m.From, []string{message.To}, format(m.From, message))
+}
+
+// Renders a message in RFC 5322 format.
+func format(from string, message Message) []byte {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(message.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(message.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.Replace(message.Body, "\n", "\r\n", -1))
+
+	return []byte(b.String())
+}
+
+// Keeps user supplied values from adding headers of their own.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	commands "go-multitenancy-boilerplate/commands"
 	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
 	routers "go-multitenancy-boilerplate/routers"
+	services "go-multitenancy-boilerplate/services/v1"
+	tokens "go-multitenancy-boilerplate/tokens"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -17,9 +26,47 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
+	// Anything other than serve is a management command, e.g. "tenant create -subdomain acme".
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(commands.Run(os.Args[1:]))
+	}
+
+	// Refuse to start with token authentication but no usable signing keys.
+	if tokens.TokensEnabled() {
+		if _, err := tokens.DefaultKeyRing(); err != nil {
+			log.Fatal("Error loading the token signing keys: ", err)
+		}
+	}
+
 	// Start database services and load master database.
 	database.StartDatabaseServices()
 
+	// Close every tenant pool and the master connection on the way out.
+	defer database.StopDatabaseServices()
+
+	// Create the first master user, or print a setup token, while none exist.
+	if err := services.BootstrapMasterUser(); err != nil {
+		log.Fatal("Error bootstrapping the first master user: ", err)
+	}
+
+	// Migrate tenants, clean up sessions and close idle tenant pools in the background.
+	database.StartBackgroundServices()
+
+	// Background work started by the server, stopped before the database services.
+	quit := make(chan struct{})
+
+	// Every hour drop the data of deleted tenants whose grace period is over.
+	go services.PeriodicTenantPurge(1*time.Hour, quit)
+
+	// Run queued tenant provisioning jobs in the background.
+	workers := services.StartProvisioningWorkers(helpers.GetEnvInt("PROVISIONING_WORKERS", 2), quit)
+
+	// Let running jobs finish before the connections go away.
+	defer func() {
+		close(quit)
+		workers.Wait()
+	}()
+
 	r := routers.SetupRouter()
 
 	port := os.Getenv("PORT")
@@ -27,12 +74,32 @@ func main() {
 		port = "8000" //localhost
 	}
 
-	type Job interface {
-		Run()
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
 	}
 
 	// Starting the router instance
-	if err := r.Run(":" + port); err != nil {
-		fmt.Print(err)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Wait for an interrupt before shutting down gracefully.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErr:
+		fmt.Println("An error occurred while running the server", err)
+		os.Exit(1)
+	case <-signals:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Println("An error occurred while shutting the server down", err)
 	}
 }
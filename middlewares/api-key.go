@@ -0,0 +1,83 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	tenants "go-multitenancy-boilerplate/models/tenants"
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Finds the tenant of the API key sent with the request and places the key into the context.
+// Returns whether the request may go on.
+func findApiKeyTenancy(c *gin.Context, key string, Connection *gorm.DB) (tenants.TenantConnectionInformation, bool) {
+
+	var tenantInfo tenants.TenantConnectionInformation
+
+	apiKey, err := services.AuthenticateApiKey(key, c.ClientIP())
+
+	if err == services.ErrApiKeyInvalid {
+		resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.", "invalid_api_key")
+		return tenantInfo, false
+	}
+
+	if err == services.ErrApiKeyIpNotAllowed {
+		resources.Failed(c, http.StatusForbidden, "This API key can't be used from your IP address.", "ip_not_allowed")
+		return tenantInfo, false
+	}
+
+	if err != nil {
+		fmt.Println("An error occurred while checking the API key", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return tenantInfo, false
+	}
+
+	// Keys of deleted tenants are left behind, they simply stop working.
+	if err := Connection.Where("id = ?", apiKey.TenantId).First(&tenantInfo).Error; err != nil {
+		resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.", "invalid_api_key")
+		return tenantInfo, false
+	}
+
+	c.Set("apiKeyId", apiKey.ID)
+	c.Set("apiKey", apiKey)
+
+	return tenantInfo, true
+}
+
+// Only lets requests through which were made by a logged in user rather than with an API key, runs after IfAuthorized.
+// Used on routes acting on the user themselves, e.g. their profile, password or sessions.
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if c.GetUint("apiKeyId") > 0 || c.GetUint("userId") == 0 {
+			resources.Failed(c, http.StatusForbidden, "API keys can't do this, please log in.", "user_required")
+			return
+		}
+	}
+}
+
+// Whether the request may use a tenant permission, the connection must be in the context.
+// An API key needs the permission as a scope and the user who created it has to still hold it.
+func HasPermission(c *gin.Context, permission string) (bool, error) {
+
+	db := c.MustGet("connection").(*gorm.DB)
+
+	userId := c.GetUint("userId")
+
+	if value, found := c.Get("apiKey"); found {
+
+		apiKey := value.(*tenants.TenantApiKey)
+
+		if !apiKey.HasScope(permission) {
+			return false, nil
+		}
+
+		userId = apiKey.CreatedBy
+	}
+
+	return services.UserHasPermission(userId, permission, db)
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	tokens "go-multitenancy-boilerplate/tokens"
+)
+
+// Returns the token of an "Authorization: Bearer" header when token authentication is enabled.
+func bearerToken(c *gin.Context) (string, bool) {
+
+	if !tokens.TokensEnabled() {
+		return "", false
+	}
+
+	header := c.GetHeader("Authorization")
+
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+
+	return strings.TrimSpace(header[7:]), true
+}
@@ -2,31 +2,88 @@ package middlewares
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wader/gormstore"
 
 	resources "go-multitenancy-boilerplate/resources/api/v1"
 	ss "go-multitenancy-boilerplate/resources/sessions"
+	services "go-multitenancy-boilerplate/services/v1"
+	tokens "go-multitenancy-boilerplate/tokens"
 )
 
 // Checks if a user is logged in with a session to the master dashboard;
 func IfMasterAuthorized(Store *gormstore.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
+		// Token clients send a Bearer token instead of the session cookie.
+		if token, found := bearerToken(c); found {
+
+			claims, err := tokens.Verify(token, tokens.TypeAccess, tokens.AudienceMaster)
+
+			if err != nil {
+				resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.", err.Error())
+				return
+			}
+
+			// Tokens have no id to move, their role is looked up again on refresh.
+			if _, ok := validMasterUserSession(c, claims.UserId, claims.SessionId, time.Unix(claims.IssuedAt, 0)); !ok {
+				return
+			}
+
+			// Pass the user id, the recorded login and the token claims into the handler.
+			c.Set("userId", claims.UserId)
+			c.Set("sessionId", claims.SessionId)
+			c.Set("claims", claims)
+			return
+		}
+
+		if !tokens.SessionsEnabled() {
+			resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
+			return
+		}
+
 		sessionValues, err := Store.Get(c.Request, "connect.s.id")
 		if err != nil {
 			resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
 			return
 		}
 
-		profile := sessionValues.Values["profile"].(ss.HostProfile)
-		if profile.Authorized != 1 {
+		profile, ok := sessionValues.Values["profile"].(ss.HostProfile)
+		if !ok || profile.Authorized != 1 {
 			resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
 			return
 		}
 
-		// Pass the user id into the handler.
+		privilegesChanged, ok := validMasterUserSession(c, profile.UserId, profile.SessionId, profile.AuthorizedTime)
+
+		if !ok {
+			return
+		}
+
+		// The session is authorized again under a new id, so one seen before the change is worthless after it.
+		if privilegesChanged {
+
+			profile.AuthorizedTime = time.Now().UTC()
+			sessionValues.Values["profile"] = profile
+
+			if !rotateSession(c, sessionValues) {
+				return
+			}
+		}
+
+		// Pass the user id and the recorded login into the handler.
 		c.Set("userId", profile.UserId)
+		c.Set("sessionId", profile.SessionId)
 	}
 }
+
+// Rejects sessions and tokens which were revoked, timed out, whose master user was deleted or whose user's sessions were invalidated after they were authorized.
+// Returns whether the user's privileges changed since, and whether the request may go on.
+func validMasterUserSession(c *gin.Context, userId uint, sessionId uint, authorizedAt time.Time) (bool, bool) {
+
+	privilegesChanged, err := services.CheckMasterUserSession(userId, sessionId, authorizedAt)
+
+	return privilegesChanged, checkedSession(c, err)
+}
@@ -0,0 +1,59 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	resources "go-multitenancy-boilerplate/resources/api/v1"
+	services "go-multitenancy-boilerplate/services/v1"
+)
+
+// Only lets tenant users through whose roles grant the permission, and API keys given it as a scope, runs after IfAuthorized.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if _, found := c.Get("connection"); !found {
+			resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
+			return
+		}
+
+		allowed, err := HasPermission(c, permission)
+
+		if err != nil {
+			fmt.Println("An error occurred while checking permission", permission, err)
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+			return
+		}
+
+		if !allowed {
+			resources.Failed(c, http.StatusForbidden, "You do not have permission to do this.", "missing_permission:"+permission)
+			return
+		}
+	}
+}
+
+// Only lets master users through whose account type grants the permission, runs after IfMasterAuthorized.
+func RequireMasterPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		allowed, err := services.MasterUserHasPermission(c.GetUint("userId"), permission)
+
+		if err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
+				return
+			}
+			fmt.Println("An error occurred while checking permission", permission, err)
+			resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+			return
+		}
+
+		if !allowed {
+			resources.Failed(c, http.StatusForbidden, "You do not have permission to do this.", "missing_permission:"+permission)
+			return
+		}
+	}
+}
@@ -1,32 +1,160 @@
 package middlewares
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"github.com/jinzhu/gorm"
 	"github.com/wader/gormstore"
 
+	database "go-multitenancy-boilerplate/database"
 	resources "go-multitenancy-boilerplate/resources/api/v1"
 	ss "go-multitenancy-boilerplate/resources/sessions"
+	services "go-multitenancy-boilerplate/services/v1"
+	tokens "go-multitenancy-boilerplate/tokens"
 )
 
-// Checks if a user is logged in with a session to a tenancy.
+// Checks if a user is logged in to the tenancy found by FindTenancy.
 func IfAuthorized(Store *gormstore.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
+		// Requests made with an API key were authorized by FindTenancy, they act for no session.
+		if c.GetUint("apiKeyId") > 0 {
+			return
+		}
+
+		// Token clients send a Bearer token instead of the session cookie.
+		if token, found := bearerToken(c); found {
+
+			claims, err := tokens.Verify(token, tokens.TypeAccess, tokens.AudienceTenant)
+
+			if err != nil {
+				resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.", err.Error())
+				return
+			}
+
+			// Tokens have no id to move, their role is looked up again on refresh.
+			if _, ok := validUserSession(c, claims.TenantId, claims.UserId, claims.SessionId, time.Unix(claims.IssuedAt, 0)); !ok {
+				return
+			}
+
+			// Pass the user id, the recorded login and the token claims into the handler.
+			c.Set("userId", claims.UserId)
+			c.Set("sessionId", claims.SessionId)
+			c.Set("claims", claims)
+			return
+		}
+
+		if !tokens.SessionsEnabled() {
+			resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
+			return
+		}
+
 		sessionValues, err := Store.Get(c.Request, "connect.s.id")
 		if err != nil {
 			resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
 			return
 		}
 
-		profile := sessionValues.Values["profile"].(ss.HostProfile)
-		if profile.Authorized != 1 {
+		// A session is only ever authorized for the tenants the user logged into.
+		client, ok := sessionValues.Values["client"].(ss.ClientProfile)
+		if !ok {
 			resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
 			return
 		}
 
-		// Pass the user id into the handler.
-		c.Set("userId", profile.UserId)
+		tenantId := c.GetUint("tenantId")
+
+		userId := client.AuthorizedUsers[tenantId]
+		if userId == 0 {
+			resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
+			return
+		}
+
+		sessionId := client.UserSessionIds[tenantId]
+
+		privilegesChanged, ok := validUserSession(c, tenantId, userId, sessionId, client.AuthorizedAt[tenantId])
+
+		if !ok {
+			return
+		}
+
+		// The session is authorized again under a new id, so one seen before the change is worthless after it.
+		if privilegesChanged {
+
+			client.Authorize(tenantId, userId, sessionId)
+			sessionValues.Values["client"] = client
+
+			if !rotateSession(c, sessionValues) {
+				return
+			}
+		}
+
+		// Pass the user id and the recorded login into the handler.
+		c.Set("userId", userId)
+		c.Set("sessionId", sessionId)
+	}
+}
+
+// Rejects sessions and tokens which were revoked, timed out, whose user was deleted or whose user's sessions were invalidated after they were authorized.
+// Returns whether the user's privileges changed since, and whether the request may go on.
+func validUserSession(c *gin.Context, tenantId uint, userId uint, sessionId uint, authorizedAt time.Time) (bool, bool) {
+
+	// Sessions and tokens only ever work against the tenant they were authorized for.
+	if tenantId == 0 || tenantId != c.GetUint("tenantId") {
+		resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
+		return false, false
+	}
+
+	db, found := c.Get("connection")
+
+	if !found {
+		resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.")
+		return false, false
+	}
+
+	privilegesChanged, err := services.CheckUserSession(tenantId, userId, sessionId, authorizedAt, db.(*gorm.DB))
+
+	return privilegesChanged, checkedSession(c, err)
+}
+
+// Responds to a failed session check, returns whether the session is valid.
+func checkedSession(c *gin.Context, err error) bool {
+
+	if err == services.ErrSessionInvalidated {
+		resources.Failed(c, http.StatusUnauthorized, "You are not authorized to view this.", "session_invalidated")
+		return false
+	}
+
+	if err == services.ErrSessionExpired {
+		resources.Failed(c, http.StatusUnauthorized, "Your session has expired, please log in again.", "session_expired")
+		return false
 	}
+
+	if err != nil {
+		fmt.Println("An error occurred while checking the session", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return false
+	}
+
+	return true
+}
+
+// Moves a cookie session to a new id, the handler gets the request the store knows the new id for.
+func rotateSession(c *gin.Context, session *sessions.Session) bool {
+
+	request, err := database.RotateSession(c.Request, c.Writer, session)
+
+	if err != nil {
+		fmt.Println("An error occurred while rotating the session", err)
+		resources.Failed(c, http.StatusInternalServerError, "Something went wrong while trying to process that, please try again.")
+		return false
+	}
+
+	c.Request = request
+
+	return true
 }
@@ -1,15 +1,20 @@
 package middlewares
 
 import (
+	"bytes"
+	encoding "encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strings"
 
+	database "go-multitenancy-boilerplate/database"
 	tenants "go-multitenancy-boilerplate/models/tenants"
 	resources "go-multitenancy-boilerplate/resources/api/v1"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/jinzhu/gorm"
 )
 
@@ -17,84 +22,189 @@ type tenantIdentifierParams struct {
 	TenancyIdentifier string `form:"tenant" json:"tenant"`
 }
 
-func FindTenancy(Connection *gorm.DB) gin.HandlerFunc {
+// Resolves the tenant for the request and places its pooled connection into the context.
+func FindTenancy(Connection *gorm.DB, Tenants *database.TenantConnectionManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		var json tenantIdentifierParams
+		// Integrations send an API key instead, the key alone names the tenant.
+		if key := c.GetHeader("X-API-Key"); len(key) > 0 {
 
-		// Try and find an incoming tenancy identifier on the request
-		if err := c.Bind(&json); err == nil && len(json.TenancyIdentifier) > 0 {
-
-			var tenantInfo tenants.TenantConnectionInformation
+			tenantInfo, ok := findApiKeyTenancy(c, key, Connection)
 
-			if err := Connection.Where(&tenants.TenantConnectionInformation{TenantSubDomainIdentifier: json.TenancyIdentifier}).First(&tenantInfo).Error; err != nil {
-				fmt.Println("Tenant Identifier passed was not found in database")
-				c.AbortWithStatus(400)
+			if !ok {
+				return
 			}
 
-			conn, connErr := tenantInfo.GetConnection()
+			useTenant(c, tenantInfo, Tenants)
+			return
+		}
+
+		var tenantString string
+		var fromHost bool
+
+		// Try and find an incoming tenancy identifier on the request
+		if identifier := requestTenantIdentifier(c); len(identifier) > 0 {
+			tenantString = identifier
+		} else {
+			// Try and make a connection using the host subdomain
+			subdomain, err := getSubdomain(c.Request.Host)
 
-			if connErr != nil {
-				fmt.Println("Tenant connection could not be made for the request - attempt using json tenancyIdentifier")
+			if err != nil {
+				fmt.Println(err)
+				resources.Failed(c, http.StatusBadRequest, err.Error())
+				return
 			}
 
-			// Set connection into the context for routing
-			c.Set("connection", conn)
+			tenantString = subdomain
+			fromHost = true
+		}
 
-			// Set tenancy Identifier into params
-			c.Set("tenantIdentifier", json.TenancyIdentifier)
+		tenantInfo, renamedFrom, err := findTenant(tenantString, Connection)
 
-			c.Next()
-		} else {
-			// Try and make a connection using the host subdomain
-			getTenantConnectionByHost(c.Request.Host, c, Connection)
+		if err != nil {
+			fmt.Println("Tenant Identifier passed was not found in database")
+			resources.Failed(c, http.StatusBadRequest, err.Error())
+			return
 		}
+
+		if len(renamedFrom) > 0 {
+
+			// Browsers are sent to the new sub domain, API clients can keep using the old identifier for now.
+			if fromHost {
+				c.Redirect(http.StatusPermanentRedirect, renamedTenantURL(c.Request, renamedFrom, tenantInfo.TenantSubDomainIdentifier))
+				c.Abort()
+				return
+			}
+
+			c.Header("X-Tenant-Identifier", tenantInfo.TenantSubDomainIdentifier)
+		}
+
+		useTenant(c, tenantInfo, Tenants)
 	}
 }
 
-func getTenantConnectionByHost(hostStr string, c *gin.Context, Connection *gorm.DB) {
+// Places the pooled connection of a tenant into the context and handles the request, unless the tenant can't take requests.
+func useTenant(c *gin.Context, tenantInfo tenants.TenantConnectionInformation, Tenants *database.TenantConnectionManager) {
 
-	connectionInformation, tenantString, err := getSubdomainInformation(hostStr, Connection)
+	if !tenantInfo.IsReady() {
+		resources.Failed(c, http.StatusServiceUnavailable, "This tenant has not finished provisioning.", "tenant_"+tenantInfo.ProvisioningStatus)
+		return
+	}
 
-	if err != nil {
-		fmt.Println(err)
-		resources.Failed(c, http.StatusBadRequest, err.Error())
+	if !database.IsTenantSchemaCurrent(tenantInfo) {
+		resources.Failed(c, http.StatusServiceUnavailable, "This tenant is being upgraded, please try again later.", "tenant_migrating")
+		return
+	}
+
+	if tenantInfo.IsSuspended() {
+		resources.Failed(c, http.StatusForbidden, "This tenant has been suspended.", "tenant_suspended")
 		return
 	}
 
-	// Make a check for a tenancy identifier being passed by the host as a subdomain identifier
-	conn, connErr := connectionInformation.GetConnection()
+	conn, release, connErr := Tenants.Acquire(tenantInfo)
 
 	if connErr != nil {
-		fmt.Println("Tenant connection could not be made for the request - attempt using host tenancyIdentifier")
+		fmt.Println("Tenant connection could not be made for the request:", connErr)
+		resources.Failed(c, http.StatusServiceUnavailable, "The tenant is currently unavailable, please try again later.")
+		return
+	}
+
+	// Hand the pooled connection back once the request has been handled.
+	defer release()
+
+	// Tenants sharing tables only ever see their own rows.
+	if tenantInfo.Strategy() == tenants.IsolationShared {
+		conn = database.ScopeToTenant(conn, tenantInfo.TenantId)
 	}
 
 	// Set connection into the context for routing
 	c.Set("connection", conn)
 
 	// Set tenancy Identifier into params
-	c.Set("tenantIdentifier", tenantString)
+	c.Set("tenantIdentifier", tenantInfo.TenantSubDomainIdentifier)
+	c.Set("tenantId", tenantInfo.ID)
 
 	c.Next()
 }
 
-func getSubdomainInformation(hostStr string, Connection *gorm.DB) (TenantConnectionInfo tenants.TenantConnectionInformation, tenantIdentifier string, err error) {
+// Reads the tenant identifier from the query string or the request body.
+// The body is put back afterwards so handlers can still bind it.
+func requestTenantIdentifier(c *gin.Context) string {
+
+	if identifier := c.Query("tenant"); len(identifier) > 0 {
+		return identifier
+	}
+
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	if c.ContentType() != binding.MIMEJSON {
+		return c.PostForm("tenant")
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return ""
+	}
+
+	var json tenantIdentifierParams
+
+	if err := encoding.Unmarshal(body, &json); err != nil {
+		return ""
+	}
+
+	return json.TenancyIdentifier
+}
+
+func getSubdomain(hostStr string) (string, error) {
 
 	output := strings.Split(hostStr, ".")
 
 	if len(output) < 2 {
-		return tenants.TenantConnectionInformation{}, "", errors.New("there was no subdomain present in the string or not enough to split: " + hostStr)
+		return "", errors.New("there was no subdomain present in the string or not enough to split: " + hostStr)
 	}
 
 	if len(output[0]) <= 0 {
-		return tenants.TenantConnectionInformation{}, "", errors.New("subdomain was empty")
+		return "", errors.New("subdomain was empty")
 	}
 
+	return output[0], nil
+}
+
+// Finds a tenant by its sub domain identifier, falling back to the sub domains it used before being renamed.
+// When found through a redirect the old identifier is returned as well.
+func findTenant(tenantIdentifier string, Connection *gorm.DB) (TenantConnectionInfo tenants.TenantConnectionInformation, renamedFrom string, err error) {
+
 	var tenantInfo tenants.TenantConnectionInformation
 
-	if err := Connection.Where(&tenants.TenantConnectionInformation{TenantSubDomainIdentifier: output[0]}).First(&tenantInfo).Error; err != nil {
+	if err := Connection.Where(&tenants.TenantConnectionInformation{TenantSubDomainIdentifier: tenantIdentifier}).First(&tenantInfo).Error; err == nil {
+		return tenantInfo, "", nil
+	}
+
+	var redirect tenants.TenantSubDomainRedirect
+
+	if err := Connection.Where(&tenants.TenantSubDomainRedirect{SubDomainIdentifier: tenantIdentifier}).First(&redirect).Error; err != nil {
+		return tenants.TenantConnectionInformation{}, "", errors.New("tenancy identifier not found in database")
+	}
+
+	if err := Connection.Where("id = ?", redirect.TenantId).First(&tenantInfo).Error; err != nil {
 		return tenants.TenantConnectionInformation{}, "", errors.New("tenancy identifier not found in database")
 	}
 
-	return tenantInfo, output[0], nil
+	return tenantInfo, tenantIdentifier, nil
+}
+
+// Builds the URL of the current request on the tenant's new sub domain.
+func renamedTenantURL(r *http.Request, oldSubdomain string, newSubdomain string) string {
+
+	scheme := "http"
+
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + newSubdomain + strings.TrimPrefix(r.Host, oldSubdomain) + r.URL.RequestURI()
 }
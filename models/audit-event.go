@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Actor types of audit events.
+const (
+	ActorUser       = "user"
+	ActorMasterUser = "master_user"
+	ActorSystem     = "system"
+	ActorApiKey     = "api_key"
+)
+
+// Outcomes of audit events.
+const (
+	AuditSucceeded = "succeeded"
+	AuditFailed    = "failed"
+)
+
+// A security or administrative event. Tenant events are kept in the tenant database,
+// master events in the master database where TenantId names the tenant involved, if any.
+type AuditEvent struct {
+	ID uint `gorm:"primary_key" json:"id"`
+	TenantScoped
+	CreatedAt        time.Time `gorm:"index" json:"createdAt"`
+	ActorType        string    `gorm:"type:varchar(20)" json:"actorType"`
+	ActorId          uint      `gorm:"index" json:"actorId"`
+	ActorEmail       string    `json:"actorEmail"`
+	TenantIdentifier string    `json:"tenantIdentifier,omitempty"`
+	Action           string    `gorm:"type:varchar(100);index" json:"action"`
+	TargetType       string    `gorm:"type:varchar(50)" json:"targetType"`
+	TargetId         uint      `json:"targetId"`
+	Outcome          string    `gorm:"type:varchar(20)" json:"outcome"`
+	Error            string    `gorm:"type:text" json:"error,omitempty"`
+	IP               string    `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent        string    `gorm:"type:text" json:"userAgent"`
+	Changes          string    `gorm:"type:text" json:"changes,omitempty"` // JSON object of field: {before, after}
+}
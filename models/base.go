@@ -9,3 +9,8 @@ type Model struct {
 	UpdatedAt time.Time  `gorm:"not null" json:"updated_at" sql:"DEFAULT:CURRENT_TIMESTAMP"`
 	DeletedAt *time.Time `sql:"index" json:"deleted_at,omitempty"`
 }
+
+// Marks a table whose rows can belong to several tenants when they share tables.
+type TenantScoped struct {
+	TenantId uint `gorm:"index" json:"-"`
+}
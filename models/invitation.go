@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Invitation states, derived from the timestamps.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// An invitation for somebody to join a tenant, only the hash of the token is stored.
+type Invitation struct {
+	Model
+	TenantScoped
+	Email      string     `gorm:"type:varchar(50);index" json:"email"`
+	RoleId     uint       `json:"roleId"` // The role the user gets once accepted.
+	InvitedBy  uint       `json:"invitedBy"`
+	TokenHash  string     `gorm:"type:varchar(64);unique_index" json:"-"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	UserId     uint       `json:"userId,omitempty"` // The user created when it was accepted.
+}
+
+// The state of the invitation at the given time.
+func (i Invitation) Status(now time.Time) string {
+
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case now.After(i.ExpiresAt):
+		return InvitationExpired
+	}
+
+	return InvitationPending
+}
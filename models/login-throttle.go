@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Failed login attempts of an account or IP address, shared by every server instance.
+type LoginThrottle struct {
+	Key           string `gorm:"primary_key;type:varchar(320)"`
+	Failures      uint
+	LastFailureAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Tracks the one-time creation of the first master user, there is only ever a single row.
+// Once CompletedAt is set the bootstrap never runs again, even if every master user is removed.
+type MasterBootstrap struct {
+	ID             uint       `gorm:"primary_key"`
+	SetupTokenHash string     `json:"-"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	CompletedBy    uint       `json:"completed_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Whether the first master user has been created.
+func (b MasterBootstrap) IsCompleted() bool {
+	return b.CompletedAt != nil
+}
@@ -1,5 +1,13 @@
 package models
 
+import "time"
+
+// Master account types.
+const (
+	MasterAccountStandard   = 0
+	MasterAccountSuperAdmin = 1
+)
+
 // Master User structure
 type MasterUser struct {
 	Model
@@ -10,4 +18,14 @@ type MasterUser struct {
 	LastName      string `json:"last_name"`
 	PhoneNumber   string `json:"phone_number"`
 	RecoveryEmail string `json:"recovery_email"`
+	// The secret is kept while enrolment is unconfirmed, the last step stops a code being used twice.
+	TwoFactorSecret  string `json:"-"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+	TwoFactorStep    int64  `json:"-"`
+	// When the password was last set, passwords expire when the policy has a maximum age.
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	// Sessions and tokens authorized before this are rejected, moved forward when the password changes.
+	SessionsValidFrom *time.Time `json:"-"`
+	// Cookie sessions authorized before this move to a new id on their next request, moved forward when roles change.
+	PrivilegesChangedAt *time.Time `json:"-"`
 }
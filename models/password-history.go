@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// A previous password hash of a tenant user, kept to stop passwords being reused.
+type PasswordHistory struct {
+	ID uint `gorm:"primary_key"`
+	TenantScoped
+	CreatedAt time.Time
+	UserId    uint `gorm:"index"`
+	Hash      string
+}
+
+// A previous password hash of a master user, kept to stop passwords being reused.
+type MasterPasswordHistory struct {
+	ID           uint `gorm:"primary_key"`
+	CreatedAt    time.Time
+	MasterUserId uint `gorm:"index"`
+	Hash         string
+}
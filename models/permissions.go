@@ -0,0 +1,102 @@
+package models
+
+// Permissions of tenant users, granted through roles.
+const (
+	PermissionUsersRead      = "users:read"
+	PermissionUsersCreate    = "users:create"
+	PermissionUsersUpdate    = "users:update"
+	PermissionUsersDelete    = "users:delete"
+	PermissionRolesRead      = "roles:read"
+	PermissionRolesManage    = "roles:manage"
+	PermissionAuditRead      = "audit:read"
+	PermissionSettingsRead   = "settings:read"
+	PermissionSettingsManage = "settings:manage"
+	PermissionApiKeysManage  = "api-keys:manage"
+)
+
+// Permissions of master users, granted through their account type.
+const (
+	PermissionTenantsRead       = "tenants:read"
+	PermissionTenantsManage     = "tenants:manage"
+	PermissionMigrationsRead    = "migrations:read"
+	PermissionMigrationsRun     = "migrations:run"
+	PermissionMasterUsersRead   = "master-users:read"
+	PermissionMasterUsersCreate = "master-users:create"
+	PermissionMasterUsersUpdate = "master-users:update"
+	PermissionMasterUsersDelete = "master-users:delete"
+)
+
+// Every permission a tenant role can grant.
+var TenantPermissions = []string{
+	PermissionUsersRead,
+	PermissionUsersCreate,
+	PermissionUsersUpdate,
+	PermissionUsersDelete,
+	PermissionRolesRead,
+	PermissionRolesManage,
+	PermissionAuditRead,
+	PermissionSettingsRead,
+	PermissionSettingsManage,
+	PermissionApiKeysManage,
+}
+
+// The permissions of the roles seeded into every tenant.
+var SeedRolePermissions = map[string][]string{
+	RoleOwner: TenantPermissions,
+	RoleAdmin: {
+		PermissionUsersRead,
+		PermissionUsersCreate,
+		PermissionUsersUpdate,
+		PermissionUsersDelete,
+		PermissionRolesRead,
+		PermissionAuditRead,
+		PermissionSettingsRead,
+	},
+	RoleMember: {
+		PermissionUsersRead,
+	},
+}
+
+// The permissions of each master account type.
+var MasterAccountPermissions = map[int][]string{
+	MasterAccountStandard: {
+		PermissionTenantsRead,
+		PermissionMigrationsRead,
+		PermissionMasterUsersRead,
+	},
+	MasterAccountSuperAdmin: {
+		PermissionTenantsRead,
+		PermissionTenantsManage,
+		PermissionMigrationsRead,
+		PermissionMigrationsRun,
+		PermissionMasterUsersRead,
+		PermissionMasterUsersCreate,
+		PermissionMasterUsersUpdate,
+		PermissionMasterUsersDelete,
+		PermissionAuditRead,
+	},
+}
+
+// Whether a permission is one a tenant role can grant.
+func IsTenantPermission(permission string) bool {
+
+	for _, known := range TenantPermissions {
+		if known == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether a master account type grants a permission.
+func MasterAccountHasPermission(accountType int, permission string) bool {
+
+	for _, granted := range MasterAccountPermissions[accountType] {
+		if granted == permission {
+			return true
+		}
+	}
+
+	return false
+}
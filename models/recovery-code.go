@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// A single-use two-factor recovery code of a tenant user, only its hash is stored.
+type RecoveryCode struct {
+	ID uint `gorm:"primary_key"`
+	TenantScoped
+	CreatedAt time.Time
+	UserId    uint   `gorm:"index"`
+	CodeHash  string `gorm:"type:varchar(64)"`
+	UsedAt    *time.Time
+}
+
+// A single-use two-factor recovery code of a master user, only its hash is stored.
+type MasterRecoveryCode struct {
+	ID           uint `gorm:"primary_key"`
+	CreatedAt    time.Time
+	MasterUserId uint   `gorm:"index"`
+	CodeHash     string `gorm:"type:varchar(64)"`
+	UsedAt       *time.Time
+}
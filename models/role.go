@@ -0,0 +1,34 @@
+package models
+
+// Roles every tenant starts with.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// A named set of permissions within a tenant.
+type Role struct {
+	Model
+	TenantScoped
+	Name        string           `gorm:"type:varchar(50);index" json:"name"`
+	Description string           `json:"description"`
+	System      bool             `json:"system"` // Seeded roles can't be renamed or deleted.
+	Permissions []RolePermission `json:"permissions,omitempty"`
+}
+
+// A single permission string granted by a role, e.g. users:delete.
+type RolePermission struct {
+	ID uint `gorm:"primary_key" json:"-"`
+	TenantScoped
+	RoleId     uint   `gorm:"index" json:"-"`
+	Permission string `gorm:"type:varchar(100)" json:"permission"`
+}
+
+// Assigns a role to a user.
+type UserRole struct {
+	ID uint `gorm:"primary_key" json:"-"`
+	TenantScoped
+	UserId uint `gorm:"index" json:"userId"`
+	RoleId uint `gorm:"index" json:"roleId"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// A key integrations use instead of logging in, stored in the master database so the key alone names its tenant.
+// Only a hash of the key is kept, the prefix is shown so it can be recognised.
+type TenantApiKey struct {
+	ID         uint      `gorm:"primary_key"`
+	CreatedAt  time.Time `gorm:"not null" sql:"DEFAULT:CURRENT_TIMESTAMP"`
+	TenantId   uint      `gorm:"index"` // This is linked to the TenantConnectionInformation Table
+	Name       string    `gorm:"type:varchar(100)"`
+	Prefix     string    `gorm:"type:varchar(20)"`
+	KeyHash    string    `gorm:"type:varchar(64);unique_index"`
+	Scopes     string    `gorm:"type:text"` // Comma separated permissions the key may use.
+	AllowedIps string    `gorm:"type:text"` // Comma separated addresses or CIDR ranges, empty allows any.
+	CreatedBy  uint      // The tenant user the key acts for, it never has more permissions than they do.
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIp string `gorm:"type:varchar(45)"`
+	RevokedAt  *time.Time
+}
+
+// Whether the key can still be used.
+func (k TenantApiKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// The permissions the key may use.
+func (k TenantApiKey) ScopeList() []string {
+	return splitList(k.Scopes)
+}
+
+// Whether the key may use a permission.
+func (k TenantApiKey) HasScope(permission string) bool {
+
+	for _, scope := range k.ScopeList() {
+		if scope == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The addresses and ranges the key may be used from.
+func (k TenantApiKey) AllowedIpList() []string {
+	return splitList(k.AllowedIps)
+}
+
+// Whether the key may be used from an address.
+func (k TenantApiKey) AllowsIp(address string) bool {
+
+	allowed := k.AllowedIpList()
+
+	if len(allowed) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(address)
+
+	if ip == nil {
+		return false
+	}
+
+	for _, entry := range allowed {
+
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		if allowedIp := net.ParseIP(entry); allowedIp != nil && allowedIp.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func splitList(list string) []string {
+
+	if len(list) == 0 {
+		return []string{}
+	}
+
+	return strings.Split(list, ",")
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApiKeyAllowsIp(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		allowed string
+		address string
+		allows  bool
+	}{
+		{"no restriction", "", "203.0.113.7", true},
+		{"no restriction for an unparsable address", "", "not an address", true},
+		{"exact address", "203.0.113.7", "203.0.113.7", true},
+		{"other address", "203.0.113.7", "203.0.113.8", false},
+		{"inside a range", "10.0.0.0/8", "10.20.30.40", true},
+		{"outside a range", "10.0.0.0/8", "11.0.0.1", false},
+		{"second entry", "203.0.113.7,192.168.1.0/24", "192.168.1.200", true},
+		{"unparsable address", "203.0.113.7", "not an address", false},
+		{"ipv6 address", "2001:db8::1", "2001:db8:0:0::1", true},
+		{"ipv6 range", "2001:db8::/32", "2001:db8:ffff::1", true},
+		{"ipv4 mapped ipv6 address", "203.0.113.7", "::ffff:203.0.113.7", true},
+		{"ipv6 outside an ipv4 range", "0.0.0.0/0", "2001:db8::1", false},
+		{"unparsable entries never match", "localhost,10.0.0.0/33", "127.0.0.1", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			key := TenantApiKey{AllowedIps: test.allowed}
+
+			if allows := key.AllowsIp(test.address); allows != test.allows {
+				t.Fatalf("expected AllowsIp(%q) with %q to be %v", test.address, test.allowed, test.allows)
+			}
+		})
+	}
+}
+
+func TestApiKeyHasScope(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		scopes     string
+		permission string
+		has        bool
+	}{
+		{"no scopes", "", "users:read", false},
+		{"empty permission", "", "", false},
+		{"only scope", "users:read", "users:read", true},
+		{"one of several scopes", "users:read,roles:read", "roles:read", true},
+		{"another permission", "users:read", "users:manage", false},
+		{"prefix of a scope", "users:read", "users", false},
+		{"scope is a prefix", "users", "users:read", false},
+		{"case matters", "users:read", "Users:Read", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			key := TenantApiKey{Scopes: test.scopes}
+
+			if has := key.HasScope(test.permission); has != test.has {
+				t.Fatalf("expected HasScope(%q) with %q to be %v", test.permission, test.scopes, test.has)
+			}
+		})
+	}
+}
+
+func TestApiKeyIsActive(t *testing.T) {
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Second)
+	future := now.Add(time.Second)
+
+	tests := []struct {
+		name   string
+		key    TenantApiKey
+		active bool
+	}{
+		{"never expires", TenantApiKey{}, true},
+		{"expires later", TenantApiKey{ExpiresAt: &future}, true},
+		{"expires now", TenantApiKey{ExpiresAt: &now}, false},
+		{"expired", TenantApiKey{ExpiresAt: &past}, false},
+		{"revoked", TenantApiKey{RevokedAt: &past, ExpiresAt: &future}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if active := test.key.IsActive(now); active != test.active {
+				t.Fatalf("expected IsActive to be %v", test.active)
+			}
+		})
+	}
+}
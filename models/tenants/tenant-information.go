@@ -2,6 +2,7 @@ package models
 
 import (
 	"strings"
+	"time"
 
 	"go-multitenancy-boilerplate/models"
 
@@ -9,11 +10,66 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Isolation strategies a tenant can be provisioned with.
+const (
+	IsolationDatabase = "database" // The tenant owns a whole database.
+	IsolationSchema   = "schema"   // The tenant owns a schema inside the shared tenant database.
+	IsolationShared   = "shared"   // The tenant rows live in shared tables, scoped by tenant_id.
+)
+
+// Lifecycle states of a tenant.
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+)
+
+// Provisioning states of a tenant.
+const (
+	ProvisioningPending = "pending"
+	ProvisioningReady   = "ready"
+	ProvisioningFailed  = "failed"
+)
+
 type TenantConnectionInformation struct {
 	models.Model
 	TenantId                  uint `gorm:"AUTO_INCREMENT"`
 	TenantSubDomainIdentifier string
 	ConnectionString          string
+	IsolationStrategy         string `gorm:"type:varchar(20)"`
+	SchemaName                string `gorm:"type:varchar(63)"`
+	Status                    string `gorm:"type:varchar(20);default:'active'"`
+	SuspendedAt               *time.Time
+	SuspendedReason           string
+	ProvisioningStatus        string     `gorm:"type:varchar(20);default:'ready'"`
+	ProvisioningError         string     `gorm:"type:text"`
+	SchemaVersion             int64      // The tenant migration version the tenant schema is on.
+	MigrationStatus           string     `gorm:"type:varchar(20)"`
+	MigrationLockedUntil      *time.Time // A running migration whose lock has expired was cut off.
+}
+
+// Checks a requested isolation strategy is one we know how to provision.
+func IsValidIsolationStrategy(strategy string) bool {
+	return strategy == IsolationDatabase || strategy == IsolationSchema || strategy == IsolationShared
+}
+
+// Returns the isolation strategy, tenants created before strategies existed own a database.
+func (t TenantConnectionInformation) Strategy() string {
+
+	if len(t.IsolationStrategy) == 0 {
+		return IsolationDatabase
+	}
+
+	return t.IsolationStrategy
+}
+
+// Suspended tenants keep their data but can not be used.
+func (t TenantConnectionInformation) IsSuspended() bool {
+	return t.Status == StatusSuspended
+}
+
+// Only fully provisioned tenants can serve requests.
+func (t TenantConnectionInformation) IsReady() bool {
+	return t.ProvisioningStatus == ProvisioningReady
 }
 
 // Helper method that create and returns the database connection.
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go-multitenancy-boilerplate/models"
+)
+
+// Migration states of a tenant schema.
+const (
+	MigrationRunning   = "running"
+	MigrationSucceeded = "succeeded"
+	MigrationFailed    = "failed"
+)
+
+// The outcome of migrating a single tenant during a fleet migration run.
+type TenantMigrationResult struct {
+	models.Model
+	RunId       string `gorm:"type:varchar(40);index"`
+	TenantId    uint   `gorm:"index"` // This is linked to the TenantConnectionInformation Table
+	FromVersion int64
+	ToVersion   int64
+	Status      string `gorm:"type:varchar(20)"`
+	Error       string `gorm:"type:text"`
+	StartedAt   time.Time
+	FinishedAt  time.Time
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// The identity provider a tenant's users can log in with, tenants without a row only use passwords.
+type TenantOidcConfig struct {
+	TenantId     uint `gorm:"primary_key;auto_increment:false"` // This is linked to the TenantConnectionInformation Table
+	Enabled      bool
+	Issuer       string `gorm:"type:varchar(255)"`
+	ClientId     string `gorm:"type:varchar(255)"`
+	ClientSecret string `gorm:"type:text"`
+	Scopes       string `gorm:"type:varchar(255)"` // Space separated scopes requested besides openid.
+	// Claims read into the user's fields, empty uses the standard claim.
+	EmailClaim       string `gorm:"type:varchar(100)"`
+	FirstNameClaim   string `gorm:"type:varchar(100)"`
+	LastNameClaim    string `gorm:"type:varchar(100)"`
+	PhoneNumberClaim string `gorm:"type:varchar(100)"`
+	// The claim listing the user's groups or roles, and a JSON object mapping its values to role names.
+	// Roles named in the mapping follow the claim on every login, other roles are left alone.
+	RolesClaim  string `gorm:"type:varchar(100)"`
+	RoleMapping string `gorm:"type:text"`
+	// Users logging in for the first time are created, otherwise only existing users can log in.
+	AutoProvision        bool
+	DisablePasswordLogin bool
+	UpdatedAt            time.Time
+}
+
+func (c TenantOidcConfig) ScopeList() []string {
+	return strings.Fields(c.Scopes)
+}
+
+func (c TenantOidcConfig) EmailClaimName() string {
+	return claimName(c.EmailClaim, "email")
+}
+
+func (c TenantOidcConfig) FirstNameClaimName() string {
+	return claimName(c.FirstNameClaim, "given_name")
+}
+
+func (c TenantOidcConfig) LastNameClaimName() string {
+	return claimName(c.LastNameClaim, "family_name")
+}
+
+func (c TenantOidcConfig) PhoneNumberClaimName() string {
+	return claimName(c.PhoneNumberClaim, "phone_number")
+}
+
+// The role names by claim value, empty when roles aren't mapped.
+func (c TenantOidcConfig) RoleMap() (map[string]string, error) {
+
+	mapping := make(map[string]string)
+
+	if len(c.RoleMapping) == 0 {
+		return mapping, nil
+	}
+
+	err := json.Unmarshal([]byte(c.RoleMapping), &mapping)
+
+	return mapping, err
+}
+
+// Whether users have to log in through the provider, only once it is enabled.
+func (c TenantOidcConfig) PasswordLoginDisabled() bool {
+	return c.Enabled && c.DisablePasswordLogin
+}
+
+func claimName(configured string, standard string) string {
+
+	if len(configured) > 0 {
+		return configured
+	}
+
+	return standard
+}
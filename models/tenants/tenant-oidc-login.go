@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// A login started with a tenant's identity provider, kept until the provider sends the user back.
+// Only a hash of the state is stored, the PKCE verifier never leaves the server.
+type TenantOidcLogin struct {
+	StateHash   string    `gorm:"type:varchar(64);primary_key"`
+	TenantId    uint      // This is linked to the TenantConnectionInformation Table
+	Verifier    string    `gorm:"type:varchar(100)"`
+	Nonce       string    `gorm:"type:varchar(100)"`
+	RedirectURL string    `gorm:"type:text"`
+	ExpiresAt   time.Time `gorm:"index"`
+}
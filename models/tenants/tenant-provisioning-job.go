@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go-multitenancy-boilerplate/models"
+)
+
+// States of a provisioning job.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled" // The tenant was deleted before the job ran.
+)
+
+// A background job provisioning the storage of a tenant, persisted so it survives restarts.
+type TenantProvisioningJob struct {
+	models.Model
+	TenantId    uint   // This is linked to the TenantConnectionInformation Table
+	Status      string `gorm:"type:varchar(20);index"`
+	Attempts    int
+	Error       string     `gorm:"type:text"`
+	LockedUntil *time.Time // A running job whose lock has expired is picked up again.
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+}
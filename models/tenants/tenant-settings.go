@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	passwords "go-multitenancy-boilerplate/passwords"
+	tokens "go-multitenancy-boilerplate/tokens"
+)
+
+// Policies a tenant can change, tenants without a row use the defaults.
+type TenantSettings struct {
+	TenantId                  uint `gorm:"primary_key;auto_increment:false"` // This is linked to the TenantConnectionInformation Table
+	RequireEmailVerification  bool
+	RequireTwoFactorForAdmins bool // Applies to users holding the owner or admin role.
+	// Password policy overrides, nil uses the platform policy.
+	PasswordMinLength        *int
+	PasswordRequireUppercase *bool
+	PasswordRequireLowercase *bool
+	PasswordRequireDigit     *bool
+	PasswordRequireSpecial   *bool
+	PasswordRejectCommon     *bool
+	PasswordHistory          *int
+	PasswordMaxAgeDays       *int
+	// Session timeout overrides in minutes, nil uses the platform timeouts and zero never expires.
+	SessionIdleTimeoutMinutes     *int
+	SessionAbsoluteTimeoutMinutes *int
+	UpdatedAt                     time.Time
+}
+
+// The settings of a tenant which never changed them.
+func DefaultTenantSettings(tenantId uint) TenantSettings {
+	return TenantSettings{TenantId: tenantId}
+}
+
+// Applies the tenant's password policy overrides to the platform policy.
+func (s TenantSettings) PasswordPolicy(policy passwords.Policy) passwords.Policy {
+
+	if s.PasswordMinLength != nil {
+		policy.MinLength = *s.PasswordMinLength
+	}
+	if s.PasswordRequireUppercase != nil {
+		policy.RequireUppercase = *s.PasswordRequireUppercase
+	}
+	if s.PasswordRequireLowercase != nil {
+		policy.RequireLowercase = *s.PasswordRequireLowercase
+	}
+	if s.PasswordRequireDigit != nil {
+		policy.RequireDigit = *s.PasswordRequireDigit
+	}
+	if s.PasswordRequireSpecial != nil {
+		policy.RequireSpecial = *s.PasswordRequireSpecial
+	}
+	if s.PasswordRejectCommon != nil {
+		policy.RejectCommon = *s.PasswordRejectCommon
+	}
+	if s.PasswordHistory != nil {
+		policy.History = *s.PasswordHistory
+	}
+	if s.PasswordMaxAgeDays != nil {
+		policy.MaxAge = time.Duration(*s.PasswordMaxAgeDays) * 24 * time.Hour
+	}
+
+	return policy
+}
+
+// Applies the tenant's session timeout overrides to the platform timeouts.
+func (s TenantSettings) SessionTimeouts(timeouts tokens.Timeouts) tokens.Timeouts {
+
+	if s.SessionIdleTimeoutMinutes != nil {
+		timeouts.Idle = time.Duration(*s.SessionIdleTimeoutMinutes) * time.Minute
+	}
+	if s.SessionAbsoluteTimeoutMinutes != nil {
+		timeouts.Absolute = time.Duration(*s.SessionAbsoluteTimeoutMinutes) * time.Minute
+	}
+
+	return timeouts
+}
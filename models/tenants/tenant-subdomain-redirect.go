@@ -0,0 +1,10 @@
+package models
+
+import "go-multitenancy-boilerplate/models"
+
+// Remembers the sub domain a tenant used before being renamed so old links keep working.
+type TenantSubDomainRedirect struct {
+	models.Model
+	TenantId            uint   // This is linked to the TenantConnectionInformation Table
+	SubDomainIdentifier string `gorm:"unique_index"`
+}
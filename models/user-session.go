@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// A login of a tenant user on one device. The cookie session or tokens of that login point at it,
+// revoking it logs them out on their next request.
+type UserSession struct {
+	ID uint `gorm:"primary_key"`
+	TenantScoped
+	CreatedAt  time.Time
+	UserId     uint   `gorm:"index"`
+	UserAgent  string `gorm:"type:varchar(255)"`
+	IpAddress  string `gorm:"type:varchar(45)"`
+	LastSeenAt time.Time
+	RevokedAt  *time.Time
+	// The jti of the login's current refresh token, each refresh replaces it and presenting an older one revokes the login.
+	RefreshTokenId string `gorm:"type:varchar(64)"`
+}
+
+// A login of a master user on one device.
+type MasterUserSession struct {
+	ID           uint `gorm:"primary_key"`
+	CreatedAt    time.Time
+	MasterUserId uint   `gorm:"index"`
+	UserAgent    string `gorm:"type:varchar(255)"`
+	IpAddress    string `gorm:"type:varchar(45)"`
+	LastSeenAt   time.Time
+	RevokedAt    *time.Time
+	// The jti of the login's current refresh token.
+	RefreshTokenId string `gorm:"type:varchar(64)"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// What a single-use user token is for.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+	TokenTwoFactorLogin    = "two_factor_login"
+)
+
+// A single-use, expiring token sent to a tenant user, only its hash is stored.
+type UserToken struct {
+	ID uint `gorm:"primary_key"`
+	TenantScoped
+	CreatedAt time.Time
+	UserId    uint   `gorm:"index"`
+	Purpose   string `gorm:"type:varchar(30)"`
+	TokenHash string `gorm:"type:varchar(64);unique_index"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	Attempts  int // Failed attempts at using the token, for tokens which allow a few.
+}
+
+// A single-use, expiring token sent to a master user, only its hash is stored.
+type MasterUserToken struct {
+	ID           uint `gorm:"primary_key"`
+	CreatedAt    time.Time
+	MasterUserId uint   `gorm:"index"`
+	Purpose      string `gorm:"type:varchar(30)"`
+	TokenHash    string `gorm:"type:varchar(64);unique_index"`
+	ExpiresAt    time.Time
+	UsedAt       *time.Time
+	Attempts     int // Failed attempts at using the token, for tokens which allow a few.
+}
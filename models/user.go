@@ -1,13 +1,30 @@
 package models
 
+import "time"
+
 //User structure
 type User struct {
 	Model
-	Email         string `gorm:"type:varchar(50)" json:"email" validate:"required,email"`
-	Password      string `json:",omitempty"`
-	AccountType   int
-	FirstName     string `gorm:"type:varchar(50)" json:"first_name"`
-	LastName      string `gorm:"type:varchar(50)" json:"last_name"`
-	PhoneNumber   string
-	RecoveryEmail string
+	TenantScoped
+	Email           string `gorm:"type:varchar(50)" json:"email" validate:"required,email"`
+	Password        string `json:",omitempty"`
+	AccountType     int
+	FirstName       string `gorm:"type:varchar(50)" json:"first_name"`
+	LastName        string `gorm:"type:varchar(50)" json:"last_name"`
+	PhoneNumber     string
+	RecoveryEmail   string
+	EmailVerified   bool       `json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// The secret is kept while enrolment is unconfirmed, the last step stops a code being used twice.
+	TwoFactorSecret  string `json:"-"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+	TwoFactorStep    int64  `json:"-"`
+	// When the password was last set, passwords expire when the policy has a maximum age.
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	// Sessions and tokens authorized before this are rejected, moved forward when the password changes.
+	SessionsValidFrom *time.Time `json:"-"`
+	// Cookie sessions authorized before this move to a new id on their next request, moved forward when roles change.
+	PrivilegesChangedAt *time.Time `json:"-"`
+	// The subject of the user at the tenant's identity provider, set once they logged in through it.
+	OidcSubject string `gorm:"type:varchar(255);index" json:"-"`
 }
@@ -0,0 +1,12 @@
+package oidc
+
+import "time"
+
+// Lets tests act as if the provider's keys were loaded over a minute ago, so an unknown key id loads them again.
+func ExpireKeys(p *Provider) {
+
+	p.keys.lock.Lock()
+	defer p.keys.lock.Unlock()
+
+	p.keys.fetchedAt = time.Time{}
+}
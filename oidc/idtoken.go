@@ -0,0 +1,328 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidIDToken = errors.New("the id token is invalid")
+
+// Clocks of the provider and this server may disagree by this much.
+const clockSkew = time.Minute
+
+// The claims of a verified id token.
+type Claims map[string]interface{}
+
+// Finds a claim by name, a dotted name looks into nested objects, e.g. realm_access.roles.
+func (c Claims) Lookup(name string) (interface{}, bool) {
+
+	if value, found := c[name]; found {
+		return value, true
+	}
+
+	var current interface{} = map[string]interface{}(c)
+
+	for _, part := range strings.Split(name, ".") {
+
+		object, ok := current.(map[string]interface{})
+
+		if !ok {
+			return nil, false
+		}
+
+		if current, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// A string claim, empty when missing or of another type.
+func (c Claims) String(name string) string {
+
+	value, _ := c.Lookup(name)
+	text, _ := value.(string)
+
+	return text
+}
+
+// A boolean claim, some providers send booleans as strings.
+func (c Claims) Bool(name string) bool {
+
+	value, _ := c.Lookup(name)
+
+	switch typed := value.(type) {
+	case bool:
+		return typed
+	case string:
+		return typed == "true"
+	}
+
+	return false
+}
+
+// A claim holding a list of strings, a single string is a list of one.
+func (c Claims) Strings(name string) []string {
+
+	value, _ := c.Lookup(name)
+
+	switch typed := value.(type) {
+	case string:
+		return []string{typed}
+	case []interface{}:
+		list := make([]string, 0, len(typed))
+		for _, item := range typed {
+			if text, ok := item.(string); ok {
+				list = append(list, text)
+			}
+		}
+		return list
+	}
+
+	return []string{}
+}
+
+// The subject, the provider's permanent id of the user.
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// Whether the provider says the user logged in with more than one factor (the "mfa" method of RFC 8176).
+func (c Claims) MultiFactor() bool {
+
+	for _, method := range c.Strings("amr") {
+		if method == "mfa" {
+			return true
+		}
+	}
+
+	return false
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+// Verifies an id token was signed by the provider for this client and the login carrying the nonce, and returns its claims.
+// Only RS256 is accepted, the algorithm every provider has to support.
+func (p *Provider) VerifyIDToken(ctx context.Context, config Config, raw string, nonce string) (Claims, error) {
+
+	parts := strings.Split(raw, ".")
+
+	if len(parts) != 3 {
+		return nil, errors.Wrap(ErrInvalidIDToken, "malformed")
+	}
+
+	var header tokenHeader
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.Wrap(ErrInvalidIDToken, "malformed header")
+	}
+
+	if header.Algorithm != "RS256" {
+		return nil, errors.Wrap(ErrInvalidIDToken, "unsupported algorithm "+header.Algorithm)
+	}
+
+	key, err := p.keys.get(ctx, header.KeyId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidIDToken, "malformed signature")
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.Wrap(ErrInvalidIDToken, "bad signature")
+	}
+
+	var claims Claims
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(ErrInvalidIDToken, "malformed claims")
+	}
+
+	if err := claims.validate(config, nonce, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (c Claims) validate(config Config, nonce string, now time.Time) error {
+
+	if strings.TrimSuffix(c.String("iss"), "/") != strings.TrimSuffix(config.Issuer, "/") {
+		return errors.Wrap(ErrInvalidIDToken, "wrong issuer")
+	}
+
+	audience := c.Strings("aud")
+
+	if !contains(audience, config.ClientId) {
+		return errors.Wrap(ErrInvalidIDToken, "wrong audience")
+	}
+
+	// A token for several clients names the one it was issued to.
+	if len(audience) > 1 && c.String("azp") != config.ClientId {
+		return errors.Wrap(ErrInvalidIDToken, "wrong authorized party")
+	}
+
+	expiresAt, ok := c.number("exp")
+
+	if !ok || now.Add(-clockSkew).Unix() >= expiresAt {
+		return errors.Wrap(ErrInvalidIDToken, "expired")
+	}
+
+	if issuedAt, ok := c.number("iat"); ok && issuedAt > now.Add(clockSkew).Unix() {
+		return errors.Wrap(ErrInvalidIDToken, "issued in the future")
+	}
+
+	if c.String("nonce") != nonce {
+		return errors.Wrap(ErrInvalidIDToken, "wrong nonce")
+	}
+
+	if len(c.Subject()) == 0 {
+		return errors.Wrap(ErrInvalidIDToken, "no subject")
+	}
+
+	return nil
+}
+
+func (c Claims) number(name string) (int64, bool) {
+
+	value, ok := c[name].(float64)
+
+	return int64(value), ok
+}
+
+// The signing keys of a provider, loaded again when a token names a key that isn't known yet.
+type keySet struct {
+	uri       string
+	lock      sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyId   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+func (s *keySet) get(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if key := s.find(kid); key != nil {
+		return key, nil
+	}
+
+	// Keys are loaded again at most once a minute, so tokens naming unknown keys can't flood the provider.
+	if time.Since(s.fetchedAt) < time.Minute {
+		return nil, errors.Wrap(ErrInvalidIDToken, "unknown signing key "+kid)
+	}
+
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := getJSON(ctx, s.uri, &document); err != nil {
+		return nil, errors.Wrap(ErrDiscovery, err.Error())
+	}
+
+	s.keys = make(map[string]*rsa.PublicKey)
+	s.fetchedAt = time.Now()
+
+	for _, jwk := range document.Keys {
+
+		if jwk.KeyType != "RSA" || (len(jwk.Use) > 0 && jwk.Use != "sig") {
+			continue
+		}
+
+		if key, err := jwk.rsaKey(); err == nil {
+			s.keys[jwk.KeyId] = key
+		}
+	}
+
+	if key := s.find(kid); key != nil {
+		return key, nil
+	}
+
+	return nil, errors.Wrap(ErrInvalidIDToken, "unknown signing key "+kid)
+}
+
+// Tokens without a key id are accepted when the provider has a single key.
+func (s *keySet) find(kid string) *rsa.PublicKey {
+
+	if len(kid) == 0 && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key
+		}
+	}
+
+	return s.keys[kid]
+}
+
+func (k jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("the key exponent is too large")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func decodeSegment(segment string, target interface{}) error {
+
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(decoded, target)
+}
+
+func contains(list []string, value string) bool {
+
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
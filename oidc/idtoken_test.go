@@ -0,0 +1,88 @@
+package oidc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestClaimsValidate(t *testing.T) {
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	config := Config{Issuer: "https://idp.example.com", ClientId: "client"}
+
+	valid := func() Claims {
+		return Claims{
+			"iss":   "https://idp.example.com",
+			"aud":   "client",
+			"sub":   "user-1",
+			"nonce": "nonce",
+			"iat":   float64(now.Unix()),
+			"exp":   float64(now.Add(5 * time.Minute).Unix()),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(c Claims)
+		nonce  string
+		valid  bool
+	}{
+		{"valid", func(c Claims) {}, "nonce", true},
+		{"issuer with trailing slash", func(c Claims) { c["iss"] = "https://idp.example.com/" }, "nonce", true},
+		{"wrong issuer", func(c Claims) { c["iss"] = "https://evil.example.com" }, "nonce", false},
+		{"missing issuer", func(c Claims) { delete(c, "iss") }, "nonce", false},
+		{"wrong audience", func(c Claims) { c["aud"] = "other" }, "nonce", false},
+		{"audience list", func(c Claims) { c["aud"] = []interface{}{"other", "client"}; c["azp"] = "client" }, "nonce", true},
+		{"audience list for another party", func(c Claims) { c["aud"] = []interface{}{"other", "client"}; c["azp"] = "other" }, "nonce", false},
+		{"audience list without party", func(c Claims) { c["aud"] = []interface{}{"other", "client"} }, "nonce", false},
+		{"expired", func(c Claims) { c["exp"] = float64(now.Add(-2 * time.Minute).Unix()) }, "nonce", false},
+		{"expired within the clock skew", func(c Claims) { c["exp"] = float64(now.Add(-30 * time.Second).Unix()) }, "nonce", true},
+		{"missing expiry", func(c Claims) { delete(c, "exp") }, "nonce", false},
+		{"issued in the future", func(c Claims) { c["iat"] = float64(now.Add(2 * time.Minute).Unix()) }, "nonce", false},
+		{"wrong nonce", func(c Claims) {}, "other", false},
+		{"missing nonce", func(c Claims) { delete(c, "nonce") }, "nonce", false},
+		{"missing subject", func(c Claims) { delete(c, "sub") }, "nonce", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			claims := valid()
+			test.change(claims)
+
+			err := claims.validate(config, test.nonce, now)
+
+			if test.valid && err != nil {
+				t.Fatalf("expected the claims to be valid, got %v", err)
+			}
+
+			if !test.valid && errors.Cause(err) != ErrInvalidIDToken {
+				t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClaimsMultiFactor(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		claims Claims
+		want   bool
+	}{
+		{"no amr", Claims{}, false},
+		{"password only", Claims{"amr": []interface{}{"pwd"}}, false},
+		{"password and otp", Claims{"amr": []interface{}{"pwd", "otp", "mfa"}}, true},
+		{"single value", Claims{"amr": "mfa"}, true},
+		{"not a list of strings", Claims{"amr": []interface{}{true}}, false},
+	}
+
+	for _, test := range tests {
+		if got := test.claims.MultiFactor(); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+
+	"github.com/pkg/errors"
+)
+
+// Returned when a provider resolves to an address inside our own network.
+var ErrForbiddenAddress = errors.New("the identity provider resolves to a private address")
+
+// Ranges an identity provider can never live in, the issuer is chosen by tenants and must not reach our own network.
+var privateNetworks = parseNetworks(
+	"0.0.0.0/8",      // This network.
+	"10.0.0.0/8",     // Private.
+	"100.64.0.0/10",  // Carrier grade NAT.
+	"172.16.0.0/12",  // Private.
+	"192.168.0.0/16", // Private.
+	"198.18.0.0/15",  // Benchmarking.
+	"fc00::/7",       // Unique local.
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+
+	networks := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// Checks every connection to a provider, including redirects, once its address is resolved
+// so a name resolving to a private address can't slip through.
+func dialControl(network string, address string, _ syscall.RawConn) error {
+
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+
+	if ip == nil {
+		return errors.Wrap(ErrForbiddenAddress, host)
+	}
+
+	if ip.IsLoopback() && allowLoopback() {
+		return nil
+	}
+
+	if isForbiddenIP(ip) {
+		return errors.Wrap(ErrForbiddenAddress, host)
+	}
+
+	return nil
+}
+
+// Loopback, link local (which holds cloud metadata services), multicast and private addresses.
+func isForbiddenIP(ip net.IP) bool {
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Providers running on this machine are only good enough for development.
+func allowLoopback() bool {
+	return os.Getenv("ENVIRONMENT") == "development"
+}
+
+// The client used to talk to identity providers, it refuses to connect to private addresses.
+func newClient() *http.Client {
+
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// Endpoints must be on the issuer's origin, unless their host is listed in OIDC_ALLOWED_ENDPOINT_HOSTS
+// for providers which serve them from another domain.
+func checkEndpoint(issuer *url.URL, endpoint string) error {
+
+	parsed, err := url.Parse(endpoint)
+
+	if err != nil || !parsed.IsAbs() || len(parsed.Host) == 0 {
+		return errors.New("the endpoint is not a URL: " + endpoint)
+	}
+
+	if parsed.Scheme == issuer.Scheme && strings.EqualFold(parsed.Host, issuer.Host) {
+		return nil
+	}
+
+	if parsed.Scheme == "https" {
+		for _, host := range helpers.GetEnvList("OIDC_ALLOWED_ENDPOINT_HOSTS") {
+			if strings.EqualFold(parsed.Hostname(), host) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("the endpoint is not on the issuer's origin: " + endpoint)
+}
@@ -0,0 +1,129 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestDialControl(t *testing.T) {
+
+	tests := []struct {
+		address     string
+		development bool
+		allowed     bool
+	}{
+		{"93.184.216.34:443", false, true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", false, true},
+		{"127.0.0.1:443", false, false},
+		{"127.0.0.1:443", true, true},
+		{"[::1]:443", false, false},
+		{"[::1]:443", true, true},
+		{"169.254.169.254:80", false, false},
+		{"169.254.169.254:80", true, false},
+		{"[fe80::1]:80", false, false},
+		{"10.0.0.5:443", false, false},
+		{"172.16.4.2:443", true, false},
+		{"192.168.1.1:443", false, false},
+		{"100.64.0.1:443", false, false},
+		{"[fd00::1]:443", false, false},
+		{"[::ffff:10.0.0.5]:443", false, false},
+		{"0.0.0.0:443", false, false},
+		{"224.0.0.1:443", false, false},
+	}
+
+	defer os.Setenv("ENVIRONMENT", os.Getenv("ENVIRONMENT"))
+
+	for _, test := range tests {
+
+		environment := "production"
+		if test.development {
+			environment = "development"
+		}
+
+		os.Setenv("ENVIRONMENT", environment)
+
+		err := dialControl("tcp", test.address, nil)
+
+		if test.allowed && err != nil {
+			t.Errorf("expected %s to be allowed in %s, got %v", test.address, environment, err)
+		}
+
+		if !test.allowed && errors.Cause(err) != ErrForbiddenAddress {
+			t.Errorf("expected %s to be refused in %s, got %v", test.address, environment, err)
+		}
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	defer os.Setenv("ENVIRONMENT", os.Getenv("ENVIRONMENT"))
+	os.Setenv("ENVIRONMENT", "production")
+
+	_, err := newClient().Get(server.URL)
+
+	var opErr *net.OpError
+
+	if !errors.As(err, &opErr) || errors.Cause(opErr.Err) != ErrForbiddenAddress {
+		t.Fatalf("expected the connection to be refused, got %v", err)
+	}
+}
+
+func TestCheckEndpoint(t *testing.T) {
+
+	defer os.Setenv("OIDC_ALLOWED_ENDPOINT_HOSTS", os.Getenv("OIDC_ALLOWED_ENDPOINT_HOSTS"))
+	os.Setenv("OIDC_ALLOWED_ENDPOINT_HOSTS", "oauth2.example.net, keys.example.net")
+
+	issuer, _ := url.Parse("https://idp.example.com")
+
+	tests := []struct {
+		endpoint string
+		allowed  bool
+	}{
+		{"https://idp.example.com/token", true},
+		{"https://IDP.example.com/token", true},
+		{"https://oauth2.example.net/token", true},
+		{"https://keys.example.net/certs", true},
+		{"http://idp.example.com/token", false},
+		{"https://idp.example.com:8443/token", false},
+		{"https://elsewhere.example.com/token", false},
+		{"http://oauth2.example.net/token", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"/token", false},
+	}
+
+	for _, test := range tests {
+		if err := checkEndpoint(issuer, test.endpoint); (err == nil) != test.allowed {
+			t.Errorf("expected %s allowed to be %v, got %v", test.endpoint, test.allowed, err)
+		}
+	}
+}
+
+func TestDiscoverRejectsForeignEndpoints(t *testing.T) {
+
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         "http://169.254.169.254/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	}))
+	defer server.Close()
+
+	if _, err := Discover(context.Background(), server.URL); errors.Cause(err) != ErrDiscovery {
+		t.Fatalf("expected a token endpoint off the issuer's origin to be rejected, got %v", err)
+	}
+}
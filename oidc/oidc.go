@@ -0,0 +1,215 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrDiscovery = errors.New("the identity provider's configuration could not be loaded")
+	ErrExchange  = errors.New("the authorization code could not be exchanged")
+)
+
+// How long a provider's discovery document is used before it is loaded again.
+const discoveryTTL = time.Hour
+
+// The client used to talk to identity providers, replaced in tests.
+var Client = newClient()
+
+// A client registered with an identity provider.
+type Config struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // openid is always requested.
+}
+
+// The endpoints of an identity provider, read from its discovery document.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+
+	fetchedAt time.Time
+	keys      *keySet
+}
+
+// The tokens returned by the token endpoint.
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+var (
+	providersLock sync.Mutex
+	providers     = make(map[string]*Provider)
+)
+
+// Loads the discovery document of an issuer, documents are cached for an hour.
+func Discover(ctx context.Context, issuer string) (*Provider, error) {
+
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	providersLock.Lock()
+	cached, found := providers[issuer]
+	providersLock.Unlock()
+
+	if found && time.Since(cached.fetchedAt) < discoveryTTL {
+		return cached, nil
+	}
+
+	var provider Provider
+
+	if err := getJSON(ctx, issuer+"/.well-known/openid-configuration", &provider); err != nil {
+		return nil, errors.Wrap(ErrDiscovery, err.Error())
+	}
+
+	// The document must describe the issuer it was loaded from, otherwise tokens can't be trusted.
+	if strings.TrimSuffix(provider.Issuer, "/") != issuer {
+		return nil, errors.Wrap(ErrDiscovery, "the issuer does not match: "+provider.Issuer)
+	}
+
+	if len(provider.AuthorizationEndpoint) == 0 || len(provider.TokenEndpoint) == 0 || len(provider.JwksURI) == 0 {
+		return nil, errors.Wrap(ErrDiscovery, "an endpoint is missing")
+	}
+
+	// The document can't send us, or the user, anywhere the issuer doesn't control.
+	origin, err := url.Parse(issuer)
+
+	if err != nil {
+		return nil, errors.Wrap(ErrDiscovery, err.Error())
+	}
+
+	for _, endpoint := range []string{provider.AuthorizationEndpoint, provider.TokenEndpoint, provider.JwksURI} {
+		if err := checkEndpoint(origin, endpoint); err != nil {
+			return nil, errors.Wrap(ErrDiscovery, err.Error())
+		}
+	}
+
+	provider.fetchedAt = time.Now()
+	provider.keys = &keySet{uri: provider.JwksURI}
+
+	providersLock.Lock()
+	providers[issuer] = &provider
+	providersLock.Unlock()
+
+	return &provider, nil
+}
+
+// The URL the user is sent to for logging in, challenge is the PKCE challenge of the verifier kept for the exchange.
+func (p *Provider) AuthCodeURL(config Config, state string, nonce string, challenge string) string {
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", config.ClientId)
+	query.Set("redirect_uri", config.RedirectURL)
+	query.Set("scope", strings.Join(scopes(config), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchanges an authorization code for tokens, proving with the verifier that this client started the login.
+func (p *Provider) Exchange(ctx context.Context, config Config, code string, verifier string) (*Token, error) {
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", config.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	request, err := http.NewRequest(http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(config.ClientId), url.QueryEscape(config.ClientSecret))
+
+	response, err := Client.Do(request.WithContext(ctx))
+
+	if err != nil {
+		return nil, errors.Wrap(ErrExchange, err.Error())
+	}
+
+	defer response.Body.Close()
+
+	// The answer helps whoever reads the server logs, it must not be shown to the user.
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, errors.Wrapf(ErrExchange, "status %d: %s", response.StatusCode, body)
+	}
+
+	var token Token
+
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return nil, errors.Wrap(ErrExchange, err.Error())
+	}
+
+	if len(token.IDToken) == 0 {
+		return nil, errors.Wrap(ErrExchange, "no id token was returned")
+	}
+
+	return &token, nil
+}
+
+func scopes(config Config) []string {
+
+	requested := []string{"openid"}
+
+	for _, scope := range config.Scopes {
+		if scope != "openid" && len(scope) > 0 {
+			requested = append(requested, scope)
+		}
+	}
+
+	return requested
+}
+
+func getJSON(ctx context.Context, uri string, target interface{}) error {
+
+	request, err := http.NewRequest(http.MethodGet, uri, nil)
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Accept", "application/json")
+
+	response, err := Client.Do(request.WithContext(ctx))
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.Errorf("%s returned status %d", uri, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
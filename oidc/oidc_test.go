@@ -0,0 +1,273 @@
+package oidc_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	oidc "go-multitenancy-boilerplate/oidc"
+	oidctest "go-multitenancy-boilerplate/oidc/oidctest"
+
+	"github.com/pkg/errors"
+)
+
+func TestMain(m *testing.M) {
+
+	// The test provider runs on this machine, which only development allows.
+	os.Setenv("ENVIRONMENT", "development")
+
+	os.Exit(m.Run())
+}
+
+func TestVerifyIDToken(t *testing.T) {
+
+	server := oidctest.NewServer("client", "secret")
+	defer server.Close()
+
+	other := oidctest.NewServer("client", "secret")
+	defer other.Close()
+
+	ctx := context.Background()
+
+	provider, err := oidc.Discover(ctx, server.Issuer())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := oidc.Config{Issuer: server.Issuer(), ClientId: "client", ClientSecret: "secret"}
+
+	claims := func(change func(c oidc.Claims)) oidc.Claims {
+
+		now := time.Now()
+
+		c := oidc.Claims{
+			"iss":   server.Issuer(),
+			"aud":   "client",
+			"sub":   "user-1",
+			"nonce": "nonce",
+			"iat":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+		}
+
+		change(c)
+
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		signer *oidctest.Server
+		claims oidc.Claims
+		nonce  string
+		tamper func(raw string) string
+		valid  bool
+	}{
+		{name: "valid", signer: server, claims: claims(func(c oidc.Claims) {}), nonce: "nonce", valid: true},
+		{name: "wrong issuer", signer: server, claims: claims(func(c oidc.Claims) { c["iss"] = other.Issuer() }), nonce: "nonce"},
+		{name: "wrong audience", signer: server, claims: claims(func(c oidc.Claims) { c["aud"] = "other" }), nonce: "nonce"},
+		{name: "wrong nonce", signer: server, claims: claims(func(c oidc.Claims) {}), nonce: "other"},
+		{name: "expired", signer: server, claims: claims(func(c oidc.Claims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), nonce: "nonce"},
+		{name: "signed by another provider", signer: other, claims: claims(func(c oidc.Claims) {}), nonce: "nonce"},
+		{name: "tampered claims", signer: server, claims: claims(func(c oidc.Claims) {}), nonce: "nonce", tamper: func(raw string) string {
+			forged, _ := other.Sign(claims(func(c oidc.Claims) { c["sub"] = "admin" }))
+			return splice(raw, forged)
+		}},
+		{name: "unsigned", signer: server, claims: claims(func(c oidc.Claims) {}), nonce: "nonce", tamper: func(raw string) string {
+			return "eyJhbGciOiJub25lIn0." + segment(raw, 1) + "."
+		}},
+		{name: "malformed", signer: server, claims: claims(func(c oidc.Claims) {}), nonce: "nonce", tamper: func(raw string) string {
+			return "not-a-token"
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			raw, err := test.signer.Sign(test.claims)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.tamper != nil {
+				raw = test.tamper(raw)
+			}
+
+			verified, err := provider.VerifyIDToken(ctx, config, raw, test.nonce)
+
+			if test.valid {
+				if err != nil {
+					t.Fatalf("expected the token to be valid, got %v", err)
+				}
+				if verified.Subject() != "user-1" {
+					t.Fatalf("expected subject user-1, got %q", verified.Subject())
+				}
+				return
+			}
+
+			if errors.Cause(err) != oidc.ErrInvalidIDToken {
+				t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+
+	server := oidctest.NewServer("client", "secret")
+	defer server.Close()
+
+	ctx := context.Background()
+
+	provider, err := oidc.Discover(ctx, server.Issuer())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := oidc.Config{Issuer: server.Issuer(), ClientId: "client", ClientSecret: "secret"}
+
+	sign := func() string {
+
+		raw, err := server.Sign(oidc.Claims{
+			"iss": server.Issuer(),
+			"aud": "client",
+			"sub": "user-1",
+			"exp": time.Now().Add(5 * time.Minute).Unix(),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return raw
+	}
+
+	before := sign()
+
+	if _, err := provider.VerifyIDToken(ctx, config, before, ""); err != nil {
+		t.Fatalf("expected a token of the first key to be valid, got %v", err)
+	}
+
+	server.RotateKey()
+
+	after := sign()
+
+	steps := []struct {
+		name   string
+		raw    string
+		expire bool // Acts as if the keys were loaded over a minute ago.
+		valid  bool
+	}{
+		// Keys are loaded at most once a minute, a new key id can't make them load again straight away.
+		{"new key right after loading", after, false, false},
+		{"new key once the keys can load again", after, true, true},
+		{"retired key", before, true, false},
+	}
+
+	for _, step := range steps {
+
+		if step.expire {
+			oidc.ExpireKeys(provider)
+		}
+
+		_, err := provider.VerifyIDToken(ctx, config, step.raw, "")
+
+		if step.valid && err != nil {
+			t.Fatalf("%s: expected the token to be valid, got %v", step.name, err)
+		}
+
+		if !step.valid && errors.Cause(err) != oidc.ErrInvalidIDToken {
+			t.Fatalf("%s: expected ErrInvalidIDToken, got %v", step.name, err)
+		}
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+
+	server := oidctest.NewServer("client", "secret")
+	defer server.Close()
+
+	server.SetUser(oidc.Claims{"sub": "user-1", "email": "user@example.com"})
+
+	ctx := context.Background()
+
+	provider, err := oidc.Discover(ctx, server.Issuer())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := oidc.Config{Issuer: server.Issuer(), ClientId: "client", ClientSecret: "secret", RedirectURL: "https://acme.example.com/callback"}
+
+	verifier, err := oidc.GenerateVerifier()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := oidc.GenerateVerifier()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		verifier string
+		valid    bool
+	}{
+		{"matching verifier", verifier, true},
+		{"another verifier", other, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			redirect, err := server.Authorize(provider.AuthCodeURL(config, "state", "nonce", oidc.Challenge(verifier)))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if redirect.Query().Get("state") != "state" {
+				t.Fatalf("expected the state back, got %q", redirect.Query().Get("state"))
+			}
+
+			token, err := provider.Exchange(ctx, config, redirect.Query().Get("code"), test.verifier)
+
+			if !test.valid {
+				if errors.Cause(err) != oidc.ErrExchange {
+					t.Fatalf("expected ErrExchange, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := provider.VerifyIDToken(ctx, config, token.IDToken, "nonce")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if claims.String("email") != "user@example.com" {
+				t.Fatalf("expected the user's email, got %q", claims.String("email"))
+			}
+		})
+	}
+}
+
+// Puts the claims of one token under the header and signature of another.
+func splice(raw string, forged string) string {
+	return segment(raw, 0) + "." + segment(forged, 1) + "." + segment(raw, 2)
+}
+
+func segment(raw string, i int) string {
+	return strings.Split(raw, ".")[i]
+}
@@ -0,0 +1,317 @@
+// Package oidctest runs a fake OpenID Connect identity provider for tests and local development.
+// It logs every authorization request straight in as the configured user, no login page is shown.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	oidc "go-multitenancy-boilerplate/oidc"
+)
+
+// The key id the fake provider signs with, until its key is rotated.
+const KeyId = "oidctest"
+
+// A fake provider for one client.
+type Server struct {
+	*httptest.Server
+	ClientId     string
+	ClientSecret string
+	// How long issued id tokens are valid.
+	TokenTTL time.Duration
+
+	key   *rsa.PrivateKey
+	keyId string
+	keys  int // Keys generated so far, numbers the key ids after rotations.
+	lock  sync.Mutex
+	user  oidc.Claims
+	codes map[string]authorization
+}
+
+// An authorization code waiting to be exchanged.
+type authorization struct {
+	redirectURL string
+	challenge   string
+	nonce       string
+	claims      oidc.Claims
+}
+
+// Starts a fake provider, close it once done.
+func NewServer(clientId string, clientSecret string) *Server {
+
+	s := &Server{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		TokenTTL:     5 * time.Minute,
+		user:         oidc.Claims{"sub": "oidctest-user"},
+		codes:        make(map[string]authorization),
+	}
+
+	s.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("/authorize", s.handleAuthorize)
+	mux.HandleFunc("/token", s.handleToken)
+	mux.HandleFunc("/jwks", s.handleKeys)
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// The issuer to configure the tenant with.
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// Sets the claims of the user the next logins are made as, they must include sub.
+func (s *Server) SetUser(claims oidc.Claims) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.user = claims
+}
+
+// Replaces the signing key with a new one under a new key id, the old key is no longer published.
+func (s *Server) RotateKey() {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		panic(err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.key = key
+	s.keyId = KeyId
+
+	if s.keys > 0 {
+		s.keyId = fmt.Sprintf("%s-%d", KeyId, s.keys)
+	}
+
+	s.keys++
+}
+
+// Follows an authorization URL as a browser would, returning the URL the provider redirects back to with the code.
+func (s *Server) Authorize(authorizationURL string) (*url.URL, error) {
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	response, err := client.Get(authorizationURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	return response.Location()
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer(),
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+
+	if query.Get("client_id") != s.ClientId || query.Get("response_type") != "code" {
+		http.Error(w, "unknown client or response type", http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("code_challenge_method") != "S256" || len(query.Get("code_challenge")) == 0 {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	redirectURL, err := url.Parse(query.Get("redirect_uri"))
+
+	if err != nil || !redirectURL.IsAbs() {
+		http.Error(w, "invalid redirect uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+
+	s.lock.Lock()
+	s.codes[code] = authorization{
+		redirectURL: query.Get("redirect_uri"),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		claims:      s.user,
+	}
+	s.lock.Unlock()
+
+	values := redirectURL.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirectURL.RawQuery = values.Encode()
+
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	clientId, clientSecret, ok := r.BasicAuth()
+
+	if ok {
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if clientId != s.ClientId || clientSecret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// Codes are single use.
+	s.lock.Lock()
+	pending, found := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.lock.Unlock()
+
+	if !found || pending.redirectURL != r.PostForm.Get("redirect_uri") || oidc.Challenge(r.PostForm.Get("code_verifier")) != pending.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := s.Sign(s.idTokenClaims(pending))
+
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, oidc.Token{
+		AccessToken: randomString(),
+		TokenType:   "Bearer",
+		IDToken:     idToken,
+		ExpiresIn:   int(s.TokenTTL.Seconds()),
+	})
+}
+
+func (s *Server) idTokenClaims(pending authorization) oidc.Claims {
+
+	now := time.Now()
+
+	claims := oidc.Claims{}
+
+	for name, value := range pending.claims {
+		claims[name] = value
+	}
+
+	claims["iss"] = s.Issuer()
+	claims["aud"] = s.ClientId
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(s.TokenTTL).Unix()
+
+	if len(pending.nonce) > 0 {
+		claims["nonce"] = pending.nonce
+	}
+
+	return claims
+}
+
+// Signs claims as the provider would, for tests of tokens the provider wouldn't issue.
+func (s *Server) Sign(claims oidc.Claims) (string, error) {
+
+	s.lock.Lock()
+	key, keyId := s.key, s.keyId
+	s.lock.Unlock()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyId})
+
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(unsigned))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+
+	s.lock.Lock()
+	public, keyId := s.key.PublicKey, s.keyId
+	s.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyId,
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+
+	buffer := make([]byte, 24)
+
+	if _, err := rand.Read(buffer); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buffer)
+}
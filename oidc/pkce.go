@@ -0,0 +1,19 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+)
+
+// Generates a PKCE code verifier, 43 url safe characters as RFC 7636 recommends.
+func GenerateVerifier() (string, error) {
+	return helpers.GenerateToken(32)
+}
+
+// The S256 challenge of a verifier, sent with the authorization request.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,62 @@
+package passwords
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	commonOnce sync.Once
+	common     map[string]bool
+)
+
+// Whether a password is on the bundled list of common passwords, compared case insensitively.
+// The list is read once from PASSWORD_COMMON_LIST, a missing list disables the check.
+func IsCommon(password string) bool {
+
+	commonOnce.Do(func() {
+		common = loadCommon(commonListPath())
+	})
+
+	return common[strings.ToLower(password)]
+}
+
+func loadCommon(path string) map[string]bool {
+
+	list := make(map[string]bool)
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		fmt.Println("The common password list could not be read, common passwords are allowed", err)
+		return list
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); len(line) > 0 && !strings.HasPrefix(line, "#") {
+			list[strings.ToLower(line)] = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Println("The common password list could not be read completely", err)
+	}
+
+	return list
+}
+
+func commonListPath() string {
+
+	if path := strings.TrimSpace(os.Getenv("PASSWORD_COMMON_LIST")); len(path) > 0 {
+		return path
+	}
+
+	return "passwords/common-passwords.txt"
+}
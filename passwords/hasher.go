@@ -0,0 +1,253 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms a password can be hashed with, chosen with PASSWORD_HASHER.
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var ErrMalformedHash = errors.New("the password hash is malformed")
+
+// Hashes passwords with one algorithm and its parameters.
+// Hashes carry their algorithm and parameters, so a hasher can tell when one was made with weaker settings.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, encoded string) bool
+	// Whether the hash was made with another algorithm or weaker parameters than this hasher uses.
+	NeedsRehash(encoded string) bool
+}
+
+var (
+	hasherOnce    sync.Once
+	defaultHasher Hasher
+)
+
+// The hasher configured in the environment, read once.
+func DefaultHasher() Hasher {
+
+	hasherOnce.Do(func() {
+		defaultHasher = hasherFromEnv()
+	})
+
+	return defaultHasher
+}
+
+// Hashes a password with the configured hasher.
+func Hash(password string) (string, error) {
+	return DefaultHasher().Hash(password)
+}
+
+// Checks a password against a hash made by any supported algorithm, so older hashes keep working after the hasher changes.
+func Verify(password string, encoded string) bool {
+
+	switch {
+	case strings.HasPrefix(encoded, "$"+AlgorithmArgon2id+"$"):
+		return Argon2idHasher{}.Verify(password, encoded)
+	case strings.HasPrefix(encoded, "$2"):
+		return BcryptHasher{}.Verify(password, encoded)
+	}
+
+	return false
+}
+
+// Takes about as long as verifying a password with the configured hasher, for logins of unknown accounts
+// which shouldn't fail any sooner than wrong passwords do.
+func VerifyUnknown(password string) {
+	DefaultHasher().Hash(password)
+}
+
+// Whether a hash should be replaced with one from the configured hasher, checked once its password was verified.
+func NeedsRehash(encoded string) bool {
+	return DefaultHasher().NeedsRehash(encoded)
+}
+
+func hasherFromEnv() Hasher {
+
+	algorithm := strings.ToLower(strings.TrimSpace(os.Getenv("PASSWORD_HASHER")))
+
+	switch algorithm {
+	case AlgorithmArgon2id:
+		return Argon2idHasher{
+			Memory:      uint32(helpers.GetEnvInt("PASSWORD_ARGON2_MEMORY", 64*1024)),
+			Iterations:  uint32(helpers.GetEnvInt("PASSWORD_ARGON2_ITERATIONS", 3)),
+			Parallelism: uint8(helpers.GetEnvInt("PASSWORD_ARGON2_PARALLELISM", 2)),
+		}
+	case "", AlgorithmBcrypt:
+	default:
+		fmt.Println("Unknown PASSWORD_HASHER", algorithm, "passwords are hashed with bcrypt")
+	}
+
+	return BcryptHasher{Cost: helpers.GetEnvInt("PASSWORD_BCRYPT_COST", 12)}
+}
+
+// Bcrypt
+//
+
+type BcryptHasher struct {
+	Cost int
+}
+
+// Costs below bcrypt's default are raised to it.
+func (h BcryptHasher) cost() int {
+
+	if h.Cost < bcrypt.DefaultCost {
+		return bcrypt.DefaultCost
+	}
+
+	if h.Cost > bcrypt.MaxCost {
+		return bcrypt.MaxCost
+	}
+
+	return h.Cost
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost())
+	return string(hash), err
+}
+
+func (h BcryptHasher) Verify(password string, encoded string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err != nil || cost < h.cost()
+}
+
+// Argon2id
+//
+
+// Memory is in KiB. Hashes are encoded as $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var argon2Encoding = base64.RawStdEncoding
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// Parameters below the OWASP minimum are raised to it.
+func (h Argon2idHasher) params() argon2Params {
+
+	p := argon2Params{memory: h.Memory, iterations: h.Iterations, parallelism: h.Parallelism}
+
+	if p.memory < 19*1024 {
+		p.memory = 19 * 1024
+	}
+	if p.iterations < 2 {
+		p.iterations = 2
+	}
+	if p.parallelism < 1 {
+		p.parallelism = 1
+	}
+
+	return p
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+
+	p := h.params()
+
+	p.salt = make([]byte, argon2SaltLength)
+
+	if _, err := rand.Read(p.salt); err != nil {
+		return "", err
+	}
+
+	p.key = argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", AlgorithmArgon2id, argon2.Version, p.memory, p.iterations, p.parallelism,
+		argon2Encoding.EncodeToString(p.salt), argon2Encoding.EncodeToString(p.key)), nil
+}
+
+func (h Argon2idHasher) Verify(password string, encoded string) bool {
+
+	p, err := decodeArgon2id(encoded)
+
+	if err != nil {
+		return false
+	}
+
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+
+	return subtle.ConstantTimeCompare(key, p.key) == 1
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+
+	p, err := decodeArgon2id(encoded)
+
+	if err != nil {
+		return true
+	}
+
+	want := h.params()
+
+	return p.memory < want.memory || p.iterations < want.iterations || p.parallelism < want.parallelism || len(p.key) < argon2KeyLength
+}
+
+func decodeArgon2id(encoded string) (argon2Params, error) {
+
+	var p argon2Params
+
+	// "", "argon2id", "v=19", "m=…,t=…,p=…", salt, key
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return p, ErrMalformedHash
+	}
+
+	var version int
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, ErrMalformedHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, ErrMalformedHash
+	}
+
+	var err error
+
+	if p.salt, err = argon2Encoding.DecodeString(parts[4]); err != nil {
+		return p, ErrMalformedHash
+	}
+
+	if p.key, err = argon2Encoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return p, ErrMalformedHash
+	}
+
+	return p, nil
+}
@@ -0,0 +1,109 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+
+	hashers := map[string]Hasher{
+		AlgorithmBcrypt:   BcryptHasher{Cost: 10},
+		AlgorithmArgon2id: Argon2idHasher{Memory: 19 * 1024, Iterations: 2, Parallelism: 1},
+	}
+
+	for algorithm, hasher := range hashers {
+		t.Run(algorithm, func(t *testing.T) {
+
+			encoded, err := hasher.Hash("Correct-Horse7")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !Verify("Correct-Horse7", encoded) {
+				t.Fatal("expected the password to match its hash")
+			}
+
+			if Verify("correct-horse7", encoded) {
+				t.Fatal("expected another password not to match")
+			}
+
+			if again, _ := hasher.Hash("Correct-Horse7"); again == encoded {
+				t.Fatal("expected every hash to be salted")
+			}
+
+			if Verify("Correct-Horse7", encoded[:len(encoded)-4]) {
+				t.Fatal("expected a truncated hash not to match")
+			}
+		})
+	}
+
+	if Verify("Correct-Horse7", "$argon2i$v=19$m=19456,t=2,p=1$c2FsdA$a2V5") || Verify("", "") {
+		t.Fatal("expected unknown algorithms not to match")
+	}
+
+	if !strings.HasPrefix(hashOrFail(t, Argon2idHasher{}), "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatal("expected parameters below the minimum to be raised to it")
+	}
+}
+
+func hashOrFail(t *testing.T, hasher Hasher) string {
+
+	encoded, err := hasher.Hash("Correct-Horse7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encoded
+}
+
+func TestNeedsRehash(t *testing.T) {
+
+	bcrypt := BcryptHasher{Cost: 10}
+	argon2id := Argon2idHasher{Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+	hash := func(hasher Hasher) string {
+
+		encoded, err := hasher.Hash("Correct-Horse7")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return encoded
+	}
+
+	bcryptHash := hash(bcrypt)
+	argon2idHash := hash(argon2id)
+
+	tests := []struct {
+		name    string
+		hasher  Hasher
+		encoded string
+		rehash  bool
+	}{
+		{"bcrypt with the same cost", bcrypt, bcryptHash, false},
+		{"bcrypt with a higher cost", BcryptHasher{Cost: 11}, bcryptHash, true},
+		{"bcrypt below the default cost", BcryptHasher{Cost: 4}, bcryptHash, false},
+		{"bcrypt for an argon2id hash", bcrypt, argon2idHash, true},
+		{"bcrypt for a malformed hash", bcrypt, "not a hash", true},
+		{"argon2id with the same parameters", argon2id, argon2idHash, false},
+		{"argon2id below the minimum parameters", Argon2idHasher{}, argon2idHash, false},
+		{"argon2id with more memory", Argon2idHasher{Memory: 32 * 1024, Iterations: 2, Parallelism: 1}, argon2idHash, true},
+		{"argon2id with more iterations", Argon2idHasher{Memory: 19 * 1024, Iterations: 3, Parallelism: 1}, argon2idHash, true},
+		{"argon2id with more parallelism", Argon2idHasher{Memory: 19 * 1024, Iterations: 2, Parallelism: 2}, argon2idHash, true},
+		{"argon2id for a bcrypt hash", argon2id, bcryptHash, true},
+		{"argon2id for a malformed hash", argon2id, "$argon2id$v=19$m=19456", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			if rehash := test.hasher.NeedsRehash(test.encoded); rehash != test.rehash {
+				t.Fatalf("expected NeedsRehash to be %v, got %v", test.rehash, rehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package passwords
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+)
+
+// Rules a password can break, reported with every violation.
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleUppercase = "uppercase"
+	RuleLowercase = "lowercase"
+	RuleDigit     = "digit"
+	RuleSpecial   = "special"
+	RuleCommon    = "common"
+	RuleHistory   = "history"
+)
+
+// Longer passwords are refused so hashing stays cheap.
+const MaxLength = 128
+
+// The rules a new password has to follow.
+type Policy struct {
+	MinLength        int           `json:"minLength"`
+	RequireUppercase bool          `json:"requireUppercase"`
+	RequireLowercase bool          `json:"requireLowercase"`
+	RequireDigit     bool          `json:"requireDigit"`
+	RequireSpecial   bool          `json:"requireSpecial"`
+	RejectCommon     bool          `json:"rejectCommon"` // Refuses passwords from the bundled list of common passwords.
+	History          int           `json:"history"`      // How many previous passwords can't be used again, 0 allows any.
+	MaxAge           time.Duration `json:"maxAge"`       // How long a password can be used before it has to be changed, 0 never expires.
+}
+
+// A broken rule.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Returned when a password breaks the policy, holding every broken rule.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+
+	messages := make([]string, 0, len(e.Violations))
+
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+
+	return "the password does not meet the password policy: " + strings.Join(messages, " ")
+}
+
+// The platform policy from the environment, used for master users and tenants which don't override it.
+// The defaults are the rules passwords always had: at least 8 characters, a capital letter and a special character.
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:        helpers.GetEnvInt("PASSWORD_MIN_LENGTH", 8),
+		RequireUppercase: helpers.GetEnvBool("PASSWORD_REQUIRE_UPPERCASE", true),
+		RequireLowercase: helpers.GetEnvBool("PASSWORD_REQUIRE_LOWERCASE", false),
+		RequireDigit:     helpers.GetEnvBool("PASSWORD_REQUIRE_DIGIT", false),
+		RequireSpecial:   helpers.GetEnvBool("PASSWORD_REQUIRE_SPECIAL", true),
+		RejectCommon:     helpers.GetEnvBool("PASSWORD_REJECT_COMMON", true),
+		History:          helpers.GetEnvInt("PASSWORD_HISTORY", 0),
+		MaxAge:           helpers.GetEnvDuration("PASSWORD_MAX_AGE", 0),
+	}
+}
+
+// Checks a password against every rule that doesn't need earlier passwords, returns all broken rules.
+func (p Policy) Check(password string) []Violation {
+
+	var violations []Violation
+
+	length := len([]rune(password))
+
+	if length < p.MinLength {
+		violations = append(violations, Violation{RuleMinLength, "The password must be at least " + helpers.Int64ToString(int64(p.MinLength)) + " characters long."})
+	}
+
+	if length > MaxLength {
+		violations = append(violations, Violation{RuleMaxLength, "The password can't be longer than " + helpers.Int64ToString(MaxLength) + " characters."})
+	}
+
+	var upper, lower, digit, special bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r) && !unicode.IsSpace(r):
+			special = true
+		}
+	}
+
+	if p.RequireUppercase && !upper {
+		violations = append(violations, Violation{RuleUppercase, "The password must contain a capital letter."})
+	}
+
+	if p.RequireLowercase && !lower {
+		violations = append(violations, Violation{RuleLowercase, "The password must contain a lower case letter."})
+	}
+
+	if p.RequireDigit && !digit {
+		violations = append(violations, Violation{RuleDigit, "The password must contain a number."})
+	}
+
+	if p.RequireSpecial && !special {
+		violations = append(violations, Violation{RuleSpecial, "The password must contain a special character."})
+	}
+
+	if p.RejectCommon && IsCommon(password) {
+		violations = append(violations, Violation{RuleCommon, "The password is too common, please choose another one."})
+	}
+
+	return violations
+}
+
+// Checks a password, returning a *PolicyError with every broken rule.
+func (p Policy) Validate(password string) error {
+
+	if violations := p.Check(password); len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// Whether a password set at the given time has to be changed.
+func (p Policy) Expired(changedAt *time.Time, now time.Time) bool {
+	return p.MaxAge > 0 && changedAt != nil && now.Sub(*changedAt) > p.MaxAge
+}
+
+// The violation reported when a password was used before.
+func HistoryViolation(history int) Violation {
+	return Violation{RuleHistory, "The password can't be one of your last " + helpers.Int64ToString(int64(history)) + " passwords."}
+}
@@ -0,0 +1,57 @@
+package passwords
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+
+	// The bundled list is found relative to the repository root, tests run from the package directory.
+	os.Setenv("PASSWORD_COMMON_LIST", "common-passwords.txt")
+
+	os.Exit(m.Run())
+}
+
+func TestPolicyCheck(t *testing.T) {
+
+	strict := Policy{MinLength: 10, RequireUppercase: true, RequireLowercase: true, RequireDigit: true, RequireSpecial: true, RejectCommon: true}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		password string
+		broken   []string
+	}{
+		{"meets every rule", strict, "Correct-Horse7", nil},
+		{"too short", strict, "Sh0rt!x", []string{RuleMinLength}},
+		{"length counts characters not bytes", Policy{MinLength: 4}, "äöüß", nil},
+		{"too long", Policy{}, strings.Repeat("a", MaxLength+1), []string{RuleMaxLength}},
+		{"no capital letter", strict, "correct-horse7", []string{RuleUppercase}},
+		{"no lower case letter", strict, "CORRECT-HORSE7", []string{RuleLowercase}},
+		{"no number", strict, "Correct-Horse", []string{RuleDigit}},
+		{"no special character", strict, "CorrectHorse7", []string{RuleSpecial}},
+		{"spaces are not special", strict, "Correct Horse7", []string{RuleSpecial}},
+		{"common", Policy{RejectCommon: true}, "password", []string{RuleCommon}},
+		{"common in another case", Policy{RejectCommon: true}, "PassWord", []string{RuleCommon}},
+		{"common allowed", Policy{}, "password", nil},
+		{"every rule broken", strict, "abc123", []string{RuleMinLength, RuleUppercase, RuleSpecial, RuleCommon}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			var broken []string
+
+			for _, violation := range test.policy.Check(test.password) {
+				broken = append(broken, violation.Rule)
+			}
+
+			if !reflect.DeepEqual(broken, test.broken) {
+				t.Fatalf("expected %v to be broken, got %v", test.broken, broken)
+			}
+		})
+	}
+}
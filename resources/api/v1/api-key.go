@@ -0,0 +1,49 @@
+package v1resources
+
+import (
+	"time"
+
+	tenants "go-multitenancy-boilerplate/models/tenants"
+)
+
+type CreateApiKeyRequest struct {
+	Name       string     `form:"name" json:"name" binding:"required"`
+	Scopes     []string   `form:"scopes" json:"scopes" binding:"required"`
+	AllowedIps []string   `form:"allowedIps" json:"allowedIps"`
+	ExpiresAt  *time.Time `form:"expiresAt" json:"expiresAt"`
+}
+
+// An API key without its secret, which only the creator ever sees.
+type ApiKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIps []string   `json:"allowedIps"`
+	CreatedBy  uint       `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIp string     `json:"lastUsedIp,omitempty"`
+}
+
+// A new API key, the key is shown this once.
+type CreatedApiKeyResponse struct {
+	ApiKeyResponse
+	Key string `json:"key"`
+}
+
+func NewApiKeyResponse(k tenants.TenantApiKey) ApiKeyResponse {
+	return ApiKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.ScopeList(),
+		AllowedIps: k.AllowedIpList(),
+		CreatedBy:  k.CreatedBy,
+		CreatedAt:  k.CreatedAt,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		LastUsedIp: k.LastUsedIp,
+	}
+}
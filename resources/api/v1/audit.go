@@ -0,0 +1,65 @@
+package v1resources
+
+import (
+	"encoding/json"
+	"time"
+
+	models "go-multitenancy-boilerplate/models"
+)
+
+type ListAuditEventsRequest struct {
+	PaginationRequest
+	ActorId    uint       `form:"actorId" json:"actorId"`
+	Action     string     `form:"action" json:"action"`
+	TargetType string     `form:"targetType" json:"targetType"`
+	TargetId   uint       `form:"targetId" json:"targetId"`
+	Outcome    string     `form:"outcome" json:"outcome"`
+	TenantId   uint       `form:"tenantId" json:"tenantId"`
+	From       *time.Time `form:"from" json:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         *time.Time `form:"to" json:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// AuditEventResponse struct
+type AuditEventResponse struct {
+	ID               uint            `json:"id"`
+	CreatedAt        time.Time       `json:"createdAt"`
+	ActorType        string          `json:"actorType"`
+	ActorId          uint            `json:"actorId"`
+	ActorEmail       string          `json:"actorEmail,omitempty"`
+	TenantId         uint            `json:"tenantId,omitempty"`
+	TenantIdentifier string          `json:"tenantIdentifier,omitempty"`
+	Action           string          `json:"action"`
+	TargetType       string          `json:"targetType"`
+	TargetId         uint            `json:"targetId,omitempty"`
+	Outcome          string          `json:"outcome"`
+	Error            string          `json:"error,omitempty"`
+	IP               string          `json:"ip"`
+	UserAgent        string          `json:"userAgent"`
+	Changes          json.RawMessage `json:"changes,omitempty"`
+}
+
+func NewAuditEventResponse(e models.AuditEvent) AuditEventResponse {
+
+	response := AuditEventResponse{
+		ID:               e.ID,
+		CreatedAt:        e.CreatedAt,
+		ActorType:        e.ActorType,
+		ActorId:          e.ActorId,
+		ActorEmail:       e.ActorEmail,
+		TenantId:         e.TenantId,
+		TenantIdentifier: e.TenantIdentifier,
+		Action:           e.Action,
+		TargetType:       e.TargetType,
+		TargetId:         e.TargetId,
+		Outcome:          e.Outcome,
+		Error:            e.Error,
+		IP:               e.IP,
+		UserAgent:        e.UserAgent,
+	}
+
+	if len(e.Changes) > 0 {
+		response.Changes = json.RawMessage(e.Changes)
+	}
+
+	return response
+}
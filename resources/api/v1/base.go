@@ -14,6 +14,33 @@ type Response struct {
 	Errors  []interface{} `json:"error,omitempty"`
 }
 
+// Paging parameters shared by every list endpoint.
+type PaginationRequest struct {
+	Page     int `form:"page" json:"page"`
+	PageSize int `form:"pageSize" json:"pageSize"`
+}
+
+// Clamps the paging parameters to sensible values.
+func (p *PaginationRequest) Normalize() {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.PageSize < 1 {
+		p.PageSize = 20
+	}
+	if p.PageSize > 100 {
+		p.PageSize = 100
+	}
+}
+
+// Response data for a single page of a list.
+type PaginatedResponse struct {
+	Items    interface{} `json:"items"`
+	Total    int         `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+}
+
 //Message returns map data
 func Failed(c *gin.Context, status int, message string, errors ...interface{}) {
 	c.AbortWithStatusJSON(status, Response{
@@ -29,3 +56,11 @@ func Succeeded(c *gin.Context, data interface{}) {
 		Data:    data,
 	})
 }
+
+// Responds with 202 for work which continues in the background.
+func Accepted(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Data:    data,
+	})
+}
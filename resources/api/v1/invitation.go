@@ -0,0 +1,56 @@
+package v1resources
+
+import (
+	"time"
+
+	models "go-multitenancy-boilerplate/models"
+)
+
+type CreateInvitationRequest struct {
+	Email  string `form:"email" json:"email" binding:"required"`
+	RoleId uint   `form:"roleId" json:"roleId"`
+}
+
+type ListInvitationsRequest struct {
+	PaginationRequest
+	Status string `form:"status" json:"status"`
+}
+
+type AcceptInvitationRequest struct {
+	Token     string `form:"token" json:"token" binding:"required"`
+	Password  string `form:"password" json:"password" binding:"required"`
+	FirstName string `form:"firstName" json:"firstName" binding:"required"`
+	LastName  string `form:"lastName" json:"lastName" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `form:"token" json:"token" binding:"required"`
+}
+
+type InvitationResponse struct {
+	ID         uint       `json:"id"`
+	Email      string     `json:"email"`
+	RoleId     uint       `json:"roleId"`
+	InvitedBy  uint       `json:"invitedBy"`
+	Status     string     `json:"status"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	UserId     uint       `json:"userId,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func NewInvitationResponse(i models.Invitation) InvitationResponse {
+	return InvitationResponse{
+		ID:         i.ID,
+		Email:      i.Email,
+		RoleId:     i.RoleId,
+		InvitedBy:  i.InvitedBy,
+		Status:     i.Status(time.Now().UTC()),
+		ExpiresAt:  i.ExpiresAt,
+		AcceptedAt: i.AcceptedAt,
+		RevokedAt:  i.RevokedAt,
+		UserId:     i.UserId,
+		CreatedAt:  i.CreatedAt,
+	}
+}
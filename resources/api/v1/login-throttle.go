@@ -0,0 +1,8 @@
+package v1resources
+
+// Unlocks throttled logins from an IP address, or with an email address of a tenant or, without a tenant id, the master dashboard.
+type UnlockLoginRequest struct {
+	IpAddress string `form:"ipAddress" json:"ipAddress"`
+	Email     string `form:"email" json:"email"`
+	TenantId  uint   `form:"tenantId" json:"tenantId"`
+}
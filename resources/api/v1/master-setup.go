@@ -0,0 +1,11 @@
+package v1resources
+
+type MasterSetupRequest struct {
+	Token    string `form:"token" json:"token" binding:"required"`
+	Email    string `form:"email" json:"email" binding:"required"`
+	Password string `form:"password" json:"password" binding:"required"`
+}
+
+type MasterSetupStatusResponse struct {
+	Pending bool `json:"pending"`
+}
@@ -0,0 +1,55 @@
+package v1resources
+
+import (
+	"time"
+
+	migrations "go-multitenancy-boilerplate/database/migrations"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+)
+
+// MigrationStatusResponse struct
+type MigrationStatusResponse struct {
+	CurrentVersion int64                        `json:"currentVersion"`
+	LatestVersion  int64                        `json:"latestVersion"`
+	Migrations     []migrations.MigrationStatus `json:"migrations"`
+}
+
+type StartFleetMigrationRequest struct {
+	OnlyFailed  bool   `form:"onlyFailed" json:"onlyFailed"`
+	Concurrency int    `form:"concurrency" json:"concurrency"`
+	TenantIds   []uint `form:"tenantIds" json:"tenantIds"`
+}
+
+type ListMigrationResultsRequest struct {
+	PaginationRequest
+	RunId    string `form:"runId" json:"runId"`
+	TenantId uint   `form:"tenantId" json:"tenantId"`
+	Status   string `form:"status" json:"status"`
+}
+
+// TenantMigrationResultResponse struct
+type TenantMigrationResultResponse struct {
+	ID          uint      `json:"id"`
+	RunId       string    `json:"runId"`
+	TenantId    uint      `json:"tenantId"`
+	FromVersion int64     `json:"fromVersion"`
+	ToVersion   int64     `json:"toVersion"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+}
+
+func NewTenantMigrationResultResponse(r tenants.TenantMigrationResult) TenantMigrationResultResponse {
+	return TenantMigrationResultResponse{
+		ID:          r.ID,
+		RunId:       r.RunId,
+		TenantId:    r.TenantId,
+		FromVersion: r.FromVersion,
+		ToVersion:   r.ToVersion,
+		Status:      r.Status,
+		Error:       r.Error,
+		StartedAt:   r.StartedAt,
+		FinishedAt:  r.FinishedAt,
+	}
+}
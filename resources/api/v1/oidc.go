@@ -0,0 +1,66 @@
+package v1resources
+
+import (
+	"time"
+
+	tenants "go-multitenancy-boilerplate/models/tenants"
+)
+
+// Fields left out of the request keep their current value, roleMapping replaces the whole mapping.
+type UpdateOidcConfigRequest struct {
+	Enabled              *bool             `form:"enabled" json:"enabled"`
+	Issuer               *string           `form:"issuer" json:"issuer"`
+	ClientId             *string           `form:"clientId" json:"clientId"`
+	ClientSecret         *string           `form:"clientSecret" json:"clientSecret"`
+	Scopes               *string           `form:"scopes" json:"scopes"`
+	EmailClaim           *string           `form:"emailClaim" json:"emailClaim"`
+	FirstNameClaim       *string           `form:"firstNameClaim" json:"firstNameClaim"`
+	LastNameClaim        *string           `form:"lastNameClaim" json:"lastNameClaim"`
+	PhoneNumberClaim     *string           `form:"phoneNumberClaim" json:"phoneNumberClaim"`
+	RolesClaim           *string           `form:"rolesClaim" json:"rolesClaim"`
+	RoleMapping          map[string]string `form:"roleMapping" json:"roleMapping"`
+	AutoProvision        *bool             `form:"autoProvision" json:"autoProvision"`
+	DisablePasswordLogin *bool             `form:"disablePasswordLogin" json:"disablePasswordLogin"`
+}
+
+// The configuration without the client secret, which is never sent back.
+type OidcConfigResponse struct {
+	TenantId             uint              `json:"tenantId"`
+	Enabled              bool              `json:"enabled"`
+	Issuer               string            `json:"issuer"`
+	ClientId             string            `json:"clientId"`
+	ClientSecretSet      bool              `json:"clientSecretSet"`
+	Scopes               string            `json:"scopes"`
+	EmailClaim           string            `json:"emailClaim"`
+	FirstNameClaim       string            `json:"firstNameClaim"`
+	LastNameClaim        string            `json:"lastNameClaim"`
+	PhoneNumberClaim     string            `json:"phoneNumberClaim"`
+	RolesClaim           string            `json:"rolesClaim"`
+	RoleMapping          map[string]string `json:"roleMapping"`
+	AutoProvision        bool              `json:"autoProvision"`
+	DisablePasswordLogin bool              `json:"disablePasswordLogin"`
+	UpdatedAt            time.Time         `json:"updatedAt"`
+}
+
+func NewOidcConfigResponse(c tenants.TenantOidcConfig) OidcConfigResponse {
+
+	mapping, _ := c.RoleMap()
+
+	return OidcConfigResponse{
+		TenantId:             c.TenantId,
+		Enabled:              c.Enabled,
+		Issuer:               c.Issuer,
+		ClientId:             c.ClientId,
+		ClientSecretSet:      len(c.ClientSecret) > 0,
+		Scopes:               c.Scopes,
+		EmailClaim:           c.EmailClaimName(),
+		FirstNameClaim:       c.FirstNameClaimName(),
+		LastNameClaim:        c.LastNameClaimName(),
+		PhoneNumberClaim:     c.PhoneNumberClaimName(),
+		RolesClaim:           c.RolesClaim,
+		RoleMapping:          mapping,
+		AutoProvision:        c.AutoProvision,
+		DisablePasswordLogin: c.DisablePasswordLogin,
+		UpdatedAt:            c.UpdatedAt,
+	}
+}
@@ -0,0 +1,41 @@
+package v1resources
+
+import (
+	"time"
+
+	passwords "go-multitenancy-boilerplate/passwords"
+)
+
+// The rules a new password has to follow.
+type PasswordPolicyResponse struct {
+	MinLength        int  `json:"minLength"`
+	MaxLength        int  `json:"maxLength"`
+	RequireUppercase bool `json:"requireUppercase"`
+	RequireLowercase bool `json:"requireLowercase"`
+	RequireDigit     bool `json:"requireDigit"`
+	RequireSpecial   bool `json:"requireSpecial"`
+	RejectCommon     bool `json:"rejectCommon"`
+	History          int  `json:"history"`
+	MaxAgeDays       int  `json:"maxAgeDays"`
+}
+
+func NewPasswordPolicyResponse(p passwords.Policy) PasswordPolicyResponse {
+	return PasswordPolicyResponse{
+		MinLength:        p.MinLength,
+		MaxLength:        passwords.MaxLength,
+		RequireUppercase: p.RequireUppercase,
+		RequireLowercase: p.RequireLowercase,
+		RequireDigit:     p.RequireDigit,
+		RequireSpecial:   p.RequireSpecial,
+		RejectCommon:     p.RejectCommon,
+		History:          p.History,
+		MaxAgeDays:       int(p.MaxAge / (24 * time.Hour)),
+	}
+}
+
+// Sent when a login used the right password but it has expired.
+// The reset token sets a new one through the password reset endpoint.
+type PasswordExpiredResponse struct {
+	Reason     string `json:"reason"`
+	ResetToken string `json:"resetToken"`
+}
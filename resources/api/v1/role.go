@@ -0,0 +1,46 @@
+package v1resources
+
+import (
+	models "go-multitenancy-boilerplate/models"
+)
+
+type CreateRoleRequest struct {
+	Name        string   `form:"name" json:"name" binding:"required"`
+	Description string   `form:"description" json:"description"`
+	Permissions []string `form:"permissions" json:"permissions"`
+}
+
+type UpdateRoleRequest struct {
+	Name        string   `form:"name" json:"name"`
+	Description string   `form:"description" json:"description"`
+	Permissions []string `form:"permissions" json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	UserId uint `form:"userId" json:"userId" binding:"required"`
+}
+
+type RoleResponse struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	System      bool     `json:"system"`
+	Permissions []string `json:"permissions"`
+}
+
+func NewRoleResponse(role models.Role) RoleResponse {
+
+	permissions := make([]string, 0, len(role.Permissions))
+
+	for _, granted := range role.Permissions {
+		permissions = append(permissions, granted.Permission)
+	}
+
+	return RoleResponse{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		System:      role.System,
+		Permissions: permissions,
+	}
+}
@@ -0,0 +1,39 @@
+package v1resources
+
+import (
+	"time"
+
+	models "go-multitenancy-boilerplate/models"
+)
+
+// A login of the current user, current marks the one making the request.
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IpAddress  string    `json:"ipAddress"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	Current    bool      `json:"current"`
+}
+
+func NewSessionResponse(s models.UserSession, currentId uint) SessionResponse {
+	return SessionResponse{
+		ID:         s.ID,
+		UserAgent:  s.UserAgent,
+		IpAddress:  s.IpAddress,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		Current:    s.ID == currentId,
+	}
+}
+
+func NewMasterSessionResponse(s models.MasterUserSession, currentId uint) SessionResponse {
+	return SessionResponse{
+		ID:         s.ID,
+		UserAgent:  s.UserAgent,
+		IpAddress:  s.IpAddress,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		Current:    s.ID == currentId,
+	}
+}
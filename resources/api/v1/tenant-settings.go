@@ -0,0 +1,80 @@
+package v1resources
+
+import (
+	tenants "go-multitenancy-boilerplate/models/tenants"
+	passwords "go-multitenancy-boilerplate/passwords"
+	tokens "go-multitenancy-boilerplate/tokens"
+)
+
+// Fields left out of the request keep their current value.
+type UpdateTenantSettingsRequest struct {
+	RequireEmailVerification  *bool `form:"requireEmailVerification" json:"requireEmailVerification"`
+	RequireTwoFactorForAdmins *bool `form:"requireTwoFactorForAdmins" json:"requireTwoFactorForAdmins"`
+	// Password policy overrides, resetPasswordPolicy drops all of them before the others apply.
+	ResetPasswordPolicy      bool  `form:"resetPasswordPolicy" json:"resetPasswordPolicy"`
+	PasswordMinLength        *int  `form:"passwordMinLength" json:"passwordMinLength"`
+	PasswordRequireUppercase *bool `form:"passwordRequireUppercase" json:"passwordRequireUppercase"`
+	PasswordRequireLowercase *bool `form:"passwordRequireLowercase" json:"passwordRequireLowercase"`
+	PasswordRequireDigit     *bool `form:"passwordRequireDigit" json:"passwordRequireDigit"`
+	PasswordRequireSpecial   *bool `form:"passwordRequireSpecial" json:"passwordRequireSpecial"`
+	PasswordRejectCommon     *bool `form:"passwordRejectCommon" json:"passwordRejectCommon"`
+	PasswordHistory          *int  `form:"passwordHistory" json:"passwordHistory"`
+	PasswordMaxAgeDays       *int  `form:"passwordMaxAgeDays" json:"passwordMaxAgeDays"`
+	// Session timeouts in minutes, 0 never expires. resetSessionTimeouts drops both overrides before the others apply.
+	ResetSessionTimeouts          bool `form:"resetSessionTimeouts" json:"resetSessionTimeouts"`
+	SessionIdleTimeoutMinutes     *int `form:"sessionIdleTimeoutMinutes" json:"sessionIdleTimeoutMinutes"`
+	SessionAbsoluteTimeoutMinutes *int `form:"sessionAbsoluteTimeoutMinutes" json:"sessionAbsoluteTimeoutMinutes"`
+}
+
+type TenantSettingsResponse struct {
+	TenantId                  uint `json:"tenantId"`
+	RequireEmailVerification  bool `json:"requireEmailVerification"`
+	RequireTwoFactorForAdmins bool `json:"requireTwoFactorForAdmins"`
+	// Overrides are null where the platform policy applies, passwordPolicy is the policy in effect.
+	PasswordMinLength        *int                   `json:"passwordMinLength"`
+	PasswordRequireUppercase *bool                  `json:"passwordRequireUppercase"`
+	PasswordRequireLowercase *bool                  `json:"passwordRequireLowercase"`
+	PasswordRequireDigit     *bool                  `json:"passwordRequireDigit"`
+	PasswordRequireSpecial   *bool                  `json:"passwordRequireSpecial"`
+	PasswordRejectCommon     *bool                  `json:"passwordRejectCommon"`
+	PasswordHistory          *int                   `json:"passwordHistory"`
+	PasswordMaxAgeDays       *int                   `json:"passwordMaxAgeDays"`
+	PasswordPolicy           PasswordPolicyResponse `json:"passwordPolicy"`
+	// Overrides are null where the platform timeouts apply, sessionTimeouts are the timeouts in effect.
+	SessionIdleTimeoutMinutes     *int                    `json:"sessionIdleTimeoutMinutes"`
+	SessionAbsoluteTimeoutMinutes *int                    `json:"sessionAbsoluteTimeoutMinutes"`
+	SessionTimeouts               SessionTimeoutsResponse `json:"sessionTimeouts"`
+}
+
+// Minutes, 0 never expires.
+type SessionTimeoutsResponse struct {
+	IdleMinutes     int `json:"idleMinutes"`
+	AbsoluteMinutes int `json:"absoluteMinutes"`
+}
+
+func NewSessionTimeoutsResponse(t tokens.Timeouts) SessionTimeoutsResponse {
+	return SessionTimeoutsResponse{
+		IdleMinutes:     int(t.Idle.Minutes()),
+		AbsoluteMinutes: int(t.Absolute.Minutes()),
+	}
+}
+
+func NewTenantSettingsResponse(s tenants.TenantSettings) TenantSettingsResponse {
+	return TenantSettingsResponse{
+		TenantId:                      s.TenantId,
+		RequireEmailVerification:      s.RequireEmailVerification,
+		RequireTwoFactorForAdmins:     s.RequireTwoFactorForAdmins,
+		PasswordMinLength:             s.PasswordMinLength,
+		PasswordRequireUppercase:      s.PasswordRequireUppercase,
+		PasswordRequireLowercase:      s.PasswordRequireLowercase,
+		PasswordRequireDigit:          s.PasswordRequireDigit,
+		PasswordRequireSpecial:        s.PasswordRequireSpecial,
+		PasswordRejectCommon:          s.PasswordRejectCommon,
+		PasswordHistory:               s.PasswordHistory,
+		PasswordMaxAgeDays:            s.PasswordMaxAgeDays,
+		PasswordPolicy:                NewPasswordPolicyResponse(s.PasswordPolicy(passwords.DefaultPolicy())),
+		SessionIdleTimeoutMinutes:     s.SessionIdleTimeoutMinutes,
+		SessionAbsoluteTimeoutMinutes: s.SessionAbsoluteTimeoutMinutes,
+		SessionTimeouts:               NewSessionTimeoutsResponse(s.SessionTimeouts(tokens.DefaultTimeouts())),
+	}
+}
@@ -1,5 +1,90 @@
 package v1resources
 
+import (
+	"time"
+
+	tenants "go-multitenancy-boilerplate/models/tenants"
+)
+
 type CreateNewTenantRequest struct {
 	SubDomainIdentifier string `form:"subDomainIdentifier" json:"subDomainIdentifier" binding:"required"`
+	IsolationStrategy   string `form:"isolationStrategy" json:"isolationStrategy"`
+}
+
+type ListTenantsRequest struct {
+	PaginationRequest
+	Search         string `form:"search" json:"search"`
+	Status         string `form:"status" json:"status"`
+	Strategy       string `form:"strategy" json:"strategy"`
+	IncludeDeleted bool   `form:"includeDeleted" json:"includeDeleted"`
+}
+
+type RenameTenantRequest struct {
+	SubDomainIdentifier string `form:"subDomainIdentifier" json:"subDomainIdentifier" binding:"required"`
+}
+
+type SuspendTenantRequest struct {
+	Reason string `form:"reason" json:"reason"`
+}
+
+// TenantResponse struct, the connection string is never exposed.
+type TenantResponse struct {
+	ID                  uint       `json:"id"`
+	TenantId            uint       `json:"tenantId"`
+	SubDomainIdentifier string     `json:"subDomainIdentifier"`
+	IsolationStrategy   string     `json:"isolationStrategy"`
+	Status              string     `json:"status"`
+	SuspendedAt         *time.Time `json:"suspendedAt,omitempty"`
+	SuspendedReason     string     `json:"suspendedReason,omitempty"`
+	ProvisioningStatus  string     `json:"provisioningStatus"`
+	ProvisioningError   string     `json:"provisioningError,omitempty"`
+	SchemaVersion       int64      `json:"schemaVersion"`
+	MigrationStatus     string     `json:"migrationStatus,omitempty"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+	DeletedAt           *time.Time `json:"deletedAt,omitempty"`
+}
+
+func NewTenantResponse(t tenants.TenantConnectionInformation) TenantResponse {
+	return TenantResponse{
+		ID:                  t.ID,
+		TenantId:            t.TenantId,
+		SubDomainIdentifier: t.TenantSubDomainIdentifier,
+		IsolationStrategy:   t.Strategy(),
+		Status:              t.Status,
+		SuspendedAt:         t.SuspendedAt,
+		SuspendedReason:     t.SuspendedReason,
+		ProvisioningStatus:  t.ProvisioningStatus,
+		ProvisioningError:   t.ProvisioningError,
+		SchemaVersion:       t.SchemaVersion,
+		MigrationStatus:     t.MigrationStatus,
+		CreatedAt:           t.CreatedAt,
+		UpdatedAt:           t.UpdatedAt,
+		DeletedAt:           t.DeletedAt,
+	}
+}
+
+// TenantProvisioningJobResponse struct
+type TenantProvisioningJobResponse struct {
+	ID         uint       `json:"id"`
+	TenantId   uint       `json:"tenantId"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+func NewTenantProvisioningJobResponse(j tenants.TenantProvisioningJob) TenantProvisioningJobResponse {
+	return TenantProvisioningJobResponse{
+		ID:         j.ID,
+		TenantId:   j.TenantId,
+		Status:     j.Status,
+		Attempts:   j.Attempts,
+		Error:      j.Error,
+		CreatedAt:  j.CreatedAt,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+	}
 }
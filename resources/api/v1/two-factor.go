@@ -0,0 +1,32 @@
+package v1resources
+
+type TwoFactorCodeRequest struct {
+	Code string `form:"code" json:"code" binding:"required"` // A code from the authenticator app or a recovery code.
+}
+
+type TwoFactorChallengeRequest struct {
+	Challenge string `form:"challenge" json:"challenge" binding:"required"`
+}
+
+type TwoFactorLoginRequest struct {
+	Challenge string `form:"challenge" json:"challenge" binding:"required"`
+	Code      string `form:"code" json:"code" binding:"required"`
+}
+
+// Returned by login when the password was right but a second step is needed.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	Challenge         string `json:"challenge"`
+	EnrolmentRequired bool   `json:"enrolmentRequired"`
+}
+
+// Returned once the second step of a login succeeded.
+type TwoFactorLoginResponse struct {
+	Message       string      `json:"message"`
+	Tokens        interface{} `json:"tokens,omitempty"`
+	RecoveryCodes []string    `json:"recoveryCodes,omitempty"` // Only for users who enrolled while logging in.
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
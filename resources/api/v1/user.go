@@ -16,13 +16,27 @@ type CreateUserRequest struct {
 type UpdateUserRequest struct {
 	Id            uint   `form:"id" json:"id" binding:"required"`
 	Email         string `form:"email" json:"email"`
-	AccountType   int    `form:"accountType" json:"accountType"`
+	AccountType   *int   `form:"accountType" json:"accountType"`
 	FirstName     string `form:"firstName" json:"firstName"`
 	LastName      string `form:"lastName" json:"lastName"`
 	PhoneNumber   string `form:"phoneNumber" json:"phoneNumber"`
 	RecoveryEmail string `form:"recoveryEmail" json:"recoveryEmail"`
 }
 
+// The fields users can change about themselves, empty fields are left unchanged.
+type UpdateProfileRequest struct {
+	Email         string `form:"email" json:"email"`
+	FirstName     string `form:"firstName" json:"firstName"`
+	LastName      string `form:"lastName" json:"lastName"`
+	PhoneNumber   string `form:"phoneNumber" json:"phoneNumber"`
+	RecoveryEmail string `form:"recoveryEmail" json:"recoveryEmail"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `form:"currentPassword" json:"currentPassword" binding:"required"`
+	Password        string `form:"password" json:"password" binding:"required"`
+}
+
 type LoginRequest struct {
 	Email    string `form:"email" json:"email" binding:"required"`
 	Password string `form:"password" json:"password" binding:"required"`
@@ -31,3 +45,16 @@ type LoginRequest struct {
 type DeleteUserRequest struct {
 	Id uint `form:"id" json:"id" binding:"required"`
 }
+
+type RefreshTokenRequest struct {
+	RefreshToken string `form:"refreshToken" json:"refreshToken" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `form:"email" json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `form:"token" json:"token" binding:"required"`
+	Password string `form:"password" json:"password" binding:"required"`
+}
@@ -1,13 +1,45 @@
 package resources
 
+import "time"
+
+// Keyed by tenant id rather than sub domain identifier, an identifier can be renamed or reused by a new tenant.
+// Sessions saved while the maps were keyed by identifier no longer decode, the store starts them over and their users log in again.
 type ClientProfile struct {
-	LoginAttempts    map[string]map[string]*LoginAttempt // Key is email address
-	AuthorizationMap map[string]uint                     // Key is tenant identifier
+	AuthorizedUsers map[uint]uint      // Key is tenant id, the user the session is authorized as
+	AuthorizedAt    map[uint]time.Time // Key is tenant id
+	UserSessionIds  map[uint]uint      // Key is tenant id, the recorded login of each tenant
 }
 
 func newClientProfile() ClientProfile {
 	c := ClientProfile{}
-	c.LoginAttempts = make(map[string]map[string]*LoginAttempt)
-	c.AuthorizationMap = make(map[string]uint)
+	c.AuthorizedUsers = make(map[uint]uint)
+	c.AuthorizedAt = make(map[uint]time.Time)
+	c.UserSessionIds = make(map[uint]uint)
 	return c
 }
+
+// Authorizes the session for a tenant as of now, sessionId is the recorded login.
+func (c *ClientProfile) Authorize(tenantId uint, userId uint, sessionId uint) {
+
+	// Profiles which weren't made by newClientProfile don't have the maps yet.
+	if c.AuthorizedUsers == nil {
+		c.AuthorizedUsers = make(map[uint]uint)
+	}
+	if c.AuthorizedAt == nil {
+		c.AuthorizedAt = make(map[uint]time.Time)
+	}
+	if c.UserSessionIds == nil {
+		c.UserSessionIds = make(map[uint]uint)
+	}
+
+	c.AuthorizedUsers[tenantId] = userId
+	c.AuthorizedAt[tenantId] = time.Now().UTC()
+	c.UserSessionIds[tenantId] = sessionId
+}
+
+// Removes the authorization for a tenant.
+func (c *ClientProfile) Unauthorize(tenantId uint) {
+	delete(c.AuthorizedUsers, tenantId)
+	delete(c.AuthorizedAt, tenantId)
+	delete(c.UserSessionIds, tenantId)
+}
@@ -0,0 +1,25 @@
+package resources
+
+import "testing"
+
+func TestClientProfileAuthorize(t *testing.T) {
+
+	profile := newClientProfile()
+
+	profile.Authorize(2, 4, 9)
+	profile.Authorize(3, 5, 10)
+
+	if profile.AuthorizedUsers[2] != 4 || profile.UserSessionIds[2] != 9 || profile.AuthorizedAt[2].IsZero() {
+		t.Fatalf("expected tenant 2 to be authorized, got %+v", profile)
+	}
+
+	profile.Unauthorize(2)
+
+	if profile.AuthorizedUsers[2] != 0 || profile.UserSessionIds[2] != 0 {
+		t.Fatalf("expected tenant 2 to be unauthorized, got %+v", profile)
+	}
+
+	if profile.AuthorizedUsers[3] != 5 {
+		t.Fatalf("expected tenant 3 to stay authorized, got %+v", profile)
+	}
+}
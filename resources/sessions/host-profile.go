@@ -3,16 +3,14 @@ package resources
 import "time"
 
 type HostProfile struct {
-	LoginAttempts        map[string]*LoginAttempt // Key is used email address
-	LastLoginAttemptTime time.Time
-	AuthorizedTime       time.Time
-	UserId               uint
-	Authorized           uint
+	AuthorizedTime time.Time
+	UserId         uint
+	SessionId      uint // The recorded login.
+	Authorized     uint
 }
 
 func newHostProfile() HostProfile {
 	h := HostProfile{}
-	h.LoginAttempts = make(map[string]*LoginAttempt)
 	h.Authorized = 0
 	return h
 }
@@ -1,248 +1,107 @@
 package resources
 
 import (
-	"fmt"
-	helpers "go-multitenancy-boilerplate/helpers"
-	res "go-multitenancy-boilerplate/resources/api/v1"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	helpers "go-multitenancy-boilerplate/helpers"
+	res "go-multitenancy-boilerplate/resources/api/v1"
+	throttle "go-multitenancy-boilerplate/throttle"
+
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
 	"github.com/wader/gormstore"
 )
 
-type LoginAttempt struct {
-	LastLoginAttemptTime time.Time
-	LoginAttempts        uint
-}
+// Called whenever a login is refused because of too many attempts, e.g. to audit the lockout.
+var OnLockout func(c *gin.Context, email string)
 
 // Checks if a user is logged in with a session to the master dashboard
 func HandleMasterLoginAttempt(Store *gormstore.Store) gin.HandlerFunc {
-	return func(c *gin.Context) {
-
-		// Try and get a session.
-		sessionValues, err := Store.Get(c.Request, "connect.s.id")
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong.."})
-			c.Abort()
-			return
-		}
-
-		// Check to see if the user is already authorized..
-		if sessionValues.ID != "" {
-
-			p := sessionValues.Values["profile"].(HostProfile)
-
-			if p.Authorized == 1 {
-				c.JSON(http.StatusOK, gin.H{
-					"outcome": "Already Authorized",
-					"message": "user already authorized with application.",
-				})
-				c.Abort()
-				return
-			}
-		}
-
-		// Check our parameters out.
-		var json res.LoginRequest
 
-		// Abort if we don't have the correct variables to begin with.
-		if err := c.ShouldBindJSON(&json); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "Email or Password provided are incorrect, please try again."})
-			fmt.Println("Can't bind request variables for login")
-			c.Abort()
-			return
-		}
+	authorized := func(c *gin.Context, session *sessions.Session) bool {
+		return session.Values["profile"].(HostProfile).Authorized == 1
+	}
 
-		if !helpers.ValidateEmail(json.Email) {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "Email or Password provided are incorrect, please try again."})
-			fmt.Println("Email is not in a valid format.")
-			c.Abort()
-			return
-		}
+	return handleLoginAttempt(Store, authorized, func(c *gin.Context, email string) string {
+		return throttle.MasterAccountKey(email)
+	})
+}
 
-		// Abort if the passed password is not correct.
+// Checks if a user is logged in with a session to the client dashboard
+func HandleLoginAttempt(Store *gormstore.Store) gin.HandlerFunc {
 
-		// Validate the password being sent.
-		if len(json.Password) <= 7 {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "The specified password was to short, must be longer than 8 characters."})
-			c.Abort()
-			return
-		}
+	// Holds the user id the session is authorized as for this tenant.
+	authorized := func(c *gin.Context, session *sessions.Session) bool {
+		return session.Values["client"].(ClientProfile).AuthorizedUsers[c.GetUint("tenantId")] > 0
+	}
 
-		// Validate the password contains at least one letter and capital
-		if !helpers.ContainsCapitalLetter(json.Password) {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "The specified password does not contain a capital letter."})
-			c.Abort()
-			return
-		}
+	attempt := handleLoginAttempt(Store, authorized, func(c *gin.Context, email string) string {
+		return throttle.AccountKey(c.GetUint("tenantId"), email)
+	})
 
-		// Make sure the password contains at least one special character.
-		if !helpers.ContainsSpecialCharacter(json.Password) {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "The password must contain at least one special character."})
-			c.Abort()
-			return
-		}
+	return func(c *gin.Context) {
 
-		if err != nil {
+		// Try and get tenancy identifier
+		if _, found := c.Get("tenantIdentifier"); !found {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong.."})
 			c.Abort()
 			return
 		}
 
-		c.Set("bindedJson", json)
-
-		// Check to see if a new session is found.
-		if sessionValues.ID == "" {
-			// Setup new session with empty profiles.
-			session, err := Store.New(c.Request, "connect.s.id")
-
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong.."})
-				c.Abort()
-				return
-			}
-
-			// Host profile requires little setup
-			session.Values["profile"] = newHostProfile()
-
-			// Add the entry record to hostProfile
-			session.Values["profile"].(HostProfile).LoginAttempts[json.Email] = &LoginAttempt{LoginAttempts: 1, LastLoginAttemptTime: time.Now().UTC()}
-
-			// Client profile requires no setup
-			session.Values["client"] = newClientProfile()
-
-			// Set the session back to the handler for use.
-			c.Set("session", session)
-			return
-		} else {
-			// Profile was already found
-			h := sessionValues.Values["profile"].(HostProfile)
-
-			// Check if the email used is already in our login attempts.
-			loginAttemptsFound, found := h.LoginAttempts[json.Email]
-
-			if !found {
-				// email has not been used to login add a new entry
-				h.LoginAttempts[json.Email] = &LoginAttempt{LoginAttempts: 1, LastLoginAttemptTime: time.Now().UTC()}
-
-				// Set the session back to the handler for use.
-				c.Set("session", sessionValues)
-				return
-			}
-
-			// Check to see if login attempts exceeds 3 attempts
-			if found && loginAttemptsFound.LoginAttempts > 2 {
-				// Check to see if last login attempt was over half an hour ago
-				if time.Now().Sub(loginAttemptsFound.LastLoginAttemptTime).Minutes() > 30 {
-					// reset login attempts to have 2 more.
-					loginAttemptsFound.LoginAttempts = 1
-					loginAttemptsFound.LastLoginAttemptTime = time.Now().UTC()
-
-					// Set the session back to the handler for use.
-					c.Set("session", sessionValues)
-					return
-				} else {
-					c.JSON(http.StatusInternalServerError, gin.H{"message": "You have been locked out for too many attempts to login..", "status": "locked out", "timeLeft": 30 - time.Now().Sub(loginAttemptsFound.LastLoginAttemptTime).Minutes()})
-					c.Abort()
-					return
-				}
-			}
-
-			if found && loginAttemptsFound.LoginAttempts <= 2 {
-				// increase login attempt count
-				loginAttemptsFound.LoginAttempts++
-				// replace last attempt date
-				loginAttemptsFound.LastLoginAttemptTime = time.Now().UTC()
-
-				// Set the session back to the handler for use.
-				c.Set("session", sessionValues)
-				return
-			}
-		}
+		attempt(c)
 	}
 }
 
-// Checks if a user is logged in with a session to the client dashboard
-func HandleLoginAttempt(Store *gormstore.Store) gin.HandlerFunc {
+// Refuses logins to accounts or from IP addresses which failed too often, failures are counted by the login handlers.
+// Sets the bound request, the session and the throttled attempt for the handler.
+func handleLoginAttempt(Store *gormstore.Store, authorized func(c *gin.Context, session *sessions.Session) bool, accountKey func(c *gin.Context, email string) string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		// Try and get tenancy identifier
-		tenantIdentifier, found := c.Get("tenantIdentifier")
+		// Try and get a session, a new one is returned when there is none.
+		session, err := Store.Get(c.Request, "connect.s.id")
 
-		if !found {
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong.."})
 			c.Abort()
 			return
 		}
 
-		// Try and get a session.
-		sessionValues, err := Store.Get(c.Request, "connect.s.id")
+		EnsureProfiles(session)
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong.."})
+		// Check to see if the user is already authorized..
+		if authorized(c, session) {
+			c.JSON(http.StatusOK, gin.H{
+				"outcome": "Already Authorized",
+				"message": "user already authorized with application.",
+			})
 			c.Abort()
 			return
 		}
 
-		// Check to see if the user is already authorized..
-		if sessionValues.ID != "" {
-
-			p := sessionValues.Values["client"].(ClientProfile)
-
-			authorizationEntry := p.AuthorizationMap[tenantIdentifier.(string)]
-
-			if authorizationEntry == 1 {
-				c.JSON(http.StatusOK, gin.H{
-					"outcome": "Already Authorized",
-					"message": "user already authorized with application.",
-				})
-				c.Abort()
-				return
-			}
-		}
-
 		// Check our parameters out.
 		var json res.LoginRequest
 
 		// Abort if we don't have the correct variables to begin with.
 		if err := c.ShouldBindJSON(&json); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Email or Password provided are incorrect, please try again."})
-			fmt.Println("Can't bind request variables for login")
 			c.Abort()
 			return
 		}
 
 		if !helpers.ValidateEmail(json.Email) {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Email or Password provided are incorrect, please try again."})
-			fmt.Println("Email is not in a valid format.")
 			c.Abort()
 			return
 		}
 
-		// Abort if the passed password is not correct.
+		// The password policy only applies to new passwords, older ones still have to log in.
 
-		// Validate the password being sent.
-		if len(json.Password) <= 7 {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "The specified password was to short, must be longer than 8 characters."})
-			c.Abort()
-			return
-		}
+		attempt := throttle.Attempt{Account: accountKey(c, json.Email), Ip: throttle.IpKey(c.ClientIP())}
 
-		// Validate the password contains at least one letter and capital
-		if !helpers.ContainsCapitalLetter(json.Password) {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "The specified password does not contain a capital letter."})
-			c.Abort()
-			return
-		}
-
-		// Make sure the password contains at least one special character.
-		if !helpers.ContainsSpecialCharacter(json.Password) {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "The password must contain at least one special character."})
-			c.Abort()
-			return
-		}
+		wait, err := throttle.Default().Check(attempt)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong.."})
@@ -250,90 +109,28 @@ func HandleLoginAttempt(Store *gormstore.Store) gin.HandlerFunc {
 			return
 		}
 
-		c.Set("bindedJson", json)
-
-		// Check to see if a new session is found.
-		if sessionValues.ID == "" {
-			// Setup new session with empty profiles.
-			session, err := Store.New(c.Request, "connect.s.id")
-
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong.."})
-				c.Abort()
-				return
+		if wait > 0 {
+			if OnLockout != nil {
+				OnLockout(c, json.Email)
 			}
-
-			// Host profile requires little setup
-			session.Values["profile"] = newHostProfile()
-
-			// Client profile requires no setup
-			session.Values["client"] = newClientProfile()
-
-			session.Values["client"].(ClientProfile).LoginAttempts[tenantIdentifier.(string)] = make(map[string]*LoginAttempt)
-			session.Values["client"].(ClientProfile).LoginAttempts[tenantIdentifier.(string)][json.Email] = &LoginAttempt{LoginAttempts: 1, LastLoginAttemptTime: time.Now().UTC()}
-
-			// Set the session back to the handler for use.
-			c.Set("session", session)
+			LockedOut(c, wait)
 			return
-		} else {
-			// Profile was already found
-			h := sessionValues.Values["client"].(ClientProfile)
-
-			// Attempt to find tenant entry in login attempts.
-			tenantMap, found := h.LoginAttempts[tenantIdentifier.(string)]
-
-			if !found {
-				// Create a new entry for the tenant entry in map, also create login attempt
-				tenantMap = make(map[string]*LoginAttempt)
-				tenantMap[json.Email] = &LoginAttempt{LoginAttempts: 1, LastLoginAttemptTime: time.Now().UTC()}
-
-				// Set the session back to the handler for use.
-				c.Set("session", sessionValues)
-				return
-			}
-
-			// Check if the email used is already in our login attempts.
-			loginAttemptsFound, found := tenantMap[json.Email]
-
-			if !found {
-				// email has not been used to login add a new entry
-				loginAttemptsFound = &LoginAttempt{LoginAttempts: 1, LastLoginAttemptTime: time.Now().UTC()}
-
-				// Set the session back to the handler for use.
-				c.Set("session", sessionValues)
-				return
-			}
-
-			// Check to see if login attempts exceeds 3 attempts
-			if found && loginAttemptsFound.LoginAttempts > 2 {
-				// Check to see if last login attempt was over half an hour ago
-				if time.Now().Sub(loginAttemptsFound.LastLoginAttemptTime).Minutes() > 30 {
-					// reset login attempts to have 2 more.
-					loginAttemptsFound.LoginAttempts = 1
-					loginAttemptsFound.LastLoginAttemptTime = time.Now().UTC()
+		}
 
-					// Set the session back to the handler for use.
-					c.Set("session", sessionValues)
-					return
-				} else {
-					c.JSON(http.StatusInternalServerError, gin.H{"message": "You have been locked out for too many attempts to login..", "status": "locked out", "timeLeft": 30 - time.Now().Sub(loginAttemptsFound.LastLoginAttemptTime).Minutes()})
-					c.Abort()
-					return
-				}
-			}
+		c.Set("bindedJson", json)
+		c.Set("loginAttempt", attempt)
 
-			if found && loginAttemptsFound.LoginAttempts <= 2 {
-				// increase login attempt count
-				loginAttemptsFound.LoginAttempts++
-				// replace last attempt date
-				loginAttemptsFound.LastLoginAttemptTime = time.Now().UTC()
+		// Set the session back to the handler for use.
+		c.Set("session", session)
+	}
+}
 
-				// Set the session back to the handler for use.
-				c.Set("session", sessionValues)
-				return
-			}
+// Refuses a login which has to wait, telling the client for how long.
+func LockedOut(c *gin.Context, wait time.Duration) {
 
-		}
+	seconds := int(math.Ceil(wait.Seconds()))
 
-	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"message": "You have been locked out for too many attempts to login..", "status": "locked out", "timeLeft": wait.Minutes(), "retryAfter": seconds})
+	c.Abort()
 }
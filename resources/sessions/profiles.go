@@ -0,0 +1,15 @@
+package resources
+
+import "github.com/gorilla/sessions"
+
+// Gives a session the profiles the login middlewares expect, sessions which never went through them have none.
+func EnsureProfiles(session *sessions.Session) {
+
+	if _, ok := session.Values["profile"].(HostProfile); !ok {
+		session.Values["profile"] = newHostProfile()
+	}
+
+	if _, ok := session.Values["client"].(ClientProfile); !ok {
+		session.Values["client"] = newClientProfile()
+	}
+}
@@ -1,7 +1,11 @@
 package routers
 
 import (
+	"log"
+
 	v1 "go-multitenancy-boilerplate/controllers/v1"
+	helpers "go-multitenancy-boilerplate/helpers"
+	ss "go-multitenancy-boilerplate/resources/sessions"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,6 +15,12 @@ func SetupRouter() *gin.Engine {
 
 	router := gin.Default()
 
+	// Forwarded client addresses are only believed from these proxies, by default the connection's address is used.
+	// API key allowlists and login throttling go by the client address, so it must not be up to the client.
+	if err := router.SetTrustedProxies(helpers.GetEnvList("TRUSTED_PROXIES")); err != nil {
+		log.Fatal("Error setting the trusted proxies: ", err)
+	}
+
 	// Giving access to storage folder
 	router.Static("/storage", "storage")
 
@@ -20,10 +30,20 @@ func SetupRouter() *gin.Engine {
 
 	router.Use(CORSMiddleware())
 
+	// Lockouts are decided by the login attempt middleware but recorded in the audit log.
+	ss.OnLockout = v1.RecordLockout
+
 	// API route for version 1
 	v1.SetupUserRoutes(router)
+	v1.SetupRoleRoutes(router)
+	v1.SetupInvitationRoutes(router)
+	v1.SetupSettingsRoutes(router)
+	v1.SetupApiKeyRoutes(router)
 	v1.SetupMasterUserRoutes(router)
+	v1.SetupMasterSetupRoutes(router)
 	v1.SetupTenantRoutes(router)
+	v1.SetupMigrationRoutes(router)
+	v1.SetupAuditRoutes(router)
 
 	return router
 }
@@ -34,7 +54,7 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Max-Age", "86400")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, DELETE, PATCH")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Max")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Max")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
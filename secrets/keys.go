@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Encryption keys by key id. Values are encrypted with the active key and decrypted with whichever key
+// they name, so a key can be rotated by adding a new one, making it active and removing the old one
+// once every value has been encrypted again.
+type KeyRing struct {
+	keys   map[string][]byte
+	active string
+}
+
+// Creates a key ring, the active key must be one of the keys and every key must be 32 bytes.
+func NewKeyRing(keys map[string][]byte, active string) (*KeyRing, error) {
+
+	if _, ok := keys[active]; !ok {
+		return nil, errors.Errorf("the active encryption key %q is not configured", active)
+	}
+
+	for kid, key := range keys {
+		if len(key) != 32 {
+			return nil, errors.Errorf("the encryption key %q must be 32 bytes", kid)
+		}
+		if strings.Contains(kid, ":") {
+			return nil, errors.Errorf("the encryption key id %q can't contain a colon", kid)
+		}
+	}
+
+	return &KeyRing{keys: keys, active: active}, nil
+}
+
+// Loads the keys from ENCRYPTION_KEYS ("kid:base64 key,kid:base64 key") and the active key id from
+// ENCRYPTION_ACTIVE_KID, which defaults to the first key.
+func KeyRingFromEnv() (*KeyRing, error) {
+
+	keys := make(map[string][]byte)
+	first := ""
+
+	for _, entry := range strings.Split(os.Getenv("ENCRYPTION_KEYS"), ",") {
+
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, errors.New("ENCRYPTION_KEYS entries must look like kid:base64 key")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+
+		if err != nil {
+			return nil, errors.Errorf("the encryption key %q is not base64", parts[0])
+		}
+
+		keys[parts[0]] = key
+
+		if len(first) == 0 {
+			first = parts[0]
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	active := strings.TrimSpace(os.Getenv("ENCRYPTION_ACTIVE_KID"))
+	if len(active) == 0 {
+		active = first
+	}
+
+	return NewKeyRing(keys, active)
+}
+
+var (
+	defaultKeys    *KeyRing
+	defaultKeysErr error
+	loadKeys       sync.Once
+)
+
+// The key ring configured through the environment, loaded on first use.
+func DefaultKeyRing() (*KeyRing, error) {
+
+	loadKeys.Do(func() {
+		defaultKeys, defaultKeysErr = KeyRingFromEnv()
+	})
+
+	return defaultKeys, defaultKeysErr
+}
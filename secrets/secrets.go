@@ -0,0 +1,140 @@
+// Package secrets encrypts values kept in the database, such as TOTP secrets, with AES-256-GCM.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Encrypted values look like enc:<kid>:<base64 nonce and ciphertext>.
+const prefix = "enc:"
+
+var (
+	ErrNotConfigured = errors.New("ENCRYPTION_KEYS is not configured")
+	ErrUnknownKey    = errors.New("the value was encrypted with a key which is not configured")
+	ErrMalformed     = errors.New("the encrypted value is malformed")
+)
+
+// Whether a stored value is encrypted, values stored before encryption was introduced are not.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypts a value with the active key, empty values stay empty.
+func (k *KeyRing) Encrypt(plaintext string) (string, error) {
+
+	if len(plaintext) == 0 {
+		return "", nil
+	}
+
+	aead, err := newAEAD(k.keys[k.active])
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	// The key id is authenticated too, so a value can't be passed off as encrypted with another key.
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.active))
+
+	return prefix + k.active + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypts a value with the key it names, values which aren't encrypted are returned as they are.
+func (k *KeyRing) Decrypt(value string) (string, error) {
+
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+
+	if len(parts) != 2 {
+		return "", ErrMalformed
+	}
+
+	key, ok := k.keys[parts[0]]
+
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	aead, err := newAEAD(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(parts[0]))
+
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	return string(plaintext), nil
+}
+
+// Whether a stored value should be encrypted again, because it isn't yet or not with the active key.
+func (k *KeyRing) NeedsReencrypt(value string) bool {
+	return len(value) > 0 && !strings.HasPrefix(value, prefix+k.active+":")
+}
+
+// Encrypts a value with the configured keys.
+func Encrypt(plaintext string) (string, error) {
+
+	ring, err := DefaultKeyRing()
+
+	if err != nil {
+		return "", err
+	}
+
+	return ring.Encrypt(plaintext)
+}
+
+// Decrypts a value with the configured keys, values which aren't encrypted need no keys.
+func Decrypt(value string) (string, error) {
+
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	ring, err := DefaultKeyRing()
+
+	if err != nil {
+		return "", err
+	}
+
+	return ring.Decrypt(value)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
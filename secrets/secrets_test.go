@@ -0,0 +1,165 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testKeyRing(t *testing.T, active string, kids ...string) *KeyRing {
+
+	keys := make(map[string][]byte)
+
+	for i, kid := range kids {
+		keys[kid] = bytes.Repeat([]byte{byte(i + 1)}, 32)
+	}
+
+	ring, err := NewKeyRing(keys, active)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ring
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+
+	ring := testKeyRing(t, "2026-10", "2026-10")
+
+	encrypted, err := ring.Encrypt("JBSWY3DPEHPK3PXP")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(encrypted, "enc:2026-10:") || strings.Contains(encrypted, "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("expected an encrypted value, got %q", encrypted)
+	}
+
+	decrypted, err := ring.Decrypt(encrypted)
+
+	if err != nil || decrypted != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected the secret back, got %q, %v", decrypted, err)
+	}
+
+	if again, _ := ring.Encrypt("JBSWY3DPEHPK3PXP"); again == encrypted {
+		t.Fatal("expected a fresh nonce for every encryption")
+	}
+
+	if empty, err := ring.Encrypt(""); err != nil || empty != "" {
+		t.Fatalf("expected empty values to stay empty, got %q, %v", empty, err)
+	}
+}
+
+func TestDecryptPlaintext(t *testing.T) {
+
+	ring := testKeyRing(t, "2026-10", "2026-10")
+
+	if decrypted, err := ring.Decrypt("JBSWY3DPEHPK3PXP"); err != nil || decrypted != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected values stored before encryption to pass through, got %q, %v", decrypted, err)
+	}
+
+	if !ring.NeedsReencrypt("JBSWY3DPEHPK3PXP") || ring.NeedsReencrypt("") {
+		t.Fatal("expected only non-empty plaintext to need encrypting")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+
+	old := testKeyRing(t, "2026-09", "2026-09", "2026-10")
+	rotated := testKeyRing(t, "2026-10", "2026-09", "2026-10")
+
+	encrypted, _ := old.Encrypt("JBSWY3DPEHPK3PXP")
+
+	if decrypted, err := rotated.Decrypt(encrypted); err != nil || decrypted != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected values of the old key to decrypt after rotation, got %q, %v", decrypted, err)
+	}
+
+	if !rotated.NeedsReencrypt(encrypted) || old.NeedsReencrypt(encrypted) {
+		t.Fatal("expected only values of an inactive key to need encrypting again")
+	}
+
+	removed := testKeyRing(t, "2026-10", "2026-10")
+
+	if _, err := removed.Decrypt(encrypted); err != ErrUnknownKey {
+		t.Fatalf("expected ErrUnknownKey once the old key is removed, got %v", err)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+
+	ring := testKeyRing(t, "2026-10", "2026-09", "2026-10")
+
+	encrypted, _ := ring.Encrypt("JBSWY3DPEHPK3PXP")
+	sealed := strings.TrimPrefix(encrypted, "enc:2026-10:")
+
+	raw, _ := base64.RawURLEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+
+	for _, value := range []string{
+		"enc:2026-10:" + base64.RawURLEncoding.EncodeToString(raw),
+		"enc:2026-09:" + sealed, // Passed off as encrypted with another key
+		"enc:2026-10:not base64!",
+		"enc:2026-10:",
+		"enc:2026-10",
+	} {
+		if _, err := ring.Decrypt(value); err != ErrMalformed {
+			t.Errorf("expected ErrMalformed for %q, got %v", value, err)
+		}
+	}
+}
+
+func TestNewKeyRingValidates(t *testing.T) {
+
+	key := bytes.Repeat([]byte{1}, 32)
+
+	if _, err := NewKeyRing(map[string][]byte{"a": key}, "b"); err == nil {
+		t.Error("expected an unknown active key to be rejected")
+	}
+
+	if _, err := NewKeyRing(map[string][]byte{"a": key[:16]}, "a"); err == nil {
+		t.Error("expected a short key to be rejected")
+	}
+
+	if _, err := NewKeyRing(map[string][]byte{"a:b": key}, "a:b"); err == nil {
+		t.Error("expected a key id with a colon to be rejected")
+	}
+}
+
+func TestKeyRingFromEnv(t *testing.T) {
+
+	defer os.Unsetenv("ENCRYPTION_KEYS")
+	defer os.Unsetenv("ENCRYPTION_ACTIVE_KID")
+
+	os.Setenv("ENCRYPTION_KEYS", "")
+
+	if _, err := KeyRingFromEnv(); err != ErrNotConfigured {
+		t.Fatalf("expected ErrNotConfigured, got %v", err)
+	}
+
+	first := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	second := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+
+	os.Setenv("ENCRYPTION_KEYS", "2026-09:"+first+", 2026-10:"+second)
+
+	ring, err := KeyRingFromEnv()
+
+	if err != nil || ring.active != "2026-09" {
+		t.Fatalf("expected the first key to be active by default, got %+v, %v", ring, err)
+	}
+
+	os.Setenv("ENCRYPTION_ACTIVE_KID", "2026-10")
+
+	if ring, err := KeyRingFromEnv(); err != nil || ring.active != "2026-10" {
+		t.Fatalf("expected ENCRYPTION_ACTIVE_KID to pick the active key, got %+v, %v", ring, err)
+	}
+
+	os.Setenv("ENCRYPTION_KEYS", "2026-09:not base64!")
+
+	if _, err := KeyRingFromEnv(); err == nil {
+		t.Fatal("expected a key which isn't base64 to be rejected")
+	}
+}
@@ -0,0 +1,82 @@
+package v1services
+
+import (
+	database "go-multitenancy-boilerplate/database"
+	models "go-multitenancy-boilerplate/models"
+	passwords "go-multitenancy-boilerplate/passwords"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Audited self-service actions.
+const (
+	AuditPasswordChange       = "auth.password_changed"
+	AuditMasterPasswordChange = "master_auth.password_changed"
+)
+
+var ErrIncorrectPassword = errors.New("the current password is incorrect")
+
+// Changes the password of a tenant user who knows their current one.
+// Every session and token of the user authorized before now stops working, the caller authorizes the current one again.
+func ChangePassword(actor Actor, userId uint, current string, password string, connection *gorm.DB) error {
+
+	err := changePassword(actor.TenantId, userId, current, password, connection)
+
+	recordTenantEvent(connection, actor, AuditPasswordChange, "user", userId, nil, nil, err)
+
+	return err
+}
+
+func changePassword(tenantId uint, userId uint, current string, password string, connection *gorm.DB) error {
+
+	policy, err := GetTenantPasswordPolicy(tenantId)
+
+	if err != nil {
+		return err
+	}
+
+	return connection.Transaction(func(tx *gorm.DB) error {
+
+		var user models.User
+
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id, password").Where("id = ?", userId).First(&user).Error; err != nil {
+			return err
+		}
+
+		if !passwords.Verify(current, user.Password) {
+			return ErrIncorrectPassword
+		}
+
+		return setUserPassword(userId, password, policy, tx)
+	})
+}
+
+// Changes the password of a master user who knows their current one.
+// Every session and token of the user authorized before now stops working, the caller authorizes the current one again.
+func ChangeMasterPassword(actor Actor, userId uint, current string, password string) error {
+
+	err := changeMasterPassword(userId, current, password)
+
+	recordMasterEvent(actor, 0, AuditMasterPasswordChange, "master_user", userId, nil, nil, err)
+
+	return err
+}
+
+func changeMasterPassword(userId uint, current string, password string) error {
+
+	return database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		var user MasterUser
+
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id, password").Where("id = ?", userId).First(&user).Error; err != nil {
+			return err
+		}
+
+		if !passwords.Verify(current, user.Password) {
+			return ErrIncorrectPassword
+		}
+
+		return setMasterUserPassword(userId, password, tx)
+	})
+}
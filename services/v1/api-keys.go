@@ -0,0 +1,244 @@
+package v1services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Audited API key actions.
+const (
+	AuditApiKeyCreate = "api_key.create"
+	AuditApiKeyRevoke = "api_key.revoke"
+)
+
+// Keys start with this, followed by random characters shown as the key's prefix.
+const apiKeyPrefix = "mtk_"
+
+// How often the last use of a key is written, requests in between don't touch the row.
+const apiKeyTouchInterval = time.Minute
+
+var (
+	ErrApiKeyInvalid      = errors.New("the API key is invalid, revoked or expired")
+	ErrApiKeyIpNotAllowed = errors.New("the API key can't be used from this IP address")
+	ErrInvalidApiKey      = errors.New("the API key details are invalid")
+	ErrScopeNotHeld       = errors.New("a key can't be given a permission its creator doesn't have")
+	ErrApiKeyRevoked      = errors.New("the API key has already been revoked")
+)
+
+// The details of a new API key.
+type ApiKeyRequest struct {
+	Name       string
+	Scopes     []string
+	AllowedIps []string // Addresses or CIDR ranges, empty allows any.
+	ExpiresAt  *time.Time
+}
+
+// Creates an API key acting for the actor with some of their permissions.
+// The key is only ever returned here, afterwards only its prefix is known.
+func CreateApiKey(actor Actor, request ApiKeyRequest, connection *gorm.DB) (*tenants.TenantApiKey, string, error) {
+
+	apiKey, key, err := createApiKey(actor, request, connection)
+
+	var id uint
+	if apiKey != nil {
+		id = apiKey.ID
+	}
+
+	recordTenantEvent(connection, actor, AuditApiKeyCreate, "api_key", id, nil, apiKey, err)
+
+	return apiKey, key, err
+}
+
+func createApiKey(actor Actor, request ApiKeyRequest, connection *gorm.DB) (*tenants.TenantApiKey, string, error) {
+
+	allowedIps, err := request.validate()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	// A key never grants more than its creator holds.
+	for _, scope := range request.Scopes {
+
+		allowed, err := UserHasPermission(actor.UserId(), scope, connection)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if !allowed {
+			return nil, "", errors.Wrap(ErrScopeNotHeld, scope)
+		}
+	}
+
+	prefix, key, err := generateApiKey()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	apiKey := tenants.TenantApiKey{
+		TenantId:   actor.TenantId,
+		Name:       strings.TrimSpace(request.Name),
+		Prefix:     prefix,
+		KeyHash:    helpers.HashToken(key),
+		Scopes:     strings.Join(request.Scopes, ","),
+		AllowedIps: strings.Join(allowedIps, ","),
+		CreatedBy:  actor.UserId(),
+		ExpiresAt:  request.ExpiresAt,
+	}
+
+	if err := database.Connection.Create(&apiKey).Error; err != nil {
+		return nil, "", err
+	}
+
+	return &apiKey, key, nil
+}
+
+// Checks the key details, returns the allowed addresses in their canonical form.
+func (r ApiKeyRequest) validate() ([]string, error) {
+
+	if name := strings.TrimSpace(r.Name); len(name) == 0 || len(name) > 100 {
+		return nil, errors.Wrap(ErrInvalidApiKey, "the name must be between 1 and 100 characters")
+	}
+
+	if len(r.Scopes) == 0 {
+		return nil, errors.Wrap(ErrInvalidApiKey, "at least one scope is required")
+	}
+
+	if err := validatePermissions(r.Scopes); err != nil {
+		return nil, errors.Wrap(ErrInvalidApiKey, err.Error())
+	}
+
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return nil, errors.Wrap(ErrInvalidApiKey, "the expiry must be in the future")
+	}
+
+	allowedIps := []string{}
+
+	for _, entry := range r.AllowedIps {
+
+		entry = strings.TrimSpace(entry)
+
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			allowedIps = append(allowedIps, network.String())
+			continue
+		}
+
+		ip := net.ParseIP(entry)
+
+		if ip == nil {
+			return nil, errors.Wrap(ErrInvalidApiKey, "not an IP address or CIDR range: "+entry)
+		}
+
+		allowedIps = append(allowedIps, ip.String())
+	}
+
+	return allowedIps, nil
+}
+
+// Generates a key, the visible prefix is the start of it.
+func generateApiKey() (string, string, error) {
+
+	buffer := make([]byte, 4)
+
+	if _, err := rand.Read(buffer); err != nil {
+		return "", "", err
+	}
+
+	secret, err := helpers.GenerateToken(32)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix := apiKeyPrefix + hex.EncodeToString(buffer)
+
+	return prefix, prefix + "_" + secret, nil
+}
+
+// Lists the keys of a tenant which haven't been revoked, newest first.
+func ListApiKeys(tenantId uint) ([]tenants.TenantApiKey, error) {
+
+	var apiKeys []tenants.TenantApiKey
+
+	err := database.Connection.Where("tenant_id = ? AND revoked_at IS NULL", tenantId).Order("created_at DESC").Find(&apiKeys).Error
+
+	return apiKeys, err
+}
+
+// Revokes a key of the actor's tenant, it stops working straight away.
+func RevokeApiKey(actor Actor, id uint, connection *gorm.DB) error {
+
+	err := database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		var apiKey tenants.TenantApiKey
+
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ? AND tenant_id = ?", id, actor.TenantId).First(&apiKey).Error; err != nil {
+			return err
+		}
+
+		if apiKey.RevokedAt != nil {
+			return ErrApiKeyRevoked
+		}
+
+		return tx.Model(&apiKey).UpdateColumn("revoked_at", time.Now().UTC()).Error
+	})
+
+	recordTenantEvent(connection, actor, AuditApiKeyRevoke, "api_key", id, nil, nil, err)
+
+	return err
+}
+
+// Finds the active key presented by a request and records its use.
+func AuthenticateApiKey(key string, ip string) (*tenants.TenantApiKey, error) {
+
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrApiKeyInvalid
+	}
+
+	var apiKey tenants.TenantApiKey
+
+	if err := database.Connection.Where("key_hash = ?", helpers.HashToken(key)).First(&apiKey).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrApiKeyInvalid
+		}
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	if !apiKey.IsActive(now) {
+		return nil, ErrApiKeyInvalid
+	}
+
+	if !apiKey.AllowsIp(ip) {
+		return nil, ErrApiKeyIpNotAllowed
+	}
+
+	// Writing on every request would turn busy integrations into a stream of updates.
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval || apiKey.LastUsedIp != ip {
+
+		err := database.Connection.Model(&apiKey).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		}).Error
+
+		if err != nil {
+			fmt.Println("An error occurred while recording the use of API key", apiKey.Prefix, err)
+		}
+	}
+
+	return &apiKey, nil
+}
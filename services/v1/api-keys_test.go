@@ -0,0 +1,113 @@
+package v1services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	databasetest "go-multitenancy-boilerplate/database/databasetest"
+	helpers "go-multitenancy-boilerplate/helpers"
+)
+
+func TestAuthenticateApiKey(t *testing.T) {
+
+	const key = apiKeyPrefix + "0123456789abcdef"
+
+	now := time.Now().UTC()
+	recently := now.Add(-10 * time.Second)
+	past := now.Add(-time.Hour)
+
+	// The columns of the stored key authentication looks at.
+	type storedKey struct {
+		scopes     string
+		allowedIps string
+		expiresAt  *time.Time
+		revokedAt  *time.Time
+		lastUsedAt *time.Time
+		lastUsedIp string
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		stored  *storedKey
+		lookup  error
+		ip      string
+		err     error
+		touched bool
+	}{
+		{"valid key", key, &storedKey{scopes: "users:read"}, nil, "203.0.113.7", nil, true},
+		{"used recently from the same address", key, &storedKey{lastUsedAt: &recently, lastUsedIp: "203.0.113.7"}, nil, "203.0.113.7", nil, false},
+		{"used recently from another address", key, &storedKey{lastUsedAt: &recently, lastUsedIp: "203.0.113.8"}, nil, "203.0.113.7", nil, true},
+		{"used a while ago", key, &storedKey{lastUsedAt: &past, lastUsedIp: "203.0.113.7"}, nil, "203.0.113.7", nil, true},
+		{"allowed address", key, &storedKey{allowedIps: "203.0.113.0/24"}, nil, "203.0.113.7", nil, true},
+		{"address not allowed", key, &storedKey{allowedIps: "198.51.100.0/24"}, nil, "203.0.113.7", ErrApiKeyIpNotAllowed, false},
+		{"revoked", key, &storedKey{revokedAt: &past}, nil, "203.0.113.7", ErrApiKeyInvalid, false},
+		{"expired", key, &storedKey{expiresAt: &past}, nil, "203.0.113.7", ErrApiKeyInvalid, false},
+		{"unknown key", key, nil, nil, "203.0.113.7", ErrApiKeyInvalid, false},
+		{"not an api key", "0123456789abcdef", &storedKey{}, nil, "203.0.113.7", ErrApiKeyInvalid, false},
+		{"lookup fails", key, nil, errors.New("connection reset"), "203.0.113.7", errors.New("connection reset"), false},
+	}
+
+	optional := func(value *time.Time) driver.Value {
+		if value == nil {
+			return nil
+		}
+		return *value
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			recorder, restore := useTestDatabase()
+			defer restore()
+
+			if test.stored != nil {
+				recorder.On(`FROM "tenant_api_keys"`, databasetest.Response{
+					Columns: []string{"id", "tenant_id", "prefix", "key_hash", "scopes", "allowed_ips", "expires_at", "revoked_at", "last_used_at", "last_used_ip"},
+					Rows: [][]driver.Value{{int64(3), int64(2), key[:8], helpers.HashToken(key), test.stored.scopes, test.stored.allowedIps,
+						optional(test.stored.expiresAt), optional(test.stored.revokedAt), optional(test.stored.lastUsedAt), test.stored.lastUsedIp}},
+				})
+			}
+
+			if test.lookup != nil {
+				recorder.On(`FROM "tenant_api_keys"`, databasetest.Response{Err: test.lookup})
+			}
+
+			apiKey, err := AuthenticateApiKey(test.key, test.ip)
+
+			if (err == nil) != (test.err == nil) || (err != nil && err.Error() != test.err.Error()) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+
+			if err == nil && (apiKey == nil || apiKey.TenantId != 2 || apiKey.Scopes != test.stored.scopes) {
+				t.Fatalf("expected the stored key, got %+v", apiKey)
+			}
+
+			lookups := recorder.Matching(`FROM "tenant_api_keys"`)
+
+			if test.key != key {
+				if len(lookups) != 0 {
+					t.Fatalf("expected keys without the prefix not to be looked up, got %v", lookups)
+				}
+				return
+			}
+
+			// Only the hash of the key ever reaches the database.
+			if len(lookups) != 1 || lookups[0].Args[0] != helpers.HashToken(key) {
+				t.Fatalf("expected the key to be looked up by its hash, got %v", lookups)
+			}
+
+			updates := recorder.Matching(`UPDATE "tenant_api_keys"`)
+
+			if test.touched != (len(updates) == 1) {
+				t.Fatalf("expected the use to be recorded: %v, got %v", test.touched, updates)
+			}
+
+			if test.touched && updates[0].Args[1] != test.ip {
+				t.Fatalf("expected the address to be recorded, got %v", updates[0].Args)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package v1services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	models "go-multitenancy-boilerplate/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Audited actions.
+const (
+	AuditUserCreate        = "user.create"
+	AuditUserUpdate        = "user.update"
+	AuditUserDelete        = "user.delete"
+	AuditLogin             = "auth.login"
+	AuditLockout           = "auth.lockout"
+	AuditMasterUserCreate  = "master_user.create"
+	AuditMasterUserUpdate  = "master_user.update"
+	AuditMasterUserDelete  = "master_user.delete"
+	AuditMasterLogin       = "master_auth.login"
+	AuditMasterLockout     = "master_auth.lockout"
+	AuditTenantCreate      = "tenant.create"
+	AuditTenantCreateQueue = "tenant.create_queued"
+	AuditTenantSettings    = "tenant.settings_update"
+)
+
+// Fields which never end up in an audit diff.
+var auditRedactedFields = map[string]bool{
+	"Password":         true,
+	"ConnectionString": true,
+	"TokenHash":        true,
+	"KeyHash":          true,
+	"CodeHash":         true,
+	"TwoFactorSecret":  true,
+	"ClientSecret":     true,
+	"TwoFactorStep":    true,
+	"UpdatedAt":        true,
+	"CreatedAt":        true,
+}
+
+// Who is performing a call, recorded with every audit event.
+type Actor struct {
+	Type             string
+	Id               uint
+	Email            string
+	TenantId         uint // The tenant the request was made against, if any.
+	TenantIdentifier string
+	IP               string
+	UserAgent        string
+	ApiKeyUserId     uint // For API keys, the user the key acts for.
+}
+
+// The user behind the actor, for API keys the user who created the key.
+func (a Actor) UserId() uint {
+
+	if a.Type == models.ActorApiKey {
+		return a.ApiKeyUserId
+	}
+
+	return a.Id
+}
+
+// An actor for work not started by a user, e.g. the command line or start up.
+func SystemActor(name string) Actor {
+	return Actor{Type: models.ActorSystem, Email: name}
+}
+
+// A change of a single field.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Filters for listing audit events.
+type AuditFilter struct {
+	ActorId    uint
+	Action     string // Matches the action or, ending in a dot, every action starting with it.
+	TargetType string
+	TargetId   uint
+	Outcome    string
+	TenantId   uint // Master events only, the tenant involved.
+	From       *time.Time
+	To         *time.Time
+	Page       int
+	PageSize   int
+}
+
+// Records a login lockout, pass the tenant connection for tenant users or nil for master users.
+func RecordLockout(actor Actor, email string, connection *gorm.DB) {
+
+	actor.Email = email
+	cause := errors.New("too many failed login attempts")
+
+	if connection == nil {
+		recordMasterEvent(actor, 0, AuditMasterLockout, "master_user", 0, nil, nil, cause)
+		return
+	}
+
+	recordTenantEvent(connection, actor, AuditLockout, "user", 0, nil, nil, cause)
+}
+
+// Lists audit events newest first, returns the events and the total number matching the filters.
+// Pass a tenant connection for tenant events or database.Connection for master events.
+func ListAuditEvents(filter AuditFilter, connection *gorm.DB) ([]models.AuditEvent, int, error) {
+
+	query := connection.Model(&models.AuditEvent{})
+
+	if filter.ActorId > 0 {
+		query = query.Where("actor_id = ?", filter.ActorId)
+	}
+
+	if strings.HasSuffix(filter.Action, ".") {
+		query = query.Where("action LIKE ?", filter.Action+"%")
+	} else if len(filter.Action) > 0 {
+		query = query.Where("action = ?", filter.Action)
+	}
+
+	if len(filter.TargetType) > 0 {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+
+	if filter.TargetId > 0 {
+		query = query.Where("target_id = ?", filter.TargetId)
+	}
+
+	if len(filter.Outcome) > 0 {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+
+	if filter.TenantId > 0 {
+		query = query.Where("tenant_id = ?", filter.TenantId)
+	}
+
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []models.AuditEvent
+
+	if err := query.Order("created_at desc, id desc").Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// Records an event in the tenant database, a failure to record never fails the call being audited.
+func recordTenantEvent(connection *gorm.DB, actor Actor, action string, targetType string, targetId uint, before interface{}, after interface{}, cause error) {
+	recordEvent(connection, auditEvent(actor, action, targetType, targetId, before, after, cause))
+}
+
+// Records an event in the master database, tenantId names the tenant involved, if any.
+func recordMasterEvent(actor Actor, tenantId uint, action string, targetType string, targetId uint, before interface{}, after interface{}, cause error) {
+
+	event := auditEvent(actor, action, targetType, targetId, before, after, cause)
+	event.TenantId = tenantId
+
+	recordEvent(database.Connection, event)
+}
+
+func recordEvent(connection *gorm.DB, event models.AuditEvent) {
+
+	if err := connection.Create(&event).Error; err != nil {
+		fmt.Println("An error occurred while recording the audit event", event.Action, err)
+	}
+}
+
+func auditEvent(actor Actor, action string, targetType string, targetId uint, before interface{}, after interface{}, cause error) models.AuditEvent {
+
+	event := models.AuditEvent{
+		ActorType:        actor.Type,
+		ActorId:          actor.Id,
+		ActorEmail:       actor.Email,
+		TenantIdentifier: actor.TenantIdentifier,
+		Action:           action,
+		TargetType:       targetType,
+		TargetId:         targetId,
+		Outcome:          models.AuditSucceeded,
+		IP:               actor.IP,
+		UserAgent:        actor.UserAgent,
+	}
+
+	if cause != nil {
+		event.Outcome = models.AuditFailed
+		event.Error = cause.Error()
+	}
+
+	if changes := auditDiff(before, after); len(changes) > 0 {
+		if encoded, err := json.Marshal(changes); err == nil {
+			event.Changes = string(encoded)
+		}
+	}
+
+	return event
+}
+
+// Compares the exported fields of two values of the same struct type, either may be nil.
+func auditDiff(before interface{}, after interface{}) map[string]AuditChange {
+
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+
+	changes := make(map[string]AuditChange)
+
+	for name, value := range afterFields {
+		if previous, ok := beforeFields[name]; !ok || !reflect.DeepEqual(previous, value) {
+			changes[name] = AuditChange{Before: beforeFields[name], After: value}
+		}
+	}
+
+	for name, value := range beforeFields {
+		if _, ok := afterFields[name]; !ok {
+			changes[name] = AuditChange{Before: value}
+		}
+	}
+
+	return changes
+}
+
+// Flattens the exported fields of a struct, including embedded structs, leaving out redacted fields.
+func auditFields(value interface{}) map[string]interface{} {
+
+	fields := make(map[string]interface{})
+
+	if value == nil {
+		return fields
+	}
+
+	v := reflect.ValueOf(value)
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return fields
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return fields
+	}
+
+	collectAuditFields(v, fields)
+
+	return fields
+}
+
+func collectAuditFields(v reflect.Value, fields map[string]interface{}) {
+
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+
+		field := t.Field(i)
+
+		if field.PkgPath != "" || auditRedactedFields[field.Name] {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collectAuditFields(v.Field(i), fields)
+			continue
+		}
+
+		// Relations are audited on their own.
+		switch field.Type.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Struct:
+			if field.Type != reflect.TypeOf(time.Time{}) {
+				continue
+			}
+		}
+
+		fields[field.Name] = v.Field(i).Interface()
+	}
+}
@@ -0,0 +1,124 @@
+package v1services
+
+import (
+	"fmt"
+	"time"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+	mailer "go-multitenancy-boilerplate/mailer"
+	models "go-multitenancy-boilerplate/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Audited email verification actions.
+const (
+	AuditEmailVerificationSent = "user.email_verification_sent"
+	AuditEmailVerified         = "user.email_verified"
+)
+
+// Emails a tenant user a link to verify their email address.
+func SendEmailVerification(actor Actor, userId uint, connection *gorm.DB) error {
+
+	var user models.User
+
+	if err := connection.Where("id = ?", userId).First(&user).Error; err != nil {
+		return err
+	}
+
+	return sendEmailVerification(actor, user, connection)
+}
+
+// Sends a new verification link to an unverified tenant user.
+// Unknown and already verified email addresses are silently ignored so the response doesn't reveal who has an account.
+func RequestEmailVerification(actor Actor, email string, connection *gorm.DB) error {
+
+	var user models.User
+
+	if err := connection.Where("email = ?", email).First(&user).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	if user.EmailVerified {
+		return nil
+	}
+
+	actor.Email = email
+
+	return sendEmailVerification(actor, user, connection)
+}
+
+// Marks the email address of the tenant user the verification token was issued to as verified.
+func VerifyEmail(actor Actor, token string, connection *gorm.DB) error {
+
+	var userId uint
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		found, err := consumeUserToken(token, models.TokenEmailVerification, tx)
+
+		if err != nil {
+			return err
+		}
+
+		userId = found.UserId
+
+		return tx.Model(&models.User{}).Where("id = ?", found.UserId).UpdateColumns(map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": time.Now().UTC(),
+		}).Error
+	})
+
+	actor.Id = userId
+	recordTenantEvent(connection, actor, AuditEmailVerified, "user", userId, nil, nil, err)
+
+	return err
+}
+
+func sendEmailVerification(actor Actor, user models.User, connection *gorm.DB) error {
+
+	token, err := issueUserToken(user.ID, models.TokenEmailVerification, emailVerificationTTL(), connection)
+
+	if err == nil {
+
+		link := tokenLink("TENANT_EMAIL_VERIFICATION_URL", actor.TenantIdentifier, token)
+
+		body := "Please confirm this is your email address.\n\n"
+
+		if len(link) > 0 {
+			body += "Verify your email address: " + link + "\n"
+		} else {
+			body += "Your verification code: " + token + "\n"
+		}
+
+		body += fmt.Sprintf("\nThe link expires in %s.\n", emailVerificationTTL())
+
+		err = mailer.Default().Send(mailer.Message{To: user.Email, Subject: "Verify your email address", Body: body})
+	}
+
+	recordTenantEvent(connection, actor, AuditEmailVerificationSent, "user", user.ID, nil, nil, err)
+
+	return err
+}
+
+// Resets the verified state after the email address changed, links sent to the old address stop working.
+func unverifyEmail(userId uint, tx *gorm.DB) error {
+
+	err := tx.Model(&models.User{}).Where("id = ?", userId).UpdateColumns(map[string]interface{}{
+		"email_verified":    false,
+		"email_verified_at": nil,
+	}).Error
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userId, models.TokenEmailVerification).Delete(&models.UserToken{}).Error
+}
+
+func emailVerificationTTL() time.Duration {
+	return helpers.GetEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+}
@@ -0,0 +1,339 @@
+package v1services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+	mailer "go-multitenancy-boilerplate/mailer"
+	models "go-multitenancy-boilerplate/models"
+	passwords "go-multitenancy-boilerplate/passwords"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Audited invitation actions.
+const (
+	AuditInvitationCreate = "invitation.create"
+	AuditInvitationResend = "invitation.resend"
+	AuditInvitationRevoke = "invitation.revoke"
+	AuditInvitationAccept = "invitation.accept"
+)
+
+var (
+	ErrUserExists        = errors.New("a user with that email address already exists")
+	ErrInvitationPending = errors.New("that email address already has a pending invitation")
+	ErrInvitationClosed  = errors.New("the invitation has already been accepted or revoked")
+)
+
+// Invites somebody to join the tenant, they get the role once they accept, the member role when roleId is 0.
+func CreateInvitation(actor Actor, email string, roleId uint, connection *gorm.DB) (*models.Invitation, error) {
+
+	invitation, err := createInvitation(actor, email, roleId, connection)
+
+	var id uint
+	if invitation != nil {
+		id = invitation.ID
+	}
+
+	recordTenantEvent(connection, actor, AuditInvitationCreate, "invitation", id, nil, invitation, err)
+
+	return invitation, err
+}
+
+func createInvitation(actor Actor, email string, roleId uint, connection *gorm.DB) (*models.Invitation, error) {
+
+	var invitation models.Invitation
+	var token string
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		var users int
+		if err := tx.Model(&models.User{}).Where("email = ?", email).Count(&users).Error; err != nil {
+			return err
+		}
+
+		if users > 0 {
+			return ErrUserExists
+		}
+
+		var pending int
+		if err := pendingInvitations(tx.Model(&models.Invitation{}), time.Now().UTC()).Where("email = ?", email).Count(&pending).Error; err != nil {
+			return err
+		}
+
+		if pending > 0 {
+			return ErrInvitationPending
+		}
+
+		role, err := invitationRole(roleId, tx)
+
+		if err != nil {
+			return err
+		}
+
+		if token, err = helpers.GenerateToken(32); err != nil {
+			return err
+		}
+
+		invitation = models.Invitation{
+			Email:     email,
+			RoleId:    role.ID,
+			InvitedBy: actor.UserId(),
+			TokenHash: helpers.HashToken(token),
+			ExpiresAt: time.Now().UTC().Add(invitationTTL()),
+		}
+
+		return tx.Create(&invitation).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &invitation, sendInvitation(actor.TenantIdentifier, invitation.Email, token)
+}
+
+// Lists the invitations of the tenant newest first, optionally only those with the given status.
+func ListInvitations(status string, page int, pageSize int, connection *gorm.DB) ([]models.Invitation, int, error) {
+
+	query := connection.Model(&models.Invitation{})
+	now := time.Now().UTC()
+
+	switch status {
+	case models.InvitationPending:
+		query = pendingInvitations(query, now)
+	case models.InvitationAccepted:
+		query = query.Where("accepted_at IS NOT NULL")
+	case models.InvitationRevoked:
+		query = query.Where("revoked_at IS NOT NULL")
+	case models.InvitationExpired:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	}
+
+	var total int
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var found []models.Invitation
+
+	if err := query.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&found).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return found, total, nil
+}
+
+// Sends an invitation again with a new token and expiry, the previous link stops working.
+func ResendInvitation(actor Actor, id uint, connection *gorm.DB) (*models.Invitation, error) {
+
+	var invitation models.Invitation
+	var token string
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&invitation).Error; err != nil {
+			return err
+		}
+
+		if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+			return ErrInvitationClosed
+		}
+
+		var err error
+
+		if token, err = helpers.GenerateToken(32); err != nil {
+			return err
+		}
+
+		return tx.Model(&invitation).Updates(models.Invitation{
+			TokenHash: helpers.HashToken(token),
+			ExpiresAt: time.Now().UTC().Add(invitationTTL()),
+		}).Error
+	})
+
+	if err == nil {
+		err = sendInvitation(actor.TenantIdentifier, invitation.Email, token)
+	}
+
+	recordTenantEvent(connection, actor, AuditInvitationResend, "invitation", id, nil, nil, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+// Revokes an invitation which hasn't been accepted yet.
+func RevokeInvitation(actor Actor, id uint, connection *gorm.DB) (string, error) {
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		var invitation models.Invitation
+
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&invitation).Error; err != nil {
+			return err
+		}
+
+		if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+			return ErrInvitationClosed
+		}
+
+		return tx.Model(&invitation).Update("revoked_at", time.Now().UTC()).Error
+	})
+
+	recordTenantEvent(connection, actor, AuditInvitationRevoke, "invitation", id, nil, nil, err)
+
+	if err != nil {
+		return "", err
+	}
+
+	return "The invitation has been revoked", nil
+}
+
+// Accepts an invitation, creating the user with the password and name they chose.
+// The email address is verified as the invitation was delivered to it.
+func AcceptInvitation(actor Actor, token string, password string, firstName string, lastName string, connection *gorm.DB) (uint, error) {
+
+	var invitation models.Invitation
+	var user models.User
+
+	policy, err := GetTenantPasswordPolicy(actor.TenantId)
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = connection.Transaction(func(tx *gorm.DB) error {
+
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Where("token_hash = ?", helpers.HashToken(token)).First(&invitation).Error
+
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrInvalidToken
+		}
+
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+
+		if invitation.Status(now) != models.InvitationPending {
+			return ErrInvalidToken
+		}
+
+		var users int
+		if err := tx.Model(&models.User{}).Where("email = ?", invitation.Email).Count(&users).Error; err != nil {
+			return err
+		}
+
+		if users > 0 {
+			return ErrUserExists
+		}
+
+		if err := policy.Validate(password); err != nil {
+			return err
+		}
+
+		hash, err := passwords.Hash(password)
+
+		if err != nil {
+			return err
+		}
+
+		user = models.User{
+			Email:             invitation.Email,
+			Password:          hash,
+			FirstName:         firstName,
+			LastName:          lastName,
+			EmailVerified:     true,
+			EmailVerifiedAt:   &now,
+			PasswordChangedAt: &now,
+		}
+
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		if err := recordPasswordHistory(user.ID, hash, tx); err != nil {
+			return err
+		}
+
+		// The role may have been deleted since the invitation was sent.
+		role, err := invitationRole(invitation.RoleId, tx)
+
+		if gorm.IsRecordNotFoundError(err) {
+			role, err = invitationRole(0, tx)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(&models.UserRole{UserId: user.ID, RoleId: role.ID}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&invitation).Updates(models.Invitation{AcceptedAt: &now, UserId: user.ID}).Error
+	})
+
+	actor.Id = user.ID
+	actor.Email = invitation.Email
+	recordTenantEvent(connection, actor, AuditInvitationAccept, "invitation", invitation.ID, nil, nil, err)
+
+	if err != nil {
+		return 0, err
+	}
+
+	recordTenantEvent(connection, actor, AuditUserCreate, "user", user.ID, nil, &user, nil)
+
+	return user.ID, nil
+}
+
+// Limits a query to invitations which can still be accepted.
+func pendingInvitations(query *gorm.DB, now time.Time) *gorm.DB {
+	return query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+}
+
+// The role an invitation grants, the member role when roleId is 0.
+func invitationRole(roleId uint, tx *gorm.DB) (*models.Role, error) {
+
+	var role models.Role
+
+	query := tx.Where("id = ?", roleId)
+
+	if roleId == 0 {
+		query = tx.Where("name = ? AND system = ?", models.RoleMember, true)
+	}
+
+	if err := query.First(&role).Error; err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func sendInvitation(tenantIdentifier string, email string, token string) error {
+
+	link := tokenLink("TENANT_INVITATION_URL", tenantIdentifier, token)
+
+	body := "You have been invited to join " + tenantIdentifier + ".\n\n"
+
+	if len(link) > 0 {
+		body += "Accept the invitation: " + link + "\n"
+	} else {
+		body += "Your invitation code: " + token + "\n"
+	}
+
+	body += fmt.Sprintf("\nThe invitation expires in %s.\n", invitationTTL())
+
+	return mailer.Default().Send(mailer.Message{To: email, Subject: "You have been invited to " + tenantIdentifier, Body: body})
+}
+
+func invitationTTL() time.Duration {
+	return helpers.GetEnvDuration("INVITATION_TTL", 7*24*time.Hour)
+}
@@ -0,0 +1,94 @@
+package v1services
+
+import (
+	database "go-multitenancy-boilerplate/database"
+	models "go-multitenancy-boilerplate/models"
+	throttle "go-multitenancy-boilerplate/throttle"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Audited unlocks of throttled logins.
+const (
+	AuditUserUnlock       = "user.login_unlock"
+	AuditMasterUserUnlock = "master_user.login_unlock"
+	AuditEmailUnlock      = "master_auth.email_unlock"
+	AuditIpAddressUnlock  = "master_auth.ip_unlock"
+)
+
+// Returned when a login's email address or password is wrong, these count towards the login throttle.
+var ErrInvalidCredentials = errors.New("passwords did not match")
+
+// Whether a login failed on its email address, password or two-factor code rather than something else.
+func IsInvalidCredentials(err error) bool {
+	return err == ErrInvalidCredentials || err == ErrInvalidTwoFactorCode || gorm.IsRecordNotFoundError(err)
+}
+
+// Lets a tenant user who failed to log in too often try again, their IP address stays throttled.
+func UnlockUser(actor Actor, userId uint, connection *gorm.DB) error {
+
+	err := unlockUser(actor.TenantId, userId, connection)
+
+	recordTenantEvent(connection, actor, AuditUserUnlock, "user", userId, nil, nil, err)
+
+	return err
+}
+
+func unlockUser(tenantId uint, userId uint, connection *gorm.DB) error {
+
+	var user models.User
+
+	if err := connection.Select("id, email").Where("id = ?", userId).First(&user).Error; err != nil {
+		return err
+	}
+
+	return throttle.Default().Unlock(throttle.AccountKey(tenantId, user.Email))
+}
+
+// Lets a master user who failed to log in too often try again, their IP address stays throttled.
+func UnlockMasterUser(actor Actor, userId uint) error {
+
+	err := unlockMasterUser(userId)
+
+	recordMasterEvent(actor, 0, AuditMasterUserUnlock, "master_user", userId, nil, nil, err)
+
+	return err
+}
+
+func unlockMasterUser(userId uint) error {
+
+	var user MasterUser
+
+	if err := database.Connection.Select("id, email").Where("id = ?", userId).First(&user).Error; err != nil {
+		return err
+	}
+
+	return throttle.Default().Unlock(throttle.MasterAccountKey(user.Email))
+}
+
+// Unlocks logins with an email address whether or not it belongs to a user, a tenant id of zero is the master dashboard.
+func UnlockEmail(actor Actor, tenantId uint, email string) error {
+
+	key := throttle.MasterAccountKey(email)
+
+	if tenantId > 0 {
+		key = throttle.AccountKey(tenantId, email)
+	}
+
+	err := throttle.Default().Unlock(key)
+
+	recordMasterEvent(actor, tenantId, AuditEmailUnlock, "email", 0, nil, map[string]string{"email": email}, err)
+
+	return err
+}
+
+// Unlocks logins from an IP address, for every tenant and the master dashboard.
+func UnlockIpAddress(actor Actor, ipAddress string) error {
+
+	err := throttle.Default().Unlock(throttle.IpKey(ipAddress))
+
+	recordMasterEvent(actor, 0, AuditIpAddressUnlock, "ip_address", 0, nil, map[string]string{"ipAddress": ipAddress}, err)
+
+	return err
+}
@@ -0,0 +1,233 @@
+package v1services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
+	models "go-multitenancy-boilerplate/models"
+	passwords "go-multitenancy-boilerplate/passwords"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Returned once the first master user exists, the setup flow can never be used again.
+var ErrMasterSetupCompleted = errors.New("the master setup has already been completed")
+
+// Returned when the setup token does not match the one printed at start up.
+var ErrInvalidSetupToken = errors.New("the setup token is invalid")
+
+// Runs on start up until the first master user exists. Credentials in MASTER_BOOTSTRAP_EMAIL and
+// MASTER_BOOTSTRAP_PASSWORD create the super admin straight away, otherwise a one-time setup token
+// is printed which CompleteMasterSetup exchanges for the super admin.
+func BootstrapMasterUser() error {
+
+	return database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		bootstrap, err := lockMasterBootstrap(tx)
+
+		if err != nil {
+			return err
+		}
+
+		if bootstrap.IsCompleted() {
+			return nil
+		}
+
+		// Installs which already have master users never need the setup flow.
+		var count int
+		if err := tx.Model(&models.MasterUser{}).Unscoped().Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return completeMasterBootstrap(tx, bootstrap, 0)
+		}
+
+		email := strings.TrimSpace(os.Getenv("MASTER_BOOTSTRAP_EMAIL"))
+		password := os.Getenv("MASTER_BOOTSTRAP_PASSWORD")
+
+		if len(email) > 0 && len(password) > 0 {
+
+			if message, ok := validateMasterSetup(email, password); !ok {
+				return errors.New("MASTER_BOOTSTRAP_EMAIL and MASTER_BOOTSTRAP_PASSWORD: " + message)
+			}
+
+			user, err := createSuperAdmin(tx, email, password)
+
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Created the first master user", email)
+
+			recordEvent(tx, auditEvent(SystemActor("bootstrap"), AuditMasterUserCreate, "master_user", user.ID, nil, user, nil))
+
+			return completeMasterBootstrap(tx, bootstrap, user.ID)
+		}
+
+		// A new token every start, so a token which was lost or leaked stops working after a restart.
+		token, err := helpers.GenerateToken(32)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(bootstrap).Update("setup_token_hash", helpers.HashToken(token)).Error; err != nil {
+			return err
+		}
+
+		fmt.Println("No master users exist yet, create the first one with POST /api/v1/master/setup using the setup token:", token)
+
+		return nil
+	})
+}
+
+// Whether the first master user still has to be created.
+func IsMasterSetupPending() (bool, error) {
+
+	var bootstrap models.MasterBootstrap
+
+	if err := database.Connection.First(&bootstrap).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return !bootstrap.IsCompleted(), nil
+}
+
+// Exchanges the setup token for the first master user, returns the id of the new super admin.
+func CompleteMasterSetup(actor Actor, token string, email string, password string) (uint, error) {
+
+	if err := MasterPasswordPolicy().Validate(password); err != nil {
+		return 0, err
+	}
+
+	var userId uint
+	completedElsewhere := false
+
+	err := database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		bootstrap, err := lockMasterBootstrap(tx)
+
+		if err != nil {
+			return err
+		}
+
+		if bootstrap.IsCompleted() {
+			return ErrMasterSetupCompleted
+		}
+
+		if len(bootstrap.SetupTokenHash) == 0 || !helpers.CheckTokenHash(token, bootstrap.SetupTokenHash) {
+			return ErrInvalidSetupToken
+		}
+
+		// Somebody may have created a master user another way, e.g. from the command line.
+		var count int
+		if err := tx.Model(&models.MasterUser{}).Unscoped().Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count > 0 {
+			completedElsewhere = true
+			return completeMasterBootstrap(tx, bootstrap, 0)
+		}
+
+		user, err := createSuperAdmin(tx, email, password)
+
+		if err != nil {
+			return err
+		}
+
+		userId = user.ID
+
+		recordEvent(tx, auditEvent(actor, AuditMasterUserCreate, "master_user", user.ID, nil, user, nil))
+
+		return completeMasterBootstrap(tx, bootstrap, user.ID)
+	})
+
+	// The completed state is stored even though no user was created.
+	if err == nil && completedElsewhere {
+		return 0, ErrMasterSetupCompleted
+	}
+
+	return userId, err
+}
+
+// Loads the bootstrap row, creating it the first time, and holds it until the transaction ends.
+func lockMasterBootstrap(tx *gorm.DB) (*models.MasterBootstrap, error) {
+
+	// Serialises concurrent start ups which would otherwise both create the row.
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('master_bootstrap'))").Error; err != nil {
+		return nil, err
+	}
+
+	var bootstrap models.MasterBootstrap
+
+	err := tx.Set("gorm:query_option", "FOR UPDATE").First(&bootstrap).Error
+
+	if gorm.IsRecordNotFoundError(err) {
+		bootstrap = models.MasterBootstrap{}
+		err = tx.Create(&bootstrap).Error
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &bootstrap, nil
+}
+
+func completeMasterBootstrap(tx *gorm.DB, bootstrap *models.MasterBootstrap, userId uint) error {
+
+	now := time.Now().UTC()
+
+	return tx.Model(bootstrap).Updates(map[string]interface{}{
+		"setup_token_hash": "",
+		"completed_at":     now,
+		"completed_by":     userId,
+	}).Error
+}
+
+func createSuperAdmin(tx *gorm.DB, email string, password string) (*MasterUser, error) {
+
+	hash, err := passwords.Hash(password)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	user := MasterUser{Email: email, Password: hash, AccountType: models.MasterAccountSuperAdmin, PasswordChangedAt: &now}
+
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, err
+	}
+
+	if err := recordMasterPasswordHistory(user.ID, hash, tx); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Applies the same rules as creating a master user through the API.
+func validateMasterSetup(email string, password string) (string, bool) {
+
+	if !helpers.ValidateEmail(email) {
+		return "Email is incorrect, please try again.", false
+	}
+
+	if err := MasterPasswordPolicy().Validate(password); err != nil {
+		return err.Error(), false
+	}
+
+	return "", true
+}
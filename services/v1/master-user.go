@@ -2,17 +2,34 @@ package v1services
 
 import (
 	"errors"
+	"time"
 
 	database "go-multitenancy-boilerplate/database"
-	helpers "go-multitenancy-boilerplate/helpers"
 	models "go-multitenancy-boilerplate/models"
+	passwords "go-multitenancy-boilerplate/passwords"
+
+	"github.com/jinzhu/gorm"
 )
 
 type MasterUser models.MasterUser
 
+var (
+	ErrUnknownAccountType = errors.New("unknown account type")
+	ErrLastSuperAdmin     = errors.New("at least one master user must stay a super admin")
+)
+
 // Creates a standard user in the database.
 // Returns the inserted user id
-func CreateMasterUser(email string, password string, accountType int) (uint, error) {
+func CreateMasterUser(actor Actor, email string, password string, accountType int) (uint, error) {
+
+	id, err := createMasterUser(email, password, accountType)
+
+	recordMasterEvent(actor, 0, AuditMasterUserCreate, "master_user", id, nil, &MasterUser{Email: email, AccountType: accountType}, err)
+
+	return id, err
+}
+
+func createMasterUser(email string, password string, accountType int) (uint, error) {
 
 	// Slice for found users.
 	var foundUsers []MasterUser
@@ -26,18 +43,33 @@ func CreateMasterUser(email string, password string, accountType int) (uint, err
 		return 0, errors.New("A user with that email address already exists")
 	}
 
+	if err := MasterPasswordPolicy().Validate(password); err != nil {
+		return 0, err
+	}
+
 	// Hash the password so it's not clear text.
 	// Run outside of the if statements so we can grab the result outside of local scope.
-	hash, hashErr := helpers.HashPassword([]byte(password))
+	hash, hashErr := passwords.Hash(password)
 
 	if hashErr != nil {
 		return 0, hashErr
 	}
 
-	var user = MasterUser{Email: email, Password: hash, AccountType: accountType}
+	now := time.Now().UTC()
+
+	var user = MasterUser{Email: email, Password: hash, AccountType: accountType, PasswordChangedAt: &now}
 
-	// Run create
-	if err := database.Connection.Create(&user).Error; err != nil {
+	// Run create, the first password goes into the history in the same transaction.
+	err := database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		return recordMasterPasswordHistory(user.ID, hash, tx)
+	})
+
+	if err != nil {
 		// Error Handler
 		return 0, err
 	}
@@ -47,49 +79,147 @@ func CreateMasterUser(email string, password string, accountType int) (uint, err
 }
 
 // Logs a user in.
-func LoginMasterUser(email string, password string) (uint, bool, error) {
+func LoginMasterUser(actor Actor, email string, password string) (uint, bool, error) {
+
+	id, ok, err := loginMasterUser(email, password)
+
+	if actor.Id == 0 {
+		actor.Id = id
+		actor.Email = email
+	}
+
+	recordMasterEvent(actor, 0, AuditMasterLogin, "master_user", id, nil, nil, err)
+
+	return id, ok, err
+}
+
+func loginMasterUser(email string, password string) (uint, bool, error) {
 
 	// Create local state user
 	var user MasterUser
 
 	// Find the user by email, return error if input is malformed.
 	if err := database.Connection.First(&user, "email = ?", email).Error; err != nil {
+		// Unknown addresses fail like wrong passwords, and take as long, so logins don't tell who has an account.
+		if gorm.IsRecordNotFoundError(err) {
+			passwords.VerifyUnknown(password)
+			return 0, false, ErrInvalidCredentials
+		}
 		return 0, false, err
 	}
 
 	// Now we've found a user send off the hashed password and sent password for decoding.
-	if result := helpers.CheckPasswordHash(password, user.Password); result != true {
+	if result := passwords.Verify(password, user.Password); result != true {
 		// Passwords do not match
-		return 0, false, errors.New("passwords did not match")
+		return 0, false, ErrInvalidCredentials
+	}
+
+	rehashMasterUserPassword(user.ID, password, user.Password)
+
+	if MasterPasswordPolicy().Expired(user.PasswordChangedAt, time.Now().UTC()) {
+		return user.ID, false, expiredMasterUserPassword(user.ID)
 	}
 
 	// Checks have bee passed return true
 	return user.ID, true, nil
 }
 
-// Updates a user in the database.
-// A separate method is called when updating a company id
-func UpdateMasterUser(id uint, email string, accountType int, firstName string, lastName string, phoneNumber string, recoveryEmail string) (string, error) {
+// Updates a user in the database, empty fields are left unchanged.
+// A nil account type keeps the current one, users updating themselves never change it.
+func UpdateMasterUser(actor Actor, id uint, email string, accountType *int, firstName string, lastName string, phoneNumber string, recoveryEmail string) (string, error) {
 
-	var user MasterUser
+	before := findAuditedMasterUser(id)
+
+	outcome, err := updateMasterUser(id, email, accountType, firstName, lastName, phoneNumber, recoveryEmail)
+
+	recordMasterEvent(actor, 0, AuditMasterUserUpdate, "master_user", id, before, findAuditedMasterUser(id), err)
 
-	// Update the basic user information, anything that was set as nil will not be changed.
-	if err := database.Connection.Model(&user).Where("id = ?", id).Updates(MasterUser{
-		Email:         email,
-		AccountType:   accountType,
-		FirstName:     firstName,
-		LastName:      lastName,
-		PhoneNumber:   phoneNumber,
-		RecoveryEmail: recoveryEmail,
-	}).Error; err != nil {
+	return outcome, err
+}
+
+func updateMasterUser(id uint, email string, accountType *int, firstName string, lastName string, phoneNumber string, recoveryEmail string) (string, error) {
+
+	if accountType != nil {
+		if _, known := models.MasterAccountPermissions[*accountType]; !known {
+			return "", ErrUnknownAccountType
+		}
+	}
+
+	err := database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		var user MasterUser
+
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&user).Error; err != nil {
+			return err
+		}
+
+		// Update the basic user information, anything that was set as nil will not be changed.
+		if err := tx.Model(&user).Updates(MasterUser{
+			Email:         email,
+			FirstName:     firstName,
+			LastName:      lastName,
+			PhoneNumber:   phoneNumber,
+			RecoveryEmail: recoveryEmail,
+		}).Error; err != nil {
+			return err
+		}
+
+		if accountType == nil || *accountType == user.AccountType {
+			return nil
+		}
+
+		if err := ensureNotLastSuperAdmin(user, tx); err != nil {
+			return err
+		}
+
+		// Set on its own, Updates skips zero values so a super admin could never be made a standard user.
+		if err := tx.Model(&user).Update("account_type", *accountType).Error; err != nil {
+			return err
+		}
+
+		return markMasterUserPrivilegesChanged(tx.Where("id = ?", user.ID))
+	})
+
+	if err != nil {
 		return "", err
 	}
 
 	return "User Information Successfully Updated.", nil
 }
 
+// Refuses to take super admin away from the only master user who has it.
+func ensureNotLastSuperAdmin(user MasterUser, tx *gorm.DB) error {
+
+	if user.AccountType != models.MasterAccountSuperAdmin {
+		return nil
+	}
+
+	// Locks the other super admins so two demotions at once can't both pass.
+	var others []MasterUser
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id").Where("account_type = ? AND id <> ?", models.MasterAccountSuperAdmin, user.ID).Find(&others).Error; err != nil {
+		return err
+	}
+
+	if len(others) == 0 {
+		return ErrLastSuperAdmin
+	}
+
+	return nil
+}
+
 // Deletes a user in the database.
-func DeleteMasterUser(id uint) (string, error) {
+func DeleteMasterUser(actor Actor, id uint) (string, error) {
+
+	before := findAuditedMasterUser(id)
+
+	outcome, err := deleteMasterUser(id)
+
+	recordMasterEvent(actor, 0, AuditMasterUserDelete, "master_user", id, before, nil, err)
+
+	return outcome, err
+}
+
+func deleteMasterUser(id uint) (string, error) {
 	var user MasterUser
 
 	if err := database.Connection.Where("id = ?", id).Delete(&user).Error; err != nil {
@@ -99,12 +229,24 @@ func DeleteMasterUser(id uint) (string, error) {
 	return "The user has been successfully deleted", nil
 }
 
+// Loads a master user as it is before or after an audited change, nil when it can't be found.
+func findAuditedMasterUser(id uint) *MasterUser {
+
+	var user MasterUser
+
+	if err := database.Connection.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil
+	}
+
+	return &user
+}
+
 // Get a specific user from the database.
 func GetMasterUser(id uint) (*MasterUser, error) {
 
 	var user MasterUser
 
-	if err := database.Connection.Select("id, created_at, updated_at, email, account_type, first_name, last_name, phone_number").Where("id = ? ", id).First(&user).Error; err != nil {
+	if err := database.Connection.Select("id, created_at, updated_at, email, account_type, first_name, last_name, phone_number, recovery_email, two_factor_enabled, password_changed_at").Where("id = ? ", id).First(&user).Error; err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,96 @@
+package v1services
+
+import (
+	"fmt"
+
+	database "go-multitenancy-boilerplate/database"
+	migrations "go-multitenancy-boilerplate/database/migrations"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+)
+
+// Returns the version the master database is on and the state of every master migration.
+func GetMasterMigrationStatus() (int64, []migrations.MigrationStatus, error) {
+
+	current, err := database.MasterMigrations.CurrentVersion(database.Connection)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	statuses, err := database.MasterMigrations.Status(database.Connection)
+
+	return current, statuses, err
+}
+
+// Returns the version a tenant schema is on and the state of every tenant migration.
+func GetTenantMigrationStatus(id uint) (int64, []migrations.MigrationStatus, error) {
+
+	tenant, err := GetTenant(id)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	conn, release, err := database.TenantConnections.Acquire(*tenant)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer release()
+
+	current, err := database.TenantMigrations.CurrentVersion(conn)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	statuses, err := database.TenantMigrations.Status(conn)
+
+	return current, statuses, err
+}
+
+// Starts migrating the tenant fleet in the background, returns the run id to follow the results with.
+func StartFleetMigration(options database.FleetMigrationOptions) (string, error) {
+
+	return database.StartTenantFleetMigration(options, func(report database.FleetMigrationReport, err error) {
+
+		if err != nil {
+			fmt.Println("An error occurred while migrating the tenant fleet", err)
+			return
+		}
+
+		fmt.Printf("Tenant migration run %s finished, %d succeeded and %d failed\n", report.RunId, report.Succeeded, report.Failed)
+	})
+}
+
+// Lists the recorded tenant migration results a page at a time, newest first.
+func ListTenantMigrationResults(runId string, tenantId uint, status string, page int, pageSize int) ([]tenants.TenantMigrationResult, int, error) {
+
+	var found []tenants.TenantMigrationResult
+	var total int
+
+	query := database.Connection.Model(&tenants.TenantMigrationResult{})
+
+	if len(runId) > 0 {
+		query = query.Where("run_id = ?", runId)
+	}
+
+	if tenantId > 0 {
+		query = query.Where("tenant_id = ?", tenantId)
+	}
+
+	if len(status) > 0 {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&found).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return found, total, nil
+}
@@ -0,0 +1,622 @@
+package v1services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
+	models "go-multitenancy-boilerplate/models"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+	oidc "go-multitenancy-boilerplate/oidc"
+	secrets "go-multitenancy-boilerplate/secrets"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Audited single sign-on actions.
+const (
+	AuditOidcConfigUpdate = "tenant.oidc_update"
+	AuditOidcConfigDelete = "tenant.oidc_delete"
+	AuditOidcLogin        = "auth.oidc_login"
+)
+
+// How long the user has to log in at the provider and come back.
+const OidcLoginTTL = 10 * time.Minute
+
+var (
+	ErrInvalidOidcConfig     = errors.New("the single sign-on configuration is invalid")
+	ErrOidcNotEnabled        = errors.New("single sign-on is not enabled for this tenant")
+	ErrOidcLoginInvalid      = errors.New("the single sign-on login is unknown or has expired")
+	ErrOidcUserNotFound      = errors.New("no user exists for this identity and provisioning is disabled")
+	ErrOidcAccountConflict   = errors.New("the user is already linked to another identity")
+	ErrPasswordLoginDisabled = errors.New("password login is disabled for this tenant")
+)
+
+// Changes to the single sign-on configuration of a tenant, fields left nil keep their current value.
+type OidcConfigUpdate struct {
+	Enabled              *bool
+	Issuer               *string
+	ClientId             *string
+	ClientSecret         *string
+	Scopes               *string
+	EmailClaim           *string
+	FirstNameClaim       *string
+	LastNameClaim        *string
+	PhoneNumberClaim     *string
+	RolesClaim           *string
+	RoleMapping          map[string]string // Replaces the mapping when not nil.
+	AutoProvision        *bool
+	DisablePasswordLogin *bool
+}
+
+// Gets the single sign-on configuration of a tenant, not found when it never set one up.
+func GetTenantOidcConfig(tenantId uint) (*tenants.TenantOidcConfig, error) {
+
+	var config tenants.TenantOidcConfig
+
+	if err := database.Connection.Where("tenant_id = ?", tenantId).First(&config).Error; err != nil {
+		return nil, err
+	}
+
+	secret, err := secrets.Decrypt(config.ClientSecret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config.ClientSecret = secret
+
+	return &config, nil
+}
+
+// Whether a tenant's users have to log in through its identity provider.
+func PasswordLoginDisabled(tenantId uint) (bool, error) {
+
+	config, err := GetTenantOidcConfig(tenantId)
+
+	if gorm.IsRecordNotFoundError(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return config.PasswordLoginDisabled(), nil
+}
+
+// Changes the single sign-on configuration of a tenant, recorded in the master audit log.
+// Role names in the mapping must exist in the tenant, connection is the tenant's.
+func UpdateTenantOidcConfig(actor Actor, tenantId uint, update OidcConfigUpdate, connection *gorm.DB) (*tenants.TenantOidcConfig, error) {
+
+	before, err := GetTenantOidcConfig(tenantId)
+
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	after := tenants.TenantOidcConfig{TenantId: tenantId}
+
+	if before != nil {
+		after = *before
+	}
+
+	err = update.apply(&after)
+
+	if err == nil {
+		err = validateOidcConfig(after, connection)
+	}
+
+	if err == nil {
+		err = saveOidcConfig(&after)
+	}
+
+	recordMasterEvent(actor, tenantId, AuditOidcConfigUpdate, "tenant", tenantId, before, &after, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
+
+// Saves a configuration with its client secret encrypted, the configuration keeps the plain secret.
+func saveOidcConfig(config *tenants.TenantOidcConfig) error {
+
+	stored := *config
+
+	secret, err := secrets.Encrypt(config.ClientSecret)
+
+	if err != nil {
+		return err
+	}
+
+	stored.ClientSecret = secret
+
+	// Save inserts the row for tenants setting it up.
+	if err := database.Connection.Save(&stored).Error; err != nil {
+		return err
+	}
+
+	config.UpdatedAt = stored.UpdatedAt
+
+	return nil
+}
+
+func (u OidcConfigUpdate) apply(config *tenants.TenantOidcConfig) error {
+
+	setBool := func(target *bool, value *bool) {
+		if value != nil {
+			*target = *value
+		}
+	}
+
+	setString := func(target *string, value *string) {
+		if value != nil {
+			*target = strings.TrimSpace(*value)
+		}
+	}
+
+	setBool(&config.Enabled, u.Enabled)
+	setString(&config.Issuer, u.Issuer)
+	setString(&config.ClientId, u.ClientId)
+	setString(&config.ClientSecret, u.ClientSecret)
+	setString(&config.Scopes, u.Scopes)
+	setString(&config.EmailClaim, u.EmailClaim)
+	setString(&config.FirstNameClaim, u.FirstNameClaim)
+	setString(&config.LastNameClaim, u.LastNameClaim)
+	setString(&config.PhoneNumberClaim, u.PhoneNumberClaim)
+	setString(&config.RolesClaim, u.RolesClaim)
+	setBool(&config.AutoProvision, u.AutoProvision)
+	setBool(&config.DisablePasswordLogin, u.DisablePasswordLogin)
+
+	if u.RoleMapping != nil {
+
+		encoded, err := json.Marshal(u.RoleMapping)
+
+		if err != nil {
+			return err
+		}
+
+		config.RoleMapping = string(encoded)
+	}
+
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+
+	return nil
+}
+
+// Checks a configuration before it is saved, an enabled one must reach its provider.
+func validateOidcConfig(config tenants.TenantOidcConfig, connection *gorm.DB) error {
+
+	if len(config.Issuer) > 0 {
+
+		issuer, err := url.Parse(config.Issuer)
+
+		if err != nil || !issuer.IsAbs() || len(issuer.Host) == 0 {
+			return errors.Wrap(ErrInvalidOidcConfig, "the issuer must be a URL")
+		}
+
+		// Plain http is only good enough for a provider running on this machine.
+		if issuer.Scheme != "https" && !(issuer.Scheme == "http" && isLoopback(issuer.Hostname())) {
+			return errors.Wrap(ErrInvalidOidcConfig, "the issuer must use https")
+		}
+	}
+
+	mapping, err := config.RoleMap()
+
+	if err != nil {
+		return errors.Wrap(ErrInvalidOidcConfig, "the role mapping must map claim values to role names")
+	}
+
+	for _, name := range mapping {
+
+		if err := connection.Select("id").Where("name = ?", name).First(&models.Role{}).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return errors.Wrap(ErrInvalidOidcConfig, "unknown role "+name)
+			}
+			return err
+		}
+	}
+
+	if config.DisablePasswordLogin && !config.Enabled {
+		return errors.Wrap(ErrInvalidOidcConfig, "password login can only be disabled once single sign-on is enabled")
+	}
+
+	if !config.Enabled {
+		return nil
+	}
+
+	if len(config.Issuer) == 0 || len(config.ClientId) == 0 || len(config.ClientSecret) == 0 {
+		return errors.Wrap(ErrInvalidOidcConfig, "the issuer, client id and client secret are required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Whatever the issuer answered is only logged, it could be a service the issuer URL was pointed at.
+	if _, err := oidc.Discover(ctx, config.Issuer); err != nil {
+		fmt.Println("An error occurred while loading the configuration of identity provider", config.Issuer, err)
+		return errors.Wrap(ErrInvalidOidcConfig, "the issuer's configuration could not be loaded")
+	}
+
+	return nil
+}
+
+func isLoopback(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// Removes the single sign-on configuration of a tenant, its users log in with passwords again.
+func DeleteTenantOidcConfig(actor Actor, tenantId uint) error {
+
+	before, err := GetTenantOidcConfig(tenantId)
+
+	if err == nil {
+		err = database.Connection.Where("tenant_id = ?", tenantId).Delete(&tenants.TenantOidcConfig{}).Error
+	}
+
+	recordMasterEvent(actor, tenantId, AuditOidcConfigDelete, "tenant", tenantId, before, nil, err)
+
+	return err
+}
+
+// The client registered for a tenant, the redirect URL is where the provider sends the user back to.
+func oidcClient(config *tenants.TenantOidcConfig, redirectURL string) oidc.Config {
+	return oidc.Config{
+		Issuer:       config.Issuer,
+		ClientId:     config.ClientId,
+		ClientSecret: config.ClientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       config.ScopeList(),
+	}
+}
+
+// Starts a login with the tenant's identity provider, returns the URL to send the user to and the login's state.
+// The state has to be kept by the browser the login was started from, see HandleOidcCallback.
+func StartOidcLogin(ctx context.Context, tenantId uint, redirectURL string) (string, string, error) {
+
+	config, err := GetTenantOidcConfig(tenantId)
+
+	if gorm.IsRecordNotFoundError(err) || (err == nil && !config.Enabled) {
+		return "", "", ErrOidcNotEnabled
+	}
+
+	if err != nil {
+		return "", "", err
+	}
+
+	provider, err := oidc.Discover(ctx, config.Issuer)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := helpers.GenerateToken(32)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := helpers.GenerateToken(32)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, err := oidc.GenerateVerifier()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now().UTC()
+
+	// Logins which were never finished are cleared out as new ones start.
+	if err := database.Connection.Where("expires_at < ?", now).Delete(&tenants.TenantOidcLogin{}).Error; err != nil {
+		fmt.Println("An error occurred while removing expired single sign-on logins", err)
+	}
+
+	login := tenants.TenantOidcLogin{
+		StateHash:   helpers.HashToken(state),
+		TenantId:    tenantId,
+		Verifier:    verifier,
+		Nonce:       nonce,
+		RedirectURL: redirectURL,
+		ExpiresAt:   now.Add(OidcLoginTTL),
+	}
+
+	if err := database.Connection.Create(&login).Error; err != nil {
+		return "", "", err
+	}
+
+	return provider.AuthCodeURL(oidcClient(config, redirectURL), state, nonce, oidc.Challenge(verifier)), state, nil
+}
+
+// Finishes a login the provider sent the user back from, creating or updating the tenant user from the id token.
+// Returns the id of the user who logged in and whether the provider checked a second factor.
+func FinishOidcLogin(ctx context.Context, actor Actor, state string, code string, connection *gorm.DB) (uint, bool, error) {
+
+	userId, email, multiFactor, err := finishOidcLogin(ctx, actor.TenantId, state, code, connection)
+
+	if actor.Id == 0 {
+		actor.Id = userId
+		actor.Email = email
+	}
+
+	recordTenantEvent(connection, actor, AuditOidcLogin, "user", userId, nil, nil, err)
+
+	return userId, multiFactor, err
+}
+
+func finishOidcLogin(ctx context.Context, tenantId uint, state string, code string, connection *gorm.DB) (uint, string, bool, error) {
+
+	login, err := consumeOidcLogin(tenantId, state)
+
+	if err != nil {
+		return 0, "", false, err
+	}
+
+	config, err := GetTenantOidcConfig(tenantId)
+
+	if gorm.IsRecordNotFoundError(err) || (err == nil && !config.Enabled) {
+		return 0, "", false, ErrOidcNotEnabled
+	}
+
+	if err != nil {
+		return 0, "", false, err
+	}
+
+	provider, err := oidc.Discover(ctx, config.Issuer)
+
+	if err != nil {
+		return 0, "", false, err
+	}
+
+	client := oidcClient(config, login.RedirectURL)
+
+	token, err := provider.Exchange(ctx, client, code, login.Verifier)
+
+	if err != nil {
+		return 0, "", false, err
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, client, token.IDToken, login.Nonce)
+
+	if err != nil {
+		return 0, "", false, err
+	}
+
+	email := strings.TrimSpace(claims.String(config.EmailClaimName()))
+
+	userId, err := provisionOidcUser(config, claims, email, connection)
+
+	return userId, email, claims.MultiFactor(), err
+}
+
+// Takes the login a state belongs to, a state can only be used once.
+func consumeOidcLogin(tenantId uint, state string) (*tenants.TenantOidcLogin, error) {
+
+	var login tenants.TenantOidcLogin
+
+	err := database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("state_hash = ?", helpers.HashToken(state)).First(&login).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrOidcLoginInvalid
+			}
+			return err
+		}
+
+		if err := tx.Delete(&login).Error; err != nil {
+			return err
+		}
+
+		// A state started for another tenant is as good as unknown.
+		if login.TenantId != tenantId || time.Now().UTC().After(login.ExpiresAt) {
+			return ErrOidcLoginInvalid
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &login, nil
+}
+
+// Finds the user an identity belongs to, linking users by their verified email address on their first login
+// and creating them when the tenant provisions users. Their profile and mapped roles follow the claims.
+func provisionOidcUser(config *tenants.TenantOidcConfig, claims oidc.Claims, email string, connection *gorm.DB) (uint, error) {
+
+	var user models.User
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		err := tx.Where("oidc_subject = ?", claims.Subject()).First(&user).Error
+
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		created := false
+
+		if gorm.IsRecordNotFoundError(err) {
+
+			// An address the provider hasn't verified could belong to anybody, it never takes over an account.
+			if len(email) == 0 || !claims.Bool("email_verified") {
+				return errors.Wrap(ErrOidcUserNotFound, "the identity has no verified email address")
+			}
+
+			err = tx.Where("email = ?", email).First(&user).Error
+
+			switch {
+			case err == nil && len(user.OidcSubject) > 0:
+				return ErrOidcAccountConflict
+			case err == nil:
+				if err := tx.Model(&user).UpdateColumn("oidc_subject", claims.Subject()).Error; err != nil {
+					return err
+				}
+			case !gorm.IsRecordNotFoundError(err):
+				return err
+			case !config.AutoProvision:
+				return ErrOidcUserNotFound
+			default:
+				if err := createOidcUser(&user, claims, email, tx); err != nil {
+					return err
+				}
+				created = true
+			}
+		}
+
+		if !created {
+			if err := updateOidcProfile(&user, config, claims, tx); err != nil {
+				return err
+			}
+		}
+
+		return syncOidcRoles(user.ID, config, claims, tx)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return user.ID, nil
+}
+
+// Creates a user who only logs in through the provider, they have no password until they reset it.
+func createOidcUser(user *models.User, claims oidc.Claims, email string, tx *gorm.DB) error {
+
+	if !helpers.ValidateEmail(email) || len(email) > 50 {
+		return errors.Wrap(ErrOidcUserNotFound, "the email address can't be used: "+email)
+	}
+
+	now := time.Now().UTC()
+
+	*user = models.User{
+		Email:           email,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+		OidcSubject:     claims.Subject(),
+	}
+
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+
+	return assignInitialRole(user.ID, tx)
+}
+
+// Copies the mapped claims into the user's fields, claims the provider didn't send leave the field alone.
+func updateOidcProfile(user *models.User, config *tenants.TenantOidcConfig, claims oidc.Claims, tx *gorm.DB) error {
+
+	changes := make(map[string]interface{})
+
+	fields := []struct {
+		column  string
+		claim   string
+		current string
+		limit   int
+	}{
+		{"first_name", config.FirstNameClaimName(), user.FirstName, 50},
+		{"last_name", config.LastNameClaimName(), user.LastName, 50},
+		{"phone_number", config.PhoneNumberClaimName(), user.PhoneNumber, 0},
+	}
+
+	for _, field := range fields {
+
+		value := strings.TrimSpace(claims.String(field.claim))
+
+		if field.limit > 0 && len(value) > field.limit {
+			value = value[:field.limit]
+		}
+
+		if len(value) > 0 && value != field.current {
+			changes[field.column] = value
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return tx.Model(user).UpdateColumns(changes).Error
+}
+
+// Gives the user the roles the claim maps to and takes away the other mapped roles.
+// The last owner keeps the owner role, otherwise nobody could manage the tenant.
+func syncOidcRoles(userId uint, config *tenants.TenantOidcConfig, claims oidc.Claims, tx *gorm.DB) error {
+
+	if len(config.RolesClaim) == 0 {
+		return nil
+	}
+
+	mapping, err := config.RoleMap()
+
+	if err != nil || len(mapping) == 0 {
+		return err
+	}
+
+	wanted := make(map[string]bool)
+
+	for _, value := range claims.Strings(config.RolesClaim) {
+		if name, found := mapping[value]; found {
+			wanted[name] = true
+		}
+	}
+
+	managed := make([]string, 0, len(mapping))
+
+	for _, name := range mapping {
+		managed = append(managed, name)
+	}
+
+	var roles []models.Role
+
+	if err := tx.Where("name IN (?)", managed).Find(&roles).Error; err != nil {
+		return err
+	}
+
+	changed := false
+
+	for _, role := range roles {
+
+		var held int
+		if err := tx.Model(&models.UserRole{}).Where("user_id = ? AND role_id = ?", userId, role.ID).Count(&held).Error; err != nil {
+			return err
+		}
+
+		switch {
+		case wanted[role.Name] && held == 0:
+			if err := tx.Create(&models.UserRole{UserId: userId, RoleId: role.ID}).Error; err != nil {
+				return err
+			}
+			changed = true
+		case !wanted[role.Name] && held > 0:
+			if err := ensureNotLastOwner(userId, role.ID, tx); err == ErrLastOwner {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ? AND role_id = ?", userId, role.ID).Delete(&models.UserRole{}).Error; err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return markUserPrivilegesChanged(tx.Where("id = ?", userId))
+}
@@ -0,0 +1,56 @@
+package v1services
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	databasetest "go-multitenancy-boilerplate/database/databasetest"
+	secrets "go-multitenancy-boilerplate/secrets"
+)
+
+func TestOidcClientSecretStoredEncrypted(t *testing.T) {
+
+	recorder, restore := useTestDatabase()
+	defer restore()
+
+	secret := "client-secret"
+
+	config, err := UpdateTenantOidcConfig(Actor{Id: 1}, 3, OidcConfigUpdate{ClientSecret: &secret}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ClientSecret != secret {
+		t.Fatalf("expected the returned configuration to keep the plain secret, got %q", config.ClientSecret)
+	}
+
+	var stored string
+
+	for _, statement := range recorder.Matching("tenant_oidc_configs") {
+		for _, arg := range statement.Args {
+			if value, ok := arg.(string); ok && strings.Contains(value, secret) {
+				t.Fatalf("expected the secret not to be stored in plain text, got %v", statement)
+			} else if ok && secrets.IsEncrypted(value) {
+				stored = value
+			}
+		}
+	}
+
+	if len(stored) == 0 {
+		t.Fatalf("expected the secret to be stored encrypted, got %v", recorder.Statements())
+	}
+
+	recorder.Reset()
+	recorder.On(`FROM "tenant_oidc_configs"`, databasetest.Response{
+		Columns: []string{"tenant_id", "client_secret"},
+		Rows:    [][]driver.Value{{int64(3), stored}},
+	})
+
+	loaded, err := GetTenantOidcConfig(3)
+
+	if err != nil || loaded.ClientSecret != secret {
+		t.Fatalf("expected the stored secret to be decrypted, got %+v, %v", loaded, err)
+	}
+}
@@ -0,0 +1,272 @@
+package v1services
+
+import (
+	"fmt"
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	models "go-multitenancy-boilerplate/models"
+	passwords "go-multitenancy-boilerplate/passwords"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Previous password hashes kept per user, the most a policy can ask for.
+const maxPasswordHistory = 24
+
+// Returned on login when the password is right but has expired.
+// The reset token sets a new password through the password reset endpoint.
+type PasswordExpiredError struct {
+	UserId     uint
+	ResetToken string
+}
+
+func (e *PasswordExpiredError) Error() string {
+	return "the password has expired and has to be changed"
+}
+
+// The password policy of a tenant, the platform policy with the tenant's overrides applied.
+func GetTenantPasswordPolicy(tenantId uint) (passwords.Policy, error) {
+
+	settings, err := GetTenantSettings(tenantId)
+
+	if err != nil {
+		return passwords.DefaultPolicy(), err
+	}
+
+	return settings.PasswordPolicy(passwords.DefaultPolicy()), nil
+}
+
+// The password policy of master users, always the platform policy.
+func MasterPasswordPolicy() passwords.Policy {
+	return passwords.DefaultPolicy()
+}
+
+// Tenant users
+//
+
+// Checks a new password of a tenant user against the policy and, for existing users, their previous passwords.
+func checkUserPassword(userId uint, password string, policy passwords.Policy, tx *gorm.DB) error {
+
+	violations := policy.Check(password)
+
+	if userId > 0 && policy.History > 0 {
+
+		var user models.User
+
+		if err := tx.Select("id, password").Where("id = ?", userId).First(&user).Error; err != nil {
+			return err
+		}
+
+		var previous []string
+
+		if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", userId).Order("id desc").Limit(policy.History).Pluck("hash", &previous).Error; err != nil {
+			return err
+		}
+
+		if passwordReused(password, append([]string{user.Password}, previous...)) {
+			violations = append(violations, passwords.HistoryViolation(policy.History))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &passwords.PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// Changes the password of a tenant user once it passes the policy.
+func setUserPassword(userId uint, password string, policy passwords.Policy, tx *gorm.DB) error {
+
+	if err := checkUserPassword(userId, password, policy, tx); err != nil {
+		return err
+	}
+
+	hash, err := passwords.Hash(password)
+
+	if err != nil {
+		return err
+	}
+
+	// Sessions from before the change stop working, whoever knew the old password is logged out.
+	err = tx.Model(&models.User{}).Where("id = ?", userId).UpdateColumns(map[string]interface{}{
+		"password":            hash,
+		"password_changed_at": time.Now().UTC(),
+		"sessions_valid_from": sessionsValidFromNow(),
+	}).Error
+
+	if err != nil {
+		return err
+	}
+
+	if err := revokeUserSessions(tx, userId, false); err != nil {
+		return err
+	}
+
+	return recordPasswordHistory(userId, hash, tx)
+}
+
+func recordPasswordHistory(userId uint, hash string, tx *gorm.DB) error {
+
+	if err := tx.Create(&models.PasswordHistory{UserId: userId, Hash: hash}).Error; err != nil {
+		return err
+	}
+
+	// Only the most recent hashes are kept.
+	kept := tx.Model(&models.PasswordHistory{}).Select("id").Where("user_id = ?", userId).Order("id desc").Limit(maxPasswordHistory).SubQuery()
+
+	return tx.Where("user_id = ? AND id NOT IN (?)", userId, kept).Delete(&models.PasswordHistory{}).Error
+}
+
+// Replaces a hash made with an older algorithm or weaker parameters once the password was verified at login.
+// A failure only means the old hash stays, the login goes ahead either way.
+func rehashUserPassword(userId uint, password string, current string, connection *gorm.DB) {
+
+	if !passwords.NeedsRehash(current) {
+		return
+	}
+
+	hash, err := passwords.Hash(password)
+
+	// The stored hash is compared so a password changed in the meantime isn't overwritten.
+	if err == nil {
+		err = connection.Model(&models.User{}).Where("id = ? AND password = ?", userId, current).UpdateColumn("password", hash).Error
+	}
+
+	if err != nil {
+		fmt.Println("An error occurred while rehashing the password of user", userId, err)
+	}
+}
+
+// Master users
+//
+
+// Checks a new password of a master user against the policy and, for existing users, their previous passwords.
+func checkMasterUserPassword(userId uint, password string, tx *gorm.DB) error {
+
+	policy := MasterPasswordPolicy()
+	violations := policy.Check(password)
+
+	if userId > 0 && policy.History > 0 {
+
+		var user MasterUser
+
+		if err := tx.Select("id, password").Where("id = ?", userId).First(&user).Error; err != nil {
+			return err
+		}
+
+		var previous []string
+
+		if err := tx.Model(&models.MasterPasswordHistory{}).Where("master_user_id = ?", userId).Order("id desc").Limit(policy.History).Pluck("hash", &previous).Error; err != nil {
+			return err
+		}
+
+		if passwordReused(password, append([]string{user.Password}, previous...)) {
+			violations = append(violations, passwords.HistoryViolation(policy.History))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &passwords.PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// Changes the password of a master user once it passes the policy.
+func setMasterUserPassword(userId uint, password string, tx *gorm.DB) error {
+
+	if err := checkMasterUserPassword(userId, password, tx); err != nil {
+		return err
+	}
+
+	hash, err := passwords.Hash(password)
+
+	if err != nil {
+		return err
+	}
+
+	// Sessions from before the change stop working, whoever knew the old password is logged out.
+	err = tx.Model(&MasterUser{}).Where("id = ?", userId).UpdateColumns(map[string]interface{}{
+		"password":            hash,
+		"password_changed_at": time.Now().UTC(),
+		"sessions_valid_from": sessionsValidFromNow(),
+	}).Error
+
+	if err != nil {
+		return err
+	}
+
+	if err := revokeMasterUserSessions(tx, userId, false); err != nil {
+		return err
+	}
+
+	return recordMasterPasswordHistory(userId, hash, tx)
+}
+
+func recordMasterPasswordHistory(userId uint, hash string, tx *gorm.DB) error {
+
+	if err := tx.Create(&models.MasterPasswordHistory{MasterUserId: userId, Hash: hash}).Error; err != nil {
+		return err
+	}
+
+	// Only the most recent hashes are kept.
+	kept := tx.Model(&models.MasterPasswordHistory{}).Select("id").Where("master_user_id = ?", userId).Order("id desc").Limit(maxPasswordHistory).SubQuery()
+
+	return tx.Where("master_user_id = ? AND id NOT IN (?)", userId, kept).Delete(&models.MasterPasswordHistory{}).Error
+}
+
+// Replaces a hash made with an older algorithm or weaker parameters once the password was verified at login.
+func rehashMasterUserPassword(userId uint, password string, current string) {
+
+	if !passwords.NeedsRehash(current) {
+		return
+	}
+
+	hash, err := passwords.Hash(password)
+
+	if err == nil {
+		err = database.Connection.Model(&MasterUser{}).Where("id = ? AND password = ?", userId, current).UpdateColumn("password", hash).Error
+	}
+
+	if err != nil {
+		fmt.Println("An error occurred while rehashing the password of master user", userId, err)
+	}
+}
+
+// Whether the password matches any of the hashes.
+func passwordReused(password string, hashes []string) bool {
+
+	for _, hash := range hashes {
+		if len(hash) > 0 && passwords.Verify(password, hash) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Issues a reset token for a tenant user whose password expired, so they can choose a new one straight away.
+func expiredUserPassword(userId uint, connection *gorm.DB) error {
+
+	token, err := issueUserToken(userId, models.TokenPasswordReset, passwordResetTTL(), connection)
+
+	if err != nil {
+		return err
+	}
+
+	return &PasswordExpiredError{UserId: userId, ResetToken: token}
+}
+
+// Issues a reset token for a master user whose password expired, so they can choose a new one straight away.
+func expiredMasterUserPassword(userId uint) error {
+
+	token, err := issueMasterUserToken(userId, models.TokenPasswordReset, passwordResetTTL())
+
+	if err != nil {
+		return err
+	}
+
+	return &PasswordExpiredError{UserId: userId, ResetToken: token}
+}
@@ -0,0 +1,143 @@
+package v1services
+
+import (
+	"database/sql/driver"
+	"os"
+	"testing"
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	databasetest "go-multitenancy-boilerplate/database/databasetest"
+	passwords "go-multitenancy-boilerplate/passwords"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+
+	// The configured hasher is read once, logins should rehash anything weaker than bcrypt at cost 11.
+	os.Setenv("PASSWORD_HASHER", passwords.AlgorithmBcrypt)
+	os.Setenv("PASSWORD_BCRYPT_COST", "11")
+	// Secrets stored by the services are encrypted with this key.
+	os.Setenv("ENCRYPTION_KEYS", "test:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=")
+
+	os.Exit(m.Run())
+}
+
+func testHash(t *testing.T, hasher passwords.Hasher, password string) string {
+
+	hash, err := hasher.Hash(password)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+// Answers lookups of the table with a single account holding the password hash.
+func respondWithAccount(recorder *databasetest.Recorder, table string, id uint, email string, hash string) {
+	recorder.On(`FROM "`+table+`"`, databasetest.Response{
+		Columns: []string{"id", "email", "password", "email_verified", "password_changed_at"},
+		Rows:    [][]driver.Value{{int64(id), email, hash, true, time.Now().UTC()}},
+	})
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+
+	const password = "Correct-Horse7"
+
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		rehash   bool
+	}{
+		{"bcrypt with the configured cost", testHash(t, passwords.BcryptHasher{Cost: 11}, password), password, false},
+		{"bcrypt with a higher cost", testHash(t, passwords.BcryptHasher{Cost: 12}, password), password, false},
+		{"bcrypt with a lower cost", testHash(t, passwords.BcryptHasher{Cost: 10}, password), password, true},
+		{"argon2id", testHash(t, passwords.Argon2idHasher{}, password), password, true},
+		{"wrong password", testHash(t, passwords.BcryptHasher{Cost: 10}, password), "Wrong-Horse7", false},
+	}
+
+	logins := []struct {
+		name  string
+		table string
+		login func(password string) (bool, error)
+	}{
+		{"tenant user", "users", func(password string) (bool, error) {
+			_, ok, err := loginUser(2, "someone@example.com", password, database.Connection)
+			return ok, err
+		}},
+		{"master user", "master_users", func(password string) (bool, error) {
+			_, ok, err := loginMasterUser("someone@example.com", password)
+			return ok, err
+		}},
+	}
+
+	for _, login := range logins {
+		for _, test := range tests {
+			t.Run(login.name+" "+test.name, func(t *testing.T) {
+
+				recorder, restore := useTestDatabase()
+				defer restore()
+
+				respondWithAccount(recorder, login.table, 4, "someone@example.com", test.stored)
+
+				ok, err := login.login(test.password)
+
+				if test.password == password && (!ok || err != nil) {
+					t.Fatalf("expected the login to succeed, got %v %v", ok, err)
+				}
+
+				if test.password != password && err != ErrInvalidCredentials {
+					t.Fatalf("expected the login to fail, got %v %v", ok, err)
+				}
+
+				updates := recorder.Matching(`UPDATE "` + login.table + `" SET "password"`)
+
+				if !test.rehash {
+					if len(updates) != 0 {
+						t.Fatalf("expected the hash to be kept, got %v", updates)
+					}
+					return
+				}
+
+				if len(updates) != 1 {
+					t.Fatalf("expected the hash to be replaced, got %v", recorder.Statements())
+				}
+
+				// The new hash is only stored if nobody changed the password in the meantime.
+				args := updates[0].Args
+				rehashed, _ := args[0].(string)
+
+				if args[1] != int64(4) || args[2] != test.stored {
+					t.Fatalf("expected the update to be limited to the verified hash, got %v", args)
+				}
+
+				if cost, err := bcrypt.Cost([]byte(rehashed)); err != nil || cost != 11 || !passwords.Verify(password, rehashed) {
+					t.Fatalf("expected a bcrypt hash at cost 11 of the same password, got %s", rehashed)
+				}
+			})
+		}
+	}
+}
+
+func TestLoginUnknownEmail(t *testing.T) {
+
+	recorder, restore := useTestDatabase()
+	defer restore()
+
+	// Nobody answers the lookups, so neither account exists.
+	if _, _, err := loginUser(2, "nobody@example.com", "Correct-Horse7", database.Connection); err != ErrInvalidCredentials {
+		t.Fatalf("expected an unknown tenant user to fail like a wrong password, got %v", err)
+	}
+
+	if _, _, err := loginMasterUser("nobody@example.com", "Correct-Horse7"); err != ErrInvalidCredentials {
+		t.Fatalf("expected an unknown master user to fail like a wrong password, got %v", err)
+	}
+
+	if len(recorder.Matching("UPDATE")) != 0 {
+		t.Fatalf("expected nothing to be written, got %v", recorder.Statements())
+	}
+}
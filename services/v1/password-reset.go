@@ -0,0 +1,170 @@
+package v1services
+
+import (
+	"fmt"
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
+	mailer "go-multitenancy-boilerplate/mailer"
+	models "go-multitenancy-boilerplate/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Audited password reset actions.
+const (
+	AuditPasswordResetRequest       = "auth.password_reset_requested"
+	AuditPasswordReset              = "auth.password_reset"
+	AuditMasterPasswordResetRequest = "master_auth.password_reset_requested"
+	AuditMasterPasswordReset        = "master_auth.password_reset"
+)
+
+// Emails a tenant user a password reset link, sent to their recovery email when they have one.
+// Unknown email addresses are silently ignored so the response doesn't reveal who has an account.
+func RequestPasswordReset(actor Actor, email string, connection *gorm.DB) error {
+
+	if disabled, err := PasswordLoginDisabled(actor.TenantId); err != nil || disabled {
+		if err == nil {
+			err = ErrPasswordLoginDisabled
+		}
+		return err
+	}
+
+	var user models.User
+
+	if err := connection.Where("email = ?", email).First(&user).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := issueUserToken(user.ID, models.TokenPasswordReset, passwordResetTTL(), connection)
+
+	if err == nil {
+		err = sendPasswordReset(recipient(user.Email, user.RecoveryEmail), tokenLink("TENANT_PASSWORD_RESET_URL", actor.TenantIdentifier, token), token)
+	}
+
+	actor.Email = email
+	recordTenantEvent(connection, actor, AuditPasswordResetRequest, "user", user.ID, nil, nil, err)
+
+	return err
+}
+
+// Sets a new password for the tenant user the reset token was issued to, the token can only be used once.
+func ResetPassword(actor Actor, token string, password string, connection *gorm.DB) error {
+
+	var userId uint
+
+	// Links sent before passwords were turned off stop working too.
+	if disabled, err := PasswordLoginDisabled(actor.TenantId); err != nil || disabled {
+		if err == nil {
+			err = ErrPasswordLoginDisabled
+		}
+		return err
+	}
+
+	policy, err := GetTenantPasswordPolicy(actor.TenantId)
+
+	if err != nil {
+		return err
+	}
+
+	err = connection.Transaction(func(tx *gorm.DB) error {
+
+		found, err := consumeUserToken(token, models.TokenPasswordReset, tx)
+
+		if err != nil {
+			return err
+		}
+
+		userId = found.UserId
+
+		// A password the policy refuses rolls back, so the token can be used again.
+		return setUserPassword(found.UserId, password, policy, tx)
+	})
+
+	actor.Id = userId
+	recordTenantEvent(connection, actor, AuditPasswordReset, "user", userId, nil, nil, err)
+
+	return err
+}
+
+// Emails a master user a password reset link, unknown email addresses are silently ignored.
+func RequestMasterPasswordReset(actor Actor, email string) error {
+
+	var user MasterUser
+
+	if err := database.Connection.Where("email = ?", email).First(&user).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := issueMasterUserToken(user.ID, models.TokenPasswordReset, passwordResetTTL())
+
+	if err == nil {
+		err = sendPasswordReset(recipient(user.Email, user.RecoveryEmail), tokenLink("MASTER_PASSWORD_RESET_URL", "", token), token)
+	}
+
+	actor.Email = email
+	recordMasterEvent(actor, 0, AuditMasterPasswordResetRequest, "master_user", user.ID, nil, nil, err)
+
+	return err
+}
+
+// Sets a new password for the master user the reset token was issued to, the token can only be used once.
+func ResetMasterPassword(actor Actor, token string, password string) error {
+
+	var userId uint
+
+	err := database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		found, err := consumeMasterUserToken(token, models.TokenPasswordReset, tx)
+
+		if err != nil {
+			return err
+		}
+
+		userId = found.MasterUserId
+
+		// A password the policy refuses rolls back, so the token can be used again.
+		return setMasterUserPassword(found.MasterUserId, password, tx)
+	})
+
+	actor.Id = userId
+	recordMasterEvent(actor, 0, AuditMasterPasswordReset, "master_user", userId, nil, nil, err)
+
+	return err
+}
+
+func sendPasswordReset(to string, link string, token string) error {
+
+	body := "Somebody asked to reset the password of your account. If that wasn't you, ignore this email.\n\n"
+
+	if len(link) > 0 {
+		body += "Reset your password: " + link + "\n"
+	} else {
+		body += "Your password reset code: " + token + "\n"
+	}
+
+	body += fmt.Sprintf("\nThe link expires in %s and can only be used once.\n", passwordResetTTL())
+
+	return mailer.Default().Send(mailer.Message{To: to, Subject: "Reset your password", Body: body})
+}
+
+// Recovery emails take precedence over the login email.
+func recipient(email string, recoveryEmail string) string {
+
+	if len(recoveryEmail) > 0 {
+		return recoveryEmail
+	}
+
+	return email
+}
+
+func passwordResetTTL() time.Duration {
+	return helpers.GetEnvDuration("PASSWORD_RESET_TTL", 1*time.Hour)
+}
@@ -0,0 +1,353 @@
+package v1services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Returned when asking to provision a tenant which is already provisioned.
+var ErrTenantAlreadyProvisioned = errors.New("the tenant has already been provisioned")
+
+// Returned when asking to provision a tenant which has been deleted, it has to be restored first.
+var ErrTenantDeleted = errors.New("the tenant has been deleted")
+
+// Returned when deleting a tenant a worker is still provisioning.
+var ErrTenantBeingProvisioned = errors.New("the tenant is being provisioned")
+
+// Wakes an idle worker up as soon as a job is queued instead of waiting for the next poll.
+var jobQueued = make(chan struct{}, 1)
+
+// Reserves the tenant record and queues a job to provision its storage in the background.
+func EnqueueTenantProvisioning(actor Actor, subDomainIdentifier string, strategy string) (*tenants.TenantProvisioningJob, string, error) {
+
+	tenant, job, outcome, err := enqueueTenantProvisioning(subDomainIdentifier, strategy)
+
+	recordMasterEvent(actor, tenant.ID, AuditTenantCreateQueue, "tenant", tenant.ID, nil, tenant, err)
+
+	return job, outcome, err
+}
+
+func enqueueTenantProvisioning(subDomainIdentifier string, strategy string) (*tenants.TenantConnectionInformation, *tenants.TenantProvisioningJob, string, error) {
+
+	if len(strategy) == 0 {
+		strategy = database.DefaultIsolationStrategy()
+	}
+
+	tenant, err := database.NewTenantConnectionInformation(subDomainIdentifier, strategy)
+
+	if err != nil {
+		return &tenant, nil, "error choosing the isolation strategy", err
+	}
+
+	if available, err := isSubDomainAvailable(subDomainIdentifier, 0); err != nil {
+		return &tenant, nil, "error checking the sub domain identifier", err
+	} else if !available {
+		return &tenant, nil, "error the sub domain identifier is already in use", ErrSubDomainInUse
+	}
+
+	tenant.ProvisioningStatus = tenants.ProvisioningPending
+
+	var job tenants.TenantProvisioningJob
+
+	err = database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Create(&tenant).Error; err != nil {
+			return err
+		}
+
+		job = tenants.TenantProvisioningJob{TenantId: tenant.ID, Status: tenants.JobQueued}
+
+		return tx.Create(&job).Error
+	})
+
+	if err != nil {
+		return &tenant, nil, "error queueing the new tenant", err
+	}
+
+	notifyProvisioningWorkers()
+
+	return &tenant, &job, "The tenant is being provisioned", nil
+}
+
+// Queues another provisioning attempt for a tenant which failed or never finished.
+// If the tenant already has a job waiting or running that job is returned instead.
+func EnqueueTenantReprovisioning(id uint) (*tenants.TenantProvisioningJob, string, error) {
+
+	tenant, err := GetTenant(id)
+
+	if err != nil {
+		return nil, "The tenant could not be found", err
+	}
+
+	// Deleted tenants are waiting to be purged, provisioning them again would bring their storage back.
+	if tenant.DeletedAt != nil {
+		return nil, "The tenant has been deleted, restore it first", ErrTenantDeleted
+	}
+
+	if tenant.IsReady() {
+		return nil, "The tenant has already been provisioned", ErrTenantAlreadyProvisioned
+	}
+
+	var job tenants.TenantProvisioningJob
+	queued := false
+
+	err = database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		// Deleting the tenant takes the same lock, a tenant deleted since it was looked up is not queued.
+		if err := lockTenant(tx, id, tenant); err != nil {
+			return err
+		}
+
+		if tenant.DeletedAt != nil {
+			return ErrTenantDeleted
+		}
+
+		if err := tx.Where("tenant_id = ? AND status IN (?)", tenant.ID, []string{tenants.JobQueued, tenants.JobRunning}).First(&job).Error; err == nil {
+			return nil
+		} else if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		if err := tx.Model(tenant).Updates(map[string]interface{}{
+			"provisioning_status": tenants.ProvisioningPending,
+			"provisioning_error":  "",
+		}).Error; err != nil {
+			return err
+		}
+
+		job = tenants.TenantProvisioningJob{TenantId: tenant.ID, Status: tenants.JobQueued}
+		queued = true
+
+		return tx.Create(&job).Error
+	})
+
+	if err == ErrTenantDeleted {
+		return nil, "The tenant has been deleted, restore it first", err
+	}
+
+	if err != nil {
+		return nil, "error queueing the tenant", err
+	}
+
+	if !queued {
+		return &job, "The tenant is already being provisioned", nil
+	}
+
+	notifyProvisioningWorkers()
+
+	return &job, "The tenant is being provisioned", nil
+}
+
+// Cancels the provisioning jobs of a tenant which haven't started yet, or whose worker went away.
+// Fails with ErrTenantBeingProvisioned while a worker is still running one.
+func cancelProvisioningJobs(tx *gorm.DB, tenantId uint) error {
+
+	now := time.Now().UTC()
+
+	// A worker claiming one of the jobs holds its row, the update waits for the claim and then leaves the job alone.
+	if err := tx.Model(&tenants.TenantProvisioningJob{}).
+		Where("tenant_id = ? AND (status = ? OR (status = ? AND locked_until < ?))", tenantId, tenants.JobQueued, tenants.JobRunning, now).
+		Updates(map[string]interface{}{
+			"status":       tenants.JobCancelled,
+			"locked_until": nil,
+			"finished_at":  &now,
+		}).Error; err != nil {
+		return err
+	}
+
+	var running int
+
+	if err := tx.Model(&tenants.TenantProvisioningJob{}).Where("tenant_id = ? AND status = ?", tenantId, tenants.JobRunning).Count(&running).Error; err != nil {
+		return err
+	}
+
+	if running > 0 {
+		return ErrTenantBeingProvisioned
+	}
+
+	return nil
+}
+
+// Get a specific provisioning job from the database.
+func GetProvisioningJob(id uint) (*tenants.TenantProvisioningJob, error) {
+
+	var job tenants.TenantProvisioningJob
+
+	if err := database.Connection.Where("id = ?", id).First(&job).Error; err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Starts the background workers running queued provisioning jobs. Close quit channel to stop,
+// the returned wait group is done once every worker has finished its current job.
+func StartProvisioningWorkers(count int, quit <-chan struct{}) *sync.WaitGroup {
+
+	var workers sync.WaitGroup
+
+	for i := 0; i < count; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			provisioningWorker(quit)
+		}()
+	}
+
+	return &workers
+}
+
+func provisioningWorker(quit <-chan struct{}) {
+
+	pollInterval := helpers.GetEnvDuration("PROVISIONING_POLL_INTERVAL", 10*time.Second)
+
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+
+		job, err := claimProvisioningJob()
+
+		if err != nil {
+			fmt.Println("An error occurred while claiming a provisioning job", err)
+		}
+
+		if job != nil {
+			runProvisioningJob(job)
+			continue
+		}
+
+		select {
+		case <-quit:
+			return
+		case <-jobQueued:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Locks the oldest queued job, or a running job whose worker went away, for this worker.
+func claimProvisioningJob() (*tenants.TenantProvisioningJob, error) {
+
+	var job tenants.TenantProvisioningJob
+
+	now := time.Now().UTC()
+
+	err := database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+			Where("status = ? OR (status = ? AND locked_until < ?)", tenants.JobQueued, tenants.JobRunning, now).
+			Order("id").
+			First(&job).Error; err != nil {
+			return err
+		}
+
+		lockedUntil := now.Add(provisioningJobLease())
+
+		job.Status = tenants.JobRunning
+		job.Attempts++
+		job.LockedUntil = &lockedUntil
+		job.StartedAt = &now
+
+		return tx.Save(&job).Error
+	})
+
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func runProvisioningJob(job *tenants.TenantProvisioningJob) {
+
+	maxAttempts := helpers.GetEnvInt("PROVISIONING_JOB_MAX_ATTEMPTS", 3)
+
+	// Jobs picked up again after a crash are only retried a few times.
+	if job.Attempts > maxAttempts {
+		err := fmt.Errorf("the job was abandoned after %d attempts", maxAttempts)
+
+		if tenant, lookupErr := GetTenant(job.TenantId); lookupErr == nil {
+			markTenantFailed(tenant, err)
+		}
+
+		finishProvisioningJob(job, err)
+		return
+	}
+
+	// Keep the job locked for as long as the steps are running.
+	done := make(chan struct{})
+	go extendProvisioningJobLock(job.ID, done)
+
+	_, err := ProvisionTenant(job.TenantId)
+
+	close(done)
+
+	finishProvisioningJob(job, err)
+}
+
+func extendProvisioningJobLock(id uint, done <-chan struct{}) {
+
+	lease := provisioningJobLease()
+
+	t := time.NewTicker(lease / 3)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := database.Connection.Model(&tenants.TenantProvisioningJob{}).Where("id = ?", id).Update("locked_until", time.Now().UTC().Add(lease)).Error; err != nil {
+				fmt.Println("An error occurred while extending the lock of provisioning job", id, err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func finishProvisioningJob(job *tenants.TenantProvisioningJob, cause error) {
+
+	now := time.Now().UTC()
+
+	values := map[string]interface{}{
+		"status":       tenants.JobSucceeded,
+		"error":        "",
+		"locked_until": nil,
+		"finished_at":  &now,
+	}
+
+	if cause != nil {
+		values["status"] = tenants.JobFailed
+		values["error"] = cause.Error()
+	}
+
+	if err := database.Connection.Model(job).Updates(values).Error; err != nil {
+		fmt.Println("An error occurred while finishing provisioning job", job.ID, err)
+	}
+}
+
+func notifyProvisioningWorkers() {
+	select {
+	case jobQueued <- struct{}{}:
+	default:
+	}
+}
+
+// How long a worker may hold a job before another worker assumes it died.
+func provisioningJobLease() time.Duration {
+	return helpers.GetEnvDuration("PROVISIONING_JOB_LEASE", 5*time.Minute)
+}
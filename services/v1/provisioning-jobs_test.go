@@ -0,0 +1,292 @@
+package v1services
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	databasetest "go-multitenancy-boilerplate/database/databasetest"
+	models "go-multitenancy-boilerplate/models"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/pkg/errors"
+)
+
+// Answers lookups of tenant records with the tenant.
+func respondWithTenant(recorder *databasetest.Recorder, tenant tenants.TenantConnectionInformation) {
+	recorder.On(`FROM "tenant_connection_informations"`, tenantRow(tenant))
+}
+
+func tenantRow(tenant tenants.TenantConnectionInformation) databasetest.Response {
+
+	var deletedAt driver.Value
+
+	if tenant.DeletedAt != nil {
+		deletedAt = *tenant.DeletedAt
+	}
+
+	return databasetest.Response{
+		Columns: []string{"id", "tenant_sub_domain_identifier", "isolation_strategy", "provisioning_status", "deleted_at"},
+		Rows:    [][]driver.Value{{int64(tenant.ID), tenant.TenantSubDomainIdentifier, tenant.IsolationStrategy, tenant.ProvisioningStatus, deletedAt}},
+	}
+}
+
+// Answers lookups of provisioning jobs with the job.
+func respondWithJob(recorder *databasetest.Recorder, job tenants.TenantProvisioningJob) {
+	recorder.On(`FROM "tenant_provisioning_jobs"`, databasetest.Response{
+		Columns: []string{"id", "tenant_id", "status", "attempts"},
+		Rows:    [][]driver.Value{{int64(job.ID), int64(job.TenantId), job.Status, int64(job.Attempts)}},
+	})
+}
+
+func TestClaimProvisioningJobWithNothingQueued(t *testing.T) {
+
+	recorder, restore := useTestDatabase()
+	defer restore()
+
+	job, err := claimProvisioningJob()
+
+	if job != nil || err != nil {
+		t.Fatalf("expected no job, got %v %v", job, err)
+	}
+
+	if len(recorder.Matching(`UPDATE "tenant_provisioning_jobs"`)) != 0 || len(recorder.Matching("ROLLBACK")) != 1 {
+		t.Fatalf("expected nothing to be claimed, got %v", recorder.Statements())
+	}
+}
+
+func TestClaimProvisioningJobLeasesJob(t *testing.T) {
+
+	recorder, restore := useTestDatabase()
+	defer restore()
+
+	queued := tenants.TenantProvisioningJob{TenantId: 5, Status: tenants.JobQueued, Attempts: 1}
+	queued.ID = 3
+
+	respondWithJob(recorder, queued)
+
+	before := time.Now().UTC()
+
+	job, err := claimProvisioningJob()
+
+	if err != nil || job == nil || job.ID != 3 {
+		t.Fatalf("expected a job, got %v %v", job, err)
+	}
+
+	// Workers skip jobs another worker has locked, and take over running jobs whose lease expired.
+	selects := recorder.Matching("FOR UPDATE SKIP LOCKED")
+
+	if len(selects) != 1 || !strings.Contains(selects[0].Query, "status = $1 OR (status = $2 AND locked_until < $3)") ||
+		selects[0].Args[0] != tenants.JobQueued || selects[0].Args[1] != tenants.JobRunning {
+		t.Fatalf("expected queued and expired jobs to be locked, got %v", selects)
+	}
+
+	if job.Status != tenants.JobRunning || job.Attempts != 2 || job.StartedAt == nil {
+		t.Fatalf("expected the job to be running its second attempt, got %+v", job)
+	}
+
+	if job.LockedUntil == nil || job.LockedUntil.Before(before.Add(provisioningJobLease())) || job.LockedUntil.After(time.Now().UTC().Add(provisioningJobLease())) {
+		t.Fatalf("expected the job to be leased for %s, got %v", provisioningJobLease(), job.LockedUntil)
+	}
+
+	if len(recorder.Matching(`UPDATE "tenant_provisioning_jobs"`)) != 1 || len(recorder.Matching("COMMIT")) != 1 {
+		t.Fatalf("expected the lease to be saved in the same transaction, got %v", recorder.Statements())
+	}
+}
+
+func TestRunProvisioningJobAbandonsAfterMaxAttempts(t *testing.T) {
+
+	recorder, restore := useTestDatabase()
+	defer restore()
+
+	tenant := tenants.TenantConnectionInformation{TenantSubDomainIdentifier: "acme", ProvisioningStatus: tenants.ProvisioningPending}
+	tenant.ID = 5
+
+	respondWithTenant(recorder, tenant)
+
+	job := &tenants.TenantProvisioningJob{TenantId: 5, Status: tenants.JobRunning, Attempts: 4}
+	job.ID = 3
+
+	runProvisioningJob(job)
+
+	if len(recorder.Matching("CREATE")) != 0 {
+		t.Fatalf("expected the tenant not to be provisioned again, got %v", recorder.Statements())
+	}
+
+	tenantUpdates := recorder.Matching(`UPDATE "tenant_connection_informations"`)
+
+	if len(tenantUpdates) != 1 || tenantUpdates[0].Args[1] != tenants.ProvisioningFailed {
+		t.Fatalf("expected the tenant to be marked as failed, got %v", recorder.Statements())
+	}
+
+	jobUpdates := recorder.Matching(`UPDATE "tenant_provisioning_jobs"`)
+
+	if len(jobUpdates) != 1 || jobUpdates[0].Args[0] != "the job was abandoned after 3 attempts" || jobUpdates[0].Args[3] != tenants.JobFailed {
+		t.Fatalf("expected the job to be finished as failed, got %v", jobUpdates)
+	}
+}
+
+func TestEnqueueTenantReprovisioning(t *testing.T) {
+
+	deletedAt := time.Now().UTC()
+
+	tests := []struct {
+		name     string
+		tenant   tenants.TenantConnectionInformation
+		job      *tenants.TenantProvisioningJob
+		err      error
+		enqueued bool
+	}{
+		{"failed tenant", tenants.TenantConnectionInformation{ProvisioningStatus: tenants.ProvisioningFailed}, nil, nil, true},
+		{"job already queued", tenants.TenantConnectionInformation{ProvisioningStatus: tenants.ProvisioningPending}, &tenants.TenantProvisioningJob{Status: tenants.JobQueued}, nil, false},
+		{"provisioned tenant", tenants.TenantConnectionInformation{ProvisioningStatus: tenants.ProvisioningReady}, nil, ErrTenantAlreadyProvisioned, false},
+		{"deleted tenant", tenants.TenantConnectionInformation{ProvisioningStatus: tenants.ProvisioningFailed, Model: models.Model{DeletedAt: &deletedAt}}, nil, ErrTenantDeleted, false},
+		{"deleted while being queued", tenants.TenantConnectionInformation{ProvisioningStatus: tenants.ProvisioningFailed}, nil, ErrTenantDeleted, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			recorder, restore := useTestDatabase()
+			defer restore()
+
+			test.tenant.ID = 5
+			respondWithTenant(recorder, test.tenant)
+
+			// The tenant is checked again once its row is locked.
+			if test.name == "deleted while being queued" {
+				locked := test.tenant
+				locked.DeletedAt = &deletedAt
+				recorder.On("LIMIT 1 FOR UPDATE", tenantRow(locked))
+			}
+
+			if test.job != nil {
+				test.job.ID = 3
+				test.job.TenantId = 5
+				respondWithJob(recorder, *test.job)
+			}
+
+			job, _, err := EnqueueTenantReprovisioning(5)
+
+			if err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+
+			inserts := recorder.Matching(`INSERT INTO "tenant_provisioning_jobs"`)
+
+			if test.enqueued != (len(inserts) == 1) {
+				t.Fatalf("expected a job to be queued: %v, got %v", test.enqueued, recorder.Statements())
+			}
+
+			if test.job != nil && (job == nil || job.ID != 3) {
+				t.Fatalf("expected the queued job to be returned, got %+v", job)
+			}
+		})
+	}
+}
+
+func TestDeleteTenantCancelsQueuedProvisioning(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		status  string
+		running int64
+		err     error
+		purged  bool
+	}{
+		{"ready tenant", tenants.ProvisioningReady, 0, nil, false},
+		{"tenant waiting to be provisioned", tenants.ProvisioningPending, 0, nil, true},
+		{"tenant being provisioned", tenants.ProvisioningPending, 1, ErrTenantBeingProvisioned, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			recorder, restore := useTestDatabase()
+			defer restore()
+
+			tenant := tenants.TenantConnectionInformation{TenantSubDomainIdentifier: "acme", ProvisioningStatus: test.status}
+			tenant.ID = 5
+
+			respondWithTenant(recorder, tenant)
+			recorder.On(`SELECT count(*) FROM "tenant_provisioning_jobs"`, databasetest.Response{Columns: []string{"count"}, Rows: [][]driver.Value{{test.running}}})
+
+			_, err := DeleteTenant(5)
+
+			if err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+
+			// The tenant row stays locked until the jobs are cancelled and the tenant deleted.
+			if locks := recorder.Matching(`FROM "tenant_connection_informations"  WHERE (id = $1) ORDER BY "tenant_connection_informations"."id" ASC LIMIT 1 FOR UPDATE`); len(locks) != 1 {
+				t.Fatalf("expected the tenant to be locked, got %v", recorder.Statements())
+			}
+
+			cancels := recorder.Matching(`UPDATE "tenant_provisioning_jobs" SET`)
+
+			if len(cancels) != 1 || cancels[0].Args[2] != tenants.JobCancelled || cancels[0].Args[4] != int64(5) || cancels[0].Args[5] != tenants.JobQueued {
+				t.Fatalf("expected the queued jobs to be cancelled, got %v", cancels)
+			}
+
+			deletes := recorder.Matching(`UPDATE "tenant_connection_informations" SET "deleted_at"`)
+			purges := recorder.Matching(`DROP DATABASE`)
+
+			if test.err != nil {
+				if len(deletes) != 0 || len(purges) != 0 || len(recorder.Matching("ROLLBACK")) != 1 {
+					t.Fatalf("expected nothing to be deleted, got %v", recorder.Statements())
+				}
+				return
+			}
+
+			if len(deletes) != 1 || len(recorder.Matching("ROLLBACK")) != 0 {
+				t.Fatalf("expected the tenant to be deleted, got %v", recorder.Statements())
+			}
+
+			if test.purged != (len(purges) == 1) {
+				t.Fatalf("expected the storage to be dropped: %v, got %v", test.purged, recorder.Statements())
+			}
+		})
+	}
+}
+
+func TestProvisionTenantStopsOnceDeleted(t *testing.T) {
+
+	recorder, restore := useTestDatabase()
+	defer restore()
+
+	deletedAt := time.Now().UTC()
+
+	tenant := tenants.TenantConnectionInformation{TenantSubDomainIdentifier: "acme", ProvisioningStatus: tenants.ProvisioningPending}
+	tenant.ID = 5
+
+	deleted := tenant
+	deleted.DeletedAt = &deletedAt
+
+	// The tenant is deleted after the first step ran.
+	respondWithTenant(recorder, deleted)
+	recorder.OnTimes(`FROM "tenant_connection_informations"`, 1, databasetest.Response{Columns: []string{"id", "provisioning_status"}, Rows: [][]driver.Value{{int64(5), tenants.ProvisioningPending}}})
+
+	var journal []string
+
+	steps := unlessTenantDeleted([]provisioningStep{
+		journalStep(&journal, "a", nil, nil, true),
+		journalStep(&journal, "b", nil, nil, true),
+	})
+
+	err := runProvisioningSteps(&tenant, steps)
+
+	if errors.Cause(err) != ErrTenantDeleted {
+		t.Fatalf("expected the deletion to stop provisioning, got %v", err)
+	}
+
+	if expected := []string{"run a", "rollback a"}; !reflect.DeepEqual(journal, expected) {
+		t.Fatalf("expected %v, got %v", expected, journal)
+	}
+
+	// Tenants deleted before a worker picks them up aren't provisioned at all.
+	if _, err := ProvisionTenant(5); err != ErrTenantDeleted {
+		t.Fatalf("expected a deleted tenant not to be provisioned, got %v", err)
+	}
+}
@@ -0,0 +1,398 @@
+package v1services
+
+import (
+	models "go-multitenancy-boilerplate/models"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrRoleNameInUse      = errors.New("a role with that name already exists")
+	ErrUnknownPermission  = errors.New("unknown permission")
+	ErrSystemRole         = errors.New("seeded roles can not be renamed or deleted")
+	ErrOwnerRolePermanent = errors.New("the permissions of the owner role can not be changed")
+	ErrLastOwner          = errors.New("a tenant must keep at least one owner")
+	ErrRoleNotHeld        = errors.New("the user holds a role you don't have")
+)
+
+// Lists every role of the tenant together with its permissions.
+func ListRoles(connection *gorm.DB) ([]models.Role, error) {
+
+	var roles []models.Role
+
+	if err := connection.Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Get a specific role with its permissions.
+func GetRole(id uint, connection *gorm.DB) (*models.Role, error) {
+
+	var role models.Role
+
+	if err := connection.Preload("Permissions").Where("id = ?", id).First(&role).Error; err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+// Creates a custom role granting the given permissions.
+func CreateRole(name string, description string, permissions []string, connection *gorm.DB) (*models.Role, error) {
+
+	if err := validatePermissions(permissions); err != nil {
+		return nil, err
+	}
+
+	role := models.Role{Name: name, Description: description}
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := ensureRoleNameAvailable(name, 0, tx); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+
+		return replaceRolePermissions(&role, permissions, tx)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+// Updates a role, seeded roles keep their name and the owner role keeps every permission.
+func UpdateRole(id uint, name string, description string, permissions []string, connection *gorm.DB) (*models.Role, error) {
+
+	if err := validatePermissions(permissions); err != nil {
+		return nil, err
+	}
+
+	var role models.Role
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Where("id = ?", id).First(&role).Error; err != nil {
+			return err
+		}
+
+		if role.System && role.Name == models.RoleOwner {
+			return ErrOwnerRolePermanent
+		}
+
+		if len(name) > 0 && name != role.Name {
+
+			if role.System {
+				return ErrSystemRole
+			}
+
+			if err := ensureRoleNameAvailable(name, role.ID, tx); err != nil {
+				return err
+			}
+
+			role.Name = name
+		}
+
+		role.Description = description
+
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+
+		if err := replaceRolePermissions(&role, permissions, tx); err != nil {
+			return err
+		}
+
+		return markRoleHoldersPrivilegesChanged(role.ID, tx)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+// Deletes a custom role and removes it from every user.
+func DeleteRole(id uint, connection *gorm.DB) (string, error) {
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		var role models.Role
+
+		if err := tx.Where("id = ?", id).First(&role).Error; err != nil {
+			return err
+		}
+
+		if role.System {
+			return ErrSystemRole
+		}
+
+		if err := markRoleHoldersPrivilegesChanged(role.ID, tx); err != nil {
+			return err
+		}
+
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&role).Error
+	})
+
+	if err != nil {
+		return "An error occurred when trying to delete the role", err
+	}
+
+	return "The role has been successfully deleted", nil
+}
+
+// Gives a user a role, assigning a role the user already has does nothing.
+func AssignRole(userId uint, roleId uint, connection *gorm.DB) (string, error) {
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Select("id").Where("id = ?", userId).First(&models.User{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Select("id").Where("id = ?", roleId).First(&models.Role{}).Error; err != nil {
+			return err
+		}
+
+		var count int
+		if err := tx.Model(&models.UserRole{}).Where("user_id = ? AND role_id = ?", userId, roleId).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return nil
+		}
+
+		if err := tx.Create(&models.UserRole{UserId: userId, RoleId: roleId}).Error; err != nil {
+			return err
+		}
+
+		return markUserPrivilegesChanged(tx.Where("id = ?", userId))
+	})
+
+	if err != nil {
+		return "An error occurred when trying to assign the role", err
+	}
+
+	return "The role has been successfully assigned", nil
+}
+
+// Takes a role away from a user, the last owner of a tenant keeps the owner role.
+func UnassignRole(userId uint, roleId uint, connection *gorm.DB) (string, error) {
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := ensureNotLastOwner(userId, roleId, tx); err != nil {
+			return err
+		}
+
+		result := tx.Where("user_id = ? AND role_id = ?", userId, roleId).Delete(&models.UserRole{})
+
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return markUserPrivilegesChanged(tx.Where("id = ?", userId))
+	})
+
+	if err != nil {
+		return "An error occurred when trying to remove the role", err
+	}
+
+	return "The role has been successfully removed", nil
+}
+
+// Lists the roles a user has.
+func GetUserRoles(userId uint, connection *gorm.DB) ([]models.Role, error) {
+
+	var roles []models.Role
+
+	if err := connection.Where("id IN (?)", connection.Table("user_roles").Select("role_id").Where("user_id = ?", userId).SubQuery()).Order("id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Lists every permission a user has through their roles.
+func GetUserPermissions(userId uint, connection *gorm.DB) ([]string, error) {
+
+	var permissions []string
+
+	err := connection.Model(&models.RolePermission{}).
+		Where("role_id IN (?)", connection.Table("user_roles").Select("role_id").Where("user_id = ?", userId).SubQuery()).
+		Pluck("DISTINCT permission", &permissions).Error
+
+	return permissions, err
+}
+
+// Whether a user has a permission through any of their roles.
+func UserHasPermission(userId uint, permission string, connection *gorm.DB) (bool, error) {
+
+	var count int
+
+	err := connection.Model(&models.RolePermission{}).
+		Where("permission = ?", permission).
+		Where("role_id IN (?)", connection.Table("user_roles").Select("role_id").Where("user_id = ?", userId).SubQuery()).
+		Count(&count).Error
+
+	return count > 0, err
+}
+
+// Whether a master user's account type grants a permission.
+func MasterUserHasPermission(userId uint, permission string) (bool, error) {
+
+	user, err := GetMasterUser(userId)
+
+	if err != nil {
+		return false, err
+	}
+
+	return models.MasterAccountHasPermission(user.AccountType, permission), nil
+}
+
+// Gives a new user their first role, the first user of a tenant becomes its owner.
+func assignInitialRole(userId uint, tx *gorm.DB) error {
+
+	var owners int
+	if err := tx.Model(&models.UserRole{}).Where("role_id IN (?)", systemRoleQuery(models.RoleOwner, tx)).Count(&owners).Error; err != nil {
+		return err
+	}
+
+	name := models.RoleMember
+	if owners == 0 {
+		name = models.RoleOwner
+	}
+
+	var role models.Role
+
+	if err := tx.Where("name = ? AND system = ?", name, true).First(&role).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&models.UserRole{UserId: userId, RoleId: role.ID}).Error
+}
+
+// Refuses to take the owner role away from the only user who has it.
+func ensureNotLastOwner(userId uint, roleId uint, tx *gorm.DB) error {
+
+	var role models.Role
+
+	if err := tx.Where("id = ?", roleId).First(&role).Error; err != nil {
+		return err
+	}
+
+	if !role.System || role.Name != models.RoleOwner {
+		return nil
+	}
+
+	var others int
+	if err := tx.Model(&models.UserRole{}).Where("role_id = ? AND user_id <> ?", roleId, userId).Count(&others).Error; err != nil {
+		return err
+	}
+
+	if others == 0 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+// Refuses to let a tenant user manage someone holding a role they don't, e.g. an admin taking over an owner's account.
+// Users always manage themselves, and work not done for a tenant user isn't limited by roles.
+func ensureCanManageUser(actor Actor, userId uint, tx *gorm.DB) error {
+
+	if (actor.Type != models.ActorUser && actor.Type != models.ActorApiKey) || actor.UserId() == userId {
+		return nil
+	}
+
+	var missing int
+
+	err := tx.Model(&models.UserRole{}).
+		Where("user_id = ?", userId).
+		Where("role_id NOT IN (?)", tx.Table("user_roles").Select("role_id").Where("user_id = ?", actor.UserId()).SubQuery()).
+		Count(&missing).Error
+
+	if err != nil {
+		return err
+	}
+
+	if missing > 0 {
+		return ErrRoleNotHeld
+	}
+
+	return nil
+}
+
+func systemRoleQuery(name string, tx *gorm.DB) interface{} {
+	return tx.Model(&models.Role{}).Select("id").Where("name = ? AND system = ?", name, true).SubQuery()
+}
+
+func ensureRoleNameAvailable(name string, exceptId uint, tx *gorm.DB) error {
+
+	var count int
+	if err := tx.Model(&models.Role{}).Where("name = ? AND id <> ?", name, exceptId).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return ErrRoleNameInUse
+	}
+
+	return nil
+}
+
+func replaceRolePermissions(role *models.Role, permissions []string, tx *gorm.DB) error {
+
+	if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+
+	role.Permissions = nil
+
+	for _, permission := range permissions {
+
+		granted := models.RolePermission{RoleId: role.ID, Permission: permission}
+
+		if err := tx.Create(&granted).Error; err != nil {
+			return err
+		}
+
+		role.Permissions = append(role.Permissions, granted)
+	}
+
+	return nil
+}
+
+func validatePermissions(permissions []string) error {
+
+	for _, permission := range permissions {
+		if !models.IsTenantPermission(permission) {
+			return errors.Wrap(ErrUnknownPermission, permission)
+		}
+	}
+
+	return nil
+}
+
+// Moves the privileges of every user holding a role forward, their cookie sessions move to a new id.
+func markRoleHoldersPrivilegesChanged(roleId uint, tx *gorm.DB) error {
+	return markUserPrivilegesChanged(tx.Where("id IN (?)", tx.Model(&models.UserRole{}).Select("user_id").Where("role_id = ?", roleId).SubQuery()))
+}
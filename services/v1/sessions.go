@@ -0,0 +1,400 @@
+package v1services
+
+import (
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	models "go-multitenancy-boilerplate/models"
+	tokens "go-multitenancy-boilerplate/tokens"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Audited session actions.
+const (
+	AuditSessionRevoke             = "auth.session_revoked"
+	AuditSessionRevokeOthers       = "auth.other_sessions_revoked"
+	AuditUserForceLogout           = "user.force_logout"
+	AuditMasterSessionRevoke       = "master_auth.session_revoked"
+	AuditMasterSessionRevokeOthers = "master_auth.other_sessions_revoked"
+	AuditMasterUserForceLogout     = "master_user.force_logout"
+)
+
+// Returned for sessions and tokens which were revoked, authorized before the user's sessions were invalidated, or whose user is gone.
+var ErrSessionInvalidated = errors.New("the session is no longer valid")
+
+// Returned for sessions and tokens whose login went unused for too long or is older than its lifetime, the session is ended.
+var ErrSessionExpired = errors.New("the session has expired")
+
+// Last seen times are only written this often, so busy sessions don't write on every request.
+const sessionTouchInterval = time.Minute
+
+// Tenant users
+//
+
+// Records a new login of a tenant user, the session that logged in before on the same cookie is ended.
+func StartUserSession(userId uint, previousId uint, userAgent string, ipAddress string, connection *gorm.DB) (uint, error) {
+
+	now := time.Now().UTC()
+
+	session := models.UserSession{
+		UserId:     userId,
+		UserAgent:  truncate(userAgent, 255),
+		IpAddress:  truncate(ipAddress, 45),
+		LastSeenAt: now,
+	}
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		if previousId > 0 {
+			if err := tx.Model(&models.UserSession{}).Where("id = ? AND revoked_at IS NULL", previousId).UpdateColumn("revoked_at", now).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&session).Error
+	})
+
+	return session.ID, err
+}
+
+// Checks the session a request was authorized with, and notes the user was seen which renews its idle timeout.
+// The session has to belong to the user, still be active and within the tenant's timeouts, and the user's sessions can't have been invalidated since authorizedAt.
+// Returns whether the user's privileges changed since authorizedAt, cookie sessions then move to a new id.
+func CheckUserSession(tenantId uint, userId uint, sessionId uint, authorizedAt time.Time, connection *gorm.DB) (bool, error) {
+
+	timeouts, err := GetTenantSessionTimeouts(tenantId)
+
+	if err != nil {
+		return false, err
+	}
+
+	var user models.User
+
+	err = connection.Select("id, sessions_valid_from, privileges_changed_at").Where("id = ?", userId).First(&user).Error
+
+	if err == nil {
+		err = checkSessionValidFrom(user.SessionsValidFrom, authorizedAt)
+	}
+
+	var session models.UserSession
+
+	if err == nil {
+		err = connection.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionId, userId).First(&session).Error
+	}
+
+	if gorm.IsRecordNotFoundError(err) {
+		return false, ErrSessionInvalidated
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+
+	if timeouts.Expired(session.CreatedAt, session.LastSeenAt, now) {
+		return false, expireSession(connection.Model(&session))
+	}
+
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		if err := connection.Model(&session).UpdateColumn("last_seen_at", now).Error; err != nil {
+			return false, err
+		}
+	}
+
+	return privilegesChangedSince(user.PrivilegesChangedAt, authorizedAt), nil
+}
+
+// The session timeouts of a tenant, the platform timeouts with the tenant's overrides.
+func GetTenantSessionTimeouts(tenantId uint) (tokens.Timeouts, error) {
+
+	settings, err := GetTenantSettings(tenantId)
+
+	if err != nil {
+		return tokens.Timeouts{}, err
+	}
+
+	return settings.SessionTimeouts(tokens.DefaultTimeouts()), nil
+}
+
+// Moves the privileges of tenant users forward, the query picks the users.
+func markUserPrivilegesChanged(query *gorm.DB) error {
+	return query.Model(&models.User{}).UpdateColumn("privileges_changed_at", time.Now().UTC()).Error
+}
+
+// Lists the active sessions of a tenant user, most recently seen first.
+func ListUserSessions(userId uint, connection *gorm.DB) ([]models.UserSession, error) {
+
+	var sessions []models.UserSession
+
+	err := connection.Where("user_id = ? AND revoked_at IS NULL", userId).Order("last_seen_at desc").Find(&sessions).Error
+
+	return sessions, err
+}
+
+// Revokes one session of a tenant user, ErrRecordNotFound when the user has no such active session.
+func RevokeUserSession(actor Actor, userId uint, sessionId uint, connection *gorm.DB) error {
+
+	err := revokeUserSessions(connection.Where("id = ?", sessionId), userId, true)
+
+	recordTenantEvent(connection, actor, AuditSessionRevoke, "user_session", sessionId, nil, nil, err)
+
+	return err
+}
+
+// Revokes every session of a tenant user except the current one.
+func RevokeOtherUserSessions(actor Actor, userId uint, currentId uint, connection *gorm.DB) error {
+
+	err := revokeUserSessions(connection.Where("id <> ?", currentId), userId, false)
+
+	recordTenantEvent(connection, actor, AuditSessionRevokeOthers, "user", userId, nil, nil, err)
+
+	return err
+}
+
+// Logs a tenant user out everywhere, including tokens and sessions from before sessions were recorded.
+func ForceLogoutUser(actor Actor, userId uint, connection *gorm.DB) error {
+
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		var user models.User
+
+		if err := tx.Select("id").Where("id = ?", userId).First(&user).Error; err != nil {
+			return err
+		}
+
+		if err := ensureCanManageUser(actor, userId, tx); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).UpdateColumn("sessions_valid_from", sessionsValidFromNow()).Error; err != nil {
+			return err
+		}
+
+		return revokeUserSessions(tx, userId, false)
+	})
+
+	recordTenantEvent(connection, actor, AuditUserForceLogout, "user", userId, nil, nil, err)
+
+	return err
+}
+
+// Ends the session a tenant user logged out of.
+func EndUserSession(userId uint, sessionId uint, connection *gorm.DB) error {
+	return revokeUserSessions(connection.Where("id = ?", sessionId), userId, false)
+}
+
+func revokeUserSessions(query *gorm.DB, userId uint, mustExist bool) error {
+
+	now := time.Now().UTC()
+
+	result := query.Model(&models.UserSession{}).Where("user_id = ? AND revoked_at IS NULL", userId).UpdateColumn("revoked_at", now)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if mustExist && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Master users
+//
+
+// Records a new login of a master user, the session that logged in before on the same cookie is ended.
+func StartMasterUserSession(userId uint, previousId uint, userAgent string, ipAddress string) (uint, error) {
+
+	now := time.Now().UTC()
+
+	session := models.MasterUserSession{
+		MasterUserId: userId,
+		UserAgent:    truncate(userAgent, 255),
+		IpAddress:    truncate(ipAddress, 45),
+		LastSeenAt:   now,
+	}
+
+	err := database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		if previousId > 0 {
+			if err := tx.Model(&models.MasterUserSession{}).Where("id = ? AND revoked_at IS NULL", previousId).UpdateColumn("revoked_at", now).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&session).Error
+	})
+
+	return session.ID, err
+}
+
+// Checks the session a request was authorized with, and notes the master user was seen which renews its idle timeout.
+// Returns whether the user's privileges changed since authorizedAt, cookie sessions then move to a new id.
+func CheckMasterUserSession(userId uint, sessionId uint, authorizedAt time.Time) (bool, error) {
+
+	var user MasterUser
+
+	err := database.Connection.Select("id, sessions_valid_from, privileges_changed_at").Where("id = ?", userId).First(&user).Error
+
+	if err == nil {
+		err = checkSessionValidFrom(user.SessionsValidFrom, authorizedAt)
+	}
+
+	var session models.MasterUserSession
+
+	if err == nil {
+		err = database.Connection.Where("id = ? AND master_user_id = ? AND revoked_at IS NULL", sessionId, userId).First(&session).Error
+	}
+
+	if gorm.IsRecordNotFoundError(err) {
+		return false, ErrSessionInvalidated
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+
+	if MasterSessionTimeouts().Expired(session.CreatedAt, session.LastSeenAt, now) {
+		return false, expireSession(database.Connection.Model(&session))
+	}
+
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		if err := database.Connection.Model(&session).UpdateColumn("last_seen_at", now).Error; err != nil {
+			return false, err
+		}
+	}
+
+	return privilegesChangedSince(user.PrivilegesChangedAt, authorizedAt), nil
+}
+
+// The session timeouts of master users, the platform timeouts.
+func MasterSessionTimeouts() tokens.Timeouts {
+	return tokens.DefaultTimeouts()
+}
+
+// Moves the privileges of master users forward, the query picks the users.
+func markMasterUserPrivilegesChanged(query *gorm.DB) error {
+	return query.Model(&MasterUser{}).UpdateColumn("privileges_changed_at", time.Now().UTC()).Error
+}
+
+// Lists the active sessions of a master user, most recently seen first.
+func ListMasterUserSessions(userId uint) ([]models.MasterUserSession, error) {
+
+	var sessions []models.MasterUserSession
+
+	err := database.Connection.Where("master_user_id = ? AND revoked_at IS NULL", userId).Order("last_seen_at desc").Find(&sessions).Error
+
+	return sessions, err
+}
+
+// Revokes one session of a master user, ErrRecordNotFound when the user has no such active session.
+func RevokeMasterUserSession(actor Actor, userId uint, sessionId uint) error {
+
+	err := revokeMasterUserSessions(database.Connection.Where("id = ?", sessionId), userId, true)
+
+	recordMasterEvent(actor, 0, AuditMasterSessionRevoke, "master_user_session", sessionId, nil, nil, err)
+
+	return err
+}
+
+// Revokes every session of a master user except the current one.
+func RevokeOtherMasterUserSessions(actor Actor, userId uint, currentId uint) error {
+
+	err := revokeMasterUserSessions(database.Connection.Where("id <> ?", currentId), userId, false)
+
+	recordMasterEvent(actor, 0, AuditMasterSessionRevokeOthers, "master_user", userId, nil, nil, err)
+
+	return err
+}
+
+// Logs a master user out everywhere, including tokens and sessions from before sessions were recorded.
+func ForceLogoutMasterUser(actor Actor, userId uint) error {
+
+	err := database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		var user MasterUser
+
+		if err := tx.Select("id").Where("id = ?", userId).First(&user).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).UpdateColumn("sessions_valid_from", sessionsValidFromNow()).Error; err != nil {
+			return err
+		}
+
+		return revokeMasterUserSessions(tx, userId, false)
+	})
+
+	recordMasterEvent(actor, 0, AuditMasterUserForceLogout, "master_user", userId, nil, nil, err)
+
+	return err
+}
+
+// Ends the session a master user logged out of.
+func EndMasterUserSession(userId uint, sessionId uint) error {
+	return revokeMasterUserSessions(database.Connection.Where("id = ?", sessionId), userId, false)
+}
+
+func revokeMasterUserSessions(query *gorm.DB, userId uint, mustExist bool) error {
+
+	now := time.Now().UTC()
+
+	result := query.Model(&models.MasterUserSession{}).Where("master_user_id = ? AND revoked_at IS NULL", userId).UpdateColumn("revoked_at", now)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if mustExist && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Shared
+//
+
+// Ends a session which timed out, the query picks it.
+func expireSession(query *gorm.DB) error {
+
+	if err := query.UpdateColumn("revoked_at", time.Now().UTC()).Error; err != nil {
+		return err
+	}
+
+	return ErrSessionExpired
+}
+
+func privilegesChangedSince(changedAt *time.Time, authorizedAt time.Time) bool {
+	return changedAt != nil && changedAt.After(authorizedAt)
+}
+
+func checkSessionValidFrom(validFrom *time.Time, authorizedAt time.Time) error {
+
+	if validFrom != nil && authorizedAt.Before(*validFrom) {
+		return ErrSessionInvalidated
+	}
+
+	return nil
+}
+
+// Sessions are invalidated from the start of the current second, token issue times only have second precision.
+func sessionsValidFromNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// Cuts a string down to a column's length in characters.
+func truncate(s string, length int) string {
+
+	if runes := []rune(s); len(runes) > length {
+		return string(runes[:length])
+	}
+
+	return s
+}
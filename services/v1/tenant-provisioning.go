@@ -0,0 +1,186 @@
+package v1services
+
+import (
+	"fmt"
+
+	database "go-multitenancy-boilerplate/database"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/pkg/errors"
+)
+
+// A single provisioning step and the compensation that undoes it.
+type provisioningStep struct {
+	name     string
+	run      func(tenant *tenants.TenantConnectionInformation) error
+	rollback func(tenant *tenants.TenantConnectionInformation) error
+}
+
+// Runs the steps in order. When a step fails the completed steps are rolled back in reverse order,
+// a tenant record which survives the rollback is marked as failed so it can be retried or cleaned up.
+func runProvisioningSteps(tenant *tenants.TenantConnectionInformation, steps []provisioningStep) error {
+
+	for i, step := range steps {
+
+		err := step.run(tenant)
+
+		if err == nil {
+			continue
+		}
+
+		err = errors.Wrap(err, step.name)
+
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].rollback == nil {
+				continue
+			}
+
+			// Stop at the first failed rollback, the earlier steps (such as the tenant record) are
+			// what lets someone find and clean up what was left behind.
+			if rollbackErr := steps[j].rollback(tenant); rollbackErr != nil {
+				err = errors.Errorf("%s (rolling back %s failed: %s)", err.Error(), steps[j].name, rollbackErr.Error())
+				break
+			}
+		}
+
+		markTenantFailed(tenant, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// Inserts the tenant record as pending, this reserves the sub domain.
+// Rolling back removes the record again.
+func reserveTenantStep() provisioningStep {
+	return provisioningStep{
+		name: "reserving the tenant record",
+		run: func(tenant *tenants.TenantConnectionInformation) error {
+			tenant.ProvisioningStatus = tenants.ProvisioningPending
+			return database.Connection.Create(tenant).Error
+		},
+		rollback: func(tenant *tenants.TenantConnectionInformation) error {
+			if err := database.Connection.Unscoped().Delete(tenant).Error; err != nil {
+				return err
+			}
+			tenant.ID = 0
+			return nil
+		},
+	}
+}
+
+// Creates the database or schema holding the tenant data, rolling back drops it again.
+func createTenantStorageStep() provisioningStep {
+	return provisioningStep{
+		name: "creating the tenant storage",
+		run: func(tenant *tenants.TenantConnectionInformation) error {
+			return database.CreateTenantStorage(*tenant)
+		},
+		rollback: func(tenant *tenants.TenantConnectionInformation) error {
+			return database.DropTenantStorage(*tenant)
+		},
+	}
+}
+
+// Migrates the tenant tables, the storage rollback removes anything created here.
+func migrateTenantStep() provisioningStep {
+	return provisioningStep{
+		name: "migrating the tenant tables",
+		run: func(tenant *tenants.TenantConnectionInformation) error {
+			return database.MigrateTenant("provisioning", *tenant)
+		},
+	}
+}
+
+// Marks the tenant as ready to serve requests.
+func markTenantReadyStep() provisioningStep {
+	return provisioningStep{
+		name: "marking the tenant as ready",
+		run: func(tenant *tenants.TenantConnectionInformation) error {
+			tenant.ProvisioningStatus = tenants.ProvisioningReady
+			tenant.ProvisioningError = ""
+			return database.Connection.Model(tenant).Updates(map[string]interface{}{
+				"provisioning_status": tenants.ProvisioningReady,
+				"provisioning_error":  "",
+			}).Error
+		},
+	}
+}
+
+// Steps run for a tenant record which already exists.
+func tenantStorageSteps() []provisioningStep {
+	return []provisioningStep{
+		createTenantStorageStep(),
+		migrateTenantStep(),
+		markTenantReadyStep(),
+	}
+}
+
+// Checks the tenant still exists and hasn't been deleted before each step, so a tenant deleted
+// while it is being provisioned has what was already created rolled back.
+func unlessTenantDeleted(steps []provisioningStep) []provisioningStep {
+
+	for i := range steps {
+		run := steps[i].run
+
+		steps[i].run = func(tenant *tenants.TenantConnectionInformation) error {
+
+			current, err := GetTenant(tenant.ID)
+
+			if err != nil {
+				return err
+			}
+
+			if current.DeletedAt != nil {
+				return ErrTenantDeleted
+			}
+
+			return run(tenant)
+		}
+	}
+
+	return steps
+}
+
+// Records the failure on the tenant record, unless the record itself was rolled back.
+func markTenantFailed(tenant *tenants.TenantConnectionInformation, cause error) {
+
+	if tenant.ID == 0 {
+		return
+	}
+
+	tenant.ProvisioningStatus = tenants.ProvisioningFailed
+	tenant.ProvisioningError = cause.Error()
+
+	if err := database.Connection.Unscoped().Model(tenant).Updates(map[string]interface{}{
+		"provisioning_status": tenants.ProvisioningFailed,
+		"provisioning_error":  cause.Error(),
+	}).Error; err != nil {
+		fmt.Println("An error occurred while recording the failed provisioning of tenant", tenant.TenantSubDomainIdentifier, err)
+	}
+}
+
+// Retries provisioning a tenant which failed or never finished.
+func ProvisionTenant(id uint) (string, error) {
+
+	tenant, err := GetTenant(id)
+
+	if err != nil {
+		return "The tenant could not be found", err
+	}
+
+	if tenant.DeletedAt != nil {
+		return "The tenant has been deleted, restore it first", ErrTenantDeleted
+	}
+
+	if tenant.IsReady() {
+		return "The tenant has already been provisioned", nil
+	}
+
+	if err := runProvisioningSteps(tenant, unlessTenantDeleted(tenantStorageSteps())); err != nil {
+		return "error provisioning the tenant", err
+	}
+
+	return "The tenant has been successfully provisioned", nil
+}
@@ -0,0 +1,194 @@
+package v1services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	database "go-multitenancy-boilerplate/database"
+	databasetest "go-multitenancy-boilerplate/database/databasetest"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+)
+
+// Points the master connection at a recorder, the returned function puts the previous connection back.
+func useTestDatabase() (*databasetest.Recorder, func()) {
+
+	previous, previousTenants := database.Connection, database.TenantConnections
+	db, recorder := databasetest.Open()
+
+	database.Connection = db
+	database.TenantConnections = database.NewTenantConnectionManager(database.TenantPoolOptions{})
+
+	return recorder, func() {
+		database.Connection, database.TenantConnections = previous, previousTenants
+		db.Close()
+	}
+}
+
+// A step which records when it runs and is rolled back, failing where asked to.
+func journalStep(journal *[]string, name string, runErr error, rollbackErr error, reversible bool) provisioningStep {
+
+	step := provisioningStep{
+		name: name,
+		run: func(tenant *tenants.TenantConnectionInformation) error {
+			*journal = append(*journal, "run "+name)
+			return runErr
+		},
+	}
+
+	if reversible {
+		step.rollback = func(tenant *tenants.TenantConnectionInformation) error {
+			*journal = append(*journal, "rollback "+name)
+			return rollbackErr
+		}
+	}
+
+	return step
+}
+
+func TestRunProvisioningSteps(t *testing.T) {
+
+	failed := errors.New("failed")
+
+	tests := []struct {
+		name    string
+		steps   func(journal *[]string) []provisioningStep
+		journal []string
+		err     string
+	}{
+		{
+			"every step succeeds",
+			func(journal *[]string) []provisioningStep {
+				return []provisioningStep{
+					journalStep(journal, "a", nil, nil, true),
+					journalStep(journal, "b", nil, nil, true),
+				}
+			},
+			[]string{"run a", "run b"},
+			"",
+		},
+		{
+			"completed steps are rolled back in reverse order",
+			func(journal *[]string) []provisioningStep {
+				return []provisioningStep{
+					journalStep(journal, "a", nil, nil, true),
+					journalStep(journal, "b", nil, nil, false),
+					journalStep(journal, "c", nil, nil, true),
+					journalStep(journal, "d", failed, nil, true),
+					journalStep(journal, "e", nil, nil, true),
+				}
+			},
+			[]string{"run a", "run b", "run c", "run d", "rollback c", "rollback a"},
+			"d: failed",
+		},
+		{
+			"a failed rollback stops the rollback",
+			func(journal *[]string) []provisioningStep {
+				return []provisioningStep{
+					journalStep(journal, "a", nil, nil, true),
+					journalStep(journal, "b", nil, errors.New("still in use"), true),
+					journalStep(journal, "c", failed, nil, true),
+				}
+			},
+			[]string{"run a", "run b", "run c", "rollback b"},
+			"c: failed (rolling back b failed: still in use)",
+		},
+		{
+			"the first step failing has nothing to roll back",
+			func(journal *[]string) []provisioningStep {
+				return []provisioningStep{
+					journalStep(journal, "a", failed, nil, true),
+				}
+			},
+			[]string{"run a"},
+			"a: failed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			_, restore := useTestDatabase()
+			defer restore()
+
+			var journal []string
+
+			err := runProvisioningSteps(&tenants.TenantConnectionInformation{}, test.steps(&journal))
+
+			if !reflect.DeepEqual(journal, test.journal) {
+				t.Fatalf("expected %v, got %v", test.journal, journal)
+			}
+
+			if (err == nil && len(test.err) > 0) || (err != nil && err.Error() != test.err) {
+				t.Fatalf("expected the error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestRunProvisioningStepsMarksTenantFailed(t *testing.T) {
+
+	recorder, restore := useTestDatabase()
+	defer restore()
+
+	tenant := &tenants.TenantConnectionInformation{TenantSubDomainIdentifier: "acme"}
+	journal := []string{}
+
+	steps := []provisioningStep{
+		reserveTenantStep(),
+		journalStep(&journal, "storage", nil, nil, true),
+		journalStep(&journal, "migrations", errors.New("failed"), nil, false),
+	}
+
+	// The tenant record can't be removed, so it is left behind marked as failed.
+	recorder.On(`DELETE FROM "tenant_connection_informations"`, databasetest.Response{Err: errors.New("locked")})
+
+	err := runProvisioningSteps(tenant, steps)
+
+	if err == nil || !strings.Contains(err.Error(), "rolling back reserving the tenant record failed: locked") {
+		t.Fatalf("expected the failed rollback to be reported, got %v", err)
+	}
+
+	if tenant.ID == 0 || tenant.ProvisioningStatus != tenants.ProvisioningFailed || tenant.ProvisioningError != err.Error() {
+		t.Fatalf("expected the tenant to be marked as failed, got %+v", tenant)
+	}
+
+	updates := recorder.Matching(`UPDATE "tenant_connection_informations" SET`)
+
+	if len(updates) != 1 || !reflect.DeepEqual(updates[0].Args[:2], []driver.Value{err.Error(), tenants.ProvisioningFailed}) {
+		t.Fatalf("expected the failure to be recorded, got %v", updates)
+	}
+}
+
+func TestRunProvisioningStepsRemovesReservedTenant(t *testing.T) {
+
+	recorder, restore := useTestDatabase()
+	defer restore()
+
+	tenant := &tenants.TenantConnectionInformation{TenantSubDomainIdentifier: "acme"}
+	journal := []string{}
+
+	steps := []provisioningStep{
+		reserveTenantStep(),
+		journalStep(&journal, "storage", errors.New("failed"), nil, true),
+	}
+
+	if err := runProvisioningSteps(tenant, steps); err == nil {
+		t.Fatal("expected the failed step to be reported")
+	}
+
+	if inserts := recorder.Matching(`INSERT INTO "tenant_connection_informations"`); len(inserts) != 1 {
+		t.Fatalf("expected the tenant to be reserved, got %v", recorder.Statements())
+	}
+
+	if deletes := recorder.Matching(`DELETE FROM "tenant_connection_informations"`); len(deletes) != 1 {
+		t.Fatalf("expected the reservation to be removed, got %v", recorder.Statements())
+	}
+
+	// Nothing is left to mark as failed.
+	if tenant.ID != 0 || len(recorder.Matching("UPDATE")) != 0 {
+		t.Fatalf("expected the removed tenant not to be marked as failed, got %v", recorder.Statements())
+	}
+}
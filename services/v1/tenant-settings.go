@@ -0,0 +1,162 @@
+package v1services
+
+import (
+	database "go-multitenancy-boilerplate/database"
+	tenants "go-multitenancy-boilerplate/models/tenants"
+	passwords "go-multitenancy-boilerplate/passwords"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Returned when a setting is out of its allowed range.
+var ErrInvalidSettings = errors.New("the settings are invalid")
+
+// Changes to the settings of a tenant, fields left nil keep their current value.
+type TenantSettingsUpdate struct {
+	RequireEmailVerification  *bool
+	RequireTwoFactorForAdmins *bool
+	// Password policy overrides, ResetPasswordPolicy goes back to the platform policy before the others apply.
+	ResetPasswordPolicy      bool
+	PasswordMinLength        *int
+	PasswordRequireUppercase *bool
+	PasswordRequireLowercase *bool
+	PasswordRequireDigit     *bool
+	PasswordRequireSpecial   *bool
+	PasswordRejectCommon     *bool
+	PasswordHistory          *int
+	PasswordMaxAgeDays       *int
+	// Session timeout overrides in minutes, zero never expires. ResetSessionTimeouts goes back to the platform timeouts first.
+	ResetSessionTimeouts          bool
+	SessionIdleTimeoutMinutes     *int
+	SessionAbsoluteTimeoutMinutes *int
+}
+
+// Checks the password policy and session timeout overrides are within sensible bounds.
+func (u TenantSettingsUpdate) validate() error {
+
+	if u.PasswordMinLength != nil && (*u.PasswordMinLength < 6 || *u.PasswordMinLength > passwords.MaxLength) {
+		return errors.Wrap(ErrInvalidSettings, "the minimum password length must be between 6 and 128")
+	}
+
+	if u.PasswordHistory != nil && (*u.PasswordHistory < 0 || *u.PasswordHistory > maxPasswordHistory) {
+		return errors.Wrap(ErrInvalidSettings, "the password history must be between 0 and 24")
+	}
+
+	if u.PasswordMaxAgeDays != nil && (*u.PasswordMaxAgeDays < 0 || *u.PasswordMaxAgeDays > 3650) {
+		return errors.Wrap(ErrInvalidSettings, "the maximum password age must be between 0 and 3650 days")
+	}
+
+	if !validTimeoutMinutes(u.SessionIdleTimeoutMinutes, 30*24*60) {
+		return errors.Wrap(ErrInvalidSettings, "the idle session timeout must be 0 or between 5 and 43200 minutes")
+	}
+
+	if !validTimeoutMinutes(u.SessionAbsoluteTimeoutMinutes, 365*24*60) {
+		return errors.Wrap(ErrInvalidSettings, "the absolute session timeout must be 0 or between 5 and 525600 minutes")
+	}
+
+	return nil
+}
+
+// Timeouts are zero to never expire, otherwise at least five minutes so the last seen time can keep up.
+func validTimeoutMinutes(minutes *int, max int) bool {
+	return minutes == nil || *minutes == 0 || (*minutes >= 5 && *minutes <= max)
+}
+
+// Gets the settings of a tenant, the defaults when it never changed them.
+func GetTenantSettings(tenantId uint) (*tenants.TenantSettings, error) {
+
+	settings := tenants.DefaultTenantSettings(tenantId)
+
+	err := database.Connection.Where("tenant_id = ?", tenantId).First(&settings).Error
+
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// Changes the settings of a tenant, recorded in the master audit log.
+func UpdateTenantSettings(actor Actor, tenantId uint, update TenantSettingsUpdate) (*tenants.TenantSettings, error) {
+
+	if err := update.validate(); err != nil {
+		return nil, err
+	}
+
+	before, err := GetTenantSettings(tenantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	after := *before
+
+	if update.RequireEmailVerification != nil {
+		after.RequireEmailVerification = *update.RequireEmailVerification
+	}
+
+	if update.RequireTwoFactorForAdmins != nil {
+		after.RequireTwoFactorForAdmins = *update.RequireTwoFactorForAdmins
+	}
+
+	if update.ResetPasswordPolicy {
+		defaults := tenants.DefaultTenantSettings(tenantId)
+		after.PasswordMinLength = defaults.PasswordMinLength
+		after.PasswordRequireUppercase = defaults.PasswordRequireUppercase
+		after.PasswordRequireLowercase = defaults.PasswordRequireLowercase
+		after.PasswordRequireDigit = defaults.PasswordRequireDigit
+		after.PasswordRequireSpecial = defaults.PasswordRequireSpecial
+		after.PasswordRejectCommon = defaults.PasswordRejectCommon
+		after.PasswordHistory = defaults.PasswordHistory
+		after.PasswordMaxAgeDays = defaults.PasswordMaxAgeDays
+	}
+
+	if update.PasswordMinLength != nil {
+		after.PasswordMinLength = update.PasswordMinLength
+	}
+	if update.PasswordRequireUppercase != nil {
+		after.PasswordRequireUppercase = update.PasswordRequireUppercase
+	}
+	if update.PasswordRequireLowercase != nil {
+		after.PasswordRequireLowercase = update.PasswordRequireLowercase
+	}
+	if update.PasswordRequireDigit != nil {
+		after.PasswordRequireDigit = update.PasswordRequireDigit
+	}
+	if update.PasswordRequireSpecial != nil {
+		after.PasswordRequireSpecial = update.PasswordRequireSpecial
+	}
+	if update.PasswordRejectCommon != nil {
+		after.PasswordRejectCommon = update.PasswordRejectCommon
+	}
+	if update.PasswordHistory != nil {
+		after.PasswordHistory = update.PasswordHistory
+	}
+	if update.PasswordMaxAgeDays != nil {
+		after.PasswordMaxAgeDays = update.PasswordMaxAgeDays
+	}
+
+	if update.ResetSessionTimeouts {
+		after.SessionIdleTimeoutMinutes = nil
+		after.SessionAbsoluteTimeoutMinutes = nil
+	}
+
+	if update.SessionIdleTimeoutMinutes != nil {
+		after.SessionIdleTimeoutMinutes = update.SessionIdleTimeoutMinutes
+	}
+	if update.SessionAbsoluteTimeoutMinutes != nil {
+		after.SessionAbsoluteTimeoutMinutes = update.SessionAbsoluteTimeoutMinutes
+	}
+
+	// Save inserts the row for tenants still on the defaults.
+	err = database.Connection.Save(&after).Error
+
+	recordMasterEvent(actor, tenantId, AuditTenantSettings, "tenant", tenantId, before, &after, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
@@ -1,43 +1,352 @@
 package v1services
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
 	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
 	tenants "go-multitenancy-boilerplate/models/tenants"
+
+	"github.com/jinzhu/gorm"
 )
 
-// Create a tenant using a domain identifier
-func CreateTenant(subDomainIdentifier string) (msg string, err error) {
+// Returned when a sub domain identifier is used by another tenant.
+var ErrSubDomainInUse = errors.New("A tenant with that sub domain identifier already exists")
+
+// Filters used when listing tenants.
+type TenantListOptions struct {
+	Search         string // Partial sub domain identifier.
+	Status         string
+	Strategy       string
+	IncludeDeleted bool
+	Page           int
+	PageSize       int
+}
+
+// Create a tenant using a domain identifier and an isolation strategy.
+// An empty strategy falls back to the configured default.
+func CreateTenant(actor Actor, subDomainIdentifier string, strategy string) (string, error) {
+
+	tenant, outcome, err := createTenant(subDomainIdentifier, strategy)
 
-	// Create new database to hold client.
-	databaseName := strings.ToLower(subDomainIdentifier) + os.Getenv("SUFFIX_TENANT_DATABASE_NAME")
-	connectionString := fmt.Sprintf(os.Getenv("CONNECTION_STRING"), databaseName)
+	recordMasterEvent(actor, tenant.ID, AuditTenantCreate, "tenant", tenant.ID, nil, tenant, err)
 
-	if err := database.Connection.Exec("CREATE DATABASE \"" + databaseName + "\" OWNER postgres").Error; err != nil {
-		return "error making the database", err
+	return outcome, err
+}
+
+func createTenant(subDomainIdentifier string, strategy string) (*tenants.TenantConnectionInformation, string, error) {
+
+	if len(strategy) == 0 {
+		strategy = database.DefaultIsolationStrategy()
 	}
 
-	tenant := tenants.TenantConnectionInformation{
-		TenantSubDomainIdentifier: subDomainIdentifier,
-		ConnectionString:          connectionString,
+	tenant, err := database.NewTenantConnectionInformation(subDomainIdentifier, strategy)
+
+	if err != nil {
+		return &tenant, "error choosing the isolation strategy", err
 	}
 
-	if err := database.Connection.Create(&tenant).Error; err != nil {
-		return "error inserting the new database record", err
+	if available, err := isSubDomainAvailable(subDomainIdentifier, 0); err != nil {
+		return &tenant, "error checking the sub domain identifier", err
+	} else if !available {
+		return &tenant, "error the sub domain identifier is already in use", ErrSubDomainInUse
 	}
 
-	tenConn, tenConErr := tenant.GetConnection()
+	// Every step is undone again if a later one fails.
+	steps := append([]provisioningStep{reserveTenantStep()}, tenantStorageSteps()...)
 
-	if tenConErr != nil {
-		return "error creating the connection using connection method", err
+	if err := runProvisioningSteps(&tenant, steps); err != nil {
+		return &tenant, "error provisioning the new tenant", err
 	}
 
-	if migrateErr := database.MigrateTenantTables(tenConn); migrateErr != nil {
-		return "error attempting to migrate the existing tables to new database", migrateErr
+	return &tenant, "New Tenant has been successfully made", nil
+}
+
+// Lists tenants a page at a time, returns the tenants and the total number matching the filters.
+func ListTenants(options TenantListOptions) ([]tenants.TenantConnectionInformation, int, error) {
+
+	var found []tenants.TenantConnectionInformation
+	var total int
+
+	query := database.Connection.Model(&tenants.TenantConnectionInformation{})
+
+	if options.IncludeDeleted {
+		query = query.Unscoped()
+	}
+
+	if len(options.Search) > 0 {
+		query = query.Where("tenant_sub_domain_identifier LIKE ?", "%"+strings.ToLower(options.Search)+"%")
+	}
+
+	if len(options.Status) > 0 {
+		query = query.Where("status = ?", options.Status)
+	}
+
+	if len(options.Strategy) > 0 {
+		query = query.Where("isolation_strategy = ?", options.Strategy)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Order("id").Offset((options.Page - 1) * options.PageSize).Limit(options.PageSize).Find(&found).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return found, total, nil
+}
+
+// Get a specific tenant from the database, including tenants waiting to be purged.
+func GetTenant(id uint) (*tenants.TenantConnectionInformation, error) {
+
+	var tenant tenants.TenantConnectionInformation
+
+	if err := database.Connection.Unscoped().Where("id = ?", id).First(&tenant).Error; err != nil {
+		return nil, err
+	}
+
+	return &tenant, nil
+}
+
+// Loads a tenant, deleted or not, and locks its row until the transaction ends.
+func lockTenant(tx *gorm.DB, id uint, tenant *tenants.TenantConnectionInformation) error {
+	return tx.Set("gorm:query_option", "FOR UPDATE").Unscoped().Where("id = ?", id).First(tenant).Error
+}
+
+// Get a specific tenant by its sub domain identifier.
+func GetTenantBySubDomain(subDomainIdentifier string) (*tenants.TenantConnectionInformation, error) {
+
+	var tenant tenants.TenantConnectionInformation
+
+	if err := database.Connection.Where("tenant_sub_domain_identifier = ?", subDomainIdentifier).First(&tenant).Error; err != nil {
+		return nil, err
+	}
+
+	return &tenant, nil
+}
+
+// Suspends a tenant, requests for it are rejected until it is resumed.
+func SuspendTenant(id uint, reason string) (string, error) {
+
+	now := time.Now().UTC()
+
+	if err := updateTenant(id, map[string]interface{}{
+		"status":           tenants.StatusSuspended,
+		"suspended_at":     &now,
+		"suspended_reason": reason,
+	}); err != nil {
+		return "An error occurred when trying to suspend the tenant", err
+	}
+
+	return "The tenant has been suspended", nil
+}
+
+// Resumes a suspended tenant.
+func ResumeTenant(id uint) (string, error) {
+
+	if err := updateTenant(id, map[string]interface{}{
+		"status":           tenants.StatusActive,
+		"suspended_at":     nil,
+		"suspended_reason": "",
+	}); err != nil {
+		return "An error occurred when trying to resume the tenant", err
+	}
+
+	return "The tenant has been resumed", nil
+}
+
+// Renames the sub domain of a tenant, the old sub domain keeps redirecting to the tenant.
+func RenameTenant(id uint, subDomainIdentifier string) (string, error) {
+
+	tenant, err := GetTenant(id)
+
+	if err != nil {
+		return "The tenant could not be found", err
+	}
+
+	if tenant.TenantSubDomainIdentifier == subDomainIdentifier {
+		return "The tenant already uses that sub domain identifier", nil
+	}
+
+	if available, err := isSubDomainAvailable(subDomainIdentifier, tenant.ID); err != nil {
+		return "An error occurred when checking the sub domain identifier", err
+	} else if !available {
+		return "The sub domain identifier is already in use", ErrSubDomainInUse
+	}
+
+	err = database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		// Renaming back to an old sub domain replaces its redirect.
+		if err := tx.Unscoped().Where("sub_domain_identifier = ?", subDomainIdentifier).Delete(&tenants.TenantSubDomainRedirect{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&tenants.TenantSubDomainRedirect{TenantId: tenant.ID, SubDomainIdentifier: tenant.TenantSubDomainIdentifier}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(tenant).Update("tenant_sub_domain_identifier", subDomainIdentifier).Error
+	})
+
+	if err != nil {
+		return "An error occurred when trying to rename the tenant", err
 	}
 
-	return "New Tenant has been successfully made", nil
+	return "The tenant has been renamed", nil
+}
+
+// Soft deletes a tenant, its data is physically removed once the grace period has passed.
+// Provisioning which hasn't started yet is cancelled, a tenant a worker is still provisioning can't be deleted.
+func DeleteTenant(id uint) (string, error) {
+
+	var tenant tenants.TenantConnectionInformation
+
+	err := database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		// Queueing provisioning takes the same lock, no job can be queued while the tenant is deleted.
+		if err := lockTenant(tx, id, &tenant); err != nil {
+			return err
+		}
+
+		if err := cancelProvisioningJobs(tx, tenant.ID); err != nil {
+			return err
+		}
+
+		return tx.Delete(&tenant).Error
+	})
+
+	if gorm.IsRecordNotFoundError(err) {
+		return "The tenant could not be found", err
+	}
+
+	if err == ErrTenantBeingProvisioned {
+		return "The tenant is being provisioned, try again once it has finished", err
+	}
+
+	if err != nil {
+		return "An error occurred when trying to delete the tenant", err
+	}
+
+	// Stop serving the tenant straight away.
+	database.TenantConnections.Evict(tenant)
+
+	// Tenants which never finished provisioning never held any data worth keeping.
+	if !tenant.IsReady() {
+		if err := purgeTenant(tenant); err != nil {
+			return "An error occurred when trying to clean up the tenant", err
+		}
+
+		return "The tenant has been permanently removed", nil
+	}
+
+	purgeAt := time.Now().UTC().Add(tenantDeletionGracePeriod())
+
+	return fmt.Sprintf("The tenant has been deleted and will be permanently removed after %s", purgeAt.Format(time.RFC3339)), nil
+}
+
+// Restores a soft deleted tenant which has not been purged yet.
+func RestoreTenant(id uint) (string, error) {
+
+	result := database.Connection.Unscoped().Model(&tenants.TenantConnectionInformation{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+
+	if result.Error != nil {
+		return "An error occurred when trying to restore the tenant", result.Error
+	}
+
+	// Tenants which don't exist, aren't deleted or were already purged can't be restored.
+	if result.RowsAffected == 0 {
+		return "The tenant could not be found", gorm.ErrRecordNotFound
+	}
+
+	return "The tenant has been restored", nil
+}
+
+// Drops the storage of every tenant whose deletion grace period has passed.
+func PurgeDeletedTenants() error {
+
+	var expired []tenants.TenantConnectionInformation
+
+	cutoff := time.Now().UTC().Add(-tenantDeletionGracePeriod())
+
+	if err := database.Connection.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at <= ?", cutoff).Find(&expired).Error; err != nil {
+		return err
+	}
+
+	for _, tenant := range expired {
+		if err := purgeTenant(tenant); err != nil {
+			fmt.Println("An error occurred while purging tenant", tenant.TenantSubDomainIdentifier, err)
+		}
+	}
+
+	return nil
+}
+
+// Drops the tenant storage and removes every record of the tenant from the master database.
+func purgeTenant(tenant tenants.TenantConnectionInformation) error {
+
+	if err := database.DropTenantStorage(tenant); err != nil {
+		return err
+	}
+
+	if err := database.Connection.Unscoped().Where("tenant_id = ?", tenant.ID).Delete(&tenants.TenantSubDomainRedirect{}).Error; err != nil {
+		return err
+	}
+
+	return database.Connection.Unscoped().Delete(&tenant).Error
+}
+
+// Runs PurgeDeletedTenants every interval. Close quit channel to stop.
+func PeriodicTenantPurge(interval time.Duration, quit <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := PurgeDeletedTenants(); err != nil {
+				fmt.Println("An error occurred while purging deleted tenants", err)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+func updateTenant(id uint, values map[string]interface{}) error {
+
+	result := database.Connection.Model(&tenants.TenantConnectionInformation{}).Where("id = ?", id).Updates(values)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// A sub domain is available when no tenant (deleted or not) uses it and no other tenant redirects from it.
+func isSubDomainAvailable(subDomainIdentifier string, tenantId uint) (bool, error) {
+
+	var tenantCount, redirectCount int
+
+	if err := database.Connection.Unscoped().Model(&tenants.TenantConnectionInformation{}).Where("tenant_sub_domain_identifier = ? AND id <> ?", subDomainIdentifier, tenantId).Count(&tenantCount).Error; err != nil {
+		return false, err
+	}
+
+	if err := database.Connection.Model(&tenants.TenantSubDomainRedirect{}).Where("sub_domain_identifier = ? AND tenant_id <> ?", subDomainIdentifier, tenantId).Count(&redirectCount).Error; err != nil {
+		return false, err
+	}
+
+	return tenantCount == 0 && redirectCount == 0, nil
+}
+
+// How long a deleted tenant can still be restored before its data is dropped.
+func tenantDeletionGracePeriod() time.Duration {
+	return helpers.GetEnvDuration("TENANT_DELETION_GRACE_PERIOD", 30*24*time.Hour)
 }
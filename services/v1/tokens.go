@@ -0,0 +1,183 @@
+package v1services
+
+import (
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	models "go-multitenancy-boilerplate/models"
+	tokens "go-multitenancy-boilerplate/tokens"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Returned when a refresh token was issued for another tenant than the one it is used against.
+var ErrTokenTenantMismatch = errors.New("the token was issued for another tenant")
+
+// Returned when a refresh token which was already exchanged is presented again, the login is revoked
+// since either the client or whoever copied the token is replaying it.
+var ErrRefreshTokenReused = errors.New("the refresh token was already used")
+
+// Issues tokens for a login of a tenant user, the refresh token becomes the login's current one.
+func IssueTenantTokens(userId uint, sessionId uint, tenantId uint, tenantIdentifier string, connection *gorm.DB) (*tokens.Pair, error) {
+
+	pair, err := issueTenantTokens(userId, sessionId, tenantId, tenantIdentifier, connection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = connection.Model(&models.UserSession{}).Where("id = ?", sessionId).UpdateColumn("refresh_token_id", pair.RefreshTokenId).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// The user is looked up so the role is current.
+func issueTenantTokens(userId uint, sessionId uint, tenantId uint, tenantIdentifier string, connection *gorm.DB) (*tokens.Pair, error) {
+
+	var user models.User
+
+	if err := connection.Select("id, account_type").Where("id = ?", userId).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	roles, err := GetUserRoles(user.ID, connection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+
+	// Roles are informational, permissions are always checked against the tenant database.
+	return tokens.Issue(tokens.Claims{
+		Audience:         tokens.AudienceTenant,
+		UserId:           user.ID,
+		SessionId:        sessionId,
+		TenantId:         tenantId,
+		TenantIdentifier: tenantIdentifier,
+		Role:             user.AccountType,
+		Roles:            names,
+	})
+}
+
+// Exchanges a tenant refresh token for new tokens, as long as the user still exists in the tenant and the login wasn't revoked or timed out.
+// Every refresh token is exchanged once, the new one replaces it.
+func RefreshTenantTokens(refreshToken string, tenantId uint, tenantIdentifier string, connection *gorm.DB) (*tokens.Pair, error) {
+
+	claims, err := tokens.Verify(refreshToken, tokens.TypeRefresh, tokens.AudienceTenant)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TenantId != tenantId {
+		return nil, ErrTokenTenantMismatch
+	}
+
+	if _, err := CheckUserSession(tenantId, claims.UserId, claims.SessionId, time.Unix(claims.IssuedAt, 0), connection); err != nil {
+		return nil, err
+	}
+
+	pair, err := issueTenantTokens(claims.UserId, claims.SessionId, tenantId, tenantIdentifier, connection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rotateRefreshToken(connection.Model(&models.UserSession{}), claims.SessionId, claims.Id, pair); err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// Issues tokens for a login of a master user, the refresh token becomes the login's current one.
+func IssueMasterTokens(userId uint, sessionId uint) (*tokens.Pair, error) {
+
+	pair, err := issueMasterTokens(userId, sessionId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.Connection.Model(&models.MasterUserSession{}).Where("id = ?", sessionId).UpdateColumn("refresh_token_id", pair.RefreshTokenId).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// The user is looked up so the role is current.
+func issueMasterTokens(userId uint, sessionId uint) (*tokens.Pair, error) {
+
+	var user MasterUser
+
+	if err := database.Connection.Select("id, account_type").Where("id = ?", userId).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return tokens.Issue(tokens.Claims{
+		Audience:  tokens.AudienceMaster,
+		UserId:    user.ID,
+		SessionId: sessionId,
+		Role:      user.AccountType,
+	})
+}
+
+// Exchanges a master refresh token for new tokens, as long as the master user still exists and the login wasn't revoked or timed out.
+// Every refresh token is exchanged once, the new one replaces it.
+func RefreshMasterTokens(refreshToken string) (*tokens.Pair, error) {
+
+	claims, err := tokens.Verify(refreshToken, tokens.TypeRefresh, tokens.AudienceMaster)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := CheckMasterUserSession(claims.UserId, claims.SessionId, time.Unix(claims.IssuedAt, 0)); err != nil {
+		return nil, err
+	}
+
+	pair, err := issueMasterTokens(claims.UserId, claims.SessionId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rotateRefreshToken(database.Connection.Model(&models.MasterUserSession{}), claims.SessionId, claims.Id, pair); err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// Makes the pair's refresh token the current one of the login, as long as the exchanged one still is.
+// Otherwise the exchanged token was used before, and the login is revoked with every token issued for it.
+func rotateRefreshToken(sessions *gorm.DB, sessionId uint, exchanged string, pair *tokens.Pair) error {
+
+	result := sessions.Where("id = ? AND refresh_token_id = ? AND revoked_at IS NULL", sessionId, exchanged).UpdateColumn("refresh_token_id", pair.RefreshTokenId)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	if err := sessions.Where("id = ? AND revoked_at IS NULL", sessionId).UpdateColumn("revoked_at", time.Now().UTC()).Error; err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
@@ -0,0 +1,49 @@
+package v1services
+
+import (
+	"strings"
+	"testing"
+
+	databasetest "go-multitenancy-boilerplate/database/databasetest"
+	models "go-multitenancy-boilerplate/models"
+	tokens "go-multitenancy-boilerplate/tokens"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+
+	db, recorder := databasetest.Open()
+	defer db.Close()
+
+	pair := &tokens.Pair{RefreshTokenId: "second"}
+
+	if err := rotateRefreshToken(db.Model(&models.UserSession{}), 4, "first", pair); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := recorder.Matching("UPDATE")
+
+	if len(updates) != 1 || !strings.Contains(updates[0].Query, "refresh_token_id = $") || updates[0].Args[0] != "second" || updates[0].Args[2] != "first" {
+		t.Fatalf("expected the current refresh token to be replaced, got %v", updates)
+	}
+}
+
+func TestRotateRefreshTokenRevokesLoginOnReuse(t *testing.T) {
+
+	db, recorder := databasetest.Open()
+	defer db.Close()
+
+	// The exchanged token isn't the login's current one any more.
+	recorder.OnTimes("refresh_token_id = $", 1, databasetest.Response{RowsAffected: 0})
+
+	err := rotateRefreshToken(db.Model(&models.UserSession{}), 4, "first", &tokens.Pair{RefreshTokenId: "third"})
+
+	if err != ErrRefreshTokenReused {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+
+	revoked := recorder.Matching("revoked_at\" = $")
+
+	if len(revoked) != 1 || revoked[0].Args[1] != int64(4) {
+		t.Fatalf("expected the login to be revoked, got %v", recorder.Statements())
+	}
+}
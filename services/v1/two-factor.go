@@ -0,0 +1,619 @@
+package v1services
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
+	models "go-multitenancy-boilerplate/models"
+	secrets "go-multitenancy-boilerplate/secrets"
+	totp "go-multitenancy-boilerplate/totp"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Audited two-factor actions, prefixed with "auth." for tenant users and "master_auth." for master users.
+const (
+	AuditTwoFactorEnabled        = "two_factor_enabled"
+	AuditTwoFactorDisabled       = "two_factor_disabled"
+	AuditRecoveryCodesRegenerate = "recovery_codes_regenerated"
+	AuditTwoFactorLogin          = "two_factor_login"
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotStarted  = errors.New("two-factor enrolment has not been started")
+	ErrTwoFactorRequired    = errors.New("two-factor authentication is required for this account")
+	ErrInvalidTwoFactorCode = errors.New("the two-factor code is invalid")
+)
+
+// Number of recovery codes handed out, each can be used once instead of a code.
+const recoveryCodeCount = 10
+
+// Wrong codes allowed for a single login challenge, after which the password has to be entered again.
+const twoFactorChallengeAttempts = 5
+
+// The second step of a login, returned once the password was correct.
+type TwoFactorChallenge struct {
+	Token             string
+	EnrolmentRequired bool // The user has to set up two-factor authentication to log in.
+}
+
+// A freshly generated secret, shown once so it can be added to an authenticator app.
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// Tenant users
+//
+
+// Starts enrolment for a tenant user, a new secret replaces any unconfirmed one.
+func BeginTwoFactorSetup(actor Actor, userId uint, connection *gorm.DB) (*TwoFactorSetup, error) {
+	return tenantTwoFactor(actor, connection).begin(userId)
+}
+
+// Enables two-factor authentication once a code from the new secret is confirmed, returns the recovery codes.
+func ConfirmTwoFactorSetup(actor Actor, userId uint, code string, connection *gorm.DB) ([]string, error) {
+	return tenantTwoFactor(actor, connection).confirm(actor, userId, code)
+}
+
+// Disables two-factor authentication for a tenant user after checking a code or recovery code.
+func DisableTwoFactor(actor Actor, userId uint, code string, connection *gorm.DB) error {
+	return tenantTwoFactor(actor, connection).disable(actor, userId, code)
+}
+
+// Replaces the recovery codes of a tenant user after checking a code or recovery code.
+func RegenerateRecoveryCodes(actor Actor, userId uint, code string, connection *gorm.DB) ([]string, error) {
+	return tenantTwoFactor(actor, connection).regenerate(actor, userId, code)
+}
+
+// Decides whether a tenant user who entered the right password needs a second step, nil when they don't.
+func StartTwoFactorLogin(actor Actor, userId uint, connection *gorm.DB) (*TwoFactorChallenge, error) {
+	return tenantTwoFactor(actor, connection).challenge(userId)
+}
+
+// Starts enrolment for a tenant user who has to set up two-factor authentication before they can log in.
+func BeginTwoFactorLoginSetup(actor Actor, challenge string, connection *gorm.DB) (*TwoFactorSetup, error) {
+	return tenantTwoFactor(actor, connection).beginFromChallenge(challenge)
+}
+
+// The email address of the tenant user a login challenge was issued to, their failed codes are throttled like failed passwords.
+func TwoFactorLoginEmail(actor Actor, challenge string, connection *gorm.DB) (string, error) {
+	return tenantTwoFactor(actor, connection).email(challenge)
+}
+
+// Completes a login with a code or recovery code, returns the user id and, for users who just enrolled, their recovery codes.
+func CompleteTwoFactorLogin(actor Actor, challenge string, code string, connection *gorm.DB) (uint, []string, error) {
+	return tenantTwoFactor(actor, connection).complete(actor, challenge, code)
+}
+
+// Master users
+//
+
+// Starts enrolment for a master user, a new secret replaces any unconfirmed one.
+func BeginMasterTwoFactorSetup(actor Actor, userId uint) (*TwoFactorSetup, error) {
+	return masterTwoFactor().begin(userId)
+}
+
+// Enables two-factor authentication once a code from the new secret is confirmed, returns the recovery codes.
+func ConfirmMasterTwoFactorSetup(actor Actor, userId uint, code string) ([]string, error) {
+	return masterTwoFactor().confirm(actor, userId, code)
+}
+
+// Disables two-factor authentication for a master user after checking a code or recovery code.
+func DisableMasterTwoFactor(actor Actor, userId uint, code string) error {
+	return masterTwoFactor().disable(actor, userId, code)
+}
+
+// Replaces the recovery codes of a master user after checking a code or recovery code.
+func RegenerateMasterRecoveryCodes(actor Actor, userId uint, code string) ([]string, error) {
+	return masterTwoFactor().regenerate(actor, userId, code)
+}
+
+// Decides whether a master user who entered the right password needs a second step, nil when they don't.
+func StartMasterTwoFactorLogin(actor Actor, userId uint) (*TwoFactorChallenge, error) {
+	return masterTwoFactor().challenge(userId)
+}
+
+// Starts enrolment for a master user who has to set up two-factor authentication before they can log in.
+func BeginMasterTwoFactorLoginSetup(actor Actor, challenge string) (*TwoFactorSetup, error) {
+	return masterTwoFactor().beginFromChallenge(challenge)
+}
+
+// The email address of the master user a login challenge was issued to, their failed codes are throttled like failed passwords.
+func MasterTwoFactorLoginEmail(challenge string) (string, error) {
+	return masterTwoFactor().email(challenge)
+}
+
+// Completes a master login with a code or recovery code, returns the user id and, for users who just enrolled, their recovery codes.
+func CompleteMasterTwoFactorLogin(actor Actor, challenge string, code string) (uint, []string, error) {
+	return masterTwoFactor().complete(actor, challenge, code)
+}
+
+// Where the two-factor state of one kind of user is kept, tenant users and master users share the logic.
+type twoFactorAccounts struct {
+	connection   *gorm.DB
+	user         func() interface{} // A model of the users table.
+	token        func() interface{} // A model of the single-use token table.
+	recoveryCode func(userId uint, hash string) interface{}
+	userColumn   string // Links tokens and recovery codes to their user.
+	issuer       string // Shown by authenticator apps.
+	auditPrefix  string
+	issueToken   func(userId uint, purpose string, ttl time.Duration) (string, error)
+	record       func(actor Actor, action string, userId uint, cause error)
+	required     func(userId uint) (bool, error)
+}
+
+func tenantTwoFactor(actor Actor, connection *gorm.DB) twoFactorAccounts {
+	return twoFactorAccounts{
+		connection: connection,
+		user:       func() interface{} { return &models.User{} },
+		token:      func() interface{} { return &models.UserToken{} },
+		recoveryCode: func(userId uint, hash string) interface{} {
+			return &models.RecoveryCode{UserId: userId, CodeHash: hash}
+		},
+		userColumn:  "user_id",
+		issuer:      twoFactorIssuer() + " (" + actor.TenantIdentifier + ")",
+		auditPrefix: "auth.",
+		issueToken: func(userId uint, purpose string, ttl time.Duration) (string, error) {
+			return issueUserToken(userId, purpose, ttl, connection)
+		},
+		record: func(actor Actor, action string, userId uint, cause error) {
+			recordTenantEvent(connection, actor, action, "user", userId, nil, nil, cause)
+		},
+		required: func(userId uint) (bool, error) {
+			return tenantRequiresTwoFactor(actor.TenantId, userId, connection)
+		},
+	}
+}
+
+func masterTwoFactor() twoFactorAccounts {
+	return twoFactorAccounts{
+		connection: database.Connection,
+		user:       func() interface{} { return &MasterUser{} },
+		token:      func() interface{} { return &models.MasterUserToken{} },
+		recoveryCode: func(userId uint, hash string) interface{} {
+			return &models.MasterRecoveryCode{MasterUserId: userId, CodeHash: hash}
+		},
+		userColumn:  "master_user_id",
+		issuer:      twoFactorIssuer(),
+		auditPrefix: "master_auth.",
+		issueToken:  issueMasterUserToken,
+		record: func(actor Actor, action string, userId uint, cause error) {
+			recordMasterEvent(actor, 0, action, "master_user", userId, nil, nil, cause)
+		},
+		required: func(userId uint) (bool, error) {
+			return helpers.GetEnvBool("MASTER_REQUIRE_TWO_FACTOR", false), nil
+		},
+	}
+}
+
+// The two-factor columns of a user.
+type twoFactorState struct {
+	ID               uint
+	Email            string
+	TwoFactorSecret  string
+	TwoFactorEnabled bool
+	TwoFactorStep    int64
+}
+
+// A login challenge token, locked for the transaction completing it.
+type twoFactorChallengeRow struct {
+	ID        uint
+	UserId    uint
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	Attempts  int
+}
+
+func (a twoFactorAccounts) begin(userId uint) (*TwoFactorSetup, error) {
+
+	var setup *TwoFactorSetup
+
+	err := a.connection.Transaction(func(tx *gorm.DB) error {
+
+		state, err := a.state(userId, tx)
+
+		if err != nil {
+			return err
+		}
+
+		if state.TwoFactorEnabled {
+			return ErrTwoFactorEnabled
+		}
+
+		secret, err := totp.GenerateSecret()
+
+		if err != nil {
+			return err
+		}
+
+		// Stored encrypted, someone reading the database can't generate codes with it.
+		encrypted, err := secrets.Encrypt(secret)
+
+		if err != nil {
+			return err
+		}
+
+		setup = &TwoFactorSetup{Secret: secret, URI: totp.URI(a.issuer, state.Email, secret)}
+
+		return tx.Model(a.user()).Where("id = ?", userId).UpdateColumn("two_factor_secret", encrypted).Error
+	})
+
+	return setup, err
+}
+
+func (a twoFactorAccounts) confirm(actor Actor, userId uint, code string) ([]string, error) {
+
+	var codes []string
+
+	err := a.connection.Transaction(func(tx *gorm.DB) error {
+
+		state, err := a.state(userId, tx)
+
+		if err != nil {
+			return err
+		}
+
+		codes, err = a.enable(state, code, tx)
+
+		return err
+	})
+
+	actor.Id = userId
+	a.record(actor, a.auditPrefix+AuditTwoFactorEnabled, userId, err)
+
+	return codes, err
+}
+
+func (a twoFactorAccounts) disable(actor Actor, userId uint, code string) error {
+
+	err := a.connection.Transaction(func(tx *gorm.DB) error {
+
+		state, err := a.state(userId, tx)
+
+		if err != nil {
+			return err
+		}
+
+		if !state.TwoFactorEnabled {
+			return ErrTwoFactorNotEnabled
+		}
+
+		required, err := a.required(userId)
+
+		if err != nil {
+			return err
+		}
+
+		if required {
+			return ErrTwoFactorRequired
+		}
+
+		if err := a.verify(state, code, tx); err != nil {
+			return err
+		}
+
+		if err := tx.Where(a.userColumn+" = ?", userId).Delete(a.recoveryCode(0, "")).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(a.user()).Where("id = ?", userId).UpdateColumns(map[string]interface{}{
+			"two_factor_secret":  "",
+			"two_factor_enabled": false,
+			"two_factor_step":    0,
+		}).Error
+	})
+
+	a.record(actor, a.auditPrefix+AuditTwoFactorDisabled, userId, err)
+
+	return err
+}
+
+func (a twoFactorAccounts) regenerate(actor Actor, userId uint, code string) ([]string, error) {
+
+	var codes []string
+
+	err := a.connection.Transaction(func(tx *gorm.DB) error {
+
+		state, err := a.state(userId, tx)
+
+		if err != nil {
+			return err
+		}
+
+		if !state.TwoFactorEnabled {
+			return ErrTwoFactorNotEnabled
+		}
+
+		if err := a.verify(state, code, tx); err != nil {
+			return err
+		}
+
+		codes, err = a.replaceRecoveryCodes(userId, tx)
+
+		return err
+	})
+
+	a.record(actor, a.auditPrefix+AuditRecoveryCodesRegenerate, userId, err)
+
+	return codes, err
+}
+
+func (a twoFactorAccounts) challenge(userId uint) (*TwoFactorChallenge, error) {
+
+	state, err := a.state(userId, a.connection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	required := false
+
+	if !state.TwoFactorEnabled {
+		if required, err = a.required(userId); err != nil {
+			return nil, err
+		}
+	}
+
+	if !state.TwoFactorEnabled && !required {
+		return nil, nil
+	}
+
+	token, err := a.issueToken(userId, models.TokenTwoFactorLogin, twoFactorChallengeTTL())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorChallenge{Token: token, EnrolmentRequired: !state.TwoFactorEnabled}, nil
+}
+
+func (a twoFactorAccounts) beginFromChallenge(challenge string) (*TwoFactorSetup, error) {
+
+	row, err := a.lockChallenge(challenge, a.connection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a.begin(row.UserId)
+}
+
+func (a twoFactorAccounts) email(challenge string) (string, error) {
+
+	row, err := a.lockChallenge(challenge, a.connection)
+
+	if err != nil {
+		return "", err
+	}
+
+	state, err := a.state(row.UserId, a.connection)
+
+	if err != nil {
+		return "", err
+	}
+
+	return state.Email, nil
+}
+
+func (a twoFactorAccounts) complete(actor Actor, challenge string, code string) (uint, []string, error) {
+
+	var userId uint
+	var codes []string
+	var failed error
+
+	err := a.connection.Transaction(func(tx *gorm.DB) error {
+
+		row, err := a.lockChallenge(challenge, tx)
+
+		if err != nil {
+			return err
+		}
+
+		userId = row.UserId
+
+		state, err := a.state(row.UserId, tx)
+
+		if err != nil {
+			return err
+		}
+
+		if state.TwoFactorEnabled {
+			failed = a.verify(state, code, tx)
+		} else {
+			codes, failed = a.enable(state, code, tx)
+		}
+
+		// Wrong codes are counted rather than rolled back, the challenge is spent once they run out.
+		if failed != nil {
+
+			updates := map[string]interface{}{"attempts": row.Attempts + 1}
+
+			if row.Attempts+1 >= twoFactorChallengeAttempts {
+				updates["used_at"] = time.Now().UTC()
+			}
+
+			return tx.Model(a.token()).Where("id = ?", row.ID).UpdateColumns(updates).Error
+		}
+
+		return tx.Model(a.token()).Where("id = ?", row.ID).UpdateColumn("used_at", time.Now().UTC()).Error
+	})
+
+	if err == nil {
+		err = failed
+	}
+
+	actor.Id = userId
+	a.record(actor, a.auditPrefix+AuditTwoFactorLogin, userId, err)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return userId, codes, nil
+}
+
+// Loads the two-factor columns of a user, locking the row when run inside a transaction.
+func (a twoFactorAccounts) state(userId uint, tx *gorm.DB) (*twoFactorState, error) {
+
+	var state twoFactorState
+
+	err := tx.Model(a.user()).
+		Set("gorm:query_option", "FOR UPDATE").
+		Select("id, email, two_factor_secret, two_factor_enabled, two_factor_step").
+		Where("id = ?", userId).
+		Scan(&state).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	if state.TwoFactorSecret, err = secrets.Decrypt(state.TwoFactorSecret); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// Turns on two-factor authentication when the code matches the unconfirmed secret.
+func (a twoFactorAccounts) enable(state *twoFactorState, code string, tx *gorm.DB) ([]string, error) {
+
+	if state.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	if len(state.TwoFactorSecret) == 0 {
+		return nil, ErrTwoFactorNotStarted
+	}
+
+	step, ok := totp.Validate(state.TwoFactorSecret, code, time.Now(), state.TwoFactorStep)
+
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	err := tx.Model(a.user()).Where("id = ?", state.ID).UpdateColumns(map[string]interface{}{
+		"two_factor_enabled": true,
+		"two_factor_step":    step,
+	}).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a.replaceRecoveryCodes(state.ID, tx)
+}
+
+// Checks a code from the authenticator app or an unused recovery code, either is used up.
+func (a twoFactorAccounts) verify(state *twoFactorState, code string, tx *gorm.DB) error {
+
+	if step, ok := totp.Validate(state.TwoFactorSecret, code, time.Now(), state.TwoFactorStep); ok {
+		return tx.Model(a.user()).Where("id = ?", state.ID).UpdateColumn("two_factor_step", step).Error
+	}
+
+	hash := helpers.HashToken(totp.NormalizeRecoveryCode(code))
+
+	used := tx.Model(a.recoveryCode(0, "")).
+		Where(a.userColumn+" = ? AND code_hash = ? AND used_at IS NULL", state.ID, hash).
+		UpdateColumn("used_at", time.Now().UTC())
+
+	if used.Error != nil {
+		return used.Error
+	}
+
+	if used.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+func (a twoFactorAccounts) replaceRecoveryCodes(userId uint, tx *gorm.DB) ([]string, error) {
+
+	if err := tx.Where(a.userColumn+" = ?", userId).Delete(a.recoveryCode(0, "")).Error; err != nil {
+		return nil, err
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		if err := tx.Create(a.recoveryCode(userId, helpers.HashToken(totp.NormalizeRecoveryCode(code)))).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// Finds an unspent login challenge, locking it when run inside a transaction.
+func (a twoFactorAccounts) lockChallenge(challenge string, tx *gorm.DB) (*twoFactorChallengeRow, error) {
+
+	var row twoFactorChallengeRow
+
+	err := tx.Model(a.token()).
+		Set("gorm:query_option", "FOR UPDATE").
+		Select("id, "+a.userColumn+" AS user_id, expires_at, used_at, attempts").
+		Where("token_hash = ? AND purpose = ?", helpers.HashToken(challenge), models.TokenTwoFactorLogin).
+		Scan(&row).Error
+
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrInvalidToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if row.UsedAt != nil || time.Now().UTC().After(row.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	return &row, nil
+}
+
+// Tenants can require owners and admins to use two-factor authentication.
+func tenantRequiresTwoFactor(tenantId uint, userId uint, connection *gorm.DB) (bool, error) {
+
+	settings, err := GetTenantSettings(tenantId)
+
+	if err != nil || !settings.RequireTwoFactorForAdmins {
+		return false, err
+	}
+
+	roles, err := GetUserRoles(userId, connection)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		if role.System && (role.Name == models.RoleOwner || role.Name == models.RoleAdmin) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func twoFactorIssuer() string {
+
+	if issuer := strings.TrimSpace(os.Getenv("TWO_FACTOR_ISSUER")); len(issuer) > 0 {
+		return issuer
+	}
+
+	return "go-multitenancy-boilerplate"
+}
+
+func twoFactorChallengeTTL() time.Duration {
+	return helpers.GetEnvDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute)
+}
@@ -0,0 +1,134 @@
+package v1services
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	database "go-multitenancy-boilerplate/database"
+	helpers "go-multitenancy-boilerplate/helpers"
+	models "go-multitenancy-boilerplate/models"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Returned for tokens that don't exist, have expired or have already been used.
+var ErrInvalidToken = errors.New("the token is invalid or has expired")
+
+// Creates a single-use token for a tenant user, replacing any unused token with the same purpose.
+func issueUserToken(userId uint, purpose string, ttl time.Duration, connection *gorm.DB) (string, error) {
+
+	token, err := helpers.GenerateToken(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userId, purpose).Delete(&models.UserToken{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserToken{
+			UserId:    userId,
+			Purpose:   purpose,
+			TokenHash: helpers.HashToken(token),
+			ExpiresAt: time.Now().UTC().Add(ttl),
+		}).Error
+	})
+
+	return token, err
+}
+
+// Marks a tenant user token as used, run inside the transaction that acts on it.
+func consumeUserToken(token string, purpose string, tx *gorm.DB) (*models.UserToken, error) {
+
+	var found models.UserToken
+
+	err := tx.Set("gorm:query_option", "FOR UPDATE").
+		Where("token_hash = ? AND purpose = ?", helpers.HashToken(token), purpose).
+		First(&found).Error
+
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrInvalidToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	if found.UsedAt != nil || now.After(found.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	if err := tx.Model(&found).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	return &found, nil
+}
+
+// Creates a single-use token for a master user, replacing any unused token with the same purpose.
+func issueMasterUserToken(userId uint, purpose string, ttl time.Duration) (string, error) {
+
+	token, err := helpers.GenerateToken(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = database.Connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Where("master_user_id = ? AND purpose = ? AND used_at IS NULL", userId, purpose).Delete(&models.MasterUserToken{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.MasterUserToken{
+			MasterUserId: userId,
+			Purpose:      purpose,
+			TokenHash:    helpers.HashToken(token),
+			ExpiresAt:    time.Now().UTC().Add(ttl),
+		}).Error
+	})
+
+	return token, err
+}
+
+// Marks a master user token as used, run inside the transaction that acts on it.
+func consumeMasterUserToken(token string, purpose string, tx *gorm.DB) (*models.MasterUserToken, error) {
+
+	var found models.MasterUserToken
+
+	err := tx.Set("gorm:query_option", "FOR UPDATE").
+		Where("token_hash = ? AND purpose = ?", helpers.HashToken(token), purpose).
+		First(&found).Error
+
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrInvalidToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	if found.UsedAt != nil || now.After(found.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	if err := tx.Model(&found).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	return &found, nil
+}
+
+// Fills the {tenant} and {token} placeholders of a link template from the environment.
+func tokenLink(templateKey string, tenantIdentifier string, token string) string {
+	return strings.NewReplacer("{tenant}", tenantIdentifier, "{token}", token).Replace(strings.TrimSpace(os.Getenv(templateKey)))
+}
@@ -2,15 +2,32 @@ package v1services
 
 import (
 	"errors"
-	helpers "go-multitenancy-boilerplate/helpers"
+	"time"
+
 	"go-multitenancy-boilerplate/models"
+	passwords "go-multitenancy-boilerplate/passwords"
 
 	"github.com/jinzhu/gorm"
 )
 
 // Creates a standard user in the database.
 // Returns the inserted user id
-func CreateUser(email string, password string, accountType int, connection *gorm.DB) (uint, error) {
+func CreateUser(actor Actor, email string, password string, accountType int, connection *gorm.DB) (uint, error) {
+
+	policy, err := GetTenantPasswordPolicy(actor.TenantId)
+
+	var id uint
+
+	if err == nil {
+		id, err = createUser(email, password, accountType, policy, connection)
+	}
+
+	recordTenantEvent(connection, actor, AuditUserCreate, "user", id, nil, &models.User{Email: email, AccountType: accountType}, err)
+
+	return id, err
+}
+
+func createUser(email string, password string, accountType int, policy passwords.Policy, connection *gorm.DB) (uint, error) {
 
 	// Slice for found users.
 	var foundUsers []models.User
@@ -24,18 +41,37 @@ func CreateUser(email string, password string, accountType int, connection *gorm
 		return 0, errors.New("A user with that email address already exists")
 	}
 
+	if err := policy.Validate(password); err != nil {
+		return 0, err
+	}
+
 	// Hash the password so it's not clear text.
 	// Run outside of the if statements so we can grab the result outside of local scope.
-	hash, hashErr := helpers.HashPassword([]byte(password))
+	hash, hashErr := passwords.Hash(password)
 
 	if hashErr != nil {
 		return 0, hashErr
 	}
 
-	var user = models.User{Email: email, Password: hash, AccountType: accountType}
+	now := time.Now().UTC()
+
+	var user = models.User{Email: email, Password: hash, AccountType: accountType, PasswordChangedAt: &now}
+
+	// Run create, the user gets their first role in the same transaction.
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		if err := recordPasswordHistory(user.ID, hash, tx); err != nil {
+			return err
+		}
 
-	// Run create
-	if err := connection.Create(&user).Error; err != nil {
+		return assignInitialRole(user.ID, tx)
+	})
+
+	if err != nil {
 		// Error Handler
 		return 0, err
 	}
@@ -44,42 +80,144 @@ func CreateUser(email string, password string, accountType int, connection *gorm
 	return user.ID, nil
 }
 
+// Returned on login when the tenant requires a verified email address and the user's isn't.
+var ErrEmailNotVerified = errors.New("the email address has not been verified")
+
 // Logs a user in.
-func LoginUser(email string, password string, connection *gorm.DB) (uint, bool, error) {
+func LoginUser(actor Actor, email string, password string, connection *gorm.DB) (uint, bool, error) {
+
+	id, ok, err := loginUser(actor.TenantId, email, password, connection)
+
+	if actor.Id == 0 {
+		actor.Id = id
+		actor.Email = email
+	}
+
+	recordTenantEvent(connection, actor, AuditLogin, "user", id, nil, nil, err)
+
+	return id, ok, err
+}
+
+func loginUser(tenantId uint, email string, password string, connection *gorm.DB) (uint, bool, error) {
+
+	// Tenants using single sign-on only may turn passwords off entirely.
+	if disabled, err := PasswordLoginDisabled(tenantId); err != nil || disabled {
+		if err == nil {
+			err = ErrPasswordLoginDisabled
+		}
+		return 0, false, err
+	}
 
 	// Create local state user
 	var user models.User
 
 	// Find the user by email, return error if input is malformed.
 	if err := connection.First(&user, "email = ?", email).Error; err != nil {
+		// Unknown addresses fail like wrong passwords, and take as long, so logins don't tell who has an account.
+		if gorm.IsRecordNotFoundError(err) {
+			passwords.VerifyUnknown(password)
+			return 0, false, ErrInvalidCredentials
+		}
 		return 0, false, err
 	}
 
 	// Now we've found a user send off the hashed password and sent password for decoding.
-	if result := helpers.CheckPasswordHash(password, user.Password); result != true {
+	if result := passwords.Verify(password, user.Password); result != true {
 		// Passwords do not match
-		return 0, false, errors.New("passwords did not match")
+		return 0, false, ErrInvalidCredentials
+	}
+
+	rehashUserPassword(user.ID, password, user.Password, connection)
+
+	if !user.EmailVerified {
+
+		settings, err := GetTenantSettings(tenantId)
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		if settings.RequireEmailVerification {
+			return user.ID, false, ErrEmailNotVerified
+		}
+	}
+
+	policy, err := GetTenantPasswordPolicy(tenantId)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	if policy.Expired(user.PasswordChangedAt, time.Now().UTC()) {
+		return user.ID, false, expiredUserPassword(user.ID, connection)
 	}
 
 	// Checks have bee passed return true
 	return user.ID, true, nil
 }
 
-// Updates a user in the database.
-// A separate method is called when updating a company id
-func UpdateUser(id uint, email string, accountType int, firstName string, lastName string, phoneNumber string, recoveryEmail string, connection *gorm.DB) (string, error) {
+// Updates a user in the database, empty fields are left unchanged.
+// A nil account type keeps the current one, users updating themselves never change it.
+func UpdateUser(actor Actor, id uint, email string, accountType *int, firstName string, lastName string, phoneNumber string, recoveryEmail string, connection *gorm.DB) (string, error) {
 
-	var user models.User
+	before := findAuditedUser(id, connection)
+
+	outcome, err := updateUser(actor, id, email, accountType, firstName, lastName, phoneNumber, recoveryEmail, connection)
+
+	after := findAuditedUser(id, connection)
+
+	recordTenantEvent(connection, actor, AuditUserUpdate, "user", id, before, after, err)
+
+	// A changed email address has to be verified again.
+	if err == nil && before != nil && after != nil && before.Email != after.Email {
+		if err := SendEmailVerification(actor, id, connection); err != nil {
+			return "User information updated, but the verification email could not be sent", nil
+		}
+	}
+
+	return outcome, err
+}
+
+func updateUser(actor Actor, id uint, email string, accountType *int, firstName string, lastName string, phoneNumber string, recoveryEmail string, connection *gorm.DB) (string, error) {
 
-	// Update the basic user information, anything that was set as nil will not be changed.
-	err := connection.Model(&user).Where("id = ?", id).Updates(models.User{
-		Email:         email,
-		AccountType:   accountType,
-		FirstName:     firstName,
-		LastName:      lastName,
-		PhoneNumber:   phoneNumber,
-		RecoveryEmail: recoveryEmail,
-	}).Error
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		var user models.User
+
+		if err := tx.Where("id = ?", id).First(&user).Error; err != nil {
+			return err
+		}
+
+		// Changing someone's email address or recovery email is enough to take over their account.
+		if err := ensureCanManageUser(actor, user.ID, tx); err != nil {
+			return err
+		}
+
+		// Update the basic user information, anything that was set as nil will not be changed.
+		err := tx.Model(&user).Updates(models.User{
+			Email:         email,
+			FirstName:     firstName,
+			LastName:      lastName,
+			PhoneNumber:   phoneNumber,
+			RecoveryEmail: recoveryEmail,
+		}).Error
+
+		// Set on its own, Updates skips zero values so an account type could never go back to 0.
+		if err == nil && accountType != nil && *accountType != user.AccountType {
+
+			err = tx.Model(&user).Update("account_type", *accountType).Error
+
+			if err == nil {
+				err = markUserPrivilegesChanged(tx.Where("id = ?", user.ID))
+			}
+		}
+
+		if err != nil || len(email) == 0 || email == user.Email {
+			return err
+		}
+
+		return unverifyEmail(user.ID, tx)
+	})
 
 	if err != nil {
 		return "", err
@@ -89,22 +227,71 @@ func UpdateUser(id uint, email string, accountType int, firstName string, lastNa
 }
 
 // Deletes a user in the database.
-func DeleteUser(id uint, connection *gorm.DB) (string, error) {
+func DeleteUser(actor Actor, id uint, connection *gorm.DB) (string, error) {
+
+	before := findAuditedUser(id, connection)
+
+	outcome, err := deleteUser(actor, id, connection)
+
+	recordTenantEvent(connection, actor, AuditUserDelete, "user", id, before, nil, err)
+
+	return outcome, err
+}
+
+func deleteUser(actor Actor, id uint, connection *gorm.DB) (string, error) {
 	var user models.User
 
-	if err := connection.Where("id = ?", id).Delete(&user).Error; err != nil {
+	err := connection.Transaction(func(tx *gorm.DB) error {
+
+		if err := ensureCanManageUser(actor, id, tx); err != nil {
+			return err
+		}
+
+		var roles []models.UserRole
+
+		if err := tx.Where("user_id = ?", id).Find(&roles).Error; err != nil {
+			return err
+		}
+
+		// The last owner can't be deleted, otherwise nobody could manage the tenant.
+		for _, role := range roles {
+			if err := ensureNotLastOwner(id, role.RoleId, tx); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", id).Delete(&user).Error
+	})
+
+	if err != nil {
 		return "An error occurred when trying to delete the user", err
 	}
 
 	return "The user has been successfully deleted", nil
 }
 
+// Loads a user as it is before or after an audited change, nil when it can't be found.
+func findAuditedUser(id uint, connection *gorm.DB) *models.User {
+
+	var user models.User
+
+	if err := connection.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil
+	}
+
+	return &user
+}
+
 // Get a specific user from the database.
 func GetUser(id uint, connection *gorm.DB) (*models.User, error) {
 
 	var user models.User
 
-	if err := connection.Select("id, created_at, updated_at, deleted_at, email, account_type, company_id, first_name, last_name").Where("id = ? ", id).First(&user).Error; err != nil {
+	if err := connection.Select("id, created_at, updated_at, deleted_at, email, account_type, first_name, last_name, phone_number, recovery_email, email_verified, email_verified_at, two_factor_enabled, password_changed_at").Where("id = ? ", id).First(&user).Error; err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,57 @@
+package throttle
+
+import (
+	"time"
+
+	models "go-multitenancy-boilerplate/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Keeps failed attempts in the master database, shared by every server instance.
+type DatabaseStore struct {
+	connection *gorm.DB
+}
+
+func NewDatabaseStore(connection *gorm.DB) *DatabaseStore {
+	return &DatabaseStore{connection: connection}
+}
+
+func (s *DatabaseStore) Get(key string) (Record, error) {
+
+	var row models.LoginThrottle
+
+	err := s.connection.Where(`"key" = ?`, key).First(&row).Error
+
+	if gorm.IsRecordNotFoundError(err) {
+		return Record{}, nil
+	}
+
+	if err != nil {
+		return Record{}, err
+	}
+
+	return Record{Failures: row.Failures, LastFailureAt: row.LastFailureAt}, nil
+}
+
+// Counted in one statement so concurrent failures on other instances aren't lost.
+func (s *DatabaseStore) Fail(key string, now time.Time, forgetBefore time.Time) (Record, error) {
+
+	var record Record
+
+	err := s.connection.Raw(`INSERT INTO login_throttles ("key", failures, last_failure_at) VALUES (?, 1, ?)
+		ON CONFLICT ("key") DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures, last_failure_at`, key, now, forgetBefore).Row().Scan(&record.Failures, &record.LastFailureAt)
+
+	return record, err
+}
+
+func (s *DatabaseStore) Reset(key string) error {
+	return s.connection.Where(`"key" = ?`, key).Delete(&models.LoginThrottle{}).Error
+}
+
+func (s *DatabaseStore) Cleanup(before time.Time) error {
+	return s.connection.Where("last_failure_at < ?", before).Delete(&models.LoginThrottle{}).Error
+}
@@ -0,0 +1,67 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Keeps failed attempts in this process, for a single server instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+func (s *MemoryStore) Get(key string) (Record, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.records[key], nil
+}
+
+func (s *MemoryStore) Fail(key string, now time.Time, forgetBefore time.Time) (Record, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.records[key]
+
+	if record.LastFailureAt.Before(forgetBefore) {
+		record.Failures = 0
+	}
+
+	record.Failures++
+	record.LastFailureAt = now
+
+	s.records[key] = record
+
+	return record, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+func (s *MemoryStore) Cleanup(before time.Time) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, record := range s.records {
+		if record.LastFailureAt.Before(before) {
+			delete(s.records, key)
+		}
+	}
+
+	return nil
+}
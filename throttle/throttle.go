@@ -0,0 +1,287 @@
+package throttle
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Stores failed attempts can be kept in, chosen with LOGIN_THROTTLE_STORE.
+const (
+	StoreDatabase = "database"
+	StoreMemory   = "memory"
+)
+
+// The failed attempts of a key.
+type Record struct {
+	Failures      uint
+	LastFailureAt time.Time
+}
+
+// Keeps failed attempts per key, the database store shares them between server instances.
+type Store interface {
+	// The record of a key, a zero record when it has none.
+	Get(key string) (Record, error)
+	// Adds a failure at now and returns the updated record, failures before forgetBefore are forgotten first.
+	Fail(key string, now time.Time, forgetBefore time.Time) (Record, error)
+	// Forgets the failures of a key.
+	Reset(key string) error
+	// Removes every record whose last failure was before the given time.
+	Cleanup(before time.Time) error
+}
+
+// How many failures a kind of key allows and how long it is locked after that.
+// Every failure past the allowed ones doubles the delay up to MaxDelay, failures are forgotten after ResetAfter without one.
+type Policy struct {
+	Failures   uint // Zero disables the policy.
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	ResetAfter time.Duration
+}
+
+// When a key with this record can be tried again, the zero time when it isn't locked.
+func (p Policy) LockedUntil(r Record, now time.Time) time.Time {
+
+	if p.Failures == 0 || r.Failures < p.Failures || r.LastFailureAt.Before(now.Add(-p.ResetAfter)) {
+		return time.Time{}
+	}
+
+	delay := p.BaseDelay
+
+	for i := p.Failures; i < r.Failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return r.LastFailureAt.Add(delay)
+}
+
+// The keys a login attempt is counted against.
+type Attempt struct {
+	Account string
+	Ip      string
+}
+
+// Throttles logins per account and per IP address.
+type Throttler struct {
+	Store   Store
+	Account Policy
+	Ip      Policy
+}
+
+// The key of a tenant user's account, tenants are throttled separately.
+func AccountKey(tenantId uint, email string) string {
+	return fmt.Sprintf("tenant:%d:%s", tenantId, normalizeEmail(email))
+}
+
+// The key of a master user's account.
+func MasterAccountKey(email string) string {
+	return "master:" + normalizeEmail(email)
+}
+
+// The key of an IP address, shared by tenant and master logins.
+func IpKey(ip string) string {
+	return "ip:" + ip
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+var (
+	mu      sync.Mutex
+	current *Throttler
+)
+
+// Creates a throttler with the policies configured in the environment.
+func New(store Store) *Throttler {
+
+	base := helpers.GetEnvDuration("LOGIN_THROTTLE_BASE_DELAY", 30*time.Second)
+	max := helpers.GetEnvDuration("LOGIN_THROTTLE_MAX_DELAY", time.Hour)
+	reset := helpers.GetEnvDuration("LOGIN_THROTTLE_RESET_AFTER", 24*time.Hour)
+
+	if max < base {
+		max = base
+	}
+
+	// Failures can't be forgotten while they still lock a key.
+	if reset < max {
+		reset = max
+	}
+
+	return &Throttler{
+		Store: store,
+		Account: Policy{
+			Failures:   uint(helpers.GetEnvInt("LOGIN_THROTTLE_ACCOUNT_FAILURES", 5)),
+			BaseDelay:  base,
+			MaxDelay:   max,
+			ResetAfter: reset,
+		},
+		Ip: Policy{
+			Failures:   uint(helpers.GetEnvInt("LOGIN_THROTTLE_IP_FAILURES", 20)),
+			BaseDelay:  base,
+			MaxDelay:   max,
+			ResetAfter: reset,
+		},
+	}
+}
+
+// Sets up the throttler with the store configured in the environment, connection is the master database.
+func Setup(connection *gorm.DB) {
+
+	store := strings.ToLower(strings.TrimSpace(os.Getenv("LOGIN_THROTTLE_STORE")))
+
+	var throttler *Throttler
+
+	switch store {
+	case StoreMemory:
+		throttler = New(NewMemoryStore())
+	case "", StoreDatabase:
+		throttler = New(NewDatabaseStore(connection))
+	default:
+		fmt.Println("Unknown LOGIN_THROTTLE_STORE", store, "failed logins are kept in the database")
+		throttler = New(NewDatabaseStore(connection))
+	}
+
+	mu.Lock()
+	current = throttler
+	mu.Unlock()
+}
+
+// The throttler set up on start, one keeping failures in memory when none was.
+func Default() *Throttler {
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current == nil {
+		current = New(NewMemoryStore())
+	}
+
+	return current
+}
+
+// How long until the attempt may be made, zero when neither its account nor its IP address is locked.
+func (t *Throttler) Check(attempt Attempt) (time.Duration, error) {
+
+	now := time.Now().UTC()
+
+	var until time.Time
+
+	for _, check := range t.checks(attempt) {
+
+		record, err := t.Store.Get(check.key)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if locked := check.policy.LockedUntil(record, now); locked.After(until) {
+			until = locked
+		}
+	}
+
+	if until.After(now) {
+		return until.Sub(now), nil
+	}
+
+	return 0, nil
+}
+
+// Counts a failed attempt against its account and IP address, returns how long until another attempt may be made.
+func (t *Throttler) Failed(attempt Attempt) (time.Duration, error) {
+
+	now := time.Now().UTC()
+
+	var until time.Time
+
+	for _, check := range t.checks(attempt) {
+
+		record, err := t.Store.Fail(check.key, now, now.Add(-check.policy.ResetAfter))
+
+		if err != nil {
+			return 0, err
+		}
+
+		if locked := check.policy.LockedUntil(record, now); locked.After(until) {
+			until = locked
+		}
+	}
+
+	if until.After(now) {
+		return until.Sub(now), nil
+	}
+
+	return 0, nil
+}
+
+// Forgets the failures of the attempt's account, its IP address keeps them so one known password can't clear it.
+func (t *Throttler) Succeeded(attempt Attempt) error {
+
+	if attempt.Account == "" {
+		return nil
+	}
+
+	return t.Store.Reset(attempt.Account)
+}
+
+// Forgets the failures of a key, unlocking it.
+func (t *Throttler) Unlock(key string) error {
+	return t.Store.Reset(key)
+}
+
+// Removes the records which no longer lock anything every interval until quit is closed.
+func (t *Throttler) PeriodicCleanup(interval time.Duration, quit <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			if err := t.Store.Cleanup(time.Now().UTC().Add(-t.resetAfter())); err != nil {
+				fmt.Println("An error occurred while cleaning up the login throttle", err)
+			}
+		}
+	}
+}
+
+func (t *Throttler) resetAfter() time.Duration {
+
+	if t.Ip.ResetAfter > t.Account.ResetAfter {
+		return t.Ip.ResetAfter
+	}
+
+	return t.Account.ResetAfter
+}
+
+type check struct {
+	key    string
+	policy Policy
+}
+
+func (t *Throttler) checks(attempt Attempt) []check {
+
+	var checks []check
+
+	if attempt.Account != "" {
+		checks = append(checks, check{attempt.Account, t.Account})
+	}
+
+	if attempt.Ip != "" {
+		checks = append(checks, check{attempt.Ip, t.Ip})
+	}
+
+	return checks
+}
@@ -0,0 +1,41 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyLockedUntil(t *testing.T) {
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	policy := Policy{Failures: 3, BaseDelay: 30 * time.Second, MaxDelay: 4 * time.Minute, ResetAfter: time.Hour}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		record Record
+		until  time.Time
+	}{
+		{"no failures", policy, Record{}, time.Time{}},
+		{"below the allowed failures", policy, Record{Failures: 2, LastFailureAt: now}, time.Time{}},
+		{"at the allowed failures", policy, Record{Failures: 3, LastFailureAt: now}, now.Add(30 * time.Second)},
+		{"one more failure doubles the delay", policy, Record{Failures: 4, LastFailureAt: now}, now.Add(time.Minute)},
+		{"two more failures double it again", policy, Record{Failures: 5, LastFailureAt: now}, now.Add(2 * time.Minute)},
+		{"the delay stops at the maximum", policy, Record{Failures: 50, LastFailureAt: now}, now.Add(4 * time.Minute)},
+		{"a maximum between doublings", Policy{Failures: 1, BaseDelay: 30 * time.Second, MaxDelay: 45 * time.Second, ResetAfter: time.Hour}, Record{Failures: 2, LastFailureAt: now}, now.Add(45 * time.Second)},
+		{"counted from the last failure", policy, Record{Failures: 3, LastFailureAt: now.Add(-10 * time.Second)}, now.Add(20 * time.Second)},
+		{"already over", policy, Record{Failures: 3, LastFailureAt: now.Add(-time.Minute)}, now.Add(-30 * time.Second)},
+		{"failures forgotten", policy, Record{Failures: 50, LastFailureAt: now.Add(-2 * time.Hour)}, time.Time{}},
+		{"disabled", Policy{}, Record{Failures: 50, LastFailureAt: now}, time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			if until := test.policy.LockedUntil(test.record, now); !until.Equal(test.until) {
+				t.Fatalf("expected %v, got %v", test.until, until)
+			}
+		})
+	}
+}
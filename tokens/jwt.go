@@ -0,0 +1,144 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Token audiences, a token for one can never be used against the other.
+const (
+	AudienceMaster = "master"
+	AudienceTenant = "tenant"
+)
+
+// Token types.
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
+var (
+	ErrMalformedToken = errors.New("the token is malformed")
+	ErrUnknownKey     = errors.New("the token was signed with an unknown key")
+	ErrBadSignature   = errors.New("the token signature is invalid")
+	ErrExpiredToken   = errors.New("the token has expired")
+)
+
+// The claims carried by access and refresh tokens.
+type Claims struct {
+	Id               string   `json:"jti"`
+	Issuer           string   `json:"iss,omitempty"`
+	Audience         string   `json:"aud"`
+	Type             string   `json:"typ"`
+	UserId           uint     `json:"sub"`
+	SessionId        uint     `json:"sid,omitempty"` // The login the tokens belong to, revoking it stops them working.
+	TenantId         uint     `json:"tid,omitempty"`
+	TenantIdentifier string   `json:"tenant,omitempty"`
+	Role             int      `json:"role"`
+	Roles            []string `json:"roles,omitempty"`
+	IssuedAt         int64    `json:"iat"`
+	ExpiresAt        int64    `json:"exp"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyId     string `json:"kid"`
+}
+
+// Signs the claims with the active key using HS256.
+func (k *KeyRing) Sign(claims Claims) (string, error) {
+
+	kid, secret := k.signingKey()
+
+	encodedHeader, err := encodeSegment(header{Algorithm: "HS256", Type: "JWT", KeyId: kid})
+
+	if err != nil {
+		return "", err
+	}
+
+	encodedClaims, err := encodeSegment(claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := encodedHeader + "." + encodedClaims
+
+	return unsigned + "." + sign(unsigned, secret), nil
+}
+
+// Verifies the signature and expiry of a token and returns its claims.
+func (k *KeyRing) Parse(token string) (*Claims, error) {
+
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	// Only ever accept the algorithm we sign with.
+	if h.Algorithm != "HS256" {
+		return nil, ErrMalformedToken
+	}
+
+	secret, ok := k.verificationKey(h.KeyId)
+
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if !hmac.Equal([]byte(sign(parts[0]+"."+parts[1], secret)), []byte(parts[2])) {
+		return nil, ErrBadSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func sign(unsigned string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func encodeSegment(value interface{}) (string, error) {
+
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func decodeSegment(segment string, value interface{}) error {
+
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(decoded, value)
+}
@@ -0,0 +1,97 @@
+package tokens
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Signing keys by key id. Tokens are signed with the active key and verified with whichever key
+// their kid header names, so a key can be rotated by adding a new one, making it active and
+// removing the old one once the tokens it signed have expired.
+type KeyRing struct {
+	keys   map[string][]byte
+	active string
+}
+
+// Creates a key ring, the active key must be one of the keys.
+func NewKeyRing(keys map[string][]byte, active string) (*KeyRing, error) {
+
+	if _, ok := keys[active]; !ok {
+		return nil, errors.Errorf("the active signing key %q is not configured", active)
+	}
+
+	for kid, secret := range keys {
+		if len(secret) < 32 {
+			return nil, errors.Errorf("the signing key %q must be at least 32 bytes", kid)
+		}
+	}
+
+	return &KeyRing{keys: keys, active: active}, nil
+}
+
+// Loads the keys from JWT_KEYS ("kid:secret,kid:secret") and the active key id from JWT_ACTIVE_KID,
+// which defaults to the first key.
+func KeyRingFromEnv() (*KeyRing, error) {
+
+	keys := make(map[string][]byte)
+	first := ""
+
+	for _, entry := range strings.Split(os.Getenv("JWT_KEYS"), ",") {
+
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, errors.New("JWT_KEYS entries must look like kid:secret")
+		}
+
+		keys[parts[0]] = []byte(parts[1])
+
+		if len(first) == 0 {
+			first = parts[0]
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("JWT_KEYS is not configured")
+	}
+
+	active := strings.TrimSpace(os.Getenv("JWT_ACTIVE_KID"))
+	if len(active) == 0 {
+		active = first
+	}
+
+	return NewKeyRing(keys, active)
+}
+
+func (k *KeyRing) signingKey() (string, []byte) {
+	return k.active, k.keys[k.active]
+}
+
+func (k *KeyRing) verificationKey(kid string) ([]byte, bool) {
+	secret, ok := k.keys[kid]
+	return secret, ok
+}
+
+var (
+	defaultKeys    *KeyRing
+	defaultKeysErr error
+	loadKeys       sync.Once
+)
+
+// The key ring configured through the environment, loaded on first use.
+func DefaultKeyRing() (*KeyRing, error) {
+
+	loadKeys.Do(func() {
+		defaultKeys, defaultKeysErr = KeyRingFromEnv()
+	})
+
+	return defaultKeys, defaultKeysErr
+}
@@ -0,0 +1,31 @@
+package tokens
+
+import (
+	"time"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+)
+
+// How long a login lasts, for cookie sessions and tokens alike. Zero never expires.
+type Timeouts struct {
+	Idle     time.Duration // Since the login was last used, every use renews it.
+	Absolute time.Duration // Since the login, however active it is.
+}
+
+// The platform timeouts, tenants can override them.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Idle:     helpers.GetEnvDuration("SESSION_IDLE_TIMEOUT", 2*time.Hour),
+		Absolute: helpers.GetEnvDuration("SESSION_ABSOLUTE_TIMEOUT", 720*time.Hour),
+	}
+}
+
+// Whether a login made at createdAt and last used at lastSeenAt has timed out by now.
+func (t Timeouts) Expired(createdAt time.Time, lastSeenAt time.Time, now time.Time) bool {
+
+	if t.Idle > 0 && now.Sub(lastSeenAt) > t.Idle {
+		return true
+	}
+
+	return t.Absolute > 0 && now.Sub(createdAt) > t.Absolute
+}
@@ -0,0 +1,133 @@
+package tokens
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	helpers "go-multitenancy-boilerplate/helpers"
+
+	"github.com/pkg/errors"
+)
+
+// Authentication modes set with AUTH_MODE.
+const (
+	ModeSession = "session" // gormstore sessions only, the default.
+	ModeJWT     = "jwt"     // Bearer tokens only.
+	ModeBoth    = "both"    // Login sets a session and returns tokens, either is accepted.
+)
+
+// Returned when a refresh is attempted with something other than a refresh token for the audience.
+var ErrNotRefreshToken = errors.New("the token is not a refresh token")
+
+// The tokens handed out on login and refresh.
+type Pair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int64  `json:"expiresIn"` // Seconds until the access token expires.
+	// The jti of the refresh token, kept with the login so every refresh token can only be exchanged once.
+	RefreshTokenId string `json:"-"`
+}
+
+func mode() string {
+
+	switch m := strings.TrimSpace(os.Getenv("AUTH_MODE")); m {
+	case ModeJWT, ModeBoth:
+		return m
+	}
+
+	return ModeSession
+}
+
+// Whether logins create gormstore sessions and the middlewares accept them.
+func SessionsEnabled() bool {
+	return mode() != ModeJWT
+}
+
+// Whether logins issue tokens and the middlewares accept Bearer tokens.
+func TokensEnabled() bool {
+	return mode() != ModeSession
+}
+
+// Issues an access and refresh token for the subject described by claims.
+func Issue(claims Claims) (*Pair, error) {
+
+	keys, err := DefaultKeyRing()
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	accessTTL := helpers.GetEnvDuration("JWT_ACCESS_TTL", 15*time.Minute)
+	refreshTTL := helpers.GetEnvDuration("JWT_REFRESH_TTL", 720*time.Hour)
+
+	claims.Issuer = os.Getenv("JWT_ISSUER")
+	claims.IssuedAt = now.Unix()
+
+	access := claims
+	access.Type = TypeAccess
+	access.ExpiresAt = now.Add(accessTTL).Unix()
+
+	if access.Id, err = helpers.GenerateToken(16); err != nil {
+		return nil, err
+	}
+
+	refresh := claims
+	refresh.Type = TypeRefresh
+	refresh.ExpiresAt = now.Add(refreshTTL).Unix()
+
+	if refresh.Id, err = helpers.GenerateToken(16); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := keys.Sign(access)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := keys.Sign(refresh)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pair{
+		AccessToken:    accessToken,
+		RefreshToken:   refreshToken,
+		TokenType:      "Bearer",
+		ExpiresIn:      int64(accessTTL.Seconds()),
+		RefreshTokenId: refresh.Id,
+	}, nil
+}
+
+// Verifies a token of the given type and audience.
+func Verify(token string, tokenType string, audience string) (*Claims, error) {
+
+	keys, err := DefaultKeyRing()
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := keys.Parse(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if issuer := os.Getenv("JWT_ISSUER"); len(issuer) > 0 && claims.Issuer != issuer {
+		return nil, ErrMalformedToken
+	}
+
+	if claims.Type != tokenType || claims.Audience != audience {
+		if tokenType == TypeRefresh {
+			return nil, ErrNotRefreshToken
+		}
+		return nil, ErrMalformedToken
+	}
+
+	return claims, nil
+}
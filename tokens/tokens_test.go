@@ -0,0 +1,267 @@
+package tokens
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	oldSecret = "an-old-secret-of-at-least-32-bytes"
+	newSecret = "a-new-secret-of-at-least-32-bytes!"
+)
+
+func TestMain(m *testing.M) {
+
+	os.Setenv("JWT_KEYS", "2026-09:"+oldSecret+", 2026-10:"+newSecret)
+	os.Setenv("JWT_ACTIVE_KID", "2026-10")
+	os.Setenv("JWT_ISSUER", "https://auth.example.com")
+
+	os.Exit(m.Run())
+}
+
+func testKeyRing(t *testing.T, keys map[string]string, active string) *KeyRing {
+
+	secrets := make(map[string][]byte)
+
+	for kid, secret := range keys {
+		secrets[kid] = []byte(secret)
+	}
+
+	ring, err := NewKeyRing(secrets, active)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ring
+}
+
+// Builds a token from raw segments, signed with the secret under HS256 whatever the header says.
+func forge(t *testing.T, h header, claims Claims, secret string) string {
+
+	encodedHeader, err := encodeSegment(h)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encodedClaims, err := encodeSegment(claims)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned := encodedHeader + "." + encodedClaims
+
+	return unsigned + "." + sign(unsigned, []byte(secret))
+}
+
+func TestIssueAndVerify(t *testing.T) {
+
+	pair, err := Issue(Claims{Audience: AudienceTenant, UserId: 4, SessionId: 9, TenantId: 2, TenantIdentifier: "acme", Roles: []string{"admin"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pair.TokenType != "Bearer" || pair.ExpiresIn != int64((15*time.Minute).Seconds()) {
+		t.Fatalf("unexpected pair %+v", pair)
+	}
+
+	access, err := Verify(pair.AccessToken, TypeAccess, AudienceTenant)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if access.UserId != 4 || access.SessionId != 9 || access.TenantId != 2 || access.TenantIdentifier != "acme" || len(access.Roles) != 1 {
+		t.Fatalf("expected the claims to survive, got %+v", access)
+	}
+
+	if access.Issuer != "https://auth.example.com" || access.ExpiresAt-access.IssuedAt != int64((15*time.Minute).Seconds()) {
+		t.Fatalf("expected the issuer and access lifetime to be set, got %+v", access)
+	}
+
+	refresh, err := Verify(pair.RefreshToken, TypeRefresh, AudienceTenant)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refresh.ExpiresAt-refresh.IssuedAt != int64((720*time.Hour).Seconds()) || len(refresh.Id) == 0 || refresh.Id == access.Id {
+		t.Fatalf("expected a long lived refresh token with its own id, got %+v", refresh)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+		audience  string
+		err       error
+	}{
+		{"access token used to refresh", pair.AccessToken, TypeRefresh, AudienceTenant, ErrNotRefreshToken},
+		{"refresh token used for access", pair.RefreshToken, TypeAccess, AudienceTenant, ErrMalformedToken},
+		{"tenant token used for the master plane", pair.AccessToken, TypeAccess, AudienceMaster, ErrMalformedToken},
+		{"tenant refresh token used for the master plane", pair.RefreshToken, TypeRefresh, AudienceMaster, ErrNotRefreshToken},
+		{"not a token", "not-a-token", TypeAccess, AudienceTenant, ErrMalformedToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Verify(test.token, test.tokenType, test.audience); err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksIssuer(t *testing.T) {
+
+	ring := testKeyRing(t, map[string]string{"2026-10": newSecret}, "2026-10")
+
+	token, err := ring.Sign(Claims{Issuer: "https://elsewhere.example.com", Audience: AudienceTenant, Type: TypeAccess, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(token, TypeAccess, AudienceTenant); err != ErrMalformedToken {
+		t.Fatalf("expected a token from another issuer to be rejected, got %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+
+	before := testKeyRing(t, map[string]string{"2026-09": oldSecret}, "2026-09")
+	during := testKeyRing(t, map[string]string{"2026-09": oldSecret, "2026-10": newSecret}, "2026-10")
+	after := testKeyRing(t, map[string]string{"2026-10": newSecret}, "2026-10")
+
+	claims := Claims{Audience: AudienceTenant, Type: TypeAccess, ExpiresAt: time.Now().Add(time.Minute).Unix()}
+
+	oldToken, err := before.Sign(claims)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken, err := during.Sign(claims)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		ring  *KeyRing
+		token string
+		err   error
+	}{
+		{"old token while both keys are configured", during, oldToken, nil},
+		{"new token while both keys are configured", during, newToken, nil},
+		{"new token once the old key is removed", after, newToken, nil},
+		{"old token once the old key is removed", after, oldToken, ErrUnknownKey},
+		{"new token before the new key is added", before, newToken, ErrUnknownKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.ring.Parse(test.token); err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+
+	// Tokens name the key they were signed with.
+	var h header
+
+	if err := decodeSegment(strings.Split(newToken, ".")[0], &h); err != nil || h.KeyId != "2026-10" {
+		t.Fatalf("expected the token to be signed with the active key, got %+v %v", h, err)
+	}
+}
+
+func TestNewKeyRing(t *testing.T) {
+
+	if _, err := NewKeyRing(map[string][]byte{"a": []byte(newSecret)}, "b"); err == nil {
+		t.Fatal("expected an active key which isn't configured to be rejected")
+	}
+
+	if _, err := NewKeyRing(map[string][]byte{"a": []byte(newSecret), "b": []byte("too short")}, "a"); err == nil {
+		t.Fatal("expected a short key to be rejected")
+	}
+
+	ring, err := KeyRingFromEnv()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kid, secret := ring.signingKey(); kid != "2026-10" || string(secret) != newSecret {
+		t.Fatalf("expected the active key from JWT_ACTIVE_KID, got %s", kid)
+	}
+
+	if secret, ok := ring.verificationKey("2026-09"); !ok || string(secret) != oldSecret {
+		t.Fatal("expected every key in JWT_KEYS to be loaded")
+	}
+}
+
+func TestParseRejectsForgedTokens(t *testing.T) {
+
+	ring := testKeyRing(t, map[string]string{"2026-10": newSecret}, "2026-10")
+
+	valid := Claims{Audience: AudienceTenant, Type: TypeAccess, UserId: 4, ExpiresAt: time.Now().Add(time.Minute).Unix()}
+	expired := valid
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+
+	token, err := ring.Sign(valid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+
+	// The same claims claiming to be somebody else, under the original signature.
+	escalated := valid
+	escalated.UserId = 1
+	escalatedClaims, _ := encodeSegment(escalated)
+
+	unsignedNone, _ := encodeSegment(header{Algorithm: "none", Type: "JWT", KeyId: "2026-10"})
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", token, nil},
+		{"expired", forge(t, header{Algorithm: "HS256", KeyId: "2026-10"}, expired, newSecret), ErrExpiredToken},
+		{"alg none without a signature", unsignedNone + "." + parts[1] + ".", ErrMalformedToken},
+		{"alg none with the original signature", unsignedNone + "." + parts[1] + "." + parts[2], ErrMalformedToken},
+		{"another HMAC algorithm", forge(t, header{Algorithm: "HS512", KeyId: "2026-10"}, valid, newSecret), ErrMalformedToken},
+		{"an asymmetric algorithm", forge(t, header{Algorithm: "RS256", KeyId: "2026-10"}, valid, newSecret), ErrMalformedToken},
+		{"lower case algorithm", forge(t, header{Algorithm: "hs256", KeyId: "2026-10"}, valid, newSecret), ErrMalformedToken},
+		{"signed with another secret", forge(t, header{Algorithm: "HS256", KeyId: "2026-10"}, valid, oldSecret), ErrBadSignature},
+		{"unknown key id", forge(t, header{Algorithm: "HS256", KeyId: "2026-09"}, valid, newSecret), ErrUnknownKey},
+		{"missing key id", forge(t, header{Algorithm: "HS256"}, valid, newSecret), ErrUnknownKey},
+		{"changed claims", parts[0] + "." + escalatedClaims + "." + parts[2], ErrBadSignature},
+		{"missing signature", parts[0] + "." + parts[1], ErrMalformedToken},
+		{"extra segment", token + ".", ErrMalformedToken},
+		{"header is not base64", "%%%." + parts[1] + "." + parts[2], ErrMalformedToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			claims, err := ring.Parse(test.token)
+
+			if err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+
+			if err == nil && claims.UserId != 4 {
+				t.Fatalf("expected the signed claims, got %+v", claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The parameters every common authenticator app supports, RFC 6238 defaults.
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	// Codes from one step either side are accepted to allow for clock drift.
+	skew = 1
+)
+
+var ErrMalformedSecret = errors.New("the two-factor secret is malformed")
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generates a random 160 bit secret, base32 encoded as authenticator apps expect.
+func GenerateSecret() (string, error) {
+
+	buffer := make([]byte, 20)
+
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(buffer), nil
+}
+
+// Builds the otpauth:// URI authenticator apps read from a QR code.
+func URI(issuer string, account string, secret string) string {
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	label := url.PathEscape(issuer + ":" + account)
+
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// The time step a moment falls into.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Computes the code of a time step.
+func Code(secret string, step int64) (string, error) {
+
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+
+	if err != nil {
+		return "", ErrMalformedSecret
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1000000), nil
+}
+
+// Checks a code at the given time, returning the step it matched.
+// Steps up to lastStep are refused so a code can't be used twice.
+func Validate(secret string, code string, t time.Time, lastStep int64) (int64, bool) {
+
+	code = strings.Replace(strings.TrimSpace(code), " ", "", -1)
+
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+
+	for step := current - skew; step <= current+skew; step++ {
+
+		if step <= lastStep {
+			continue
+		}
+
+		expected, err := Code(secret, step)
+
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// Generates single-use recovery codes, formatted as two groups of five characters.
+func GenerateRecoveryCodes(count int) ([]string, error) {
+
+	codes := make([]string, 0, count)
+
+	for i := 0; i < count; i++ {
+
+		buffer := make([]byte, 7)
+
+		if _, err := rand.Read(buffer); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(buffer))[:10]
+
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	return codes, nil
+}
+
+// Normalises a recovery code as typed by a user before it is hashed, the separator is optional.
+func NormalizeRecoveryCode(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
@@ -0,0 +1,64 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+
+	// The RFC 6238 test secret, "12345678901234567890" base32 encoded.
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	now := time.Unix(59, 0)
+	current := Step(now)
+
+	code := func(step int64) string {
+
+		code, err := Code(secret, step)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		step     int64
+		valid    bool
+	}{
+		{"rfc 6238 vector", secret, "287082", 0, current, true},
+		{"current step", secret, code(current), 0, current, true},
+		{"with spaces", secret, code(current)[:3] + " " + code(current)[3:], 0, current, true},
+		{"previous step", secret, code(current - 1), -1, current - 1, true},
+		{"next step", secret, code(current + 1), 0, current + 1, true},
+		{"two steps ago", secret, code(current - 2), -2, 0, false},
+		{"two steps ahead", secret, code(current + 2), 0, 0, false},
+		{"already used", secret, code(current), current, 0, false},
+		{"earlier than the last used", secret, code(current - 1), current, 0, false},
+		{"wrong code", secret, "000000", 0, 0, false},
+		{"too short", secret, code(current)[:5], 0, 0, false},
+		{"too long", secret, code(current) + "0", 0, 0, false},
+		{"malformed secret", "not base32!", "287082", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			step, ok := Validate(test.secret, test.code, now, test.lastStep)
+
+			if ok != test.valid {
+				t.Fatalf("expected valid to be %v, got %v", test.valid, ok)
+			}
+
+			if ok && step != test.step {
+				t.Fatalf("expected step %d, got %d", test.step, step)
+			}
+		})
+	}
+}